@@ -0,0 +1,335 @@
+package object_storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const accessStatsPageSize = 1000
+
+// AccessStats are the read statistics of an object
+type AccessStats struct {
+	Path     string    `json:"path"`
+	Reads    int64     `json:"reads"`
+	LastRead time.Time `json:"lastRead"`
+}
+
+// IAccessStore keeps the read statistics recorded by AccessTrackingBackend
+type IAccessStore interface {
+	// RecordRead counts a read of path at the given time
+	RecordRead(ctx context.Context, path string, at time.Time) *ae.AppError
+	// Forget drops the statistics of path, forgetting a path never read is not an error
+	Forget(ctx context.Context, path string) *ae.AppError
+	// AccessStats returns the statistics of path, with zero Reads when it was never read
+	AccessStats(ctx context.Context, path string) (AccessStats, *ae.AppError)
+	// ListAccessStats returns the statistics of every object read under prefix, with paths relative to prefix
+	// like ListObjects
+	ListAccessStats(ctx context.Context, prefix string) ([]AccessStats, *ae.AppError)
+}
+
+// MemoryAccessStore is an IAccessStore keeping statistics in memory, Save and Load carry them over restarts
+type MemoryAccessStore struct {
+	mu    sync.Mutex
+	stats map[string]AccessStats
+}
+
+// NewMemoryAccessStore creates a new instance of MemoryAccessStore
+func NewMemoryAccessStore() *MemoryAccessStore {
+	return &MemoryAccessStore{stats: map[string]AccessStats{}}
+}
+
+// RecordRead counts a read of path
+func (s *MemoryAccessStore) RecordRead(_ context.Context, path string, at time.Time) *ae.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats[path]
+	stats.Path = path
+	stats.Reads++
+	if at.After(stats.LastRead) {
+		stats.LastRead = at
+	}
+	s.stats[path] = stats
+	return nil
+}
+
+// Forget drops the statistics of path
+func (s *MemoryAccessStore) Forget(_ context.Context, path string) *ae.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.stats, path)
+	return nil
+}
+
+// AccessStats returns the statistics of path
+func (s *MemoryAccessStore) AccessStats(_ context.Context, path string) (AccessStats, *ae.AppError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats, ok := s.stats[path]
+	if !ok {
+		stats.Path = path
+	}
+	return stats, nil
+}
+
+// ListAccessStats returns the statistics of every object read under prefix, ordered by path
+func (s *MemoryAccessStore) ListAccessStats(_ context.Context, prefix string) ([]AccessStats, *ae.AppError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []AccessStats
+	for path, stats := range s.stats {
+		if strings.HasPrefix(path, prefix) {
+			stats.Path = removePrefixFromObjectPath(prefix, path)
+			list = append(list, stats)
+		}
+	}
+	slices.SortFunc(list, func(x, y AccessStats) int { return cmp.Compare(x.Path, y.Path) })
+	return list, nil
+}
+
+// Save writes the statistics to w as JSON
+func (s *MemoryAccessStore) Save(w io.Writer) error {
+	list, _ := s.ListAccessStats(context.Background(), "")
+	return json.NewEncoder(w).Encode(list)
+}
+
+// Load merges statistics written by Save, keeping the higher count and later read of a path known to both
+func (s *MemoryAccessStore) Load(r io.Reader) error {
+	var list []AccessStats
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, loaded := range list {
+		stats := s.stats[loaded.Path]
+		stats.Path = loaded.Path
+		stats.Reads = max(stats.Reads, loaded.Reads)
+		if loaded.LastRead.After(stats.LastRead) {
+			stats.LastRead = loaded.LastRead
+		}
+		s.stats[loaded.Path] = stats
+	}
+	return nil
+}
+
+// ObjectAccessStore is an IAccessStore keeping the statistics of every object in a small JSON sidecar object under
+// Prefix of a backend, so they are shared by every process. Each recorded read costs a read and a write of the
+// sidecar, and concurrent reads of the same object from several processes may lose counts.
+type ObjectAccessStore struct {
+	Backend IStorageBackend
+	Prefix  string
+
+	root *SubBackend
+}
+
+// NewObjectAccessStore creates a new instance of ObjectAccessStore storing sidecars under prefix, which must not
+// be empty and should lie outside the prefixes of tracked objects
+func NewObjectAccessStore(backend IStorageBackend, prefix string) (*ObjectAccessStore, *ae.AppError) {
+	root, appErr := NewSubBackend(backend, prefix)
+	if appErr != nil {
+		return nil, appErr.AddErrCode(AccessStoreUpdate.Code)
+	}
+	return &ObjectAccessStore{
+		Backend: backend,
+		Prefix:  root.Prefix,
+		root:    root,
+	}, nil
+}
+
+// RecordRead counts a read of path in its sidecar
+func (s *ObjectAccessStore) RecordRead(ctx context.Context, path string, at time.Time) *ae.AppError {
+	stats, appErr := s.AccessStats(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	stats.Reads++
+	if at.After(stats.LastRead) {
+		stats.LastRead = at
+	}
+	content, err := json.Marshal(stats)
+	if err != nil {
+		return ae.GetAppErr(ctx, err, AccessStoreUpdate, http.StatusInternalServerError)
+	}
+	if appErr := s.root.PutObject(ctx, path, content, WithContentType("application/json")); appErr != nil {
+		return appErr.AddErrCode(AccessStoreUpdate.Code)
+	}
+	return nil
+}
+
+// Forget deletes the sidecar of path
+func (s *ObjectAccessStore) Forget(ctx context.Context, path string) *ae.AppError {
+	if appErr := s.root.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(AccessStoreUpdate.Code)
+	}
+	return nil
+}
+
+// AccessStats reads the sidecar of path
+func (s *ObjectAccessStore) AccessStats(ctx context.Context, path string) (AccessStats, *ae.AppError) {
+	stats := AccessStats{Path: path}
+	object, appErr := s.root.GetObject(ctx, path)
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return stats, nil
+		}
+		return stats, appErr.AddErrCode(AccessStoreUpdate.Code)
+	}
+	if err := json.Unmarshal(object.Content, &stats); err != nil {
+		return stats, ae.GetAppErr(ctx, errors.Wrapf(err, "invalid access stats of %s", path), AccessStoreUpdate, http.StatusInternalServerError)
+	}
+	stats.Path = path
+	return stats, nil
+}
+
+// ListAccessStats reads the sidecars under prefix, one request per sidecar
+func (s *ObjectAccessStore) ListAccessStats(ctx context.Context, prefix string) ([]AccessStats, *ae.AppError) {
+	var list []AccessStats
+	cursor := ""
+	for {
+		page, appErr := s.root.ListObjects(ctx, prefix, WithMaxKeys(accessStatsPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return list, appErr.AddErrCode(AccessStoreUpdate.Code)
+		}
+		for _, sidecar := range page.Objects {
+			stats, appErr := s.AccessStats(ctx, objectKey(prefix, sidecar.Path))
+			if appErr != nil {
+				return list, appErr
+			}
+			stats.Path = sidecar.Path
+			list = append(list, stats)
+		}
+		if !page.Truncated {
+			return list, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// AccessTrackingBackend is an IStorageBackend decorator recording every successful GetObject, ranged reads
+// included, in an IAccessStore, e.g. to find objects worth moving to a colder storage class. Recording happens
+// before GetObject returns and a failure to record does not fail the read. Deleting an object drops its statistics.
+type AccessTrackingBackend struct {
+	Backend IStorageBackend
+	Store   IAccessStore
+	// OnStoreError, when set, is called when the store failed to record a read or forget a deleted object
+	OnStoreError func(ctx context.Context, path string, appErr *ae.AppError)
+}
+
+// NewAccessTrackingBackend creates a new instance of AccessTrackingBackend recording reads in store
+func NewAccessTrackingBackend(backend IStorageBackend, store IAccessStore) *AccessTrackingBackend {
+	return &AccessTrackingBackend{
+		Backend: backend,
+		Store:   store,
+	}
+}
+
+// Unwrap returns the tracked backend
+func (b *AccessTrackingBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations the tracker does not count run on the wrapped backend
+func (b *AccessTrackingBackend) transparent() {}
+
+// Describe reports the kind of store
+func (b *AccessTrackingBackend) Describe() map[string]string {
+	return map[string]string{
+		"store": fmt.Sprintf("%T", b.Store),
+	}
+}
+
+// NotReadSince returns the objects under prefix not read since the given time, e.g. time.Now().AddDate(0, 0, -30),
+// with paths relative to prefix. Objects never read count from their last modification, so a fresh object is not
+// reported before it had the chance to be read.
+func (b *AccessTrackingBackend) NotReadSince(ctx context.Context, prefix string, since time.Time) ([]AccessStats, *ae.AppError) {
+	list, appErr := b.Store.ListAccessStats(ctx, prefix)
+	if appErr != nil {
+		return nil, appErr
+	}
+	byPath := make(map[string]AccessStats, len(list))
+	for _, stats := range list {
+		byPath[stats.Path] = stats
+	}
+
+	var idle []AccessStats
+	cursor := ""
+	for {
+		page, appErr := b.Backend.ListObjects(ctx, prefix, WithMaxKeys(accessStatsPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return idle, appErr
+		}
+		for _, object := range page.Objects {
+			stats, ok := byPath[object.Path]
+			if !ok {
+				stats = AccessStats{Path: object.Path}
+			}
+			if stats.LastRead.Before(since) && object.LastModified.Before(since) {
+				idle = append(idle, stats)
+			}
+		}
+		if !page.Truncated {
+			return idle, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// GetObject retrieves an object and records the read
+func (b *AccessTrackingBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	if appErr == nil {
+		b.storeErr(ctx, path, b.Store.RecordRead(ctx, path, time.Now()))
+	}
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *AccessTrackingBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *AccessTrackingBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object, writes do not count as reads
+func (b *AccessTrackingBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object and its statistics
+func (b *AccessTrackingBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.Backend.DeleteObject(ctx, path); appErr != nil {
+		return appErr
+	}
+	b.storeErr(ctx, path, b.Store.Forget(ctx, path))
+	return nil
+}
+
+// CopyObject copies an object, the copy starts without statistics
+func (b *AccessTrackingBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.Backend.CopyObject(ctx, srcPath, dstPath); appErr != nil {
+		return appErr
+	}
+	b.storeErr(ctx, dstPath, b.Store.Forget(ctx, dstPath))
+	return nil
+}
+
+// storeErr passes a store failure to OnStoreError
+func (b *AccessTrackingBackend) storeErr(ctx context.Context, path string, appErr *ae.AppError) {
+	if appErr != nil && b.OnStoreError != nil {
+		b.OnStoreError(ctx, path, appErr)
+	}
+}
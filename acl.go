@@ -0,0 +1,177 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// gcsPublicHost serves public GCS objects
+const gcsPublicHost = "https://storage.googleapis.com"
+
+// ACL is a canned access control list, named as on S3
+type ACL string
+
+// Canned ACLs supported by S3 and GCS
+const (
+	ACLPrivate                ACL = "private"
+	ACLPublicRead             ACL = "public-read"
+	ACLAuthenticatedRead      ACL = "authenticated-read"
+	ACLBucketOwnerRead        ACL = "bucket-owner-read"
+	ACLBucketOwnerFullControl ACL = "bucket-owner-full-control"
+)
+
+// gcsPredefinedACLs maps the canned ACLs to GCS predefined ACLs
+var gcsPredefinedACLs = map[ACL]string{
+	ACLPrivate:                "private",
+	ACLPublicRead:             "publicRead",
+	ACLAuthenticatedRead:      "authenticatedRead",
+	ACLBucketOwnerRead:        "bucketOwnerRead",
+	ACLBucketOwnerFullControl: "bucketOwnerFullControl",
+}
+
+// IObjectACLManager is implemented by backends able to set the ACL of an object and address it publicly
+type IObjectACLManager interface {
+	SetACL(ctx context.Context, path string, acl ACL) *ae.AppError
+	PublicURL(ctx context.Context, path string) (string, *ae.AppError)
+}
+
+// SetACL replaces the ACL of the object at path of backend with a canned ACL. Buckets enforcing bucket level
+// access, S3 buckets with ACLs disabled or GCS buckets with uniform bucket-level access, reject object ACLs with 409
+// Conflict; grant access with a bucket policy or IAM there instead. ACLs bypass decorators, so only backends
+// implementing IObjectACLManager, S3 and GCS, support them; others fail with 501 Not Implemented.
+func SetACL(ctx context.Context, backend IStorageBackend, path string, acl ACL) *ae.AppError {
+	manager, appErr := aclManager(ctx, backend)
+	if appErr != nil {
+		return appErr
+	}
+	return manager.SetACL(ctx, path, acl)
+}
+
+// PublicURL returns the unsigned URL the object at path of backend is served at, which only answers when the object
+// is publicly readable
+func PublicURL(ctx context.Context, backend IStorageBackend, path string) (string, *ae.AppError) {
+	manager, appErr := aclManager(ctx, backend)
+	if appErr != nil {
+		return "", appErr
+	}
+	return manager.PublicURL(ctx, path)
+}
+
+// MakePublic makes the object at path of backend readable by anyone, e.g. to publish a static asset, and returns
+// its public URL
+func MakePublic(ctx context.Context, backend IStorageBackend, path string) (string, *ae.AppError) {
+	manager, appErr := aclManager(ctx, backend)
+	if appErr != nil {
+		return "", appErr
+	}
+	if appErr := manager.SetACL(ctx, path, ACLPublicRead); appErr != nil {
+		return "", appErr
+	}
+	return manager.PublicURL(ctx, path)
+}
+
+// aclManager returns backend as an IObjectACLManager, failing with 501 when it is not one
+func aclManager(ctx context.Context, backend IStorageBackend) (IObjectACLManager, *ae.AppError) {
+	manager, ok := backend.(IObjectACLManager)
+	if !ok {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("object acls are not supported by %T", backend), ACLUnsupported, http.StatusNotImplemented)
+	}
+	return manager, nil
+}
+
+// validateACL checks that acl is one of the canned ACLs
+func validateACL(ctx context.Context, acl ACL) *ae.AppError {
+	if _, ok := gcsPredefinedACLs[acl]; !ok {
+		return ae.GetAppErr(ctx, fmt.Errorf("unknown acl %q", acl), ACLInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// SetACL replaces the ACL of an object in Amazon S3 bucket with a canned ACL
+func (b *S3Backend) SetACL(ctx context.Context, path string, acl ACL) *ae.AppError {
+	if appErr := validateACL(ctx, acl); appErr != nil {
+		return appErr
+	}
+	if b.Compat.NoObjectACL {
+		return ae.GetAppErr(ctx, fmt.Errorf("object acls are not supported by %s", b.Compat.Provider), ACLUnsupported, http.StatusNotImplemented)
+	}
+	_, err := b.Client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+		ACL:    aws.String(string(acl)),
+	})
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, ACLOperation, http.StatusInternalServerError)
+		switch {
+		case contains(err.Error(), "AccessControlListNotSupported"):
+			appErr = appErr.SetHTTPCode(http.StatusConflict)
+		case isS3NotFoundError(err):
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		case isS3NotImplementedError(err):
+			appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+		case isS3ThrottlingError(err):
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
+
+// PublicURL returns the unsigned URL of an object in Amazon S3 bucket, on the endpoint and in the addressing style
+// of the client
+func (b *S3Backend) PublicURL(ctx context.Context, path string) (string, *ae.AppError) {
+	req, _ := b.Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	})
+	if err := req.Build(); err != nil {
+		return "", ae.GetAppErr(ctx, err, ACLOperation, http.StatusInternalServerError)
+	}
+	objectURL := *req.HTTPRequest.URL
+	objectURL.RawQuery = ""
+	return objectURL.String(), nil
+}
+
+// SetACL replaces the ACL of an object in Google Cloud Storage bucket with the predefined ACL matching acl
+func (b GoogleCSBackend) SetACL(ctx context.Context, path string, acl ACL) *ae.AppError {
+	if appErr := validateACL(ctx, acl); appErr != nil {
+		return appErr
+	}
+	_, err := b.Client.Object(objectKey(b.Prefix, path)).Update(ctx, storage.ObjectAttrsToUpdate{
+		PredefinedACL: gcsPredefinedACLs[acl],
+	})
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, ACLOperation, http.StatusInternalServerError)
+		var apiErr *googleapi.Error
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+			strings.Contains(strings.ToLower(apiErr.Message), "uniform bucket-level access") {
+			appErr = appErr.SetHTTPCode(http.StatusConflict)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
+
+// PublicURL returns the unsigned URL of an object in Google Cloud Storage bucket on storage.googleapis.com
+func (b GoogleCSBackend) PublicURL(ctx context.Context, path string) (string, *ae.AppError) {
+	bucket, ok := b.Client.(interface{ BucketName() string })
+	if !ok {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("the gcs client does not report its bucket"), ACLUnsupported, http.StatusNotImplemented)
+	}
+	key := objectKey(b.Prefix, path)
+	return gcsPublicHost + "/" + url.PathEscape(bucket.BucketName()) + "/" + (&url.URL{Path: key}).EscapedPath(), nil
+}
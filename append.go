@@ -0,0 +1,291 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// gcsMaxComponents is the most components a composite GCS object may have
+const gcsMaxComponents = 1024
+
+// IAppender is implemented by backends able to append to an object without rewriting it from the client
+type IAppender interface {
+	AppendObject(ctx context.Context, path string, content []byte) *ae.AppError
+}
+
+// AppendObject appends content to the object at path of backend, creating it when missing, e.g. for log style
+// workloads. The attributes of the object are kept. Backends implementing IAppender append atomically: GCS composes
+// the object with the new content, S3 copies the object into a multipart upload with the new content as last part,
+// or rewrites it when smaller than a part; both fail with 409 Conflict when the object changes during the append,
+// so that the caller can retry. Other backends, and decorators, get the object read, extended and written back,
+// which loses appends racing with each other.
+func AppendObject(ctx context.Context, backend IStorageBackend, path string, content []byte) *ae.AppError {
+	if appender, ok := backend.(IAppender); ok {
+		return appender.AppendObject(ctx, path, content)
+	}
+	object, appErr := backend.GetObject(ctx, path)
+	if appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(AppendOperation.Code)
+	}
+	var opts []PutOption
+	if appErr == nil {
+		if opts, appErr = preservedPutOptions(ctx, backend, path, object, PreserveAll()); appErr != nil {
+			return appErr.AddErrCode(AppendOperation.Code)
+		}
+	}
+	return backend.PutObject(ctx, path, append(object.Content, content...), opts...)
+}
+
+// AppendObject appends content to an object in Amazon S3 bucket. Objects of at least 5 MiB are copied into a
+// multipart upload with content as last part, smaller objects are rewritten; either way the write is conditional
+// on the object being unchanged. Attributes and tags are kept.
+func (b *S3Backend) AppendObject(ctx context.Context, path string, content []byte) *ae.AppError {
+	current, appErr := b.StatObject(ctx, path)
+	if appErr != nil && appErr.GetHTTPCode() == http.StatusNotFound {
+		return b.putConditional(ctx, path, content, PutOptions{}, "If-None-Match", "*")
+	}
+	if appErr != nil {
+		return appErr.AddErrCode(AppendOperation.Code)
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	tags, appErr := b.GetObjectTags(ctx, path)
+	if appErr != nil && appErr.GetHTTPCode() != http.StatusNotImplemented {
+		return appErr.AddErrCode(AppendOperation.Code)
+	}
+	opts := attributePutOptions(current, tags, PreserveAll())
+	if current.Encryption.Type != "" {
+		opts = append(opts, WithEncryption(current.Encryption))
+	}
+	options := getPutOptions(opts)
+	etag := `"` + current.ETag + `"`
+	if current.Size < s3MinPartSize {
+		existing, appErr := b.GetObject(ctx, path)
+		if appErr != nil {
+			return appErr.AddErrCode(AppendOperation.Code)
+		}
+		return b.putConditional(ctx, path, append(existing.Content, content...), options, "If-Match", etag)
+	}
+
+	upload, appErr := b.uploadInput(ctx, path, nil, options)
+	if appErr != nil {
+		return appErr.AddErrCode(AppendOperation.Code)
+	}
+	created, err := b.Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+	})
+	if err != nil {
+		return s3AppendErr(ctx, err)
+	}
+	uploadID := aws.StringValue(created.UploadId)
+	if appErr := b.appendParts(ctx, upload.Key, uploadID, etag, content); appErr != nil {
+		_, _ = b.Client.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   upload.Bucket,
+			Key:      upload.Key,
+			UploadId: aws.String(uploadID),
+		})
+		return appErr
+	}
+	return nil
+}
+
+// appendParts completes a multipart upload to key from a copy of its current version, matching etag, and content
+func (b *S3Backend) appendParts(ctx context.Context, key *string, uploadID string, etag string, content []byte) *ae.AppError {
+	copied, err := b.Client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:            aws.String(b.Bucket),
+		Key:               key,
+		UploadId:          aws.String(uploadID),
+		PartNumber:        aws.Int64(1),
+		CopySource:        aws.String(url.PathEscape(b.Bucket + "/" + aws.StringValue(key))),
+		CopySourceIfMatch: aws.String(etag),
+	})
+	if err != nil {
+		return s3AppendErr(ctx, err)
+	}
+	req, appended := b.Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:        aws.String(b.Bucket),
+		Key:           key,
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(2),
+		Body:          bytes.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+	})
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return s3AppendErr(ctx, err)
+	}
+	_, err = b.Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(b.Bucket),
+		Key:      key,
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{
+			{PartNumber: aws.Int64(1), ETag: copied.CopyPartResult.ETag},
+			{PartNumber: aws.Int64(2), ETag: appended.ETag},
+		}},
+	}, request.WithSetRequestHeaders(map[string]string{"If-Match": etag}))
+	if err != nil {
+		return s3AppendErr(ctx, err)
+	}
+	return nil
+}
+
+// putConditional uploads content to path in a single request sent with a conditional header
+func (b *S3Backend) putConditional(ctx context.Context, path string, content []byte, options PutOptions, header, value string) *ae.AppError {
+	upload, appErr := b.uploadInput(ctx, path, nil, options)
+	if appErr != nil {
+		return appErr.AddErrCode(AppendOperation.Code)
+	}
+	req, _ := b.Client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		Body:                 bytes.NewReader(content),
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+	})
+	req.SetContext(ctx)
+	req.ApplyOptions(request.WithSetRequestHeaders(map[string]string{header: value}))
+	if err := req.Send(); err != nil {
+		return s3AppendErr(ctx, err)
+	}
+	return nil
+}
+
+// s3AppendErr maps an S3 error of an append, a failed condition is reported as 409
+func s3AppendErr(ctx context.Context, err error) *ae.AppError {
+	if isS3PreconditionError(err) {
+		return ae.GetAppErr(ctx, withSentinel(err, ErrPreconditionFailed), AppendConflict, http.StatusConflict)
+	}
+	appErr := ae.GetAppErr(ctx, err, AppendOperation, http.StatusInternalServerError)
+	if isS3NotFoundError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if isS3ThrottlingError(err) {
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// AppendObject appends content to an object in Google Cloud Storage bucket by composing it with an object holding
+// content, conditional on the object generation. Composite objects take at most 1024 components, an object near
+// the limit is rewritten whole instead, which makes it a single component again.
+func (b GoogleCSBackend) AppendObject(ctx context.Context, path string, content []byte) *ae.AppError {
+	object := b.Client.Object(objectKey(b.Prefix, path))
+	attrs, err := object.Attrs(ctx)
+	if err != nil && err.Error() == storage.ErrObjectNotExist.Error() {
+		return b.writeConditional(ctx, object.If(storage.Conditions{DoesNotExist: true}), attrs, content)
+	}
+	if err != nil {
+		return gcsAppendErr(ctx, err)
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	current := object.Generation(attrs.Generation)
+	if attrs.ComponentCount >= gcsMaxComponents-1 {
+		reader, err := current.NewReader(ctx)
+		if err != nil {
+			return gcsAppendErr(ctx, err)
+		}
+		existing, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return gcsAppendErr(ctx, err)
+		}
+		return b.writeConditional(ctx, object.If(storage.Conditions{GenerationMatch: attrs.Generation}), attrs, append(existing, content...))
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ae.GetAppErr(ctx, err, AppendOperation, http.StatusInternalServerError)
+	}
+	tail := b.Client.Object(objectKey(b.Prefix, gcsMultipartPrefix+"/append-"+hex.EncodeToString(id)))
+	if appErr := b.writeConditional(ctx, tail, nil, content); appErr != nil {
+		return appErr
+	}
+	// the tail is only needed for the compose
+	defer func() { _ = tail.Delete(context.WithoutCancel(ctx)) }()
+	composer := object.If(storage.Conditions{GenerationMatch: attrs.Generation}).ComposerFrom(current, tail)
+	composer.ContentType = attrs.ContentType
+	composer.CacheControl = attrs.CacheControl
+	composer.ContentEncoding = attrs.ContentEncoding
+	composer.ContentDisposition = attrs.ContentDisposition
+	composer.ContentLanguage = attrs.ContentLanguage
+	composer.StorageClass = attrs.StorageClass
+	composer.KMSKeyName = attrs.KMSKeyName
+	composer.Metadata = maps.Clone(attrs.Metadata)
+	if _, err := composer.Run(ctx); err != nil {
+		return gcsAppendErr(ctx, err)
+	}
+	return nil
+}
+
+// writeConditional writes content to object, with the attributes of attrs when set
+func (b GoogleCSBackend) writeConditional(ctx context.Context, object *storage.ObjectHandle, attrs *storage.ObjectAttrs, content []byte) *ae.AppError {
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := object.NewWriter(writeCtx)
+	if attrs != nil {
+		wc.ContentType = attrs.ContentType
+		wc.CacheControl = attrs.CacheControl
+		wc.ContentEncoding = attrs.ContentEncoding
+		wc.ContentDisposition = attrs.ContentDisposition
+		wc.ContentLanguage = attrs.ContentLanguage
+		wc.StorageClass = attrs.StorageClass
+		wc.KMSKeyName = attrs.KMSKeyName
+		wc.Metadata = maps.Clone(attrs.Metadata)
+	}
+	if _, err := wc.Write(content); err != nil {
+		cancel()
+		return gcsAppendErr(ctx, err)
+	}
+	if err := wc.Close(); err != nil {
+		return gcsAppendErr(ctx, err)
+	}
+	return nil
+}
+
+// gcsAppendErr maps a GCS error of an append, a failed precondition is reported as 409
+func gcsAppendErr(ctx context.Context, err error) *ae.AppError {
+	if gcsPreconditionFailed(err) {
+		return ae.GetAppErr(ctx, withSentinel(errors.Wrap(err, "object changed while appending"), ErrPreconditionFailed), AppendConflict, http.StatusConflict)
+	}
+	appErr := ae.GetAppErr(ctx, err, AppendOperation, http.StatusInternalServerError)
+	if err.Error() == storage.ErrObjectNotExist.Error() {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if retryAfter, ok := gcsRetryAfter(err); ok {
+		appErr = throttled(appErr, retryAfter)
+	}
+	return appErr
+}
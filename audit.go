@@ -0,0 +1,201 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	pathutil "path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// actorKey is the context key of the actor
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the identity of the user or service making the calls, recorded in audit
+// events
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx, empty when it carries none
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// AuditEvent records one mutation made through an AuditBackend
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	Operation string    `json:"operation"`
+	Path      string    `json:"path"`
+	// SourcePath is the source of a copy
+	SourcePath string `json:"sourcePath,omitempty"`
+	// Size is the size of the content written by a put
+	Size    int64 `json:"size,omitempty"`
+	Success bool  `json:"success"`
+	// HTTPStatus and ErrorCode describe the error of a failed mutation
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	ErrorCode  string `json:"errorCode,omitempty"`
+}
+
+// IAuditSink stores the audit events of an AuditBackend, it must be safe for concurrent use
+type IAuditSink interface {
+	WriteEvent(ctx context.Context, event AuditEvent) *ae.AppError
+}
+
+// AuditSinkFunc adapts a function to IAuditSink
+type AuditSinkFunc func(ctx context.Context, event AuditEvent) *ae.AppError
+
+// WriteEvent calls f(ctx, event)
+func (f AuditSinkFunc) WriteEvent(ctx context.Context, event AuditEvent) *ae.AppError {
+	return f(ctx, event)
+}
+
+// WriterAuditSink is an IAuditSink writing every event as a line of JSON, e.g. to an append-only log file
+type WriterAuditSink struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+// NewWriterAuditSink creates a new instance of WriterAuditSink writing to w
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{Writer: w}
+}
+
+// WriteEvent writes the event as a line of JSON
+func (s *WriterAuditSink) WriteEvent(ctx context.Context, event AuditEvent) *ae.AppError {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to encode audit event"), AuditWrite, http.StatusInternalServerError)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.Writer.Write(append(line, '\n')); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to write audit event"), AuditWrite, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// BackendAuditSink is an IAuditSink storing every event as its own JSON object under Prefix of a backend, named
+// after its time so that listings return the trail in order. Objects are never rewritten, so the trail stays
+// append-only, all the more on a bucket with object lock or a retention policy.
+type BackendAuditSink struct {
+	Backend IStorageBackend
+	Prefix  string
+
+	sequence atomic.Int64
+}
+
+// NewBackendAuditSink creates a new instance of BackendAuditSink storing events under prefix of backend
+func NewBackendAuditSink(backend IStorageBackend, prefix string) *BackendAuditSink {
+	return &BackendAuditSink{
+		Backend: backend,
+		Prefix:  prefix,
+	}
+}
+
+// WriteEvent stores the event as a new object
+func (s *BackendAuditSink) WriteEvent(ctx context.Context, event AuditEvent) *ae.AppError {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to encode audit event"), AuditWrite, http.StatusInternalServerError)
+	}
+	// the sequence tells apart the events of a process recorded at the same time
+	name := event.Time.UTC().Format(sortableTimeLayout) + "-" + strconv.FormatInt(s.sequence.Add(1), 10) + ".json"
+	if appErr := s.Backend.PutObject(ctx, pathutil.Join(s.Prefix, name), content, WithContentType("application/json")); appErr != nil {
+		return appErr.AddErrCode(AuditWrite.Code)
+	}
+	return nil
+}
+
+// AuditBackend is an IStorageBackend decorator recording every put, delete and copy, successful or not, with the
+// actor of the context, in an IAuditSink, for compliance audit trails. Reads are not recorded. When an event cannot
+// be recorded the call fails with AuditWrite, even though the mutation itself may have been made.
+type AuditBackend struct {
+	Backend IStorageBackend
+	Sink    IAuditSink
+}
+
+// NewAuditBackend creates a new instance of AuditBackend recording the mutations of backend in sink
+func NewAuditBackend(backend IStorageBackend, sink IAuditSink) *AuditBackend {
+	return &AuditBackend{
+		Backend: backend,
+		Sink:    sink,
+	}
+}
+
+// Unwrap returns the audited backend
+func (b *AuditBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the type of the sink
+func (b *AuditBackend) Describe() map[string]string {
+	return map[string]string{
+		"sink": fmt.Sprintf("%T", b.Sink),
+	}
+}
+
+// GetObject retrieves an object
+func (b *AuditBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *AuditBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *AuditBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object and records it
+func (b *AuditBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	appErr := b.Backend.PutObject(ctx, path, content, opts...)
+	return b.record(ctx, AuditEvent{Operation: "put", Path: path, Size: int64(len(content))}, appErr)
+}
+
+// DeleteObject removes an object and records it
+func (b *AuditBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	appErr := b.Backend.DeleteObject(ctx, path)
+	return b.record(ctx, AuditEvent{Operation: "delete", Path: path}, appErr)
+}
+
+// CopyObject copies an object and records it
+func (b *AuditBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	appErr := b.Backend.CopyObject(ctx, srcPath, dstPath)
+	return b.record(ctx, AuditEvent{Operation: "copy", Path: dstPath, SourcePath: srcPath}, appErr)
+}
+
+// record completes the event of a mutation with its outcome and writes it to the sink, returning the error of the
+// mutation or else of the sink
+func (b *AuditBackend) record(ctx context.Context, event AuditEvent, appErr *ae.AppError) *ae.AppError {
+	event.Time = time.Now()
+	event.Actor = ActorFromContext(ctx)
+	event.Success = appErr == nil
+	if appErr != nil {
+		event.HTTPStatus = appErr.GetHTTPCode()
+		event.ErrorCode = appErr.GetErrCode()
+	}
+	// the event is recorded even when the caller gave up on the mutation
+	sinkErr := b.Sink.WriteEvent(context.WithoutCancel(ctx), event)
+	if appErr != nil {
+		if sinkErr != nil {
+			return appErr.AddErrCode(AuditWrite.Code)
+		}
+		return appErr
+	}
+	return sinkErr
+}
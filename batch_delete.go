@@ -0,0 +1,176 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultDeleteConcurrency = 16
+	// deletePrefixPageSize is the number of objects DeletePrefix lists and deletes at a time
+	deletePrefixPageSize = 1000
+)
+
+// DeleteResult is the outcome of deleting one path of a batch, Err is nil when the object was deleted or missing
+type DeleteResult struct {
+	Path string
+	Err  *ae.AppError
+}
+
+// DeletePrefixReport counts the objects handled by DeletePrefix so far
+type DeletePrefixReport struct {
+	Listed  int
+	Deleted int
+	// Pinned objects are left in place
+	Pinned int
+	Failed int
+}
+
+// DeleteOptions holds the settings applied to a batch delete
+type DeleteOptions struct {
+	// Concurrency is the number of delete requests in flight
+	Concurrency int
+	// Progress, when set, is called by DeletePrefix after every page of objects
+	Progress func(DeletePrefixReport)
+}
+
+// DeleteOption configures a batch delete
+type DeleteOption func(*DeleteOptions)
+
+// WithDeleteConcurrency sets the number of delete requests of a batch in flight, 16 by default
+func WithDeleteConcurrency(concurrency int) DeleteOption {
+	return func(o *DeleteOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithDeleteProgress has DeletePrefix call progress with the counts so far after every page of objects, e.g. to
+// log the progress of a long cleanup
+func WithDeleteProgress(progress func(DeletePrefixReport)) DeleteOption {
+	return func(o *DeleteOptions) {
+		o.Progress = progress
+	}
+}
+
+// getDeleteOptions applies the given options over the defaults
+func getDeleteOptions(opts []DeleteOption) DeleteOptions {
+	options := DeleteOptions{Concurrency: defaultDeleteConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// IBatchDeleter is implemented by backends able to delete many objects in few requests
+type IBatchDeleter interface {
+	DeleteObjects(ctx context.Context, paths []string, opts ...DeleteOption) ([]DeleteResult, *ae.AppError)
+}
+
+// DeleteObjects deletes paths from backend and returns the result of every path, in order. Missing objects count as
+// deleted. Backends implementing IBatchDeleter delete them in batches, S3 up to 1000 keys per request; other
+// backends, GCS included, and decorators, so that they see every delete, get parallel DeleteObject calls. When a
+// path is not deleted, the error reports how many failed with the status of the first failure.
+func DeleteObjects(ctx context.Context, backend IStorageBackend, paths []string, opts ...DeleteOption) ([]DeleteResult, *ae.AppError) {
+	if deleter, ok := backend.(IBatchDeleter); ok {
+		return deleter.DeleteObjects(ctx, paths, opts...)
+	}
+	return deleteEach(ctx, backend, paths, getDeleteOptions(opts))
+}
+
+// DeletePrefix deletes every object at prefix of backend, listing them page by page and deleting each page with
+// DeleteObjects. Pinned objects are left in place and counted, as DeleteObject refuses them. Objects failing to
+// delete do not stop the cleanup: once every page is done the error counts them, while a listing failure stops it
+// at once. The report counts the objects handled up to then.
+func DeletePrefix(ctx context.Context, backend IStorageBackend, prefix string, opts ...DeleteOption) (DeletePrefixReport, *ae.AppError) {
+	var report DeletePrefixReport
+	options := getDeleteOptions(opts)
+	var firstErr *ae.AppError
+	cursor := ""
+	for {
+		page, appErr := backend.ListObjects(ctx, prefix, WithMaxKeys(deletePrefixPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return report, appErr.AddErrCode(DeletePrefixList.Code)
+		}
+		paths := make([]string, len(page.Objects))
+		for i, object := range page.Objects {
+			paths[i] = listedKey(prefix, object.Path)
+		}
+		report.Listed += len(paths)
+		results, _ := DeleteObjects(ctx, backend, paths, opts...)
+		for _, result := range results {
+			switch {
+			case result.Err == nil:
+				report.Deleted++
+			case result.Err.GetHTTPCode() == http.StatusLocked:
+				report.Pinned++
+			default:
+				report.Failed++
+				if firstErr == nil {
+					firstErr = result.Err
+				}
+			}
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if firstErr != nil {
+		err := fmt.Errorf("%d of %d objects at %s not deleted, first: %s", report.Failed, report.Listed, prefix, firstErr.Error())
+		return report, ae.GetAppErr(ctx, err, DeletePrefixIncomplete, firstErr.GetHTTPCode())
+	}
+	return report, nil
+}
+
+// deleteEach deletes paths with one DeleteObject call each, up to the concurrency of options at a time
+func deleteEach(ctx context.Context, backend IStorageBackend, paths []string, options DeleteOptions) ([]DeleteResult, *ae.AppError) {
+	results := make([]DeleteResult, len(paths))
+	slots := make(chan struct{}, options.Concurrency)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		results[i].Path = path
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ae.GetAppErr(ctx, ctx.Err(), BatchDeleteIncomplete, http.StatusRequestTimeout)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if appErr := backend.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+				results[i].Err = appErr
+			}
+		}()
+	}
+	wg.Wait()
+	return results, batchDeleteErr(ctx, results)
+}
+
+// batchDeleteErr summarises the failures of a batch delete, nil when every path was deleted
+func batchDeleteErr(ctx context.Context, results []DeleteResult) *ae.AppError {
+	var first *ae.AppError
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			if first == nil {
+				first = result.Err
+			}
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	err := fmt.Errorf("%d of %d objects not deleted, first: %s", failed, len(results), first.Error())
+	return ae.GetAppErr(ctx, err, BatchDeleteIncomplete, first.GetHTTPCode())
+}
@@ -0,0 +1,38 @@
+package object_storage
+
+import (
+	"context"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// GetResult is the outcome of downloading one path of a batch, Object holds the content when Err is nil
+type GetResult struct {
+	Path   string
+	Object Object
+	Err    *ae.AppError
+}
+
+// GetObjectsWithContent downloads paths from backend with parallel GetObject calls, e.g. the many small objects of
+// a page to render, and returns the result of every path, in order, unlike GetObjects which lists attributes only.
+// Every path is read even when some fail, unless WithFailFast is given, with the get options of WithBatchGetOptions.
+// When a path is not read, the error reports how many failed with the status of the first failure; missing objects fail with
+// 404 Not Found.
+func GetObjectsWithContent(ctx context.Context, backend IStorageBackend, paths []string, opts ...BatchOption) ([]GetResult, *ae.AppError) {
+	results := make([]GetResult, len(paths))
+	for i, path := range paths {
+		results[i].Path = path
+	}
+	options := getBatchOptions(opts)
+	errs, appErr := runBatch(ctx, len(paths), options, BatchGetIncomplete, BatchGetSkipped, func(ctx context.Context, i int) *ae.AppError {
+		object, appErr := backend.GetObject(ctx, paths[i], options.Get...)
+		if appErr == nil {
+			results[i].Object = object
+		}
+		return appErr
+	})
+	for i := range results {
+		results[i].Err = errs[i]
+	}
+	return results, appErr
+}
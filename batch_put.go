@@ -0,0 +1,158 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const defaultPutConcurrency = 16
+
+// PutItem is one object of a batch upload
+type PutItem struct {
+	Path    string
+	Content []byte
+	Options []PutOption
+}
+
+// PutResult is the outcome of uploading one item of a batch, Err is nil when the object was uploaded
+type PutResult struct {
+	Path string
+	Err  *ae.AppError
+}
+
+// BatchOptions holds the settings applied to a batch upload or download
+type BatchOptions struct {
+	// Concurrency is the number of requests in flight
+	Concurrency int
+	// FailFast stops the batch at the first failure, the items not started fail with BatchPutSkipped
+	FailFast bool
+	// Progress, when set, is called with the number of items done, succeeded or failed, after every item
+	Progress func(done, total int)
+	// Get are the options of every read of GetObjectsWithContent
+	Get []GetOption
+}
+
+// BatchOption configures a batch upload or download
+type BatchOption func(*BatchOptions)
+
+// WithBatchConcurrency sets the number of requests of a batch in flight, 16 by default
+func WithBatchConcurrency(concurrency int) BatchOption {
+	return func(o *BatchOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithFailFast stops the batch at the first failure, cancelling the requests in flight, instead of processing every
+// item
+func WithFailFast() BatchOption {
+	return func(o *BatchOptions) {
+		o.FailFast = true
+	}
+}
+
+// WithBatchProgress has PutObjects and GetObjectsWithContent call progress with the number of items done after every
+// item. Calls are never concurrent.
+func WithBatchProgress(progress func(done, total int)) BatchOption {
+	return func(o *BatchOptions) {
+		o.Progress = progress
+	}
+}
+
+// WithBatchGetOptions applies opts to every read of GetObjectsWithContent, e.g. WithDecryptionKey
+func WithBatchGetOptions(opts ...GetOption) BatchOption {
+	return func(o *BatchOptions) {
+		o.Get = opts
+	}
+}
+
+// getBatchOptions applies the given options over the defaults
+func getBatchOptions(opts []BatchOption) BatchOptions {
+	options := BatchOptions{Concurrency: defaultPutConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// PutObjects uploads items to backend with parallel PutObject calls, e.g. the files of a generated report, and
+// returns the result of every item, in order. Every item is uploaded even when some fail, unless WithFailFast is
+// given. When an item is not uploaded, the error reports how many failed with the status of the first failure.
+func PutObjects(ctx context.Context, backend IStorageBackend, items []PutItem, opts ...BatchOption) ([]PutResult, *ae.AppError) {
+	results := make([]PutResult, len(items))
+	for i, item := range items {
+		results[i].Path = item.Path
+	}
+	errs, appErr := runBatch(ctx, len(items), getBatchOptions(opts), BatchPutIncomplete, BatchPutSkipped, func(ctx context.Context, i int) *ae.AppError {
+		return backend.PutObject(ctx, items[i].Path, items[i].Content, items[i].Options...)
+	})
+	for i := range results {
+		results[i].Err = errs[i]
+	}
+	return results, appErr
+}
+
+// runBatch runs run for count items, up to the concurrency of options at a time, and returns the error of every
+// item. When an item fails, the error reports how many failed with the status of the first failure, as incomplete;
+// items not started after a failure under FailFast fail as skipped.
+func runBatch(ctx context.Context, count int, options BatchOptions, incomplete, skipped *ae.CustomErr, run func(ctx context.Context, i int) *ae.AppError) ([]*ae.AppError, *ae.AppError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make([]*ae.AppError, count)
+	slots := make(chan struct{}, options.Concurrency)
+	var mu sync.Mutex
+	var first *ae.AppError
+	done, failed := 0, 0
+	finish := func(i int, appErr *ae.AppError) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[i] = appErr
+		if appErr != nil {
+			failed++
+			if first == nil {
+				first = appErr
+				if options.FailFast {
+					cancel()
+				}
+			}
+		}
+		done++
+		if options.Progress != nil {
+			options.Progress(done, count)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range count {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			aborted := first != nil
+			mu.Unlock()
+			if aborted {
+				finish(i, ae.GetAppErr(ctx, fmt.Errorf("item %d not processed after an earlier failure", i), skipped, http.StatusFailedDependency))
+			} else {
+				finish(i, ae.GetAppErr(ctx, ctx.Err(), incomplete, http.StatusRequestTimeout))
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			finish(i, run(ctx, i))
+		}()
+	}
+	wg.Wait()
+	if first == nil {
+		return errs, nil
+	}
+	err := fmt.Errorf("%d of %d items failed, first: %s", failed, count, first.Error())
+	return errs, ae.GetAppErr(ctx, err, incomplete, first.GetHTTPCode())
+}
@@ -0,0 +1,582 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// BucketSpec is the desired configuration of a bucket. Nil fields leave the current setting alone, set fields are
+// owned by the spec: an empty Lifecycle, CORS or Tags removes every rule or tag not in the spec.
+type BucketSpec struct {
+	// Location is the region (S3) or location (GCS) a missing bucket is created in, by default the region of the
+	// S3 client
+	Location string
+	// Project is the GCS project a missing bucket is created in
+	Project    string
+	Versioning *bool
+	Lifecycle  []LifecycleRule
+	// Encryption is the default encryption of new objects. S3 encrypts every object, so no encryption means
+	// provider managed encryption there.
+	Encryption *Encryption
+	CORS       []CORSRule
+	// Tags are bucket tags on S3 and bucket labels on GCS
+	Tags map[string]string
+}
+
+// LifecycleRule applies lifecycle actions to the objects under Prefix, zero days disable an action
+type LifecycleRule struct {
+	// ID names the rule on S3, rule-<index> by default
+	ID     string
+	Prefix string
+	// ExpireAfterDays deletes objects this many days after they were written
+	ExpireAfterDays int
+	// NoncurrentExpireAfterDays deletes noncurrent versions this many days after they became noncurrent
+	NoncurrentExpireAfterDays int
+	// TransitionAfterDays moves objects to TransitionStorageClass this many days after they were written
+	TransitionAfterDays    int
+	TransitionStorageClass string
+	// AbortIncompleteUploadsAfterDays aborts multipart uploads not completed this many days after they started
+	AbortIncompleteUploadsAfterDays int
+}
+
+// CORSRule allows browsers on AllowedOrigins to call AllowedMethods on the bucket
+type CORSRule struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflight requests, GCS allows any
+	AllowedHeaders []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int
+}
+
+// BucketProvisionReport tells what EnsureBucket changed
+type BucketProvisionReport struct {
+	Created bool
+	// Updated names the settings of an existing bucket changed to match the spec: versioning, lifecycle,
+	// encryption, cors and tags
+	Updated []string
+}
+
+// IBucketProvisioner is implemented by backends able to create and configure their bucket
+type IBucketProvisioner interface {
+	EnsureBucket(ctx context.Context, spec BucketSpec) (BucketProvisionReport, *ae.AppError)
+}
+
+// EnsureBucket creates the bucket of backend when it is missing and reconciles its configuration toward spec,
+// looking through decorators for a backend implementing IBucketProvisioner. Settings already matching the spec are
+// not written, so running it on every service start is cheap and idempotent.
+func EnsureBucket(ctx context.Context, backend IStorageBackend, spec BucketSpec) (BucketProvisionReport, *ae.AppError) {
+	for backend != nil {
+		if provisioner, ok := backend.(IBucketProvisioner); ok {
+			return provisioner.EnsureBucket(ctx, spec)
+		}
+		wrapper, ok := backend.(IWrapperBackend)
+		if !ok {
+			break
+		}
+		backend = wrapper.Unwrap()
+	}
+	return BucketProvisionReport{}, ae.GetAppErr(ctx, fmt.Errorf("backend does not provision buckets"), BucketProvision, http.StatusNotImplemented)
+}
+
+// validate rejects specs no provider could apply
+func (s BucketSpec) validate(ctx context.Context) *ae.AppError {
+	for i, rule := range s.Lifecycle {
+		if rule.ExpireAfterDays < 0 || rule.NoncurrentExpireAfterDays < 0 || rule.TransitionAfterDays < 0 || rule.AbortIncompleteUploadsAfterDays < 0 {
+			return ae.GetAppErr(ctx, fmt.Errorf("lifecycle rule %d has negative days", i), BucketSpecInvalid, http.StatusBadRequest)
+		}
+		if rule.ExpireAfterDays == 0 && rule.NoncurrentExpireAfterDays == 0 && rule.TransitionAfterDays == 0 && rule.AbortIncompleteUploadsAfterDays == 0 {
+			return ae.GetAppErr(ctx, fmt.Errorf("lifecycle rule %d has no action", i), BucketSpecInvalid, http.StatusBadRequest)
+		}
+		if (rule.TransitionAfterDays > 0) != (rule.TransitionStorageClass != "") {
+			return ae.GetAppErr(ctx, fmt.Errorf("lifecycle rule %d needs both transition days and storage class", i), BucketSpecInvalid, http.StatusBadRequest)
+		}
+	}
+	for i, rule := range s.CORS {
+		if len(rule.AllowedOrigins) == 0 || len(rule.AllowedMethods) == 0 || rule.MaxAgeSeconds < 0 {
+			return ae.GetAppErr(ctx, fmt.Errorf("cors rule %d needs origins, methods and a max age not negative", i), BucketSpecInvalid, http.StatusBadRequest)
+		}
+	}
+	if s.Encryption != nil && s.Encryption.Type == EncryptionKMS && s.Encryption.KMSKeyID == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("kms encryption needs a key"), BucketSpecInvalid, http.StatusBadRequest)
+	}
+	if s.Encryption != nil && s.Encryption.Type == EncryptionCustomerKey {
+		return ae.GetAppErr(ctx, fmt.Errorf("customer supplied keys cannot be a bucket default"), BucketSpecInvalid, http.StatusBadRequest)
+	}
+	for key := range s.Tags {
+		if key == "" {
+			return ae.GetAppErr(ctx, fmt.Errorf("tag keys must not be empty"), BucketSpecInvalid, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// withRuleIDs returns the lifecycle rules with the default ID set on rules without one
+func withRuleIDs(rules []LifecycleRule) []LifecycleRule {
+	named := make([]LifecycleRule, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			rule.ID = "rule-" + strconv.Itoa(i)
+		}
+		named[i] = rule
+	}
+	return named
+}
+
+// IS3BucketClient is the part of the S3 client used to provision buckets, implemented by *s3.S3
+type IS3BucketClient interface {
+	HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error)
+	CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error)
+	GetBucketVersioningWithContext(ctx aws.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error)
+	PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error)
+	GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error)
+	GetBucketEncryptionWithContext(ctx aws.Context, input *s3.GetBucketEncryptionInput, opts ...request.Option) (*s3.GetBucketEncryptionOutput, error)
+	PutBucketEncryptionWithContext(ctx aws.Context, input *s3.PutBucketEncryptionInput, opts ...request.Option) (*s3.PutBucketEncryptionOutput, error)
+	GetBucketCorsWithContext(ctx aws.Context, input *s3.GetBucketCorsInput, opts ...request.Option) (*s3.GetBucketCorsOutput, error)
+	PutBucketCorsWithContext(ctx aws.Context, input *s3.PutBucketCorsInput, opts ...request.Option) (*s3.PutBucketCorsOutput, error)
+	DeleteBucketCorsWithContext(ctx aws.Context, input *s3.DeleteBucketCorsInput, opts ...request.Option) (*s3.DeleteBucketCorsOutput, error)
+	GetBucketTaggingWithContext(ctx aws.Context, input *s3.GetBucketTaggingInput, opts ...request.Option) (*s3.GetBucketTaggingOutput, error)
+	PutBucketTaggingWithContext(ctx aws.Context, input *s3.PutBucketTaggingInput, opts ...request.Option) (*s3.PutBucketTaggingOutput, error)
+	DeleteBucketTaggingWithContext(ctx aws.Context, input *s3.DeleteBucketTaggingInput, opts ...request.Option) (*s3.DeleteBucketTaggingOutput, error)
+}
+
+// EnsureBucket creates the S3 bucket when it is missing and reconciles its versioning, lifecycle, default
+// encryption, CORS and tags toward spec. The client must implement IS3BucketClient.
+func (b *S3Backend) EnsureBucket(ctx context.Context, spec BucketSpec) (BucketProvisionReport, *ae.AppError) {
+	var report BucketProvisionReport
+	if appErr := spec.validate(ctx); appErr != nil {
+		return report, appErr
+	}
+	client, ok := b.Client.(IS3BucketClient)
+	if !ok {
+		return report, ae.GetAppErr(ctx, fmt.Errorf("the s3 client does not provision buckets"), BucketProvision, http.StatusNotImplemented)
+	}
+	bucket := aws.String(b.Bucket)
+
+	_, err := client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: bucket})
+	if err != nil && !isS3NotFoundError(err) {
+		return report, s3ProvisionErr(ctx, err, "head bucket")
+	}
+	if err != nil {
+		input := &s3.CreateBucketInput{Bucket: bucket}
+		location := spec.Location
+		if service, ok := b.Client.(*s3.S3); ok && location == "" {
+			location = aws.StringValue(service.Config.Region)
+		}
+		// us-east-1 is the default location and is rejected as a location constraint
+		if location != "" && location != "us-east-1" {
+			input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(location)}
+		}
+		if _, err := client.CreateBucketWithContext(ctx, input); err != nil {
+			return report, s3ProvisionErr(ctx, err, "create bucket")
+		}
+		report.Created = true
+	}
+
+	if spec.Versioning != nil {
+		current, err := client.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: bucket})
+		if err != nil {
+			return report, s3ProvisionErr(ctx, err, "get versioning")
+		}
+		if enabled := aws.StringValue(current.Status) == s3.BucketVersioningStatusEnabled; enabled != *spec.Versioning {
+			// a bucket once versioned can only be suspended
+			status := s3.BucketVersioningStatusSuspended
+			if *spec.Versioning {
+				status = s3.BucketVersioningStatusEnabled
+			}
+			_, err := client.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+				Bucket:                  bucket,
+				VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(status)},
+			})
+			if err != nil {
+				return report, s3ProvisionErr(ctx, err, "put versioning")
+			}
+			report.updated("versioning")
+		}
+	}
+
+	if spec.Lifecycle != nil {
+		desired := withRuleIDs(spec.Lifecycle)
+		var current []LifecycleRule
+		output, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: bucket})
+		if err != nil && !contains(err.Error(), "NoSuchLifecycleConfiguration") {
+			return report, s3ProvisionErr(ctx, err, "get lifecycle")
+		}
+		if err == nil {
+			for _, rule := range output.Rules {
+				current = append(current, lifecycleRuleFromS3(rule))
+			}
+		}
+		if !sameSpec(current, desired) {
+			if len(desired) == 0 {
+				_, err = client.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: bucket})
+			} else {
+				rules := make([]*s3.LifecycleRule, len(desired))
+				for i, rule := range desired {
+					rules[i] = s3LifecycleRule(rule)
+				}
+				_, err = client.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+					Bucket:                 bucket,
+					LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: rules},
+				})
+			}
+			if err != nil {
+				return report, s3ProvisionErr(ctx, err, "put lifecycle")
+			}
+			report.updated("lifecycle")
+		}
+	}
+
+	if spec.Encryption != nil {
+		desired := *spec.Encryption
+		if desired.Type == EncryptionNone {
+			desired.Type = EncryptionProviderManaged
+		}
+		var current Encryption
+		output, err := client.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: bucket})
+		if err != nil && !contains(err.Error(), "ServerSideEncryptionConfigurationNotFoundError") {
+			return report, s3ProvisionErr(ctx, err, "get encryption")
+		}
+		if err == nil && output.ServerSideEncryptionConfiguration != nil && len(output.ServerSideEncryptionConfiguration.Rules) > 0 {
+			if defaults := output.ServerSideEncryptionConfiguration.Rules[0].ApplyServerSideEncryptionByDefault; defaults != nil {
+				current = s3Encryption(defaults.SSEAlgorithm, defaults.KMSMasterKeyID)
+			}
+		}
+		if current.Type != desired.Type || current.KMSKeyID != desired.KMSKeyID {
+			defaults := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)}
+			if desired.Type == EncryptionKMS {
+				defaults = &s3.ServerSideEncryptionByDefault{
+					SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
+					KMSMasterKeyID: aws.String(desired.KMSKeyID),
+				}
+			}
+			_, err := client.PutBucketEncryptionWithContext(ctx, &s3.PutBucketEncryptionInput{
+				Bucket: bucket,
+				ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+					Rules: []*s3.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: defaults}},
+				},
+			})
+			if err != nil {
+				return report, s3ProvisionErr(ctx, err, "put encryption")
+			}
+			report.updated("encryption")
+		}
+	}
+
+	if spec.CORS != nil {
+		var current []CORSRule
+		output, err := client.GetBucketCorsWithContext(ctx, &s3.GetBucketCorsInput{Bucket: bucket})
+		if err != nil && !contains(err.Error(), "NoSuchCORSConfiguration") {
+			return report, s3ProvisionErr(ctx, err, "get cors")
+		}
+		if err == nil {
+			for _, rule := range output.CORSRules {
+				current = append(current, CORSRule{
+					AllowedOrigins: stringValues(rule.AllowedOrigins),
+					AllowedMethods: stringValues(rule.AllowedMethods),
+					AllowedHeaders: stringValues(rule.AllowedHeaders),
+					ExposeHeaders:  aws.StringValueSlice(rule.ExposeHeaders),
+					MaxAgeSeconds:  int(aws.Int64Value(rule.MaxAgeSeconds)),
+				})
+			}
+		}
+		if !sameSpec(current, spec.CORS) {
+			if len(spec.CORS) == 0 {
+				_, err = client.DeleteBucketCorsWithContext(ctx, &s3.DeleteBucketCorsInput{Bucket: bucket})
+			} else {
+				rules := make([]*s3.CORSRule, len(spec.CORS))
+				for i, rule := range spec.CORS {
+					rules[i] = &s3.CORSRule{
+						AllowedOrigins: aws.StringSlice(rule.AllowedOrigins),
+						AllowedMethods: aws.StringSlice(rule.AllowedMethods),
+						AllowedHeaders: aws.StringSlice(rule.AllowedHeaders),
+						ExposeHeaders:  aws.StringSlice(rule.ExposeHeaders),
+						MaxAgeSeconds:  aws.Int64(int64(rule.MaxAgeSeconds)),
+					}
+				}
+				_, err = client.PutBucketCorsWithContext(ctx, &s3.PutBucketCorsInput{
+					Bucket:            bucket,
+					CORSConfiguration: &s3.CORSConfiguration{CORSRules: rules},
+				})
+			}
+			if err != nil {
+				return report, s3ProvisionErr(ctx, err, "put cors")
+			}
+			report.updated("cors")
+		}
+	}
+
+	if spec.Tags != nil {
+		current := map[string]string{}
+		output, err := client.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: bucket})
+		if err != nil && !contains(err.Error(), "NoSuchTagSet") {
+			return report, s3ProvisionErr(ctx, err, "get tags")
+		}
+		if err == nil {
+			for _, tag := range output.TagSet {
+				current[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+		}
+		if !maps.Equal(current, spec.Tags) {
+			if len(spec.Tags) == 0 {
+				_, err = client.DeleteBucketTaggingWithContext(ctx, &s3.DeleteBucketTaggingInput{Bucket: bucket})
+			} else {
+				tagSet := make([]*s3.Tag, 0, len(spec.Tags))
+				for key, value := range spec.Tags {
+					tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(value)})
+				}
+				_, err = client.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+					Bucket:  bucket,
+					Tagging: &s3.Tagging{TagSet: tagSet},
+				})
+			}
+			if err != nil {
+				return report, s3ProvisionErr(ctx, err, "put tags")
+			}
+			report.updated("tags")
+		}
+	}
+	return report, nil
+}
+
+// s3LifecycleRule converts a lifecycle rule to its S3 form
+func s3LifecycleRule(rule LifecycleRule) *s3.LifecycleRule {
+	s3Rule := &s3.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+	}
+	if rule.ExpireAfterDays > 0 {
+		s3Rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(int64(rule.ExpireAfterDays))}
+	}
+	if rule.NoncurrentExpireAfterDays > 0 {
+		s3Rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(int64(rule.NoncurrentExpireAfterDays))}
+	}
+	if rule.TransitionAfterDays > 0 {
+		s3Rule.Transitions = []*s3.Transition{{
+			Days:         aws.Int64(int64(rule.TransitionAfterDays)),
+			StorageClass: aws.String(rule.TransitionStorageClass),
+		}}
+	}
+	if rule.AbortIncompleteUploadsAfterDays > 0 {
+		s3Rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(int64(rule.AbortIncompleteUploadsAfterDays))}
+	}
+	return s3Rule
+}
+
+// lifecycleRuleFromS3 converts an S3 lifecycle rule back, settings LifecycleRule cannot express make it differ
+// from every spec rule so that it is replaced
+func lifecycleRuleFromS3(s3Rule *s3.LifecycleRule) LifecycleRule {
+	rule := LifecycleRule{ID: aws.StringValue(s3Rule.ID), Prefix: aws.StringValue(s3Rule.Prefix)}
+	if s3Rule.Filter != nil && s3Rule.Filter.Prefix != nil {
+		rule.Prefix = aws.StringValue(s3Rule.Filter.Prefix)
+	}
+	if aws.StringValue(s3Rule.Status) != s3.ExpirationStatusEnabled || (s3Rule.Filter != nil && (s3Rule.Filter.And != nil || s3Rule.Filter.Tag != nil)) {
+		rule.ID += " (unmanaged)"
+	}
+	if s3Rule.Expiration != nil {
+		rule.ExpireAfterDays = int(aws.Int64Value(s3Rule.Expiration.Days))
+	}
+	if s3Rule.NoncurrentVersionExpiration != nil {
+		rule.NoncurrentExpireAfterDays = int(aws.Int64Value(s3Rule.NoncurrentVersionExpiration.NoncurrentDays))
+	}
+	if len(s3Rule.Transitions) == 1 {
+		rule.TransitionAfterDays = int(aws.Int64Value(s3Rule.Transitions[0].Days))
+		rule.TransitionStorageClass = aws.StringValue(s3Rule.Transitions[0].StorageClass)
+	} else if len(s3Rule.Transitions) > 1 {
+		rule.ID += " (unmanaged)"
+	}
+	if s3Rule.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteUploadsAfterDays = int(aws.Int64Value(s3Rule.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+	}
+	return rule
+}
+
+// stringValues dereferences S3 strings, nil when there are none so that they compare equal to an unset spec field
+func stringValues(values []*string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return aws.StringValueSlice(values)
+}
+
+// s3ProvisionErr converts an error of a bucket configuration request
+func s3ProvisionErr(ctx context.Context, err error, step string) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, errors.Wrap(err, step), BucketProvision, http.StatusInternalServerError)
+	if isS3NotImplementedError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	}
+	return appErr
+}
+
+// gcsBucketAdmin is the part of a GCS bucket handle used to provision buckets
+type gcsBucketAdmin interface {
+	Attrs(ctx context.Context) (*storage.BucketAttrs, error)
+	Create(ctx context.Context, projectID string, attrs *storage.BucketAttrs) error
+	Update(ctx context.Context, uattrs storage.BucketAttrsToUpdate) (*storage.BucketAttrs, error)
+}
+
+// EnsureBucket creates the GCS bucket in spec.Project when it is missing and reconciles its versioning, lifecycle,
+// default KMS key, CORS and labels toward spec. The client must be a bucket handle.
+func (b GoogleCSBackend) EnsureBucket(ctx context.Context, spec BucketSpec) (BucketProvisionReport, *ae.AppError) {
+	var report BucketProvisionReport
+	if appErr := spec.validate(ctx); appErr != nil {
+		return report, appErr
+	}
+	bucket, ok := b.Client.(gcsBucketAdmin)
+	if !ok {
+		return report, ae.GetAppErr(ctx, fmt.Errorf("the gcs client does not provision buckets"), BucketProvision, http.StatusNotImplemented)
+	}
+	var lifecycle storage.Lifecycle
+	for _, rule := range spec.Lifecycle {
+		lifecycle.Rules = append(lifecycle.Rules, gcsLifecycleRules(rule)...)
+	}
+	cors := make([]storage.CORS, len(spec.CORS))
+	for i, rule := range spec.CORS {
+		cors[i] = storage.CORS{
+			MaxAge:          time.Duration(rule.MaxAgeSeconds) * time.Second,
+			Methods:         rule.AllowedMethods,
+			Origins:         rule.AllowedOrigins,
+			ResponseHeaders: rule.ExposeHeaders,
+		}
+	}
+	kmsKey := ""
+	if spec.Encryption != nil && spec.Encryption.Type == EncryptionKMS {
+		kmsKey = spec.Encryption.KMSKeyID
+	}
+
+	attrs, err := bucket.Attrs(ctx)
+	if err != nil && !errors.Is(err, storage.ErrBucketNotExist) {
+		return report, ae.GetAppErr(ctx, errors.Wrap(err, "get bucket"), BucketProvision, http.StatusInternalServerError)
+	}
+	if err != nil {
+		if spec.Project == "" {
+			return report, ae.GetAppErr(ctx, fmt.Errorf("a project is required to create a gcs bucket"), BucketSpecInvalid, http.StatusBadRequest)
+		}
+		create := &storage.BucketAttrs{Location: spec.Location, Labels: spec.Tags}
+		if spec.Versioning != nil {
+			create.VersioningEnabled = *spec.Versioning
+		}
+		if spec.Lifecycle != nil {
+			create.Lifecycle = lifecycle
+		}
+		if spec.CORS != nil {
+			create.CORS = cors
+		}
+		if kmsKey != "" {
+			create.Encryption = &storage.BucketEncryption{DefaultKMSKeyName: kmsKey}
+		}
+		if err := bucket.Create(ctx, spec.Project, create); err != nil {
+			return report, ae.GetAppErr(ctx, errors.Wrap(err, "create bucket"), BucketProvision, http.StatusInternalServerError)
+		}
+		report.Created = true
+		return report, nil
+	}
+
+	var update storage.BucketAttrsToUpdate
+	if spec.Versioning != nil && *spec.Versioning != attrs.VersioningEnabled {
+		update.VersioningEnabled = *spec.Versioning
+		report.updated("versioning")
+	}
+	if spec.Lifecycle != nil && !sameSpec(attrs.Lifecycle.Rules, lifecycle.Rules) {
+		update.Lifecycle = &lifecycle
+		report.updated("lifecycle")
+	}
+	currentKey := ""
+	if attrs.Encryption != nil {
+		currentKey = attrs.Encryption.DefaultKMSKeyName
+	}
+	if spec.Encryption != nil && currentKey != kmsKey {
+		update.Encryption = &storage.BucketEncryption{DefaultKMSKeyName: kmsKey}
+		report.updated("encryption")
+	}
+	if spec.CORS != nil && !sameSpec(attrs.CORS, cors) {
+		update.CORS = cors
+		report.updated("cors")
+	}
+	if spec.Tags != nil && !maps.Equal(attrs.Labels, spec.Tags) {
+		for key, value := range spec.Tags {
+			update.SetLabel(key, value)
+		}
+		for key := range attrs.Labels {
+			if _, ok := spec.Tags[key]; !ok {
+				update.DeleteLabel(key)
+			}
+		}
+		report.updated("tags")
+	}
+	if len(report.Updated) == 0 {
+		return report, nil
+	}
+	if _, err := bucket.Update(ctx, update); err != nil {
+		return BucketProvisionReport{}, ae.GetAppErr(ctx, errors.Wrap(err, "update bucket"), BucketProvision, http.StatusInternalServerError)
+	}
+	return report, nil
+}
+
+// gcsLifecycleRules converts a lifecycle rule to GCS rules, one per action
+func gcsLifecycleRules(rule LifecycleRule) []storage.LifecycleRule {
+	var prefixes []string
+	if rule.Prefix != "" {
+		prefixes = []string{rule.Prefix}
+	}
+	var rules []storage.LifecycleRule
+	if rule.ExpireAfterDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{AgeInDays: int64(rule.ExpireAfterDays), MatchesPrefix: prefixes},
+		})
+	}
+	if rule.NoncurrentExpireAfterDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action: storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{
+				DaysSinceNoncurrentTime: int64(rule.NoncurrentExpireAfterDays),
+				Liveness:                storage.Archived,
+				MatchesPrefix:           prefixes,
+			},
+		})
+	}
+	if rule.TransitionAfterDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.SetStorageClassAction, StorageClass: rule.TransitionStorageClass},
+			Condition: storage.LifecycleCondition{AgeInDays: int64(rule.TransitionAfterDays), MatchesPrefix: prefixes},
+		})
+	}
+	if rule.AbortIncompleteUploadsAfterDays > 0 {
+		rules = append(rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.AbortIncompleteMPUAction},
+			Condition: storage.LifecycleCondition{AgeInDays: int64(rule.AbortIncompleteUploadsAfterDays), MatchesPrefix: prefixes},
+		})
+	}
+	return rules
+}
+
+// sameSpec compares a current configuration with the desired one, nil and empty being the same
+func sameSpec[T any](current, desired []T) bool {
+	if len(current) == 0 && len(desired) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(current, desired)
+}
+
+// updated records a setting changed on an existing bucket
+func (r *BucketProvisionReport) updated(setting string) {
+	if !r.Created {
+		r.Updated = append(r.Updated, setting)
+	}
+}
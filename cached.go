@@ -0,0 +1,230 @@
+package object_storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStats are the counters of a CachedBackend
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Entries and Bytes are the current number and content size of cached objects
+	Entries int
+	Bytes   int64
+}
+
+// cacheEntry is an object held by CachedBackend
+type cacheEntry struct {
+	path    string
+	object  Object
+	expires time.Time
+}
+
+// CachedBackend is an IStorageBackend decorator caching GetObject results in memory, in an LRU bounded by the
+// total content size, e.g. for hot configuration objects read thousands of times per minute. Entries expire after
+// TTL and are invalidated by writes made through this decorator; writes made by other processes are only seen
+// once the entry expired. Concurrent misses on the same path share one backend read.
+type CachedBackend struct {
+	Backend IStorageBackend
+	// MaxBytes bounds the content size of all cached objects, objects larger than MaxBytes are never cached
+	MaxBytes int64
+	// TTL is how long an object is served from the cache, zero keeps it until evicted or invalidated
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int64
+	// generation changes on every invalidation, so a read racing a write does not cache the old object
+	generation uint64
+	stats      CacheStats
+	loads      singleflight.Group
+}
+
+// NewCachedBackend creates a new instance of CachedBackend caching up to maxBytes of objects for ttl
+func NewCachedBackend(backend IStorageBackend, maxBytes int64, ttl time.Duration) (*CachedBackend, *ae.AppError) {
+	if maxBytes <= 0 || ttl < 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("cache size must be positive and ttl not negative"), CacheConfig, http.StatusInternalServerError)
+	}
+	return &CachedBackend{
+		Backend:  backend,
+		MaxBytes: maxBytes,
+		TTL:      ttl,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}, nil
+}
+
+// Unwrap returns the cached backend
+func (b *CachedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations the cache does not implement run on the wrapped backend
+func (b *CachedBackend) transparent() {}
+
+// Describe reports the cache size and ttl
+func (b *CachedBackend) Describe() map[string]string {
+	return map[string]string{
+		"maxBytes": strconv.FormatInt(b.MaxBytes, 10),
+		"ttl":      b.TTL.String(),
+	}
+}
+
+// Stats returns the cache counters
+func (b *CachedBackend) Stats() CacheStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Entries = b.lru.Len()
+	stats.Bytes = b.bytes
+	return stats
+}
+
+// Invalidate drops path from the cache, e.g. when it was changed by another process
+func (b *CachedBackend) Invalidate(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+	if element, ok := b.entries[path]; ok {
+		b.remove(element)
+	}
+}
+
+// currentGeneration returns the invalidation generation
+func (b *CachedBackend) currentGeneration() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.generation
+}
+
+// GetObject retrieves an object from the cache, reading and caching it on a miss. Ranged reads are served from a
+// cached object but never populate the cache, versioned reads and reads with a customer key bypass it.
+func (b *CachedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	if options.uncached() {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+	if options.conditional() {
+		object, appErr := b.GetObject(ctx, path, withoutConditions(opts)...)
+		return options.checkConditions(ctx, object, appErr)
+	}
+	if object, ok := b.lookup(path); ok {
+		if options.Range == nil {
+			return object, nil
+		}
+		if ranged, ok := rangeObject(object, *options.Range); ok {
+			return ranged, nil
+		}
+	}
+	if options.Range != nil {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+
+	loaded, _, _ := b.loads.Do(path, func() (interface{}, error) {
+		generation := b.currentGeneration()
+		object, appErr := b.Backend.GetObject(ctx, path)
+		if appErr != nil {
+			return appErr, nil
+		}
+		b.store(path, object, generation)
+		return object, nil
+	})
+	if appErr, ok := loaded.(*ae.AppError); ok {
+		return Object{Path: path}, appErr
+	}
+	return cloneObject(loaded.(Object)), nil
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *CachedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *CachedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object and invalidates its cache entry
+func (b *CachedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	defer b.Invalidate(path)
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object and invalidates its cache entry
+func (b *CachedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	defer b.Invalidate(path)
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object and invalidates the cache entry of the destination
+func (b *CachedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	defer b.Invalidate(dstPath)
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// lookup returns a copy of the cached object at path when it has not expired
+func (b *CachedBackend) lookup(path string) (Object, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	element, ok := b.entries[path]
+	if !ok {
+		b.stats.Misses++
+		return Object{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		b.remove(element)
+		b.stats.Misses++
+		return Object{}, false
+	}
+	b.lru.MoveToFront(element)
+	b.stats.Hits++
+	return cloneObject(entry.object), true
+}
+
+// store caches object read at generation, evicting the least recently used entries to stay within MaxBytes.
+// Nothing is cached when an invalidation happened since the read started.
+func (b *CachedBackend) store(path string, object Object, generation uint64) {
+	size := int64(len(object.Content))
+	if size > b.MaxBytes {
+		return
+	}
+	entry := &cacheEntry{path: path, object: cloneObject(object)}
+	if b.TTL > 0 {
+		entry.expires = time.Now().Add(b.TTL)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if element, ok := b.entries[path]; ok {
+		b.remove(element)
+	}
+	for b.bytes+size > b.MaxBytes && b.lru.Len() > 0 {
+		b.remove(b.lru.Back())
+		b.stats.Evictions++
+	}
+	b.entries[path] = b.lru.PushFront(entry)
+	b.bytes += size
+}
+
+// remove drops an entry, the caller holds mu
+func (b *CachedBackend) remove(element *list.Element) {
+	entry := b.lru.Remove(element).(*cacheEntry)
+	delete(b.entries, entry.path)
+	b.bytes -= int64(len(entry.object.Content))
+}
@@ -0,0 +1,298 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const defaultChaosRetryAfter = time.Second
+
+// LatencyDistribution returns the latency injected before an operation
+type LatencyDistribution func(r *rand.Rand) time.Duration
+
+// UniformLatency spreads injected latencies evenly between least and most
+func UniformLatency(least, most time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		if most <= least {
+			return least
+		}
+		return least + time.Duration(r.Int64N(int64(most-least)+1))
+	}
+}
+
+// ExponentialLatency injects latencies averaging mean, mostly short with a long tail of slow operations
+func ExponentialLatency(mean time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// ChaosOption configures a ChaosBackend
+type ChaosOption func(*ChaosBackend)
+
+// WithChaosErrorRate fails the share rate of operations, between 0 and 1, with 503 Service Unavailable
+func WithChaosErrorRate(rate float64) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.ErrorRate = rate
+	}
+}
+
+// WithChaosThrottleRate fails the share rate of operations, between 0 and 1, with 429 Too Many Requests carrying a
+// retry hint of retryAfter, one second when zero
+func WithChaosThrottleRate(rate float64, retryAfter time.Duration) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.ThrottleRate = rate
+		b.ThrottleRetryAfter = retryAfter
+	}
+}
+
+// WithChaosPartialReadRate cuts the share rate of reads, between 0 and 1, short as a dropped connection would
+func WithChaosPartialReadRate(rate float64) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.PartialReadRate = rate
+	}
+}
+
+// WithChaosLatency delays operations by latencies drawn from distribution
+func WithChaosLatency(distribution LatencyDistribution) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.Latency = distribution
+	}
+}
+
+// WithChaosOperations limits the faults to ops, every operation is affected by default
+func WithChaosOperations(ops ...Operation) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.Operations = ops
+	}
+}
+
+// WithChaosSeed makes the injected faults reproducible across runs
+func WithChaosSeed(seed uint64) ChaosOption {
+	return func(b *ChaosBackend) {
+		b.random = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// ChaosBackend is an IStorageBackend decorator injecting faults, to test the resilience of services to a degraded
+// provider, e.g. in CI: latency, failures with 503 Service Unavailable, throttling with 429 Too Many Requests, and
+// reads cut short with an unexpected EOF. Faults are drawn at random for every operation, an operation getting at
+// most one failure; the failures are transient for RetryOnTransient. Faults can be switched off and on while it is
+// in use with SetEnabled. It must not be used in production.
+type ChaosBackend struct {
+	Backend IStorageBackend
+	// ErrorRate is the share of operations failing with 503 Service Unavailable
+	ErrorRate float64
+	// ThrottleRate is the share of operations failing with 429 Too Many Requests
+	ThrottleRate float64
+	// ThrottleRetryAfter is the retry hint of throttling failures
+	ThrottleRetryAfter time.Duration
+	// PartialReadRate is the share of GetObject calls returning part of the content and an unexpected EOF
+	PartialReadRate float64
+	// Latency, when set, draws the delay of every operation
+	Latency LatencyDistribution
+	// Operations are the operations affected, every operation when empty
+	Operations []Operation
+
+	mu       sync.Mutex
+	random   *rand.Rand
+	disabled bool
+	injected int64
+}
+
+// NewChaosBackend creates a new instance of ChaosBackend, failing when a rate is outside 0 to 1 or the failure
+// rates add up to more than 1
+func NewChaosBackend(backend IStorageBackend, opts ...ChaosOption) (*ChaosBackend, *ae.AppError) {
+	b := &ChaosBackend{
+		Backend:            backend,
+		ThrottleRetryAfter: defaultChaosRetryAfter,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.random == nil {
+		b.random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	if b.ThrottleRetryAfter <= 0 {
+		b.ThrottleRetryAfter = defaultChaosRetryAfter
+	}
+	for _, rate := range []float64{b.ErrorRate, b.ThrottleRate, b.PartialReadRate} {
+		if rate < 0 || rate > 1 {
+			return nil, ae.GetAppErr(context.Background(), fmt.Errorf("fault rate %v must be between 0 and 1", rate), ChaosConfig, http.StatusInternalServerError)
+		}
+	}
+	if b.ErrorRate+b.ThrottleRate > 1 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("error and throttle rates add up to more than 1"), ChaosConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the backend faults are injected in front of
+func (b *ChaosBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the fault rates and the number of faults injected
+func (b *ChaosBackend) Describe() map[string]string {
+	operations := "all"
+	if len(b.Operations) > 0 {
+		operations = fmt.Sprint(b.Operations)
+	}
+	return map[string]string{
+		"enabled":         strconv.FormatBool(b.Enabled()),
+		"errorRate":       strconv.FormatFloat(b.ErrorRate, 'f', -1, 64),
+		"throttleRate":    strconv.FormatFloat(b.ThrottleRate, 'f', -1, 64),
+		"partialReadRate": strconv.FormatFloat(b.PartialReadRate, 'f', -1, 64),
+		"latency":         strconv.FormatBool(b.Latency != nil),
+		"operations":      operations,
+		"injected":        strconv.FormatInt(b.Injected(), 10),
+	}
+}
+
+// SetEnabled switches the faults on or off, they are on when the backend is created
+func (b *ChaosBackend) SetEnabled(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.disabled = !enabled
+}
+
+// Enabled reports whether faults are injected
+func (b *ChaosBackend) Enabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.disabled
+}
+
+// Injected returns the number of failures and partial reads injected
+func (b *ChaosBackend) Injected() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.injected
+}
+
+// GetObject retrieves an object, possibly late, failing or cut short
+func (b *ChaosBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	if appErr := b.inject(ctx, OperationGet); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	if appErr != nil || len(object.Content) == 0 || !b.draw(OperationGet, b.PartialReadRate) {
+		return object, appErr
+	}
+	b.mu.Lock()
+	object.Content = object.Content[:b.random.IntN(len(object.Content))]
+	b.mu.Unlock()
+	err := errors.Wrapf(io.ErrUnexpectedEOF, "chaos: read of %s cut short after %d bytes", path, len(object.Content))
+	return object, ae.GetAppErr(ctx, err, ChaosPartialRead, http.StatusInternalServerError)
+}
+
+// GetObjects lists all objects at the given prefix, possibly late or failing
+func (b *ChaosBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	if appErr := b.inject(ctx, OperationList); appErr != nil {
+		return nil, appErr
+	}
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix, possibly late or failing
+func (b *ChaosBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	if appErr := b.inject(ctx, OperationList); appErr != nil {
+		return ListResult{}, appErr
+	}
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object, possibly late or failing
+func (b *ChaosBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.inject(ctx, OperationPut); appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object, possibly late or failing
+func (b *ChaosBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.inject(ctx, OperationDelete); appErr != nil {
+		return appErr
+	}
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, possibly late or failing
+func (b *ChaosBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.inject(ctx, OperationCopy); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// inject delays an operation by the drawn latency, then fails it at the error or throttle rate. Failures are
+// returned before the operation reaches the backend.
+func (b *ChaosBackend) inject(ctx context.Context, op Operation) *ae.AppError {
+	if !b.affects(op) {
+		return nil
+	}
+	if b.Latency != nil {
+		b.mu.Lock()
+		latency := b.Latency(b.random)
+		b.mu.Unlock()
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ae.GetAppErr(ctx, errors.Wrapf(ctx.Err(), "chaos: %s delayed by %s", op, latency), ChaosInjected, http.StatusGatewayTimeout)
+			case <-timer.C:
+			}
+		}
+	}
+	b.mu.Lock()
+	roll := b.random.Float64()
+	b.mu.Unlock()
+	switch {
+	case roll < b.ErrorRate:
+		b.count()
+		return ae.GetAppErr(ctx, fmt.Errorf("chaos: %s failed with ServiceUnavailable", op), ChaosInjected, http.StatusServiceUnavailable)
+	case roll < b.ErrorRate+b.ThrottleRate:
+		b.count()
+		appErr := ae.GetAppErr(ctx, fmt.Errorf("chaos: %s throttled with SlowDown", op), ChaosThrottled, http.StatusTooManyRequests)
+		return throttled(appErr, b.ThrottleRetryAfter)
+	}
+	return nil
+}
+
+// draw reports whether a fault of the given rate hits an operation, and counts it
+func (b *ChaosBackend) draw(op Operation, rate float64) bool {
+	if rate <= 0 || !b.affects(op) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.random.Float64() >= rate {
+		return false
+	}
+	b.injected++
+	return true
+}
+
+// affects reports whether faults are enabled for op
+func (b *ChaosBackend) affects(op Operation) bool {
+	return b.Enabled() && (len(b.Operations) == 0 || slices.Contains(b.Operations, op))
+}
+
+// count counts an injected failure
+func (b *ChaosBackend) count() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.injected++
+}
@@ -0,0 +1,379 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultCircuitWindow        = 30 * time.Second
+	defaultCircuitMinCalls      = 20
+	defaultCircuitErrorRate     = 0.5
+	defaultCircuitOpenDuration  = 30 * time.Second
+	defaultCircuitHalfOpenCalls = 1
+	// circuitWindowBuckets is the number of buckets the window is divided in, calls leave the window bucket by bucket
+	circuitWindowBuckets = 10
+)
+
+// CircuitState is the state of a CircuitBreakerBackend
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every call with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen lets a few trial calls through to decide whether to close the circuit again
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitCondition reports whether an error counts as a failure of the provider
+type CircuitCondition func(appErr *ae.AppError) bool
+
+// CircuitStateFunc is called when the state of a circuit changes, e.g. to alert on an open circuit
+type CircuitStateFunc func(from, to CircuitState)
+
+// CircuitOption configures a CircuitBreakerBackend
+type CircuitOption func(*CircuitBreakerBackend)
+
+// WithCircuitWindow sets the span of recent calls the error and slow call rates are measured over, and the number
+// of calls the window must hold before the circuit can open
+func WithCircuitWindow(window time.Duration, minCalls int) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.Window = window
+		b.MinCalls = minCalls
+	}
+}
+
+// WithErrorRateThreshold sets the share of failed calls, between 0 and 1, opening the circuit
+func WithErrorRateThreshold(rate float64) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.ErrorRate = rate
+	}
+}
+
+// WithSlowCallThreshold opens the circuit when the share rate of calls taking duration or longer is reached
+func WithSlowCallThreshold(duration time.Duration, rate float64) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.SlowCallDuration = duration
+		b.SlowCallRate = rate
+	}
+}
+
+// WithOpenDuration sets how long the circuit stays open before letting trial calls through
+func WithOpenDuration(duration time.Duration) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.OpenDuration = duration
+	}
+}
+
+// WithHalfOpenCalls sets how many trial calls must succeed in a row to close the circuit again
+func WithHalfOpenCalls(calls int) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.HalfOpenCalls = calls
+	}
+}
+
+// WithCircuitCondition sets the errors counting as failures
+func WithCircuitCondition(condition CircuitCondition) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.Condition = condition
+	}
+}
+
+// WithCircuitStateHandler sets the function called on every state change
+func WithCircuitStateHandler(onStateChange CircuitStateFunc) CircuitOption {
+	return func(b *CircuitBreakerBackend) {
+		b.OnStateChange = onStateChange
+	}
+}
+
+// circuitBucket counts the calls that ended during one slice of the window
+type circuitBucket struct {
+	start    time.Time
+	calls    int
+	failures int
+	slow     int
+}
+
+// CircuitBreakerBackend is an IStorageBackend decorator protecting callers from a degraded provider. Once the
+// window holds MinCalls calls and their error rate reaches ErrorRate, or their slow call rate reaches SlowCallRate,
+// the circuit opens and every call fails at once with ErrCircuitOpen for OpenDuration. The circuit then lets
+// HalfOpenCalls trial calls through, closing again when they all succeed and opening again on the first failure.
+// Errors count as failures per Condition, 429 and server errors other than 501 by default, and calls cancelled by
+// their caller do not count. Create it with NewCircuitBreakerBackend.
+type CircuitBreakerBackend struct {
+	Backend          IStorageBackend
+	Window           time.Duration
+	MinCalls         int
+	ErrorRate        float64
+	SlowCallDuration time.Duration
+	SlowCallRate     float64
+	OpenDuration     time.Duration
+	HalfOpenCalls    int
+	Condition        CircuitCondition
+	OnStateChange    CircuitStateFunc
+
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	buckets  [circuitWindowBuckets]circuitBucket
+	// trials and succeeded count the trial calls started and succeeded while half-open
+	trials    int
+	succeeded int
+}
+
+// NewCircuitBreakerBackend creates a new instance of CircuitBreakerBackend opening at a 50% error rate over the last
+// 30s once 20 calls were made, for 30s, by default
+func NewCircuitBreakerBackend(backend IStorageBackend, opts ...CircuitOption) (*CircuitBreakerBackend, *ae.AppError) {
+	b := &CircuitBreakerBackend{
+		Backend:       backend,
+		Window:        defaultCircuitWindow,
+		MinCalls:      defaultCircuitMinCalls,
+		ErrorRate:     defaultCircuitErrorRate,
+		OpenDuration:  defaultCircuitOpenDuration,
+		HalfOpenCalls: defaultCircuitHalfOpenCalls,
+		Condition:     FailoverOnUnavailable,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.Window < circuitWindowBuckets || b.MinCalls < 1 || b.ErrorRate <= 0 || b.ErrorRate > 1 || b.OpenDuration <= 0 ||
+		b.HalfOpenCalls < 1 || b.Condition == nil || b.SlowCallDuration < 0 || (b.SlowCallDuration > 0 && (b.SlowCallRate <= 0 || b.SlowCallRate > 1)) {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("window, min calls, open duration and half-open calls must be positive and rates between 0 and 1"), CircuitConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the protected backend
+func (b *CircuitBreakerBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations the breaker does not guard run on the wrapped backend
+func (b *CircuitBreakerBackend) transparent() {}
+
+// Describe reports the state and thresholds of the circuit
+func (b *CircuitBreakerBackend) Describe() map[string]string {
+	description := map[string]string{
+		"state":        b.State().String(),
+		"window":       b.Window.String(),
+		"minCalls":     strconv.Itoa(b.MinCalls),
+		"errorRate":    strconv.FormatFloat(b.ErrorRate, 'f', -1, 64),
+		"openDuration": b.OpenDuration.String(),
+	}
+	if b.SlowCallDuration > 0 {
+		description["slowCallDuration"] = b.SlowCallDuration.String()
+		description["slowCallRate"] = strconv.FormatFloat(b.SlowCallRate, 'f', -1, 64)
+	}
+	return description
+}
+
+// State returns the current state of the circuit
+func (b *CircuitBreakerBackend) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.OpenDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// GetObject retrieves an object unless the circuit is open
+func (b *CircuitBreakerBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	var object Object
+	appErr := b.call(ctx, func() *ae.AppError {
+		var appErr *ae.AppError
+		object, appErr = b.Backend.GetObject(ctx, path, opts...)
+		return appErr
+	})
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix unless the circuit is open
+func (b *CircuitBreakerBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	var objects []Object
+	appErr := b.call(ctx, func() *ae.AppError {
+		var appErr *ae.AppError
+		objects, appErr = b.Backend.GetObjects(ctx, prefix)
+		return appErr
+	})
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix unless the circuit is open
+func (b *CircuitBreakerBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	appErr := b.call(ctx, func() *ae.AppError {
+		var appErr *ae.AppError
+		result, appErr = b.Backend.ListObjects(ctx, prefix, opts...)
+		return appErr
+	})
+	return result, appErr
+}
+
+// PutObject uploads an object unless the circuit is open
+func (b *CircuitBreakerBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.call(ctx, func() *ae.AppError {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	})
+}
+
+// DeleteObject removes an object unless the circuit is open
+func (b *CircuitBreakerBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.call(ctx, func() *ae.AppError {
+		return b.Backend.DeleteObject(ctx, path)
+	})
+}
+
+// CopyObject copies an object unless the circuit is open
+func (b *CircuitBreakerBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.call(ctx, func() *ae.AppError {
+		return b.Backend.CopyObject(ctx, srcPath, dstPath)
+	})
+}
+
+// call runs op when the circuit lets it through and records its outcome
+func (b *CircuitBreakerBackend) call(ctx context.Context, op func() *ae.AppError) *ae.AppError {
+	trial, retryAfter, ok := b.admit()
+	if !ok {
+		appErr := ae.GetAppErr(ctx, fmt.Errorf("circuit breaker is open, retry in %s", retryAfter.Round(time.Millisecond)), ErrCircuitOpen, http.StatusServiceUnavailable)
+		return withRetryHint(appErr, retryAfter)
+	}
+	start := time.Now()
+	appErr := op()
+	elapsed := time.Since(start)
+	failed := appErr != nil && b.Condition(appErr)
+	if ctx.Err() != nil && appErr != nil {
+		// the caller gave up, which says nothing about the provider
+		b.release(trial)
+		return appErr
+	}
+	b.record(trial, failed, b.SlowCallDuration > 0 && elapsed >= b.SlowCallDuration)
+	return appErr
+}
+
+// admit decides whether a call goes through, reporting whether it is a half-open trial call and, when rejected,
+// how long the circuit stays open
+func (b *CircuitBreakerBackend) admit() (trial bool, retryAfter time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.unlock(b.state)
+	if b.state == CircuitOpen {
+		if remaining := b.OpenDuration - time.Since(b.openedAt); remaining > 0 {
+			return false, remaining, false
+		}
+		b.setState(CircuitHalfOpen)
+	}
+	if b.state == CircuitHalfOpen {
+		if b.trials >= b.HalfOpenCalls {
+			return false, 0, false
+		}
+		b.trials++
+		return true, 0, true
+	}
+	return false, 0, true
+}
+
+// release gives back the slot of a trial call whose outcome is unknown
+func (b *CircuitBreakerBackend) release(trial bool) {
+	if !trial {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.trials--
+	}
+}
+
+// record counts the outcome of a call and moves the circuit to its next state
+func (b *CircuitBreakerBackend) record(trial, failed, slow bool) {
+	b.mu.Lock()
+	defer b.unlock(b.state)
+	if trial {
+		if b.state != CircuitHalfOpen {
+			return
+		}
+		if failed || slow {
+			b.open()
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.HalfOpenCalls {
+			b.buckets = [circuitWindowBuckets]circuitBucket{}
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		return
+	}
+
+	now := time.Now()
+	bucketSize := b.Window / circuitWindowBuckets
+	bucket := &b.buckets[now.UnixNano()/int64(bucketSize)%circuitWindowBuckets]
+	if start := now.Truncate(bucketSize); !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	bucket.calls++
+	if failed {
+		bucket.failures++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	var calls, failures, slowCalls int
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.Window {
+			calls += bucket.calls
+			failures += bucket.failures
+			slowCalls += bucket.slow
+		}
+	}
+	if calls < b.MinCalls {
+		return
+	}
+	if float64(failures) >= b.ErrorRate*float64(calls) ||
+		(b.SlowCallDuration > 0 && float64(slowCalls) >= b.SlowCallRate*float64(calls)) {
+		b.open()
+	}
+}
+
+// open opens the circuit, the caller holds mu
+func (b *CircuitBreakerBackend) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+// setState changes the state and resets the trial counters, the caller holds mu
+func (b *CircuitBreakerBackend) setState(state CircuitState) {
+	b.state = state
+	b.trials, b.succeeded = 0, 0
+}
+
+// unlock releases mu and reports a change from the state the circuit had when it was locked to OnStateChange
+func (b *CircuitBreakerBackend) unlock(from CircuitState) {
+	to := b.state
+	b.mu.Unlock()
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,278 @@
+package object_storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	// s3MinPartSize is the smallest size of every part but the last of an S3 multipart upload
+	s3MinPartSize = 5 << 20
+	// s3MaxPartSize is the largest size of a part of an S3 multipart upload
+	s3MaxPartSize = 5 << 30
+	// s3MaxParts is the largest part number of an S3 multipart upload
+	s3MaxParts = 10000
+)
+
+// ContentRange is a byte range of an upload as sent in a Content-Range header, End is inclusive and Total is -1
+// when the client does not know the total size yet
+type ContentRange struct {
+	Start int64
+	End   int64
+	Total int64
+}
+
+// Size returns the number of bytes in the range
+func (r ContentRange) Size() int64 {
+	return r.End - r.Start + 1
+}
+
+// ParseContentRange parses a Content-Range header of the form "bytes 0-1048575/4194304" or "bytes 0-1048575/*"
+func ParseContentRange(header string) (ContentRange, *ae.AppError) {
+	invalid := func() (ContentRange, *ae.AppError) {
+		return ContentRange{}, ae.GetAppErr(context.Background(), fmt.Errorf("invalid content range %q", header), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return invalid()
+	}
+	span, total, ok := strings.Cut(spec, "/")
+	if !ok {
+		return invalid()
+	}
+	start, end, ok := strings.Cut(span, "-")
+	if !ok {
+		return invalid()
+	}
+	var r ContentRange
+	var err error
+	if r.Start, err = strconv.ParseInt(start, 10, 64); err != nil || r.Start < 0 {
+		return invalid()
+	}
+	if r.End, err = strconv.ParseInt(end, 10, 64); err != nil || r.End < r.Start {
+		return invalid()
+	}
+	r.Total = -1
+	if total != "*" {
+		if r.Total, err = strconv.ParseInt(total, 10, 64); err != nil || r.End >= r.Total {
+			return invalid()
+		}
+	}
+	return r, nil
+}
+
+// ValidateContentRanges checks that the ranges received for an upload cover exactly total bytes, without gaps or
+// overlaps and agreeing with total where they state it. The ranges may be given in any order.
+func ValidateContentRanges(ranges []ContentRange, total int64) *ae.AppError {
+	ctx := context.Background()
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b ContentRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	next := int64(0)
+	for _, r := range sorted {
+		if r.Total != -1 && r.Total != total {
+			return ae.GetAppErr(ctx, fmt.Errorf("range %d-%d states total %d, expected %d", r.Start, r.End, r.Total, total), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if r.Start < next {
+			return ae.GetAppErr(ctx, fmt.Errorf("range %d-%d overlaps the previous range", r.Start, r.End), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if r.Start > next {
+			return ae.GetAppErr(ctx, fmt.Errorf("bytes %d-%d are missing", next, r.Start-1), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		next = r.End + 1
+	}
+	if next != total {
+		return ae.GetAppErr(ctx, fmt.Errorf("ranges cover %d of %d bytes", next, total), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// ClientPart is a part of a client driven multipart upload as reported by the client when completing it
+type ClientPart struct {
+	PartNumber int64
+	ETag       string
+	Size       int64
+	// ChecksumSHA256 is the base64 encoded SHA-256 of the part content
+	ChecksumSHA256 string
+}
+
+// IClientUploader is implemented by backends supporting uploads sent directly by clients, e.g. browsers, over
+// presigned part URLs. The server creates the upload, hands out one URL per part and completes the upload once
+// the client reports its parts, after validating them against what the provider received.
+type IClientUploader interface {
+	CreateClientUpload(ctx context.Context, path string, opts ...PutOption) (string, *ae.AppError)
+	PresignUploadPart(ctx context.Context, path string, uploadID string, part ClientPart, expires time.Duration) (string, *ae.AppError)
+	CompleteClientUpload(ctx context.Context, path string, uploadID string, parts []ClientPart) *ae.AppError
+	AbortClientUpload(ctx context.Context, path string, uploadID string) *ae.AppError
+}
+
+// CreateClientUpload starts a multipart upload to path with the attributes and encryption of opts and returns
+// its upload id. Parts are verified with SHA-256 checksums.
+func (b *S3Backend) CreateClientUpload(ctx context.Context, path string, opts ...PutOption) (string, *ae.AppError) {
+	options := getPutOptions(opts)
+	if options.customerKeyed() {
+		// clients would have to send the key with every part
+		return "", ae.GetAppErr(ctx, fmt.Errorf("customer supplied keys are not supported by client uploads"), ClientUploadOperation, http.StatusNotImplemented)
+	}
+	upload, appErr := b.uploadInput(ctx, path, nil, options)
+	if appErr != nil {
+		return "", appErr.AddErrCode(ClientUploadOperation.Code)
+	}
+	output, err := b.Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+		ChecksumAlgorithm:    aws.String(s3.ChecksumAlgorithmSha256),
+	})
+	if err != nil {
+		return "", s3ClientUploadErr(ctx, err)
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+// PresignUploadPart returns a URL the client uploads one part to with PUT, valid for expires. The part number,
+// size and SHA-256 checksum are signed into the URL, so the provider rejects a part not matching them; the client
+// sends them as the Content-Length and x-amz-checksum-sha256 headers.
+func (b *S3Backend) PresignUploadPart(ctx context.Context, path string, uploadID string, part ClientPart, expires time.Duration) (string, *ae.AppError) {
+	if appErr := validateClientPart(ctx, part); appErr != nil {
+		return "", appErr
+	}
+	req, _ := b.Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:         aws.String(b.Bucket),
+		Key:            aws.String(objectKey(b.Prefix, path)),
+		UploadId:       aws.String(uploadID),
+		PartNumber:     aws.Int64(part.PartNumber),
+		ContentLength:  aws.Int64(part.Size),
+		ChecksumSHA256: aws.String(part.ChecksumSHA256),
+	})
+	req.SetContext(ctx)
+	url, err := req.Presign(expires)
+	if err != nil {
+		return "", s3ClientUploadErr(ctx, err)
+	}
+	return url, nil
+}
+
+// CompleteClientUpload validates the parts reported by the client against the parts the provider received and
+// completes the upload. Parts must be numbered from 1 without gaps, every part but the last must be at least
+// 5 MiB, and the ETag, size and checksum of every part must match. A failed validation leaves the upload open.
+func (b *S3Backend) CompleteClientUpload(ctx context.Context, path string, uploadID string, parts []ClientPart) *ae.AppError {
+	if len(parts) == 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("upload %s has no parts", uploadID), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	key := objectKey(b.Prefix, path)
+	received := map[int64]*s3.Part{}
+	err := b.Client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(b.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			received[aws.Int64Value(part.PartNumber)] = part
+		}
+		return true
+	})
+	if err != nil {
+		return s3ClientUploadErr(ctx, err)
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for i, part := range parts {
+		if part.PartNumber != int64(i+1) {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d reported at position %d, parts must be numbered from 1 in order", part.PartNumber, i+1), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if i < len(parts)-1 && part.Size < s3MinPartSize {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d has %d bytes, only the last part may be smaller than %d", part.PartNumber, part.Size, s3MinPartSize), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		stored, ok := received[part.PartNumber]
+		if !ok {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d was not uploaded", part.PartNumber), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if unquoteETag(aws.StringValue(stored.ETag)) != unquoteETag(part.ETag) {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d etag mismatch", part.PartNumber), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if aws.Int64Value(stored.Size) != part.Size {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d has %d bytes, client reported %d", part.PartNumber, aws.Int64Value(stored.Size), part.Size), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		if aws.StringValue(stored.ChecksumSHA256) != part.ChecksumSHA256 {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d checksum mismatch", part.PartNumber), ClientUploadInvalid, http.StatusBadRequest)
+		}
+		completed = append(completed, &s3.CompletedPart{
+			PartNumber:     stored.PartNumber,
+			ETag:           stored.ETag,
+			ChecksumSHA256: stored.ChecksumSHA256,
+		})
+	}
+	if len(received) != len(parts) {
+		return ae.GetAppErr(ctx, fmt.Errorf("%d parts were uploaded, client reported %d", len(received), len(parts)), ClientUploadInvalid, http.StatusBadRequest)
+	}
+
+	_, err = b.Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return s3ClientUploadErr(ctx, err)
+	}
+	return nil
+}
+
+// AbortClientUpload aborts an upload and frees the parts uploaded so far
+func (b *S3Backend) AbortClientUpload(ctx context.Context, path string, uploadID string) *ae.AppError {
+	_, err := b.Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.Bucket),
+		Key:      aws.String(objectKey(b.Prefix, path)),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return s3ClientUploadErr(ctx, err)
+	}
+	return nil
+}
+
+// validateClientPart checks a part against the S3 multipart limits before a URL is signed for it
+func validateClientPart(ctx context.Context, part ClientPart) *ae.AppError {
+	if part.PartNumber < 1 || part.PartNumber > s3MaxParts {
+		return ae.GetAppErr(ctx, fmt.Errorf("part number %d outside 1-%d", part.PartNumber, s3MaxParts), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	if part.Size < 1 || part.Size > s3MaxPartSize {
+		return ae.GetAppErr(ctx, fmt.Errorf("part %d size %d outside 1-%d", part.PartNumber, part.Size, s3MaxPartSize), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	if part.ChecksumSHA256 == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("part %d has no checksum", part.PartNumber), ClientUploadInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// s3ClientUploadErr maps an S3 multipart upload error, an unknown upload id is reported as 404
+func s3ClientUploadErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, ClientUploadOperation, http.StatusInternalServerError)
+	if isS3NotFoundError(err) || contains(err.Error(), s3.ErrCodeNoSuchUpload) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if isS3NotImplementedError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	}
+	return appErr
+}
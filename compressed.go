@@ -0,0 +1,206 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// defaultCompressionThreshold is the content size from which CompressedBackend compresses by default
+const defaultCompressionThreshold = 1024
+
+// metaCompression is the user metadata key naming the algorithm a stored object is compressed with
+const metaCompression = "compression"
+
+// Compression is a content compression algorithm
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// zstdCodec returns the zstd encoder and decoder shared by every CompressedBackend, safe for concurrent EncodeAll
+// and DecodeAll calls
+var zstdCodec = sync.OnceValues(func() (*zstd.Encoder, *zstd.Decoder) {
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil)
+	return encoder, decoder
+})
+
+// CompressedOption configures a CompressedBackend
+type CompressedOption func(*CompressedBackend)
+
+// WithCompressionThreshold sets the content size from which content is compressed, smaller content is stored as is
+func WithCompressionThreshold(threshold int) CompressedOption {
+	return func(b *CompressedBackend) {
+		b.Threshold = threshold
+	}
+}
+
+// CompressedBackend is an IStorageBackend decorator compressing content on put and decompressing it on get. Content
+// smaller than Threshold, or not shrinking, is stored as is. Compressed objects are flagged in their user metadata,
+// so objects stored before compression was enabled still read correctly; the wrapped backend must store user
+// metadata. Listings report the stored, compressed size.
+type CompressedBackend struct {
+	Backend   IStorageBackend
+	Algorithm Compression
+	Threshold int
+}
+
+// NewCompressedBackend creates a new instance of CompressedBackend compressing content of 1 KiB or more with
+// algorithm by default
+func NewCompressedBackend(backend IStorageBackend, algorithm Compression, opts ...CompressedOption) (*CompressedBackend, *ae.AppError) {
+	b := &CompressedBackend{
+		Backend:   backend,
+		Algorithm: algorithm,
+		Threshold: defaultCompressionThreshold,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.Algorithm != CompressionGzip && b.Algorithm != CompressionZstd {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("unsupported compression %q", b.Algorithm), CompressionConfig, http.StatusInternalServerError)
+	}
+	if b.Threshold < 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("compression threshold must not be negative"), CompressionConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the backend storing the compressed objects
+func (b *CompressedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the algorithm and threshold
+func (b *CompressedBackend) Describe() map[string]string {
+	return map[string]string{
+		"algorithm": string(b.Algorithm),
+		"threshold": strconv.Itoa(b.Threshold),
+	}
+}
+
+// GetObject retrieves and decompresses an object. Ranged reads download the whole object and return the requested
+// range of the decompressed content.
+func (b *CompressedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, withoutRange(opts)...)
+	if appErr != nil {
+		return object, appErr
+	}
+	if object, appErr = decompressObject(ctx, object); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return sliceRange(ctx, object, getGetOptions(opts).Range, CompressionDecode)
+}
+
+// GetObjects lists all objects at the given prefix, decompressing the content of backends returning it
+func (b *CompressedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	if appErr != nil {
+		return objects, appErr
+	}
+	for i, object := range objects {
+		if objects[i], appErr = decompressObject(ctx, object); appErr != nil {
+			return nil, appErr
+		}
+	}
+	return objects, nil
+}
+
+// ListObjects lists objects at the given prefix, sizes being those of the stored content
+func (b *CompressedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object, compressed when it reaches the threshold and compression makes it smaller
+func (b *CompressedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if len(content) < b.Threshold {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	}
+	compressed, err := compress(b.Algorithm, content)
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "compressing %s", path), CompressionEncode, http.StatusInternalServerError)
+	}
+	if len(compressed) >= len(content) {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	}
+	flag := WithMetadata(map[string]string{metaCompression: string(b.Algorithm)})
+	return b.Backend.PutObject(ctx, path, compressed, append(slices.Clone(opts), flag)...)
+}
+
+// DeleteObject removes an object
+func (b *CompressedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, the copy staying compressed
+func (b *CompressedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// decompressObject decompresses the content of an object flagged as compressed and removes the flag from its
+// metadata, other objects are returned as they are
+func decompressObject(ctx context.Context, object Object) (Object, *ae.AppError) {
+	algorithm, ok := object.Meta.User[metaCompression]
+	if !ok || object.Content == nil {
+		return object, nil
+	}
+	content, err := decompress(Compression(algorithm), object.Content)
+	if err != nil {
+		return object, ae.GetAppErr(ctx, errors.Wrapf(err, "decompressing %s", object.Path), CompressionDecode, http.StatusInternalServerError)
+	}
+	object.Content = content
+	object.Size = int64(len(content))
+	object.Meta.User = maps.Clone(object.Meta.User)
+	delete(object.Meta.User, metaCompression)
+	return object, nil
+}
+
+// compress compresses content with algorithm
+func compress(algorithm Compression, content []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		encoder, _ := zstdCodec()
+		return encoder.EncodeAll(content, nil), nil
+	case CompressionGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(content); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %q", algorithm)
+}
+
+// decompress decompresses content compressed with algorithm
+func decompress(algorithm Compression, content []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		_, decoder := zstdCodec()
+		return decoder.DecodeAll(content, nil)
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return nil, fmt.Errorf("unsupported compression %q", algorithm)
+}
@@ -0,0 +1,66 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// WithIfNoneMatch only reads the object when its ETag differs from etag, e.g. the ETag of the copy a poller holds;
+// otherwise GetObject fails with ErrNotModified and 304 Not Modified, without transferring the content. Backends
+// reporting no ETags, HDFS and Redis, always read the object.
+func WithIfNoneMatch(etag string) GetOption {
+	return func(o *GetOptions) {
+		o.IfNoneMatch = unquoteETag(etag)
+	}
+}
+
+// WithIfModifiedSince only reads the object when it was modified after t, otherwise GetObject fails with
+// ErrNotModified and 304 Not Modified. Modification times are compared at second precision, as in HTTP, and the
+// condition is ignored when WithIfNoneMatch is also given.
+func WithIfModifiedSince(t time.Time) GetOption {
+	return func(o *GetOptions) {
+		o.IfModifiedSince = t
+	}
+}
+
+// conditional reports whether the options only read the object when it changed
+func (o GetOptions) conditional() bool {
+	return o.IfNoneMatch != "" || !o.IfModifiedSince.IsZero()
+}
+
+// unchanged reports whether object, read or stated, matches the conditions of the options and need not be read
+func (o GetOptions) unchanged(object Object) bool {
+	if o.IfNoneMatch != "" {
+		return object.ETag != "" && object.ETag == o.IfNoneMatch
+	}
+	if o.IfModifiedSince.IsZero() || object.LastModified.IsZero() {
+		return false
+	}
+	return !object.LastModified.Truncate(time.Second).After(o.IfModifiedSince.Truncate(time.Second))
+}
+
+// checkConditions applies the conditions of the options to the outcome of a read ignoring them, for backends
+// serving reads from a copy of the object
+func (o GetOptions) checkConditions(ctx context.Context, object Object, appErr *ae.AppError) (Object, *ae.AppError) {
+	if appErr == nil && o.unchanged(object) {
+		return Object{Path: object.Path}, notModifiedErr(ctx, object.Path)
+	}
+	return object, appErr
+}
+
+// notModifiedErr returns the error of a conditional read of an unchanged object
+func notModifiedErr(ctx context.Context, path string) *ae.AppError {
+	return ae.GetAppErr(ctx, fmt.Errorf("object %s not modified", path), ErrNotModified, http.StatusNotModified)
+}
+
+// withoutConditions returns the options reading the object whether it changed or not
+func withoutConditions(opts []GetOption) []GetOption {
+	return append(slices.Clone(opts), func(o *GetOptions) {
+		o.IfNoneMatch, o.IfModifiedSince = "", time.Time{}
+	})
+}
@@ -0,0 +1,178 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// contentStoreLockStripes is the number of locks serialising the reference count updates of a ContentStore
+const contentStoreLockStripes = 64
+
+// ContentStoreOption configures a ContentStore
+type ContentStoreOption func(*ContentStore)
+
+// WithContentHasher digests blobs with hasher instead of SHA-256. Blobs stored with one hasher are not found by the
+// digests of another.
+func WithContentHasher(hasher IHasher) ContentStoreOption {
+	return func(s *ContentStore) {
+		s.Hasher = hasher
+	}
+}
+
+// ContentStore is a content-addressable store keeping blobs under Prefix of a backend, named after the hex digest of
+// their content, e.g. build artifacts that are often identical. PutObject returns the digest to read the blob
+// back with, storing identical content once; every put takes a reference to the blob and DeleteObject releases one,
+// the blob being deleted with its last reference. Reference counts are kept in small objects next to the blobs and
+// updated under locks of the process, so processes sharing a prefix must serialise their writes, e.g. with an
+// ObjectLease.
+type ContentStore struct {
+	Backend IStorageBackend
+	Prefix  string
+	// Hasher digests the content of blobs, HashSHA256 by default
+	Hasher IHasher
+
+	locks        [contentStoreLockStripes]sync.Mutex
+	deduplicated atomic.Int64
+}
+
+// NewContentStore creates a new instance of ContentStore keeping blobs under prefix of backend
+func NewContentStore(backend IStorageBackend, prefix string, opts ...ContentStoreOption) *ContentStore {
+	s := &ContentStore{
+		Backend: backend,
+		Prefix:  cleanPrefix(prefix),
+		Hasher:  HashSHA256,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Deduplicated returns the number of PutObject calls whose content was already stored
+func (s *ContentStore) Deduplicated() int64 {
+	return s.deduplicated.Load()
+}
+
+// PutObject stores a blob unless identical content is already stored, takes a reference to it and returns its
+// digest. The options apply to the first upload of the content only.
+func (s *ContentStore) PutObject(ctx context.Context, content []byte, opts ...PutOption) (string, *ae.AppError) {
+	sum := digest(s.Hasher, content)
+	unlock := s.lock(sum)
+	defer unlock()
+	refs, appErr := s.References(ctx, sum)
+	if appErr != nil {
+		return "", appErr
+	}
+	if refs > 0 {
+		s.deduplicated.Add(1)
+	} else if appErr := s.Backend.PutObject(ctx, s.blobPath(sum), content, opts...); appErr != nil {
+		return "", appErr.AddErrCode(ContentStoreBlob.Code)
+	}
+	if appErr := s.saveReferences(ctx, sum, refs+1); appErr != nil {
+		return "", appErr
+	}
+	return sum, nil
+}
+
+// GetObject retrieves the blob of a digest, its path being the digest
+func (s *ContentStore) GetObject(ctx context.Context, sum string, opts ...GetOption) (Object, *ae.AppError) {
+	if appErr := s.validate(ctx, sum); appErr != nil {
+		return Object{}, appErr
+	}
+	object, appErr := s.Backend.GetObject(ctx, s.blobPath(sum), opts...)
+	if appErr != nil {
+		return object, appErr
+	}
+	object.Path = sum
+	return object, nil
+}
+
+// DeleteObject releases a reference to the blob of a digest and deletes the blob with its last reference, returning
+// the references left. Releasing a blob without references fails with StatusNotFound.
+func (s *ContentStore) DeleteObject(ctx context.Context, sum string) (int64, *ae.AppError) {
+	if appErr := s.validate(ctx, sum); appErr != nil {
+		return 0, appErr
+	}
+	unlock := s.lock(sum)
+	defer unlock()
+	refs, appErr := s.References(ctx, sum)
+	if appErr != nil {
+		return 0, appErr
+	}
+	switch refs {
+	case 0:
+		return 0, ae.GetAppErr(ctx, fmt.Errorf("blob %s is not stored", sum), ContentStoreBlob, http.StatusNotFound)
+	case 1:
+		if appErr := s.Backend.DeleteObject(ctx, s.blobPath(sum)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return refs, appErr.AddErrCode(ContentStoreBlob.Code)
+		}
+		if appErr := s.Backend.DeleteObject(ctx, s.referencesPath(sum)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return 0, appErr.AddErrCode(ContentStoreReferences.Code)
+		}
+		return 0, nil
+	}
+	return refs - 1, s.saveReferences(ctx, sum, refs-1)
+}
+
+// References returns the number of references to the blob of a digest, zero when it is not stored
+func (s *ContentStore) References(ctx context.Context, sum string) (int64, *ae.AppError) {
+	if appErr := s.validate(ctx, sum); appErr != nil {
+		return 0, appErr
+	}
+	object, appErr := s.Backend.GetObject(ctx, s.referencesPath(sum))
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return 0, nil
+		}
+		return 0, appErr.AddErrCode(ContentStoreReferences.Code)
+	}
+	refs, err := strconv.ParseInt(strings.TrimSpace(string(object.Content)), 10, 64)
+	if err != nil {
+		return 0, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to decode references of blob %s", sum), ContentStoreReferences, http.StatusInternalServerError)
+	}
+	return refs, nil
+}
+
+// saveReferences writes the reference count of a blob. The caller holds the lock of the digest.
+func (s *ContentStore) saveReferences(ctx context.Context, sum string, refs int64) *ae.AppError {
+	if appErr := s.Backend.PutObject(ctx, s.referencesPath(sum), []byte(strconv.FormatInt(refs, 10)), WithContentType("text/plain")); appErr != nil {
+		return appErr.AddErrCode(ContentStoreReferences.Code)
+	}
+	return nil
+}
+
+// validate checks that sum is a hex digest, so that it cannot address objects outside the store
+func (s *ContentStore) validate(ctx context.Context, sum string) *ae.AppError {
+	if _, err := hex.DecodeString(sum); err != nil || sum == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("%q is not a hex digest", sum), ContentStoreDigest, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// lock locks the reference count of a valid digest and returns the function unlocking it
+func (s *ContentStore) lock(sum string) func() {
+	first, _ := hex.DecodeString(sum[:2])
+	stripe := &s.locks[int(first[0])%contentStoreLockStripes]
+	stripe.Lock()
+	return stripe.Unlock
+}
+
+// blobPath returns the path of the blob of a digest
+func (s *ContentStore) blobPath(sum string) string {
+	return pathutil.Join(s.Prefix, "blobs", sum)
+}
+
+// referencesPath returns the path of the reference count of a digest
+func (s *ContentStore) referencesPath(sum string) string {
+	return pathutil.Join(s.Prefix, "refs", sum)
+}
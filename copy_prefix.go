@@ -0,0 +1,199 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultCopyPrefixConcurrency = 16
+	// copyPrefixPageSize is the number of objects CopyPrefix lists and copies at a time
+	copyPrefixPageSize = 1000
+)
+
+// OverwritePolicy decides what CopyPrefix does with objects already at the destination
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways copies every object over the destination
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteNever skips objects already at the destination
+	OverwriteNever
+	// OverwriteIfChanged skips objects at the destination of the same size and ETag or CRC32C as the source
+	OverwriteIfChanged
+)
+
+// CopyPrefixReport counts the objects handled by CopyPrefix so far
+type CopyPrefixReport struct {
+	Listed int
+	Copied int
+	// Skipped objects are left as they are at the destination by the overwrite policy
+	Skipped int
+	Failed  int
+	// Bytes is the size of the objects copied
+	Bytes int64
+}
+
+// CopyPrefixOptions holds the settings applied to a prefix copy
+type CopyPrefixOptions struct {
+	// Concurrency is the number of copy requests in flight
+	Concurrency int
+	Overwrite   OverwritePolicy
+	// Progress, when set, is called after every page of objects
+	Progress func(CopyPrefixReport)
+}
+
+// CopyPrefixOption configures a prefix copy
+type CopyPrefixOption func(*CopyPrefixOptions)
+
+// WithCopyPrefixConcurrency sets the number of copy requests in flight, 16 by default
+func WithCopyPrefixConcurrency(concurrency int) CopyPrefixOption {
+	return func(o *CopyPrefixOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithOverwrite sets what is done with objects already at the destination, OverwriteAlways by default
+func WithOverwrite(policy OverwritePolicy) CopyPrefixOption {
+	return func(o *CopyPrefixOptions) {
+		o.Overwrite = policy
+	}
+}
+
+// WithCopyPrefixProgress has CopyPrefix call progress with the counts so far after every page of objects
+func WithCopyPrefixProgress(progress func(CopyPrefixReport)) CopyPrefixOption {
+	return func(o *CopyPrefixOptions) {
+		o.Progress = progress
+	}
+}
+
+// getCopyPrefixOptions applies the given options over the defaults
+func getCopyPrefixOptions(opts []CopyPrefixOption) CopyPrefixOptions {
+	options := CopyPrefixOptions{Concurrency: defaultCopyPrefixConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// CopyPrefix copies every object below the folder srcPrefix of backend to the same path below dstPrefix with
+// CopyObject, on the provider side for S3 and GCS, e.g. to promote a green data set over the blue one. Objects are
+// listed page by page and each page copied with up to 16 copies in flight. The overwrite policy is checked against
+// the destination before each copy, so writes racing the copy may be overwritten. Objects failing to copy do not stop
+// the copy: once every page is done the error counts them, while a listing failure stops it at once. The report
+// counts the objects handled up to then. A dstPrefix inside srcPrefix fails with 400 Bad Request.
+func CopyPrefix(ctx context.Context, backend IStorageBackend, srcPrefix, dstPrefix string, opts ...CopyPrefixOption) (CopyPrefixReport, *ae.AppError) {
+	var report CopyPrefixReport
+	options := getCopyPrefixOptions(opts)
+	src, dst, appErr := prefixPair(ctx, srcPrefix, dstPrefix, CopyPrefixInvalid)
+	if appErr != nil {
+		return report, appErr
+	}
+	var firstErr *ae.AppError
+	cursor := ""
+	for {
+		page, appErr := backend.ListObjects(ctx, src+"/", WithMaxKeys(copyPrefixPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return report, appErr.AddErrCode(CopyPrefixList.Code)
+		}
+		report.Listed += len(page.Objects)
+		for _, result := range copyEach(ctx, backend, src, dst, page.Objects, options) {
+			switch {
+			case result.err != nil:
+				report.Failed++
+				if firstErr == nil {
+					firstErr = result.err
+				}
+			case result.skipped:
+				report.Skipped++
+			default:
+				report.Copied++
+				report.Bytes += result.size
+			}
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if firstErr != nil {
+		err := fmt.Errorf("%d of %d objects at %s not copied, first: %s", report.Failed, report.Listed, srcPrefix, firstErr.Error())
+		return report, ae.GetAppErr(ctx, err, CopyPrefixIncomplete, firstErr.GetHTTPCode())
+	}
+	return report, nil
+}
+
+// prefixPair returns the cleaned source and destination prefixes of a prefix copy, failing with invalid when the
+// destination is inside the source, where listing the source would meet the copies
+func prefixPair(ctx context.Context, srcPrefix, dstPrefix string, invalid *ae.CustomErr) (string, string, *ae.AppError) {
+	src, dst := cleanPrefix(srcPrefix), cleanPrefix(dstPrefix)
+	if src == "" || strings.HasPrefix(dst+"/", src+"/") {
+		err := fmt.Errorf("destination %q is inside the source %q", dstPrefix, srcPrefix)
+		return "", "", ae.GetAppErr(ctx, err, invalid, http.StatusBadRequest)
+	}
+	return src, dst, nil
+}
+
+// copyPrefixResult is the outcome of copying one object of a prefix
+type copyPrefixResult struct {
+	skipped bool
+	size    int64
+	err     *ae.AppError
+}
+
+// copyEach copies the objects listed below the folder src to dst, up to the concurrency of options at a time
+func copyEach(ctx context.Context, backend IStorageBackend, src, dst string, objects []Object, options CopyPrefixOptions) []copyPrefixResult {
+	results := make([]copyPrefixResult, len(objects))
+	slots := make(chan struct{}, options.Concurrency)
+	var wg sync.WaitGroup
+	for i, object := range objects {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].err = ae.GetAppErr(ctx, ctx.Err(), CopyPrefixIncomplete, http.StatusRequestTimeout)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			srcPath := objectKey(src, object.Path)
+			dstPath := objectKey(dst, object.Path)
+			skip, appErr := overwriteSkips(ctx, backend, dstPath, object, options.Overwrite)
+			if appErr == nil && !skip {
+				appErr = backend.CopyObject(ctx, srcPath, dstPath)
+			}
+			results[i] = copyPrefixResult{skipped: skip, size: object.Size, err: appErr}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// overwriteSkips reports whether policy leaves the object at dstPath as it is instead of copying source over it
+func overwriteSkips(ctx context.Context, backend IStorageBackend, dstPath string, source Object, policy OverwritePolicy) (bool, *ae.AppError) {
+	if policy == OverwriteAlways {
+		return false, nil
+	}
+	current, appErr := StatObject(ctx, backend, dstPath)
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return false, nil
+		}
+		return false, appErr
+	}
+	if policy == OverwriteNever {
+		return true, nil
+	}
+	return current.Size == source.Size && (current.ETag != "" && current.ETag == source.ETag ||
+		current.CRC32C != "" && current.CRC32C == source.CRC32C), nil
+}
@@ -0,0 +1,253 @@
+package object_storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// CopyOptions holds the settings applied to a copy between backends
+type CopyOptions struct {
+	// Progress, when set, is called with the bytes copied so far and the size of the object
+	Progress func(copied, total int64)
+	// Streamed copies the content through the process even when the provider could copy it
+	Streamed bool
+}
+
+// CopyOption configures a copy between backends
+type CopyOption func(*CopyOptions)
+
+// WithCopyProgress has the copy call progress with the bytes copied so far and the size of the object, after every
+// part of S3 multipart copies, every rewrite call of GCS copies and as the content is read by streamed copies.
+// Calls are never concurrent.
+func WithCopyProgress(progress func(copied, total int64)) CopyOption {
+	return func(o *CopyOptions) {
+		o.Progress = progress
+	}
+}
+
+// WithStreamedCopy copies the content through the process, e.g. between accounts whose credentials cannot read each
+// other's buckets or S3 compatible services on different endpoints
+func WithStreamedCopy() CopyOption {
+	return func(o *CopyOptions) {
+		o.Streamed = true
+	}
+}
+
+// getCopyOptions applies the given options over the defaults
+func getCopyOptions(opts []CopyOption) CopyOptions {
+	var options CopyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// IBucketCopier is implemented by backends able to copy an object from another bucket of their provider into theirs
+// on the provider side
+type IBucketCopier interface {
+	// CopyObjectFrom copies the object at srcPath of src to dstPath, reporting false, without copying, when src is
+	// not a bucket of the same provider
+	CopyObjectFrom(ctx context.Context, src IStorageBackend, srcPath, dstPath string, options CopyOptions) (bool, *ae.AppError)
+}
+
+// CopyObjectTo copies the object at srcPath of src to dstPath of dst, e.g. between buckets, GCS projects or AWS
+// accounts, keeping its metadata, content headers, tags and storage class. The copy is encrypted with the defaults
+// of the destination bucket, as KMS keys belong to an account or location. Between S3 backends of one provider, and
+// between GCS backends, the provider copies the object with the credentials of dst, which need read access to the
+// source: S3 in parts above 5 GiB, GCS with rewrites that carry on across locations and storage classes. Other
+// pairs, decorators included, and copies WithStreamedCopy stream the content from src to dst with constant memory.
+func CopyObjectTo(ctx context.Context, src IStorageBackend, srcPath string, dst IStorageBackend, dstPath string, opts ...CopyOption) *ae.AppError {
+	options := getCopyOptions(opts)
+	if copier, ok := dst.(IBucketCopier); ok && !options.Streamed {
+		if copied, appErr := copier.CopyObjectFrom(ctx, src, srcPath, dstPath, options); copied {
+			return appErr
+		}
+	}
+	return streamCopy(ctx, src, srcPath, dst, dstPath, options)
+}
+
+// streamCopy copies the object at srcPath of src to dstPath of dst through the process, with its attributes
+func streamCopy(ctx context.Context, src IStorageBackend, srcPath string, dst IStorageBackend, dstPath string, options CopyOptions) *ae.AppError {
+	object, appErr := StatObject(ctx, src, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	putOpts, appErr := preservedPutOptions(ctx, src, srcPath, object, PreserveAll())
+	if appErr != nil {
+		return appErr
+	}
+	progress := &uploadProgress{total: object.Size, progress: options.Progress}
+	return pipeObject(ctx, src, srcPath, dst, dstPath, object.Size, putOpts, progress, io.Discard)
+}
+
+// pipeObject streams the size bytes of the object at srcPath of src to dstPath of dst, piping DownloadToWriter into
+// PutObjectStream, and writes the content uploaded to tee
+func pipeObject(ctx context.Context, src IStorageBackend, srcPath string, dst IStorageBackend, dstPath string, size int64, putOpts []PutOption, progress *uploadProgress, tee io.Writer) *ae.AppError {
+	pr, pw := io.Pipe()
+	downloaded := make(chan *ae.AppError, 1)
+	go func() {
+		appErr := DownloadToWriter(ctx, src, srcPath, pw)
+		pw.CloseWithError(AsError(appErr))
+		downloaded <- appErr
+	}()
+	body := &progressReader{r: io.TeeReader(pr, tee), progress: progress}
+	appErr := PutObjectStream(ctx, dst, dstPath, body, size, putOpts...)
+	pr.Close()
+	// a download failing on the closed pipe only reports the failure of the upload
+	if downloadErr := <-downloaded; downloadErr != nil && !errors.Is(downloadErr.GetErr(), io.ErrClosedPipe) {
+		return downloadErr
+	}
+	return appErr
+}
+
+// CopyObjectFrom copies an object from another Amazon S3 bucket of the same provider with a copy request to this
+// bucket, in parts above 5 GiB
+func (b *S3Backend) CopyObjectFrom(ctx context.Context, src IStorageBackend, srcPath, dstPath string, options CopyOptions) (bool, *ae.AppError) {
+	source, ok := src.(*S3Backend)
+	if !ok || source.Compat.Provider != b.Compat.Provider {
+		return false, nil
+	}
+	return true, b.copyFrom(ctx, source, srcPath, dstPath, false, options.Progress)
+}
+
+// copyFrom copies the object at srcPath of src to dstPath with its attributes, tags and storage class, and its
+// encryption when keepEncryption is set, in parts above 5 GiB. The copy fails when the object changes meanwhile.
+func (b *S3Backend) copyFrom(ctx context.Context, src *S3Backend, srcPath, dstPath string, keepEncryption bool, progress func(copied, total int64)) *ae.AppError {
+	current, appErr := src.StatObject(ctx, srcPath)
+	if appErr != nil {
+		return appErr.AddErrCode(S3CopyObject.Code)
+	}
+	opts := attributePutOptions(current, nil, PreserveAttributes{StorageClass: true})
+	if current.Size > s3MaxCopySize {
+		// copies in parts do not carry the attributes and tags over, the upload sets them
+		tags, appErr := src.GetObjectTags(ctx, srcPath)
+		if appErr != nil && appErr.GetHTTPCode() != http.StatusNotImplemented {
+			return appErr.AddErrCode(S3CopyObject.Code)
+		}
+		opts = attributePutOptions(current, tags, PreserveAll())
+	}
+	if keepEncryption && (current.Encryption.Type == EncryptionKMS || current.Encryption.Type == EncryptionProviderManaged) {
+		opts = append(opts, WithEncryption(current.Encryption))
+	}
+	upload, appErr := b.uploadInput(ctx, dstPath, nil, getPutOptions(opts))
+	if appErr != nil {
+		return appErr.AddErrCode(S3CopyObject.Code)
+	}
+	srcKey := objectKey(src.Prefix, srcPath)
+	var etag *string
+	if current.ETag != "" {
+		etag = aws.String(`"` + current.ETag + `"`)
+	}
+	if current.Size <= s3MaxCopySize {
+		// metadata, content headers and tags are copied by S3
+		_, err := b.Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:               upload.Bucket,
+			Key:                  upload.Key,
+			CopySource:           aws.String(url.PathEscape(src.Bucket + "/" + srcKey)),
+			CopySourceIfMatch:    etag,
+			StorageClass:         upload.StorageClass,
+			ServerSideEncryption: upload.ServerSideEncryption,
+			SSEKMSKeyId:          upload.SSEKMSKeyId,
+		})
+		if err != nil {
+			return s3CopyErr(ctx, err)
+		}
+		if progress != nil {
+			progress(current.Size, current.Size)
+		}
+		return nil
+	}
+
+	created, err := b.Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+	})
+	if err != nil {
+		return s3CopyErr(ctx, err)
+	}
+	uploadID := aws.StringValue(created.UploadId)
+	var partProgress func(copied int64)
+	if progress != nil {
+		partProgress = func(copied int64) {
+			progress(copied, current.Size)
+		}
+	}
+	if err := b.copyParts(ctx, src.Bucket, srcKey, aws.StringValue(upload.Key), uploadID, aws.StringValue(etag), current.Size, partProgress); err != nil {
+		_, _ = b.Client.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   upload.Bucket,
+			Key:      upload.Key,
+			UploadId: aws.String(uploadID),
+		})
+		return s3CopyErr(ctx, err)
+	}
+	return nil
+}
+
+// CopyObjectFrom copies an object from another Google Cloud Storage bucket with a rewrite to this bucket
+func (b GoogleCSBackend) CopyObjectFrom(ctx context.Context, src IStorageBackend, srcPath, dstPath string, options CopyOptions) (bool, *ae.AppError) {
+	var source GoogleCSBackend
+	switch s := src.(type) {
+	case GoogleCSBackend:
+		source = s
+	case *GoogleCSBackend:
+		source = *s
+	default:
+		return false, nil
+	}
+	return true, b.copyFrom(ctx, source, srcPath, dstPath, false, options.Progress)
+}
+
+// copyFrom copies the object at srcPath of src to dstPath with its storage class, and its KMS key when
+// keepEncryption is set. GCS copies metadata and content headers, and fails the copy when the object changes
+// meanwhile.
+func (b GoogleCSBackend) copyFrom(ctx context.Context, src GoogleCSBackend, srcPath, dstPath string, keepEncryption bool, progress func(copied, total int64)) *ae.AppError {
+	source := src.Client.Object(objectKey(src.Prefix, srcPath))
+	attrs, err := source.Attrs(ctx)
+	if err == nil {
+		copier := b.Client.Object(objectKey(b.Prefix, dstPath)).CopierFrom(source.If(storage.Conditions{GenerationMatch: attrs.Generation}))
+		copier.StorageClass = attrs.StorageClass
+		if keepEncryption {
+			// objects report the key version they were encrypted with, rewrites take the key itself
+			copier.DestinationKMSKeyName, _, _ = strings.Cut(attrs.KMSKeyName, "/cryptoKeyVersions/")
+		}
+		if progress != nil {
+			copier.ProgressFunc = func(copied, total uint64) {
+				progress(int64(copied), int64(total))
+			}
+		}
+		_, err = copier.Run(ctx)
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, GCSCopyObject, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsPreconditionFailed(err) {
+			appErr = appErr.SetHTTPCode(http.StatusPreconditionFailed)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// ICOSObjectClient interface for COS object operations - allows mocking in tests
+type ICOSObjectClient interface {
+	Get(ctx context.Context, name string, opt *cos.ObjectGetOptions, id ...string) (*cos.Response, error)
+	Put(ctx context.Context, name string, r io.Reader, opt *cos.ObjectPutOptions) (*cos.Response, error)
+	Head(ctx context.Context, name string, opt *cos.ObjectHeadOptions, id ...string) (*cos.Response, error)
+	Delete(ctx context.Context, name string) (*cos.Response, error)
+	Copy(ctx context.Context, name, sourceURL string, opt *cos.ObjectCopyOptions) (*cos.ObjectCopyResult, *cos.Response, error)
+}
+
+// ICOSBucketClient interface for COS bucket operations - allows mocking in tests
+type ICOSBucketClient interface {
+	Get(ctx context.Context, opt *cos.BucketGetOptions) (*cos.BucketGetResult, *cos.Response, error)
+}
+
+// COSBackend is a storage backend for Tencent Cloud Object Storage
+type COSBackend struct {
+	// Bucket is the full bucket name including the APPID suffix, e.g. examplebucket-1250000000
+	Bucket string
+	// BucketHost is the bucket domain used to build copy sources, e.g. examplebucket-1250000000.cos.ap-guangzhou.myqcloud.com
+	BucketHost   string
+	Prefix       string
+	ObjectClient ICOSObjectClient
+	BucketClient ICOSBucketClient
+}
+
+// NewCOSBackend creates a new instance of COSBackend using a permanent SecretId/SecretKey pair
+func NewCOSBackend(bucket string, prefix string, region string, secretID string, secretKey string) (*COSBackend, *ae.AppError) {
+	return NewCOSBackendWithSessionToken(bucket, prefix, region, secretID, secretKey, "")
+}
+
+// NewCOSBackendWithSessionToken creates a new instance of COSBackend using temporary STS credentials
+func NewCOSBackendWithSessionToken(bucket string, prefix string, region string, secretID string, secretKey string, sessionToken string) (*COSBackend, *ae.AppError) {
+	if bucket == "" || region == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("bucket and region are required"), COSBackendClient, http.StatusInternalServerError)
+	}
+	bucketURL := cos.NewBucketURL(bucket, region, true)
+	client := cos.NewClient(&cos.BaseURL{BucketURL: bucketURL}, &http.Client{
+		Transport: &cos.AuthorizationTransport{
+			SecretID:     secretID,
+			SecretKey:    secretKey,
+			SessionToken: sessionToken,
+		},
+	})
+	return &COSBackend{
+		Bucket:       bucket,
+		BucketHost:   bucketURL.Host,
+		Prefix:       cleanPrefix(prefix),
+		ObjectClient: client.Object,
+		BucketClient: client.Bucket,
+	}, nil
+}
+
+// Describe reports the bucket and prefix the backend is bound to
+func (b *COSBackend) Describe() map[string]string {
+	return map[string]string{
+		"bucket": b.Bucket,
+		"prefix": b.Prefix,
+	}
+}
+
+// GetObject retrieves an object from Tencent COS bucket, at prefix
+func (b *COSBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	var object Object
+	object.Path = path
+	if options.versioned() {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("versioned reads are not supported by cos"), COSGetObject, http.StatusNotImplemented)
+	}
+
+	getOptions := &cos.ObjectGetOptions{}
+	if options.Range != nil {
+		getOptions.Range = httpRangeHeader(*options.Range)
+	}
+	if options.IfNoneMatch != "" {
+		// the cos client sends no If-None-Match, the ETag is compared from a HEAD request
+		stat, appErr := b.StatObject(ctx, path)
+		if appErr != nil {
+			return object, appErr
+		}
+		if options.unchanged(stat) {
+			return object, notModifiedErr(ctx, path)
+		}
+	} else if !options.IfModifiedSince.IsZero() {
+		getOptions.IfModifiedSince = options.IfModifiedSince.UTC().Format(http.TimeFormat)
+	}
+	resp, err := b.ObjectClient.Get(ctx, objectKey(b.Prefix, path), getOptions)
+	if cosErr, ok := err.(*cos.ErrorResponse); ok && cosErr.Response != nil && cosErr.Response.StatusCode == http.StatusNotModified {
+		return object, notModifiedErr(ctx, path)
+	}
+	if err != nil {
+		return object, getCOSAppErr(ctx, err, COSGetObject)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return object, ae.GetAppErr(ctx, errors.Wrap(err, "failed to read from reader stream"), COSGetObject, http.StatusInternalServerError)
+	}
+	object.Content = content
+	object.Size = int64(len(content))
+	if total, ok := totalSizeFromContentRange(resp.Header.Get("Content-Range")); ok {
+		object.Size = total
+	}
+	setCOSObjectHeaders(&object, resp.Header)
+	return object, nil
+}
+
+// StatObject reads the attributes of the object at path with a HEAD request, without its content
+func (b *COSBackend) StatObject(ctx context.Context, path string) (Object, *ae.AppError) {
+	object := Object{Path: path}
+	resp, err := b.ObjectClient.Head(ctx, objectKey(b.Prefix, path), nil)
+	if err != nil {
+		return object, getCOSAppErr(ctx, err, COSGetObject)
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		object.Size = size
+	}
+	setCOSObjectHeaders(&object, resp.Header)
+	return object, nil
+}
+
+// GetObjects lists all objects in Tencent COS bucket, at prefix
+func (b *COSBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects in Tencent COS bucket at the given prefix, honouring MaxKeys and cursor options
+func (b *COSBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	fullPrefix := listPrefix(b.Prefix, prefix)
+	options.Cursor = options.startCursor(fullPrefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Versions != VersionsCurrent {
+		return result, ae.GetAppErr(ctx, fmt.Errorf("version listing is not supported by the cos client"), COSGetObjects, http.StatusNotImplemented)
+	}
+
+	listOptions := &cos.BucketGetOptions{
+		Prefix: fullPrefix,
+		Marker: options.Cursor,
+	}
+	for {
+		if options.MaxKeys > 0 {
+			listOptions.MaxKeys = options.MaxKeys - len(result.Objects)
+		}
+		page, _, err := b.BucketClient.Get(ctx, listOptions)
+		if err != nil {
+			result.interrupted(listOptions.Marker, options)
+			return result, getCOSAppErr(ctx, err, COSGetObjects)
+		}
+
+		for _, obj := range page.Contents {
+			result.Scanned++
+			lastModified, _ := time.Parse(time.RFC3339, obj.LastModified)
+			object := Object{
+				Path:         removePrefixFromObjectPath(fullPrefix, obj.Key),
+				Content:      []byte{},
+				LastModified: lastModified,
+				Size:         int64(obj.Size),
+				StorageClass: obj.StorageClass,
+				ETag:         unquoteETag(obj.ETag),
+			}
+			if options.matches(object) {
+				result.Objects = append(result.Objects, object)
+			}
+		}
+
+		if !page.IsTruncated {
+			break
+		}
+		nextMarker := page.NextMarker
+		if nextMarker == "" && len(page.Contents) > 0 {
+			nextMarker = page.Contents[len(page.Contents)-1].Key
+		}
+		if nextMarker == "" || options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = nextMarker
+			break
+		}
+		listOptions.Marker = nextMarker
+	}
+	if options.Hydrate > 0 {
+		var appErr *ae.AppError
+		result.Objects, appErr = hydrateObjects(ctx, b, prefix, result.Objects, options.Hydrate)
+		return result, appErr
+	}
+	return result, nil
+}
+
+// PutObject uploads an object to Tencent COS bucket, at prefix
+func (b *COSBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	options := getPutOptions(opts)
+	if len(options.Tags) > 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("object tags are not supported by the cos client"), COSPutObject, http.StatusNotImplemented)
+	}
+	if options.ContentLanguage != "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("content language is not supported by cos"), COSPutObject, http.StatusNotImplemented)
+	}
+	if key, ok := options.invalidHeaderMetadataKey(); ok {
+		return ae.GetAppErr(ctx, fmt.Errorf("invalid metadata key %q", key), COSPutObject, http.StatusBadRequest)
+	}
+	headerOptions := &cos.ObjectPutHeaderOptions{
+		ContentLength:      len(content),
+		ContentType:        options.ContentType,
+		CacheControl:       options.CacheControl,
+		ContentEncoding:    options.ContentEncoding,
+		ContentDisposition: options.ContentDisposition,
+		XCosStorageClass:   options.StorageClass,
+	}
+	if len(options.Metadata) > 0 {
+		metadata := http.Header{}
+		for key, value := range options.Metadata {
+			metadata.Set("x-cos-meta-"+key, value)
+		}
+		headerOptions.XCosMetaXXX = &metadata
+	}
+	if options.Encryption != nil {
+		switch options.Encryption.Type {
+		case EncryptionProviderManaged:
+			headerOptions.XCosServerSideEncryption = "AES256"
+		case EncryptionNone:
+		default:
+			return ae.GetAppErr(ctx, fmt.Errorf("unsupported encryption type %q", options.Encryption.Type), COSPutObject, http.StatusNotImplemented)
+		}
+	}
+
+	_, err := b.ObjectClient.Put(ctx, objectKey(b.Prefix, path), bytes.NewReader(content), &cos.ObjectPutOptions{
+		ObjectPutHeaderOptions: headerOptions,
+	})
+	if err != nil {
+		return getCOSAppErr(ctx, err, COSPutObject)
+	}
+	return nil
+}
+
+// DeleteObject removes an object from Tencent COS bucket, at prefix
+func (b *COSBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	_, err := b.ObjectClient.Delete(ctx, objectKey(b.Prefix, path))
+	if err != nil {
+		return getCOSAppErr(ctx, err, COSDeleteObject)
+	}
+	return nil
+}
+
+// CopyObject copies an object within Tencent COS bucket. Metadata and content headers are copied by COS, the
+// storage class is read from the source as COS would otherwise write the copy as STANDARD.
+func (b *COSBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	sourceURL := b.BucketHost + "/" + objectKey(b.Prefix, srcPath)
+	head, err := b.ObjectClient.Head(ctx, objectKey(b.Prefix, srcPath), nil)
+	if err == nil {
+		_, _, err = b.ObjectClient.Copy(ctx, objectKey(b.Prefix, dstPath), sourceURL, &cos.ObjectCopyOptions{
+			ObjectCopyHeaderOptions: &cos.ObjectCopyHeaderOptions{
+				XCosStorageClass: head.Header.Get("x-cos-storage-class"),
+			},
+		})
+	}
+	if err != nil {
+		return getCOSAppErr(ctx, err, COSCopyObject)
+	}
+	return nil
+}
+
+// setCOSObjectHeaders sets the attributes of object reported by the headers of a GET or HEAD response
+func setCOSObjectHeaders(object *Object, header http.Header) {
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		object.LastModified = lastModified
+	}
+	if header.Get("x-cos-server-side-encryption") != "" {
+		object.Encryption = Encryption{Type: EncryptionProviderManaged}
+	}
+	object.ContentType = header.Get("Content-Type")
+	object.CacheControl = header.Get("Cache-Control")
+	object.ContentEncoding = header.Get("Content-Encoding")
+	object.ContentDisposition = header.Get("Content-Disposition")
+	object.StorageClass = header.Get("x-cos-storage-class")
+	object.ETag = unquoteETag(header.Get("ETag"))
+	for name, values := range header {
+		if key, ok := strings.CutPrefix(strings.ToLower(name), "x-cos-meta-"); ok && len(values) > 0 {
+			if object.Meta.User == nil {
+				object.Meta.User = map[string]string{}
+			}
+			object.Meta.User[key] = values[0]
+		}
+	}
+}
+
+// getCOSAppErr converts a COS SDK error into an AppError, keeping not found and invalid range status codes and
+// the retry hint of throttling
+func getCOSAppErr(ctx context.Context, err error, customErr *ae.CustomErr) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, customErr, http.StatusInternalServerError)
+	if cosErr, ok := err.(*cos.ErrorResponse); ok && cosErr.Response != nil {
+		switch cosErr.Response.StatusCode {
+		case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+			appErr = appErr.SetHTTPCode(cosErr.Response.StatusCode)
+		case http.StatusTooManyRequests:
+			retryAfter, ok := parseRetryAfter(cosErr.Response.Header.Get("Retry-After"), time.Now())
+			if !ok {
+				retryAfter = defaultThrottleRetryAfter
+			}
+			appErr = throttled(appErr, retryAfter)
+		}
+	}
+	return appErr
+}
@@ -0,0 +1,184 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// costEstimatePageSize is the listing page size of EstimateTransfer, the page size of S3 and GCS listings
+const costEstimatePageSize = 1000
+
+// bytesPerGB is the unit egress is billed in
+const bytesPerGB = 1 << 30
+
+// TransferKind is the kind of bulk operation a TransferPlan describes
+type TransferKind int
+
+const (
+	// TransferCopy reads every object from the source and writes it to the destination, as a sync or migration does
+	TransferCopy TransferKind = iota
+	// TransferMove is TransferCopy deleting every object from the source once copied
+	TransferMove
+	// TransferArchive copies every object onto itself within the source, e.g. to move it to a colder storage class,
+	// without the content leaving the provider
+	TransferArchive
+)
+
+// String returns the name of the kind
+func (k TransferKind) String() string {
+	switch k {
+	case TransferMove:
+		return "move"
+	case TransferArchive:
+		return "archive"
+	}
+	return "copy"
+}
+
+// ProviderPricing are the approximate list prices of a provider in USD. Requests are billed per thousand, writes
+// covering PUT, COPY and LIST requests and reads GET and HEAD requests, and deletes are free.
+type ProviderPricing struct {
+	EgressPerGB  float64
+	WritePer1000 float64
+	ReadPer1000  float64
+}
+
+// DefaultProviderPricing are the public list prices of standard storage at the time of writing, by provider name
+// as reported by TransferEstimate. They ignore free tiers, volume discounts and regional differences, so use them
+// for orders of magnitude only and pass negotiated prices where known. Providers not listed are estimated free.
+var DefaultProviderPricing = map[string]ProviderPricing{
+	"s3":     {EgressPerGB: 0.09, WritePer1000: 0.005, ReadPer1000: 0.0004},
+	"gcs":    {EgressPerGB: 0.12, WritePer1000: 0.005, ReadPer1000: 0.0004},
+	"cos":    {EgressPerGB: 0.12, WritePer1000: 0.0002, ReadPer1000: 0.0002},
+	"r2":     {EgressPerGB: 0, WritePer1000: 0.0045, ReadPer1000: 0.00036},
+	"spaces": {EgressPerGB: 0.01},
+	"wasabi": {},
+	"storj":  {EgressPerGB: 0.007},
+}
+
+// TransferPlan describes a bulk operation over the objects at Prefix of Source
+type TransferPlan struct {
+	Kind   TransferKind
+	Source IStorageBackend
+	Prefix string
+	// Destination receives the objects of TransferCopy and TransferMove, it is ignored by TransferArchive
+	Destination IStorageBackend
+	// Pricing are the prices by provider name, DefaultProviderPricing when nil
+	Pricing map[string]ProviderPricing
+}
+
+// TransferEstimate is the approximate cost of a TransferPlan
+type TransferEstimate struct {
+	Kind                TransferKind
+	SourceProvider      string
+	DestinationProvider string
+	Objects             int
+	Bytes               int64
+	// ListRequests, ReadRequests and WriteRequests are the requests the operation makes, listing included
+	ListRequests  int
+	ReadRequests  int
+	WriteRequests int
+	// EgressBytes is the content leaving the source provider
+	EgressBytes int64
+	EgressCost  float64
+	RequestCost float64
+}
+
+// TotalCost is the estimated cost of the whole operation in USD
+func (e TransferEstimate) TotalCost() float64 {
+	return e.EgressCost + e.RequestCost
+}
+
+// String summarizes the estimate on one line, e.g. for a confirmation prompt
+func (e TransferEstimate) String() string {
+	route := e.SourceProvider
+	if e.DestinationProvider != "" {
+		route += " -> " + e.DestinationProvider
+	}
+	return fmt.Sprintf("%s %s: %d objects, %d bytes, %d requests, egress $%.2f, requests $%.2f, total $%.2f",
+		e.Kind, route, e.Objects, e.Bytes, e.ListRequests+e.ReadRequests+e.WriteRequests, e.EgressCost, e.RequestCost, e.TotalCost())
+}
+
+// EstimateTransfer lists the objects a plan would transfer and estimates the requests it makes and their cost
+// before it is run, so that tools can ask for confirmation of expensive operations. Content only counts as egress
+// when it moves between providers, transfers within a provider are assumed to stay in one region. Multipart
+// uploads of large objects and retries are not accounted for.
+func EstimateTransfer(ctx context.Context, plan TransferPlan) (TransferEstimate, *ae.AppError) {
+	estimate := TransferEstimate{
+		Kind:           plan.Kind,
+		SourceProvider: providerName(plan.Source),
+	}
+	if plan.Kind != TransferArchive {
+		if plan.Destination == nil {
+			return estimate, ae.GetAppErr(ctx, fmt.Errorf("a %s plan needs a destination", plan.Kind), CostEstimate, http.StatusBadRequest)
+		}
+		estimate.DestinationProvider = providerName(plan.Destination)
+	}
+	pricing := plan.Pricing
+	if pricing == nil {
+		pricing = DefaultProviderPricing
+	}
+
+	cursor := ""
+	for {
+		page, appErr := plan.Source.ListObjects(ctx, plan.Prefix, WithMaxKeys(costEstimatePageSize), WithCursor(cursor))
+		if appErr != nil {
+			return estimate, appErr.AddErrCode(CostEstimate.Code)
+		}
+		estimate.ListRequests++
+		for _, object := range page.Objects {
+			estimate.Objects++
+			estimate.Bytes += object.Size
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	source := pricing[estimate.SourceProvider]
+	listCost := float64(estimate.ListRequests) * source.WritePer1000 / 1000
+	if plan.Kind == TransferArchive {
+		// a server side copy is a single write request to the source
+		estimate.WriteRequests = estimate.Objects
+		estimate.RequestCost = listCost + float64(estimate.WriteRequests)*source.WritePer1000/1000
+		return estimate, nil
+	}
+	destination := pricing[estimate.DestinationProvider]
+	estimate.ReadRequests = estimate.Objects
+	estimate.WriteRequests = estimate.Objects
+	estimate.RequestCost = listCost + float64(estimate.ReadRequests)*source.ReadPer1000/1000 +
+		float64(estimate.WriteRequests)*destination.WritePer1000/1000
+	if estimate.SourceProvider != estimate.DestinationProvider {
+		estimate.EgressBytes = estimate.Bytes
+		estimate.EgressCost = float64(estimate.EgressBytes) / bytesPerGB * source.EgressPerGB
+	}
+	return estimate, nil
+}
+
+// providerName returns the provider of the storage backend below the decorators of backend: the provider of S3
+// compatible services, such as r2 or wasabi, and otherwise s3, gcs, cos, hdfs or redis
+func providerName(backend IStorageBackend) string {
+	chain := DescribeBackend(backend)
+	storage := chain[len(chain)-1]
+	if provider := storage.Config["provider"]; provider != "" {
+		return provider
+	}
+	switch storage.Type {
+	case "S3Backend":
+		return "s3"
+	case "GoogleCSBackend":
+		return "gcs"
+	case "COSBackend":
+		return "cos"
+	case "HDFSBackend":
+		return "hdfs"
+	case "RedisBackend":
+		return "redis"
+	}
+	return strings.ToLower(storage.Type)
+}
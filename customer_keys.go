@@ -0,0 +1,232 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// customerKeySize is the size of the AES-256 keys of S3 SSE-C and GCS customer-supplied encryption
+const customerKeySize = 32
+
+// WithCustomerKey encrypts the object with key, a 256-bit AES key the provider uses for the request and discards
+// (S3 SSE-C, GCS customer-supplied encryption keys). Reading the object needs the key again, see
+// WithDecryptionKey, so losing the key loses the object. Caches never keep objects written or read with a key.
+func WithCustomerKey(key []byte) PutOption {
+	return WithEncryption(Encryption{Type: EncryptionCustomerKey, CustomerKey: key})
+}
+
+// WithDecryptionKey reads an object encrypted with the customer supplied key key, bypassing caches. Reading such an
+// object without its key fails with 400 Bad Request, with a wrong key with 403 Forbidden on S3.
+func WithDecryptionKey(key []byte) GetOption {
+	return func(o *GetOptions) {
+		o.CustomerKey = key
+	}
+}
+
+// customerKeyed reports whether the options encrypt the object with a customer supplied key
+func (o PutOptions) customerKeyed() bool {
+	return o.Encryption != nil && o.Encryption.Type == EncryptionCustomerKey
+}
+
+// validateCustomerKey checks that key is a 256-bit key
+func validateCustomerKey(ctx context.Context, key []byte) *ae.AppError {
+	if len(key) != customerKeySize {
+		return ae.GetAppErr(ctx, fmt.Errorf("customer keys are %d bytes, got %d", customerKeySize, len(key)), CustomerKeyInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// customerKeySHA256 returns the base64 SHA-256 of key, the fingerprint GCS reports for objects encrypted with it
+func customerKeySHA256(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// copyEncryption returns the encryption of a copy: encryption when given, otherwise the encryption of the source,
+// decrypted with sourceKey
+func copyEncryption(source Encryption, sourceKey []byte, encryption Encryption) Encryption {
+	if encryption.Type != EncryptionNone {
+		return encryption
+	}
+	if source.Type == EncryptionCustomerKey {
+		return Encryption{Type: EncryptionCustomerKey, CustomerKey: sourceKey}
+	}
+	return source
+}
+
+// IEncryptedCopier is implemented by backends able to copy objects between encryption settings on the provider side
+type IEncryptedCopier interface {
+	CopyObjectEncrypted(ctx context.Context, srcPath, dstPath string, sourceKey []byte, encryption Encryption) *ae.AppError
+}
+
+// CopyObjectEncrypted copies the object at srcPath of backend to dstPath, decrypting the source with sourceKey when
+// it is encrypted with a customer supplied key and encrypting the copy as encryption says, e.g. to rotate a customer
+// key or move an object to the KMS key of another tenant. A zero encryption keeps the encryption of the source.
+// S3 and GCS, implementing IEncryptedCopier, copy on the provider side; other backends, and decorators, get the
+// object read and written back with its attributes.
+func CopyObjectEncrypted(ctx context.Context, backend IStorageBackend, srcPath, dstPath string, sourceKey []byte, encryption Encryption) *ae.AppError {
+	if sourceKey != nil {
+		if appErr := validateCustomerKey(ctx, sourceKey); appErr != nil {
+			return appErr
+		}
+	}
+	if encryption.Type == EncryptionCustomerKey {
+		if appErr := validateCustomerKey(ctx, encryption.CustomerKey); appErr != nil {
+			return appErr
+		}
+	}
+	if copier, ok := backend.(IEncryptedCopier); ok {
+		return copier.CopyObjectEncrypted(ctx, srcPath, dstPath, sourceKey, encryption)
+	}
+	var getOpts []GetOption
+	if sourceKey != nil {
+		getOpts = append(getOpts, WithDecryptionKey(sourceKey))
+	}
+	object, appErr := backend.GetObject(ctx, srcPath, getOpts...)
+	if appErr != nil {
+		return appErr
+	}
+	opts, appErr := preservedPutOptions(ctx, backend, srcPath, object, PreserveAll())
+	if appErr != nil {
+		return appErr
+	}
+	if dst := copyEncryption(object.Encryption, sourceKey, encryption); dst.Type != EncryptionNone {
+		opts = append(opts, WithEncryption(dst))
+	}
+	return backend.PutObject(ctx, dstPath, object.Content, opts...)
+}
+
+// CopyObjectEncrypted copies an object in Amazon S3 bucket, decrypting it with sourceKey and encrypting the copy
+// with encryption
+func (b *S3Backend) CopyObjectEncrypted(ctx context.Context, srcPath, dstPath string, sourceKey []byte, encryption Encryption) *ae.AppError {
+	srcKey := objectKey(b.Prefix, srcPath)
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(srcKey),
+	}
+	copyObjectInput := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.Bucket),
+		CopySource: aws.String(url.PathEscape(b.Bucket + "/" + srcKey)),
+		Key:        aws.String(objectKey(b.Prefix, dstPath)),
+	}
+	if sourceKey != nil {
+		headInput.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		headInput.SSECustomerKey = aws.String(string(sourceKey))
+		copyObjectInput.CopySourceSSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		copyObjectInput.CopySourceSSECustomerKey = aws.String(string(sourceKey))
+	}
+	head, err := b.Client.HeadObjectWithContext(ctx, headInput)
+	if err != nil {
+		return s3CopyErr(ctx, err)
+	}
+	copyObjectInput.StorageClass = head.StorageClass
+	source := s3Encryption(head.ServerSideEncryption, head.SSEKMSKeyId)
+	if head.SSECustomerAlgorithm != nil {
+		source = Encryption{Type: EncryptionCustomerKey}
+	}
+	switch dst := copyEncryption(source, sourceKey, encryption); dst.Type {
+	case EncryptionKMS:
+		if b.Compat.NoKMSEncryption {
+			return ae.GetAppErr(ctx, fmt.Errorf("kms encryption is not supported by %s", b.Compat.Provider), S3CopyObject, http.StatusNotImplemented)
+		}
+		copyObjectInput.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		copyObjectInput.SSEKMSKeyId = aws.String(dst.KMSKeyID)
+	case EncryptionProviderManaged:
+		copyObjectInput.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case EncryptionCustomerKey:
+		copyObjectInput.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		copyObjectInput.SSECustomerKey = aws.String(string(dst.CustomerKey))
+	}
+	if _, err := b.Client.CopyObjectWithContext(ctx, copyObjectInput); err != nil {
+		return s3CopyErr(ctx, err)
+	}
+	return nil
+}
+
+// s3CopyErr maps an S3 error of a copy
+func s3CopyErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, S3CopyObject, http.StatusInternalServerError)
+	if isS3NotFoundError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if isS3PreconditionError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusPreconditionFailed)
+	} else if status, ok := s3CustomerKeyStatus(err); ok {
+		appErr = appErr.SetHTTPCode(status)
+	} else if isS3NotImplementedError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	} else if isS3ThrottlingError(err) {
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// s3CustomerKeyStatus returns the status of S3 refusing a request for a missing customer key, 400, or a wrong one,
+// 403
+func s3CustomerKeyStatus(err error) (int, bool) {
+	switch {
+	case contains(err.Error(), "InvalidRequest"), contains(err.Error(), "BadRequest"):
+		return http.StatusBadRequest, true
+	case contains(err.Error(), "AccessDenied"), contains(err.Error(), "Forbidden"):
+		return http.StatusForbidden, true
+	}
+	return 0, false
+}
+
+// CopyObjectEncrypted copies an object in Google Cloud Storage bucket, decrypting it with sourceKey and encrypting
+// the copy with encryption
+func (b GoogleCSBackend) CopyObjectEncrypted(ctx context.Context, srcPath, dstPath string, sourceKey []byte, encryption Encryption) *ae.AppError {
+	src := b.Client.Object(objectKey(b.Prefix, srcPath))
+	dst := b.Client.Object(objectKey(b.Prefix, dstPath))
+	if sourceKey != nil {
+		src = src.Key(sourceKey)
+	}
+	attrs, err := src.Attrs(ctx)
+	if err == nil {
+		var copier *storage.Copier
+		switch encryption := copyEncryption(gcsEncryption(attrs), sourceKey, encryption); encryption.Type {
+		case EncryptionCustomerKey:
+			copier = dst.Key(encryption.CustomerKey).CopierFrom(src)
+		case EncryptionKMS:
+			copier = dst.CopierFrom(src)
+			// objects report the key version they were encrypted with, rewrites take the key itself
+			copier.DestinationKMSKeyName, _, _ = strings.Cut(encryption.KMSKeyID, "/cryptoKeyVersions/")
+		default:
+			copier = dst.CopierFrom(src)
+		}
+		copier.StorageClass = attrs.StorageClass
+		_, err = copier.Run(ctx)
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, GCSCopyObject, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if status, ok := gcsCustomerKeyStatus(err); ok {
+			appErr = appErr.SetHTTPCode(status)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
+
+// gcsCustomerKeyStatus returns 400 for GCS refusing a request for a missing or wrong customer key
+func gcsCustomerKeyStatus(err error) (int, bool) {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Message), "encryption key") {
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// readResult is the outcome of a read shared by a DedupGetBackend
+type readResult struct {
+	object Object
+	appErr *ae.AppError
+}
+
+// DedupGetBackend is an IStorageBackend decorator collapsing concurrent GetObject calls reading the same path with
+// the same range into one provider request, e.g. fan-out workers fetching the same manifest at once. Every caller
+// gets the result of the shared read, with its own copy of the content. The read is not cancelled when the caller
+// that started it gives up, a caller whose context is done stops waiting and gets an error while the read goes on
+// for the others. Reads are only shared while in flight, nothing is cached.
+type DedupGetBackend struct {
+	Backend IStorageBackend
+
+	reads        singleflight.Group
+	deduplicated atomic.Int64
+}
+
+// NewDedupGetBackend creates a new instance of DedupGetBackend
+func NewDedupGetBackend(backend IStorageBackend) *DedupGetBackend {
+	return &DedupGetBackend{Backend: backend}
+}
+
+// Unwrap returns the deduplicated backend
+func (b *DedupGetBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations other than reads run on the wrapped backend
+func (b *DedupGetBackend) transparent() {}
+
+// Deduplicated returns the number of GetObject calls served by a read started by another call
+func (b *DedupGetBackend) Deduplicated() int64 {
+	return b.deduplicated.Load()
+}
+
+// GetObject retrieves an object, joining a read of the same path and range already in flight
+func (b *DedupGetBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	key := NormalizePath(path) + "\x00" + describeGetOptions(opts)
+	readCtx := context.WithoutCancel(ctx)
+	started := false
+	results := b.reads.DoChan(key, func() (interface{}, error) {
+		started = true
+		object, appErr := b.Backend.GetObject(readCtx, path, opts...)
+		return readResult{object: object, appErr: appErr}, nil
+	})
+	select {
+	case <-ctx.Done():
+		return Object{Path: path}, ae.GetAppErr(ctx, errors.Wrapf(ctx.Err(), "waiting for the read of %s", path), DedupGetWait, http.StatusRequestTimeout)
+	case result := <-results:
+		read := result.Val.(readResult)
+		if !started {
+			b.deduplicated.Add(1)
+		}
+		if result.Shared {
+			// callers may modify their content
+			read.object.Content = bytes.Clone(read.object.Content)
+		}
+		return read.object, read.appErr
+	}
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *DedupGetBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *DedupGetBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object
+func (b *DedupGetBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object
+func (b *DedupGetBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object
+func (b *DedupGetBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
@@ -0,0 +1,126 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// DedupPutBackend is an IStorageBackend decorator sharing one upload between concurrent PutObject calls writing
+// identical content with identical options to the same path, e.g. the duplicates of a retry storm in an upstream
+// service. Every caller gets the result of the shared upload. The upload is not cancelled when the caller that
+// started it gives up, a caller whose context is done stops waiting and gets an error while the upload goes on for
+// the others. Calls writing different content or options to a path are not merged.
+type DedupPutBackend struct {
+	Backend IStorageBackend
+	// Hasher digests the content identifying identical uploads, HashSHA256 by default
+	Hasher IHasher
+
+	puts         singleflight.Group
+	deduplicated atomic.Int64
+}
+
+// DedupPutOption configures a DedupPutBackend
+type DedupPutOption func(*DedupPutBackend)
+
+// WithDedupHasher digests the content of uploads with hasher, e.g. HashXXH3 to hash large content faster
+func WithDedupHasher(hasher IHasher) DedupPutOption {
+	return func(b *DedupPutBackend) {
+		b.Hasher = hasher
+	}
+}
+
+// NewDedupPutBackend creates a new instance of DedupPutBackend
+func NewDedupPutBackend(backend IStorageBackend, opts ...DedupPutOption) *DedupPutBackend {
+	b := &DedupPutBackend{
+		Backend: backend,
+		Hasher:  HashSHA256,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the deduplicated backend
+func (b *DedupPutBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations other than uploads run on the wrapped backend
+func (b *DedupPutBackend) transparent() {}
+
+// Describe reports the hasher
+func (b *DedupPutBackend) Describe() map[string]string {
+	return map[string]string{
+		"hasher": b.Hasher.Name(),
+	}
+}
+
+// Deduplicated returns the number of PutObject calls served by an upload started by another call
+func (b *DedupPutBackend) Deduplicated() int64 {
+	return b.deduplicated.Load()
+}
+
+// GetObject retrieves an object
+func (b *DedupPutBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *DedupPutBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *DedupPutBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object, joining an upload of the same content and options to path already in flight
+func (b *DedupPutBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	key, err := dedupPutKey(b.Hasher, path, content, getPutOptions(opts))
+	if err != nil {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	}
+	uploadCtx := context.WithoutCancel(ctx)
+	started := false
+	results := b.puts.DoChan(key, func() (interface{}, error) {
+		started = true
+		return b.Backend.PutObject(uploadCtx, path, content, opts...), nil
+	})
+	select {
+	case <-ctx.Done():
+		return ae.GetAppErr(ctx, errors.Wrapf(ctx.Err(), "waiting for the upload of %s", path), DedupPutWait, http.StatusRequestTimeout)
+	case result := <-results:
+		if !started {
+			b.deduplicated.Add(1)
+		}
+		appErr, _ := result.Val.(*ae.AppError)
+		return appErr
+	}
+}
+
+// DeleteObject removes an object
+func (b *DedupPutBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object
+func (b *DedupPutBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// dedupPutKey identifies the uploads that can be shared: same path, content checksum and options
+func dedupPutKey(hasher IHasher, path string, content []byte, options PutOptions) (string, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	return path + "\x00" + digest(hasher, content) + "\x00" + string(encoded), nil
+}
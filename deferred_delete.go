@@ -0,0 +1,339 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultReapBatchSize = 100
+	defaultReapRate      = 50
+	defaultReapInterval  = 10 * time.Second
+)
+
+// ReapErrorFunc is called with the path and error of an object the reaper failed to delete, path is empty when the
+// tombstones could not be listed
+type ReapErrorFunc func(ctx context.Context, path string, appErr *ae.AppError)
+
+// DeferredDeleteOption configures a DeferredDeleteBackend
+type DeferredDeleteOption func(*DeferredDeleteBackend)
+
+// WithReapBatchSize sets the number of tombstones listed and reaped per batch
+func WithReapBatchSize(size int) DeferredDeleteOption {
+	return func(b *DeferredDeleteBackend) {
+		b.BatchSize = size
+	}
+}
+
+// WithReapRate sets the number of objects reaped per second
+func WithReapRate(objectsPerSecond float64) DeferredDeleteOption {
+	return func(b *DeferredDeleteBackend) {
+		b.ReapRate = objectsPerSecond
+	}
+}
+
+// WithReapInterval sets how often the reaper looks for tombstones once it emptied the queue
+func WithReapInterval(interval time.Duration) DeferredDeleteOption {
+	return func(b *DeferredDeleteBackend) {
+		b.ReapInterval = interval
+	}
+}
+
+// WithReapErrorHandler sets the function called for every object the reaper failed to delete
+func WithReapErrorHandler(onError ReapErrorFunc) DeferredDeleteOption {
+	return func(b *DeferredDeleteBackend) {
+		b.OnReapError = onError
+	}
+}
+
+// DeferredDeleteBackend is an IStorageBackend decorator deferring deletes, smoothing the delete storms of e.g.
+// tenant offboarding that would trip provider rate limits. DeleteObject only writes an empty tombstone object under
+// TombstonePrefix and hides the object, a reaper started with Start deletes tombstoned objects in batches of
+// BatchSize at ReapRate objects per second, with the PriorityBatch priority so that it yields to other traffic
+// sharing a RateBudget. Tombstones outlive restarts, but only the process holding a tombstone hides its object until
+// it is reaped. Writing or copying to a tombstoned path cancels its delete. Create it with NewDeferredDeleteBackend.
+type DeferredDeleteBackend struct {
+	Backend IStorageBackend
+	// TombstonePrefix holds one tombstone per pending delete, named after the path of the deleted object
+	TombstonePrefix string
+	BatchSize       int
+	ReapRate        float64
+	ReapInterval    time.Duration
+	// OnReapError, when set, is called for every object the reaper failed to delete, e.g. to log it. The tombstone is
+	// kept and the delete retried in the next pass.
+	OnReapError ReapErrorFunc
+
+	mu      sync.Mutex
+	pending map[string]bool
+	// cursor is where the next batch resumes listing tombstones, so that failing deletes do not block later ones
+	cursor  string
+	limiter *rate.Limiter
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewDeferredDeleteBackend creates a new instance of DeferredDeleteBackend keeping tombstones under tombstonePrefix
+// of backend, a prefix that must not hold other objects. The tombstones left by a previous run are loaded, so their
+// objects stay hidden.
+func NewDeferredDeleteBackend(ctx context.Context, backend IStorageBackend, tombstonePrefix string, opts ...DeferredDeleteOption) (*DeferredDeleteBackend, *ae.AppError) {
+	b := &DeferredDeleteBackend{
+		Backend:         backend,
+		TombstonePrefix: cleanPrefix(tombstonePrefix),
+		BatchSize:       defaultReapBatchSize,
+		ReapRate:        defaultReapRate,
+		ReapInterval:    defaultReapInterval,
+		pending:         map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.TombstonePrefix == "" {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("a tombstone prefix is required"), DeferredDeleteConfig, http.StatusInternalServerError)
+	}
+	if b.BatchSize <= 0 || b.ReapRate <= 0 || b.ReapInterval <= 0 {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("batch size, reap rate and reap interval must be positive"), DeferredDeleteConfig, http.StatusInternalServerError)
+	}
+	b.limiter = rate.NewLimiter(rate.Limit(b.ReapRate), max(1, int(b.ReapRate)))
+	cursor := ""
+	for {
+		page, appErr := backend.ListObjects(ctx, b.TombstonePrefix, WithMaxKeys(b.BatchSize), WithCursor(cursor))
+		if appErr != nil {
+			return nil, appErr.AddErrCode(DeferredDeleteTombstone.Code)
+		}
+		for _, tombstone := range page.Objects {
+			b.pending[NormalizePath(tombstone.Path)] = true
+		}
+		if !page.Truncated {
+			return b, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Start reaps tombstoned objects until ctx is done or Stop is called, checking for new tombstones every
+// ReapInterval once the queue is empty
+func (b *DeferredDeleteBackend) Start(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return
+	}
+	ctx, b.cancel = context.WithCancel(WithPriority(ctx, PriorityBatch))
+	b.wg.Add(1)
+	go b.reapLoop(ctx)
+}
+
+// Stop stops the reaper, pending deletes stay queued
+func (b *DeferredDeleteBackend) Stop() {
+	b.mu.Lock()
+	cancel := b.cancel
+	b.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	b.wg.Wait()
+}
+
+// Pending returns the number of deletes waiting for the reaper
+func (b *DeferredDeleteBackend) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Reap deletes the objects of the next batch of tombstones, and their tombstones, at ReapRate and returns the
+// number of objects deleted and whether more tombstones follow the batch. Failed deletes are retried in the next
+// pass over the tombstones. It is called by the reaper and can be called directly, e.g. to drain the queue before
+// shutting down.
+func (b *DeferredDeleteBackend) Reap(ctx context.Context) (int, bool, *ae.AppError) {
+	b.mu.Lock()
+	cursor := b.cursor
+	b.mu.Unlock()
+	page, appErr := b.Backend.ListObjects(ctx, b.TombstonePrefix, WithMaxKeys(b.BatchSize), WithCursor(cursor))
+	if appErr != nil {
+		return 0, true, appErr.AddErrCode(DeferredDeleteTombstone.Code)
+	}
+	b.mu.Lock()
+	b.cursor = page.NextCursor
+	b.mu.Unlock()
+	reaped := 0
+	for _, tombstone := range page.Objects {
+		path := NormalizePath(tombstone.Path)
+		if err := b.limiter.Wait(ctx); err != nil {
+			return reaped, true, ae.GetAppErr(ctx, errors.Wrap(err, "waiting for the reap rate"), DeferredDeleteReap, http.StatusRequestTimeout)
+		}
+		if appErr := b.reap(ctx, path); appErr != nil {
+			if b.OnReapError != nil {
+				b.OnReapError(ctx, path, appErr)
+			}
+			continue
+		}
+		reaped++
+	}
+	return reaped, page.Truncated, nil
+}
+
+// Unwrap returns the backend holding the objects
+func (b *DeferredDeleteBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the tombstone prefix, the reap settings and the number of pending deletes
+func (b *DeferredDeleteBackend) Describe() map[string]string {
+	return map[string]string{
+		"tombstonePrefix": b.TombstonePrefix,
+		"batchSize":       strconv.Itoa(b.BatchSize),
+		"reapRate":        strconv.FormatFloat(b.ReapRate, 'f', -1, 64),
+		"pending":         strconv.Itoa(b.Pending()),
+	}
+}
+
+// GetObject retrieves an object, a tombstoned object is missing. Versioned reads go to the backend.
+func (b *DeferredDeleteBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	if !getGetOptions(opts).versioned() && b.isPending(path) {
+		return Object{}, b.deletedErr(ctx, path)
+	}
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix, leaving out tombstoned objects
+func (b *DeferredDeleteBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	return b.visible(prefix, objects), appErr
+}
+
+// ListObjects lists objects at the given prefix, leaving out tombstoned objects from listings of current versions.
+// Pages holding tombstoned objects are shorter than requested.
+func (b *DeferredDeleteBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	if getListOptions(opts).Versions == VersionsCurrent {
+		result.Objects = b.visible(prefix, result.Objects)
+	}
+	return result, appErr
+}
+
+// PutObject uploads an object, cancelling its pending delete
+func (b *DeferredDeleteBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.cancelDelete(ctx, path); appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject writes the tombstone of an object and hides it until the reaper deletes it. The object is not looked
+// up, so deleting a missing object only fails once it is tombstoned.
+func (b *DeferredDeleteBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if b.isPending(path) {
+		return b.deletedErr(ctx, path)
+	}
+	if appErr := b.Backend.PutObject(ctx, b.tombstonePath(path), []byte{}); appErr != nil {
+		return appErr.AddErrCode(DeferredDeleteTombstone.Code)
+	}
+	b.mu.Lock()
+	b.pending[NormalizePath(path)] = true
+	b.mu.Unlock()
+	return nil
+}
+
+// CopyObject copies an object, a tombstoned source is missing and the pending delete of the destination is
+// cancelled
+func (b *DeferredDeleteBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if b.isPending(srcPath) {
+		return b.deletedErr(ctx, srcPath)
+	}
+	if appErr := b.cancelDelete(ctx, dstPath); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// reapLoop reaps batches back to back while tombstones remain, then every ReapInterval, until ctx is done
+func (b *DeferredDeleteBackend) reapLoop(ctx context.Context) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.ReapInterval)
+	defer ticker.Stop()
+	for {
+		_, more, appErr := b.Reap(ctx)
+		if appErr != nil && ctx.Err() == nil && b.OnReapError != nil {
+			b.OnReapError(ctx, "", appErr)
+		}
+		if more && appErr == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap deletes a tombstoned object and then its tombstone, an object already missing counts as deleted
+func (b *DeferredDeleteBackend) reap(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.Backend.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(DeferredDeleteReap.Code)
+	}
+	if appErr := b.Backend.DeleteObject(ctx, b.tombstonePath(path)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(DeferredDeleteTombstone.Code)
+	}
+	b.mu.Lock()
+	delete(b.pending, path)
+	b.mu.Unlock()
+	return nil
+}
+
+// cancelDelete removes the tombstone of path, if any, before it is written again
+func (b *DeferredDeleteBackend) cancelDelete(ctx context.Context, path string) *ae.AppError {
+	if !b.isPending(path) {
+		return nil
+	}
+	if appErr := b.Backend.DeleteObject(ctx, b.tombstonePath(path)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(DeferredDeleteTombstone.Code)
+	}
+	b.mu.Lock()
+	delete(b.pending, NormalizePath(path))
+	b.mu.Unlock()
+	return nil
+}
+
+// visible leaves out the tombstoned objects and the tombstones of objects listed at prefix
+func (b *DeferredDeleteBackend) visible(prefix string, objects []Object) []Object {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := objects[:0]
+	for _, object := range objects {
+		path := objectKey(prefix, object.Path)
+		if b.pending[path] || strings.HasPrefix(path, b.TombstonePrefix+"/") {
+			continue
+		}
+		kept = append(kept, object)
+	}
+	return kept
+}
+
+// isPending reports whether path is tombstoned
+func (b *DeferredDeleteBackend) isPending(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending[NormalizePath(path)]
+}
+
+// tombstonePath returns the path of the tombstone of path
+func (b *DeferredDeleteBackend) tombstonePath(path string) string {
+	return pathutil.Join(b.TombstonePrefix, NormalizePath(path))
+}
+
+// deletedErr returns the error of an operation on a tombstoned object
+func (b *DeferredDeleteBackend) deletedErr(ctx context.Context, path string) *ae.AppError {
+	return ae.GetAppErr(ctx, fmt.Errorf("object %s is deleted", path), DeferredDeleteObjectDeleted, http.StatusNotFound)
+}
@@ -0,0 +1,366 @@
+package object_storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	diskCacheDataSuffix = ".data"
+	diskCacheMetaSuffix = ".meta"
+	diskCacheTempSuffix = ".tmp"
+)
+
+// diskCacheMeta is the sidecar file stored next to a cached object
+type diskCacheMeta struct {
+	// Object holds the attributes of the cached object, its content is in the data file
+	Object Object
+	// SHA256 is the hex SHA-256 of the data file, checked on every read
+	SHA256 string
+}
+
+// diskCacheEntry is a cached object tracked in the LRU
+type diskCacheEntry struct {
+	name string
+	size int64
+}
+
+// DiskCacheBackend is an IStorageBackend decorator keeping whole objects in a local directory, for large objects
+// that are read repeatedly. The directory is bounded by MaxBytes, evicting the least recently used objects, and
+// survives restarts. Every read verifies the content against the checksum recorded when it was cached; a corrupt
+// or unreadable file is dropped and the object read from the backend again. Writes made through this decorator
+// invalidate the cached object, writes made elsewhere are not seen until it is evicted or invalidated.
+type DiskCacheBackend struct {
+	Backend IStorageBackend
+	Dir     string
+	// MaxBytes bounds the size of the cached content, objects larger than MaxBytes are never cached
+	MaxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int64
+	// generation changes on every invalidation, so a read racing a write does not cache the old object
+	generation uint64
+	loads      singleflight.Group
+}
+
+// NewDiskCacheBackend creates a new instance of DiskCacheBackend caching up to maxBytes of objects in dir. Objects
+// cached in dir by a previous run are reused, least recently modified first to be evicted.
+func NewDiskCacheBackend(backend IStorageBackend, dir string, maxBytes int64) (*DiskCacheBackend, *ae.AppError) {
+	ctx := context.Background()
+	if dir == "" || maxBytes <= 0 {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("cache directory and a positive size are required"), DiskCacheConfig, http.StatusInternalServerError)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to create cache directory"), DiskCacheConfig, http.StatusInternalServerError)
+	}
+	b := &DiskCacheBackend{
+		Backend:  backend,
+		Dir:      dir,
+		MaxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+	if err := b.loadIndex(); err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to read cache directory"), DiskCacheConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the cached backend
+func (b *DiskCacheBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations the disk cache does not implement run on the wrapped backend
+func (b *DiskCacheBackend) transparent() {}
+
+// Describe reports the cache directory and size
+func (b *DiskCacheBackend) Describe() map[string]string {
+	return map[string]string{
+		"dir":      b.Dir,
+		"maxBytes": strconv.FormatInt(b.MaxBytes, 10),
+	}
+}
+
+// Invalidate drops path from the cache, e.g. when it was changed by another process
+func (b *DiskCacheBackend) Invalidate(path string) {
+	name := diskCacheName(path)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+	if element, ok := b.entries[name]; ok {
+		b.remove(element)
+	}
+}
+
+// GetObject retrieves an object from the disk cache, reading and caching it on a miss. Ranged reads are served
+// from a cached object but never populate the cache, versioned reads and reads with a customer key bypass it.
+func (b *DiskCacheBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	if options.uncached() {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+	if options.conditional() {
+		object, appErr := b.GetObject(ctx, path, withoutConditions(opts)...)
+		return options.checkConditions(ctx, object, appErr)
+	}
+	if object, ok := b.read(path); ok {
+		if options.Range == nil {
+			return object, nil
+		}
+		if ranged, ok := rangeObject(object, *options.Range); ok {
+			return ranged, nil
+		}
+	}
+	if options.Range != nil {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+
+	loaded, _, _ := b.loads.Do(path, func() (interface{}, error) {
+		generation := b.currentGeneration()
+		object, appErr := b.Backend.GetObject(ctx, path)
+		if appErr != nil {
+			return appErr, nil
+		}
+		b.write(path, object, generation)
+		return object, nil
+	})
+	if appErr, ok := loaded.(*ae.AppError); ok {
+		return Object{Path: path}, appErr
+	}
+	return cloneObject(loaded.(Object)), nil
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *DiskCacheBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *DiskCacheBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object and invalidates its cached copy
+func (b *DiskCacheBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	defer b.Invalidate(path)
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object and invalidates its cached copy
+func (b *DiskCacheBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	defer b.Invalidate(path)
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object and invalidates the cached copy of the destination
+func (b *DiskCacheBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	defer b.Invalidate(dstPath)
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// currentGeneration returns the invalidation generation
+func (b *DiskCacheBackend) currentGeneration() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.generation
+}
+
+// read returns the cached object at path after verifying its checksum, dropping it when it fails verification
+func (b *DiskCacheBackend) read(path string) (Object, bool) {
+	name := diskCacheName(path)
+	b.mu.Lock()
+	element, ok := b.entries[name]
+	if ok {
+		b.lru.MoveToFront(element)
+	}
+	b.mu.Unlock()
+	if !ok {
+		return Object{}, false
+	}
+
+	object, err := b.readFiles(name)
+	if err != nil || object.Path != path {
+		b.mu.Lock()
+		if element, ok := b.entries[name]; ok {
+			b.remove(element)
+		}
+		b.mu.Unlock()
+		return Object{}, false
+	}
+	return object, true
+}
+
+// readFiles reads and verifies the data and sidecar files of a cached object
+func (b *DiskCacheBackend) readFiles(name string) (Object, error) {
+	metaContent, err := os.ReadFile(filepath.Join(b.Dir, name+diskCacheMetaSuffix))
+	if err != nil {
+		return Object{}, err
+	}
+	var meta diskCacheMeta
+	if err := json.Unmarshal(metaContent, &meta); err != nil {
+		return Object{}, err
+	}
+	content, err := os.ReadFile(filepath.Join(b.Dir, name+diskCacheDataSuffix))
+	if err != nil {
+		return Object{}, err
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != meta.SHA256 {
+		return Object{}, fmt.Errorf("cached object %s is corrupt", meta.Object.Path)
+	}
+	object := meta.Object
+	object.Content = content
+	return object, nil
+}
+
+// write caches object read at generation, evicting the least recently used objects to stay within MaxBytes.
+// Failing to write the cache is not an error, the object is simply read from the backend next time.
+func (b *DiskCacheBackend) write(path string, object Object, generation uint64) {
+	size := int64(len(object.Content))
+	if size > b.MaxBytes {
+		return
+	}
+	name := diskCacheName(path)
+	sum := sha256.Sum256(object.Content)
+	meta := diskCacheMeta{Object: object, SHA256: hex.EncodeToString(sum[:])}
+	meta.Object.Content = nil
+	metaContent, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	// the files are written outside the lock and only renamed into place under it
+	dataTmp, err := b.writeTemp(object.Content)
+	if err != nil {
+		return
+	}
+	defer os.Remove(dataTmp)
+	metaTmp, err := b.writeTemp(metaContent)
+	if err != nil {
+		return
+	}
+	defer os.Remove(metaTmp)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if element, ok := b.entries[name]; ok {
+		b.remove(element)
+	}
+	for b.bytes+size > b.MaxBytes && b.lru.Len() > 0 {
+		b.remove(b.lru.Back())
+	}
+	// the data file is renamed into place before its sidecar, so a sidecar always describes a complete file
+	if os.Rename(dataTmp, filepath.Join(b.Dir, name+diskCacheDataSuffix)) != nil ||
+		os.Rename(metaTmp, filepath.Join(b.Dir, name+diskCacheMetaSuffix)) != nil {
+		b.removeFiles(name)
+		return
+	}
+	b.entries[name] = b.lru.PushFront(&diskCacheEntry{name: name, size: size})
+	b.bytes += size
+}
+
+// remove drops an entry and its files, the caller holds mu
+func (b *DiskCacheBackend) remove(element *list.Element) {
+	entry := b.lru.Remove(element).(*diskCacheEntry)
+	delete(b.entries, entry.name)
+	b.bytes -= entry.size
+	b.removeFiles(entry.name)
+}
+
+// removeFiles deletes the files of a cached object, sidecar first
+func (b *DiskCacheBackend) removeFiles(name string) {
+	_ = os.Remove(filepath.Join(b.Dir, name+diskCacheMetaSuffix))
+	_ = os.Remove(filepath.Join(b.Dir, name+diskCacheDataSuffix))
+}
+
+// loadIndex rebuilds the LRU from the objects cached in Dir, evicting beyond MaxBytes
+func (b *DiskCacheBackend) loadIndex() error {
+	dirEntries, err := os.ReadDir(b.Dir)
+	if err != nil {
+		return err
+	}
+	type cachedFile struct {
+		name    string
+		size    int64
+		modTime int64
+	}
+	var files []cachedFile
+	for _, dirEntry := range dirEntries {
+		if strings.HasSuffix(dirEntry.Name(), diskCacheTempSuffix) {
+			// left over by a write interrupted before the rename
+			_ = os.Remove(filepath.Join(b.Dir, dirEntry.Name()))
+			continue
+		}
+		name, ok := strings.CutSuffix(dirEntry.Name(), diskCacheDataSuffix)
+		if !ok {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(b.Dir, name+diskCacheMetaSuffix)); err != nil {
+			// interrupted write
+			b.removeFiles(name)
+			continue
+		}
+		files = append(files, cachedFile{name: name, size: info.Size(), modTime: info.ModTime().UnixNano()})
+	}
+	// most recently modified first, so the oldest objects end up at the back of the LRU
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime > files[j].modTime
+	})
+	for _, file := range files {
+		if b.bytes+file.size > b.MaxBytes {
+			b.removeFiles(file.name)
+			continue
+		}
+		b.entries[file.name] = b.lru.PushBack(&diskCacheEntry{name: file.name, size: file.size})
+		b.bytes += file.size
+	}
+	return nil
+}
+
+// diskCacheName returns the file name of the cached copy of path
+func diskCacheName(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeTemp writes content to a new temporary file in Dir and returns its name
+func (b *DiskCacheBackend) writeTemp(content []byte) (string, error) {
+	tmp, err := os.CreateTemp(b.Dir, "*"+diskCacheTempSuffix)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
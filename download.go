@@ -0,0 +1,474 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultDownloadPartSize    = 16 * 1024 * 1024
+	defaultDownloadConcurrency = 4
+)
+
+// DownloadOptions holds the settings applied to a file download
+type DownloadOptions struct {
+	PartSize    int64
+	Concurrency int
+	// Slots, when set, bounds the ranged reads of every download sharing it, by the priority of their context
+	Slots *TransferSlots
+	// Hasher computes the checksum verified, HashSHA256 by default
+	Hasher IHasher
+	// Manager, when set, bounds the transfers and buffered parts of every download sharing it, instead of Slots
+	Manager *DownloadManager
+}
+
+// DownloadOption configures a file download
+type DownloadOption func(*DownloadOptions)
+
+// WithPartSize sets the size of each ranged read of a download
+func WithPartSize(partSize int64) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.PartSize = partSize
+	}
+}
+
+// WithDownloadConcurrency sets how many ranged reads of a download run in parallel
+func WithDownloadConcurrency(concurrency int) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithTransferSlots makes every ranged read of a download wait for a slot of the shared slots, so that the
+// downloads of a process stay under a common concurrency limit and interactive downloads go first
+func WithTransferSlots(slots *TransferSlots) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.Slots = slots
+	}
+}
+
+// WithChecksumHasher verifies downloads against a checksum computed with hasher, e.g. HashBLAKE3 for multi-GB
+// artifacts
+func WithChecksumHasher(hasher IHasher) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.Hasher = hasher
+	}
+}
+
+// WithDownloadManager reads every part of a download through manager, so that its transfers and the parts buffered
+// before being written to disk count against the limits of the process
+func WithDownloadManager(manager *DownloadManager) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.Manager = manager
+	}
+}
+
+// getDownloadOptions applies the given options over the defaults
+func getDownloadOptions(opts []DownloadOption) DownloadOptions {
+	options := DownloadOptions{
+		PartSize:    defaultDownloadPartSize,
+		Concurrency: defaultDownloadConcurrency,
+		Hasher:      HashSHA256,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.PartSize <= 0 {
+		options.PartSize = defaultDownloadPartSize
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	return options
+}
+
+// IObjectDownloader is implemented by backends downloading objects with their own readers rather than through
+// GetObject, holding no more than a part of the object in memory
+type IObjectDownloader interface {
+	// DownloadToWriter streams the object at path to w
+	DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError
+	// DownloadToWriterAt downloads the object at path into w with parallel ranged reads and returns its size
+	DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError)
+}
+
+// DownloadToWriter streams the object at path of backend to w, e.g. an HTTP response or a hash, with constant
+// memory. Backends implementing IObjectDownloader, S3 and GCS, stream the object in one read; other backends, and
+// decorators, are read one part after the other with ranged reads of WithPartSize bytes. What was written before a
+// failure is left in w.
+func DownloadToWriter(ctx context.Context, backend IStorageBackend, path string, w io.Writer, opts ...DownloadOption) *ae.AppError {
+	if downloader, ok := backend.(IObjectDownloader); ok {
+		return downloader.DownloadToWriter(ctx, path, w)
+	}
+	options := getDownloadOptions(opts)
+	for offset, size := int64(0), int64(1); offset < size; {
+		part, release, appErr := readPart(ctx, backend, path, options, WithRange(offset, options.PartSize))
+		if appErr != nil && offset == 0 && appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+			// some providers reject any range on an empty object
+			part, release, appErr = readPart(ctx, backend, path, options)
+		}
+		if appErr != nil {
+			release()
+			return appErr.AddErrCode(DownloadFile.Code)
+		}
+		_, err := w.Write(part.Content)
+		release()
+		if err != nil {
+			return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to write %s", path), DownloadFile, http.StatusInternalServerError)
+		}
+		if len(part.Content) == 0 && part.Size > offset {
+			return ae.GetAppErr(ctx, fmt.Errorf("short read of %s at offset %d", path, offset), DownloadFile, http.StatusInternalServerError)
+		}
+		offset += int64(len(part.Content))
+		size = part.Size
+	}
+	return nil
+}
+
+// DownloadToFile downloads the object at path of backend into localPath with parallel ranged reads, with memory
+// bounded by the part size and concurrency. S3 downloads through its s3manager downloader and GCS with range
+// readers, unless WithTransferSlots or WithDownloadManager are given; other backends, and decorators, are read with
+// ranged GetObject calls. The object is written to a temporary file next to localPath, renamed into place once
+// complete, so localPath never holds a partial object.
+func DownloadToFile(ctx context.Context, backend IStorageBackend, path, localPath string, opts ...DownloadOption) *ae.AppError {
+	tmpFile, appErr := downloadToTemp(ctx, backend, path, localPath, getDownloadOptions(opts))
+	if appErr != nil {
+		return appErr
+	}
+	return commitTemp(ctx, tmpFile, localPath)
+}
+
+// DownloadFileVerified fetches the object at path into localPath using parallel ranged reads into a sparse,
+// preallocated temporary file next to localPath, as DownloadToFile does. The file is only renamed into place once
+// its checksum, SHA-256 unless WithChecksumHasher is given, matches expectedChecksum (hex encoded), so localPath
+// never holds a partial or corrupt artifact.
+func DownloadFileVerified(ctx context.Context, backend IStorageBackend, path, localPath, expectedChecksum string, opts ...DownloadOption) *ae.AppError {
+	options := getDownloadOptions(opts)
+	tmpFile, appErr := downloadToTemp(ctx, backend, path, localPath, options)
+	if appErr != nil {
+		return appErr
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	hash := options.Hasher.New()
+	if _, err := io.Copy(hash, tmpFile); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to hash downloaded file"), DownloadFile, http.StatusInternalServerError)
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, expectedChecksum) {
+		err := fmt.Errorf("checksum of %s is %s, expected %s", path, actual, expectedChecksum)
+		return ae.GetAppErr(ctx, err, DownloadChecksumMismatch, http.StatusUnprocessableEntity)
+	}
+	committed = true
+	return commitTemp(ctx, tmpFile, localPath)
+}
+
+// downloadToTemp downloads the object at path into a new temporary file next to localPath, removed again when the
+// download fails
+func downloadToTemp(ctx context.Context, backend IStorageBackend, path, localPath string, options DownloadOptions) (*os.File, *ae.AppError) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*.part")
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	if _, appErr := downloadTo(ctx, backend, path, tmpFile, options); appErr != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, appErr
+	}
+	return tmpFile, nil
+}
+
+// downloadTo downloads the object at path of backend into w and returns its size, through the backend's own
+// downloader unless shared transfer limits are set, which only bound ranged GetObject calls
+func downloadTo(ctx context.Context, backend IStorageBackend, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	if downloader, ok := backend.(IObjectDownloader); ok && options.Slots == nil && options.Manager == nil {
+		return downloader.DownloadToWriterAt(ctx, path, w, options)
+	}
+	return downloadParts(ctx, backend, path, w, options)
+}
+
+// commitTemp flushes and closes a downloaded temporary file and renames it to localPath, removing it on failure
+func commitTemp(ctx context.Context, tmpFile *os.File, localPath string) *ae.AppError {
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	if err := os.Rename(tmpFile.Name(), localPath); err != nil {
+		os.Remove(tmpFile.Name())
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to move file into place"), DownloadFile, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// downloadParts reads the object at path of backend into w with parallel ranged GetObject calls and returns its
+// size. Files are first extended to the size of the object, leaving a sparse file the parts are written into.
+func downloadParts(ctx context.Context, backend IStorageBackend, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	first, releaseFirst, appErr := readPart(ctx, backend, path, options, WithRange(0, options.PartSize))
+	if appErr != nil && appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+		// some providers reject any range on an empty object
+		first, releaseFirst, appErr = readPart(ctx, backend, path, options)
+	}
+	defer releaseFirst()
+	if appErr != nil {
+		return 0, appErr.AddErrCode(DownloadFile.Code)
+	}
+
+	if file, ok := w.(interface{ Truncate(size int64) error }); ok {
+		if err := file.Truncate(first.Size); err != nil {
+			return 0, ae.GetAppErr(ctx, errors.Wrap(err, "failed to preallocate file"), DownloadFile, http.StatusInternalServerError)
+		}
+	}
+	if _, err := w.WriteAt(first.Content, 0); err != nil {
+		return 0, ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	releaseFirst()
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(options.Concurrency)
+	for offset := int64(len(first.Content)); offset < first.Size; offset += options.PartSize {
+		offset := offset
+		length := options.PartSize
+		if offset+length > first.Size {
+			length = first.Size - offset
+		}
+		group.Go(func() error {
+			part, release, appErr := readPart(groupCtx, backend, path, options, WithRange(offset, length))
+			defer release()
+			if appErr != nil {
+				return appErr
+			}
+			if int64(len(part.Content)) != length {
+				return fmt.Errorf("short read at offset %d: got %d of %d bytes", offset, len(part.Content), length)
+			}
+			_, err := w.WriteAt(part.Content, offset)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		if appErr, ok := err.(*ae.AppError); ok {
+			return 0, appErr.AddErrCode(DownloadFile.Code)
+		}
+		return 0, ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	}
+	return first.Size, nil
+}
+
+// GetObjectRange reads length bytes of the object at path of backend from offset, to the end of the object when
+// length is not positive. A negative offset counts from the end of the object, e.g. -8 reads the footer length and
+// magic of a Parquet file; such reads are a single suffix range request of the last -offset bytes, cut to length
+// once read. Object.Size reports the size of the whole object.
+func GetObjectRange(ctx context.Context, backend IStorageBackend, path string, offset, length int64, opts ...GetOption) (Object, *ae.AppError) {
+	if offset >= 0 {
+		return backend.GetObject(ctx, path, append(slices.Clone(opts), WithRange(offset, length))...)
+	}
+	object, appErr := backend.GetObject(ctx, path, append(slices.Clone(opts), WithRange(offset, 0))...)
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+			// providers refuse ranged reads of empty objects
+			return backend.GetObject(ctx, path, opts...)
+		}
+		return object, appErr
+	}
+	if length > 0 && int64(len(object.Content)) > length {
+		object.Content = object.Content[:length]
+	}
+	return object, nil
+}
+
+// getPart reads an object, holding a transfer slot while it does when slots are set
+func getPart(ctx context.Context, backend IStorageBackend, path string, slots *TransferSlots, opts ...GetOption) (Object, *ae.AppError) {
+	if slots != nil {
+		if appErr := slots.acquire(ctx); appErr != nil {
+			return Object{Path: path}, appErr
+		}
+		defer slots.release()
+	}
+	return backend.GetObject(ctx, path, opts...)
+}
+
+// readPart reads a part of a download, through the download manager when set, and returns the function releasing
+// the memory of the part
+func readPart(ctx context.Context, backend IStorageBackend, path string, options DownloadOptions, opts ...GetOption) (Object, func(), *ae.AppError) {
+	if options.Manager != nil {
+		return options.Manager.Fetch(ctx, backend, path, opts...)
+	}
+	object, appErr := getPart(ctx, backend, path, options.Slots, opts...)
+	return object, func() {}, appErr
+}
+
+// DownloadToWriter streams an object from Amazon S3 bucket to w in a single GetObject request
+func (b *S3Backend) DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError {
+	s3Result, err := b.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	})
+	if err != nil {
+		return s3DownloadErr(ctx, err)
+	}
+	defer s3Result.Body.Close()
+	if _, err := io.Copy(w, s3Result.Body); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to stream %s", path), DownloadFile, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// DownloadToWriterAt downloads an object from Amazon S3 bucket into w with the s3manager downloader, falling back to
+// ranged GetObject calls for backends built without one
+func (b *S3Backend) DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	if b.Downloader == nil {
+		return downloadParts(ctx, b, path, w, options)
+	}
+	n, err := b.Downloader.DownloadWithContext(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	}, func(d *s3manager.Downloader) {
+		d.PartSize = options.PartSize
+		d.Concurrency = options.Concurrency
+	})
+	if err != nil {
+		return 0, s3DownloadErr(ctx, err)
+	}
+	return n, nil
+}
+
+// s3DownloadErr maps an S3 error of a download
+func s3DownloadErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	if isS3NotFoundError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if isS3ThrottlingError(err) {
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// DownloadToWriter streams an object from Google Cloud Storage bucket to w with a single reader
+func (b GoogleCSBackend) DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError {
+	reader, err := b.Client.Object(objectKey(b.Prefix, path)).NewReader(ctx)
+	if err == nil {
+		defer reader.Close()
+		_, err = io.Copy(w, reader)
+	}
+	if err != nil {
+		return gcsDownloadErr(ctx, errors.Wrapf(err, "failed to stream %s", path))
+	}
+	return nil
+}
+
+// DownloadToWriterAt downloads an object from Google Cloud Storage bucket into w with parallel range readers, all
+// pinned to the generation current when the download starts
+func (b GoogleCSBackend) DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	object := b.Client.Object(objectKey(b.Prefix, path))
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return 0, gcsDownloadErr(ctx, err)
+	}
+	object = object.Generation(attrs.Generation)
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(options.Concurrency)
+	for offset := int64(0); offset < attrs.Size; offset += options.PartSize {
+		offset := offset
+		length := min(options.PartSize, attrs.Size-offset)
+		group.Go(func() error {
+			reader, err := object.NewRangeReader(groupCtx, offset, length)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+			n, err := io.Copy(io.NewOffsetWriter(w, offset), reader)
+			if err == nil && n != length {
+				err = fmt.Errorf("short read at offset %d: got %d of %d bytes", offset, n, length)
+			}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return 0, gcsDownloadErr(ctx, errors.Wrapf(err, "failed to download %s", path))
+	}
+	return attrs.Size, nil
+}
+
+// gcsDownloadErr maps a GCS error of a download
+func gcsDownloadErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, DownloadFile, http.StatusInternalServerError)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if retryAfter, ok := gcsRetryAfter(err); ok {
+		appErr = throttled(appErr, retryAfter)
+	}
+	return appErr
+}
+
+// DownloadToWriter streams an object below the prefix to w
+func (b *SubBackend) DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return DownloadToWriter(ctx, b.Parent, key, w)
+}
+
+// DownloadToWriterAt downloads an object below the prefix into w
+func (b *SubBackend) DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return 0, appErr
+	}
+	return downloadTo(ctx, b.Parent, key, w, options)
+}
+
+// DownloadToWriter streams an object in its shard to w
+func (b *ShardedBackend) DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError {
+	return DownloadToWriter(ctx, b.ShardFor(path).Backend, path, w)
+}
+
+// DownloadToWriterAt downloads an object in its shard into w
+func (b *ShardedBackend) DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	return downloadTo(ctx, b.ShardFor(path).Backend, path, w, options)
+}
+
+// DownloadToWriter streams an object in the backend of its route to w
+func (b *RouterBackend) DownloadToWriter(ctx context.Context, path string, w io.Writer) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return DownloadToWriter(ctx, backend, path, w)
+}
+
+// DownloadToWriterAt downloads an object in the backend of its route into w
+func (b *RouterBackend) DownloadToWriterAt(ctx context.Context, path string, w io.WriterAt, options DownloadOptions) (int64, *ae.AppError) {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return 0, appErr
+	}
+	return downloadTo(ctx, backend, path, w, options)
+}
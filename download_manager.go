@@ -0,0 +1,184 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// bufferWaiter is a fetch waiting for n bytes of the memory budget of a DownloadManager
+type bufferWaiter struct {
+	n       int64
+	granted chan struct{}
+}
+
+// DownloadManager is a process-wide gate for downloads, shared by every call site and backend, capping the
+// concurrent transfers and the bytes held in memory so that a burst of large downloads cannot exhaust the memory
+// of the service. Fetch reserves the size of an object from the budget before reading it, and the caller releases
+// it once done with the content. Waiting for a transfer or for memory, fetches of a higher Priority go first, and
+// within a priority fetches are served in order, so small fetches do not starve large ones. It is safe for
+// concurrent use.
+type DownloadManager struct {
+	// Slots bounds the concurrent transfers
+	Slots *TransferSlots
+	// MaxBufferedBytes bounds the content held by fetches not released yet
+	MaxBufferedBytes int64
+
+	mu       sync.Mutex
+	buffered int64
+	// waiters are the fetches waiting for memory, per priority level
+	waiters [priorityLevels][]*bufferWaiter
+}
+
+// NewDownloadManager creates a new instance of DownloadManager allowing maxTransfers concurrent transfers and
+// maxBufferedBytes of content in memory
+func NewDownloadManager(maxTransfers int, maxBufferedBytes int64) (*DownloadManager, *ae.AppError) {
+	if maxTransfers <= 0 || maxBufferedBytes <= 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("max transfers and max buffered bytes must be positive"), DownloadManagerConfig, http.StatusInternalServerError)
+	}
+	return &DownloadManager{
+		Slots:            NewTransferSlots(maxTransfers),
+		MaxBufferedBytes: maxBufferedBytes,
+	}, nil
+}
+
+// Buffered returns the bytes reserved by fetches not released yet
+func (m *DownloadManager) Buffered() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.buffered
+}
+
+// Describe reports the limits and the bytes buffered
+func (m *DownloadManager) Describe() map[string]string {
+	return map[string]string{
+		"maxTransfers":     strconv.Itoa(m.Slots.slots),
+		"maxBufferedBytes": strconv.FormatInt(m.MaxBufferedBytes, 10),
+		"buffered":         strconv.FormatInt(m.Buffered(), 10),
+	}
+}
+
+// Fetch reads an object of backend once the memory budget holds its size and a transfer is free, and returns it
+// with the function releasing its memory, to call once done with the content. Objects, or ranges, larger than the
+// whole budget fail with StatusRequestEntityTooLarge. Unless the range read has a length, the object is sized with a
+// one byte ranged read first. An object that grew since it was sized is accounted at its actual size.
+func (m *DownloadManager) Fetch(ctx context.Context, backend IStorageBackend, path string, opts ...GetOption) (Object, func(), *ae.AppError) {
+	size, appErr := m.size(ctx, backend, path, opts)
+	if appErr != nil {
+		return Object{Path: path}, func() {}, appErr.AddErrCode(DownloadManagerFetch.Code)
+	}
+	if size > m.MaxBufferedBytes {
+		err := fmt.Errorf("%s is %d bytes, more than the download memory budget of %d bytes", path, size, m.MaxBufferedBytes)
+		return Object{Path: path}, func() {}, ae.GetAppErr(ctx, err, DownloadManagerBudget, http.StatusRequestEntityTooLarge)
+	}
+	if appErr := m.reserve(ctx, size); appErr != nil {
+		return Object{Path: path}, func() {}, appErr
+	}
+	object, appErr := getPart(ctx, backend, path, m.Slots, opts...)
+	if appErr != nil {
+		m.free(size)
+		return object, func() {}, appErr.AddErrCode(DownloadManagerFetch.Code)
+	}
+	actual := int64(len(object.Content))
+	if actual != size {
+		m.free(size - actual)
+	}
+	return object, sync.OnceFunc(func() { m.free(actual) }), nil
+}
+
+// size returns the bytes a GetObject call with opts would read
+func (m *DownloadManager) size(ctx context.Context, backend IStorageBackend, path string, opts []GetOption) (int64, *ae.AppError) {
+	byteRange := getGetOptions(opts).Range
+	if byteRange != nil && byteRange.Offset < 0 {
+		// suffix ranges read at most their length, the unused part is freed once read
+		return -byteRange.Offset, nil
+	}
+	if byteRange != nil && byteRange.Length > 0 {
+		return byteRange.Length, nil
+	}
+	object, appErr := getPart(ctx, backend, path, m.Slots, append(slices.Clone(opts), WithRange(0, 1))...)
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+			// providers refuse ranged reads of empty objects
+			return 0, nil
+		}
+		return 0, appErr
+	}
+	if byteRange != nil {
+		return max(object.Size-byteRange.Offset, 0), nil
+	}
+	return object.Size, nil
+}
+
+// reserve blocks until n bytes of the budget are granted to the caller, by the priority of ctx, or ctx is done
+func (m *DownloadManager) reserve(ctx context.Context, n int64) *ae.AppError {
+	level := PriorityFromContext(ctx).level()
+	m.mu.Lock()
+	if !m.queued() && m.buffered+n <= m.MaxBufferedBytes {
+		m.buffered += n
+		m.mu.Unlock()
+		return nil
+	}
+	waiter := &bufferWaiter{n: n, granted: make(chan struct{})}
+	m.waiters[level] = append(m.waiters[level], waiter)
+	// a fetch of a higher priority than the queued ones may fit right away
+	m.grant()
+	m.mu.Unlock()
+
+	select {
+	case <-waiter.granted:
+		return nil
+	case <-ctx.Done():
+	}
+	m.mu.Lock()
+	if i := slices.Index(m.waiters[level], waiter); i >= 0 {
+		m.waiters[level] = slices.Delete(m.waiters[level], i, i+1)
+		// the waiters queued behind this one may fit now
+		m.grant()
+		m.mu.Unlock()
+	} else {
+		// the bytes were granted while ctx was done, hand them on
+		m.mu.Unlock()
+		m.free(n)
+	}
+	return ae.GetAppErr(ctx, errors.Wrap(ctx.Err(), "waiting for download memory"), DownloadManagerBudget, http.StatusTooManyRequests)
+}
+
+// free returns n bytes to the budget, a negative n taking more, and grants them to the waiters they fit
+func (m *DownloadManager) free(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buffered -= n
+	m.grant()
+}
+
+// grant hands the budget to the first waiters, by priority, as long as they fit. The caller holds mu.
+func (m *DownloadManager) grant() {
+	for level := priorityLevels - 1; level >= 0; level-- {
+		for len(m.waiters[level]) > 0 {
+			waiter := m.waiters[level][0]
+			if m.buffered+waiter.n > m.MaxBufferedBytes {
+				return
+			}
+			m.buffered += waiter.n
+			close(waiter.granted)
+			m.waiters[level] = m.waiters[level][1:]
+		}
+	}
+}
+
+// queued reports whether fetches are waiting for memory. The caller holds mu.
+func (m *DownloadManager) queued() bool {
+	for _, waiters := range m.waiters {
+		if len(waiters) > 0 {
+			return true
+		}
+	}
+	return false
+}
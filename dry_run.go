@@ -0,0 +1,164 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// DryRunChange is a mutation recorded by a DryRunBackend instead of being performed
+type DryRunChange struct {
+	// Operation is OperationPut, OperationDelete or OperationCopy
+	Operation Operation
+	Path      string
+	// SourcePath is the source of a copy
+	SourcePath string
+	// Size is the size of the content written, or of the object deleted
+	Size int64
+	// Exists reports whether an object was at Path, i.e. whether a put or copy would overwrite it and a delete
+	// would remove it
+	Exists bool
+}
+
+// DryRunReport lists the mutations recorded by a DryRunBackend, in call order
+type DryRunReport struct {
+	Changes []DryRunChange
+}
+
+// String summarises the report, e.g. "2 puts, 1 copies (3072 bytes), 1 overwrites, 3 deletes (2048 bytes)".
+// Deletes of missing objects are not counted.
+func (r DryRunReport) String() string {
+	var puts, overwrites, deletes, copies int
+	var written, deleted int64
+	for _, change := range r.Changes {
+		if change.Exists && change.Operation != OperationDelete {
+			overwrites++
+		}
+		switch change.Operation {
+		case OperationPut:
+			puts++
+			written += change.Size
+		case OperationCopy:
+			copies++
+			written += change.Size
+		case OperationDelete:
+			if change.Exists {
+				deletes++
+				deleted += change.Size
+			}
+		}
+	}
+	return fmt.Sprintf("%d puts, %d copies (%d bytes), %d overwrites, %d deletes (%d bytes)",
+		puts, copies, written, overwrites, deletes, deleted)
+}
+
+// DryRunBackend is an IStorageBackend decorator previewing mutations, e.g. of a bulk cleanup job: reads are served
+// by the backend, while puts, deletes and copies are only recorded in a report. Every recorded mutation looks up the
+// object it would replace or delete, and a copy of a missing source fails as it would for real. Reads do not see
+// the recorded mutations. It is safe for concurrent use.
+type DryRunBackend struct {
+	Backend IStorageBackend
+
+	mu      sync.Mutex
+	changes []DryRunChange
+}
+
+// NewDryRunBackend creates a new instance of DryRunBackend
+func NewDryRunBackend(backend IStorageBackend) *DryRunBackend {
+	return &DryRunBackend{Backend: backend}
+}
+
+// Unwrap returns the backend serving the reads
+func (b *DryRunBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the number of mutations recorded
+func (b *DryRunBackend) Describe() map[string]string {
+	return map[string]string{
+		"changes": strconv.Itoa(len(b.Report().Changes)),
+	}
+}
+
+// Report returns the mutations recorded since the backend was created or reset
+func (b *DryRunBackend) Report() DryRunReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return DryRunReport{Changes: slices.Clone(b.changes)}
+}
+
+// Reset clears the recorded mutations
+func (b *DryRunBackend) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes = nil
+}
+
+// GetObject retrieves an object
+func (b *DryRunBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *DryRunBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *DryRunBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject records the upload of an object without performing it
+func (b *DryRunBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	_, exists, appErr := objectSize(ctx, b.Backend, path)
+	if appErr != nil {
+		return appErr.AddErrCode(DryRunStat.Code)
+	}
+	b.record(DryRunChange{Operation: OperationPut, Path: path, Size: int64(len(content)), Exists: exists})
+	return nil
+}
+
+// DeleteObject records the removal of an object without performing it
+func (b *DryRunBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	size, exists, appErr := objectSize(ctx, b.Backend, path)
+	if appErr != nil {
+		return appErr.AddErrCode(DryRunStat.Code)
+	}
+	b.record(DryRunChange{Operation: OperationDelete, Path: path, Size: size, Exists: exists})
+	return nil
+}
+
+// CopyObject records the copy of an object without performing it, failing with StatusNotFound when the source is
+// missing
+func (b *DryRunBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	size, exists, appErr := objectSize(ctx, b.Backend, srcPath)
+	if appErr != nil {
+		return appErr.AddErrCode(DryRunStat.Code)
+	}
+	if !exists {
+		return ae.GetAppErr(ctx, fmt.Errorf("source object %s not found", srcPath), DryRunCopySource, http.StatusNotFound)
+	}
+	_, overwrites, appErr := objectSize(ctx, b.Backend, dstPath)
+	if appErr != nil {
+		return appErr.AddErrCode(DryRunStat.Code)
+	}
+	b.record(DryRunChange{Operation: OperationCopy, Path: dstPath, SourcePath: srcPath, Size: size, Exists: overwrites})
+	return nil
+}
+
+// record appends a change to the report
+func (b *DryRunBackend) record(change DryRunChange) {
+	change.Path = NormalizePath(change.Path)
+	if change.SourcePath != "" {
+		change.SourcePath = NormalizePath(change.SourcePath)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes = append(b.changes, change)
+}
@@ -0,0 +1,333 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/cloudkms/v1"
+)
+
+const (
+	// clientEncryptionAlgorithm is the cipher of client-side encrypted objects
+	clientEncryptionAlgorithm = "AES256-GCM"
+	// dataKeySize is the size of the AES-256 data keys generated for every object
+	dataKeySize = 32
+)
+
+// User metadata keys of client-side encrypted objects
+const (
+	metaEncryptionKey       = "cse-key"
+	metaEncryptionKeyID     = "cse-key-id"
+	metaEncryptionAlgorithm = "cse-algorithm"
+)
+
+// IKeyProvider wraps and unwraps the data keys of client-side encrypted objects with a key encryption key
+type IKeyProvider interface {
+	// WrapKey encrypts a data key, returning the wrapped key and the id of the key encryption key used
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, *ae.AppError)
+	// UnwrapKey decrypts a data key wrapped by the key encryption key keyID
+	UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, *ae.AppError)
+}
+
+// StaticKeyProvider wraps data keys with a fixed AES-256 key, e.g. loaded from a secret store
+type StaticKeyProvider struct {
+	KeyID string
+	Key   []byte
+}
+
+// NewStaticKeyProvider creates a new instance of StaticKeyProvider, key must be 32 bytes long
+func NewStaticKeyProvider(keyID string, key []byte) (*StaticKeyProvider, *ae.AppError) {
+	if keyID == "" || len(key) != dataKeySize {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("a key id and a %d bytes key are required", dataKeySize), EncryptionKey, http.StatusInternalServerError)
+	}
+	return &StaticKeyProvider{KeyID: keyID, Key: slices.Clone(key)}, nil
+}
+
+// WrapKey encrypts a data key with the static key
+func (p *StaticKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, *ae.AppError) {
+	wrapped, err := sealAESGCM(p.Key, dataKey)
+	if err != nil {
+		return nil, "", ae.GetAppErr(ctx, err, EncryptionKey, http.StatusInternalServerError)
+	}
+	return wrapped, p.KeyID, nil
+}
+
+// UnwrapKey decrypts a data key wrapped with the static key
+func (p *StaticKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, *ae.AppError) {
+	if keyID != p.KeyID {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("data key wrapped with unknown key %q", keyID), EncryptionKey, http.StatusInternalServerError)
+	}
+	dataKey, err := openAESGCM(p.Key, wrapped)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, err, EncryptionKey, http.StatusInternalServerError)
+	}
+	return dataKey, nil
+}
+
+// IKMSClient is the part of the AWS KMS client used to wrap data keys, implemented by *kms.KMS
+type IKMSClient interface {
+	EncryptWithContext(ctx aws.Context, input *kms.EncryptInput, opts ...request.Option) (*kms.EncryptOutput, error)
+	DecryptWithContext(ctx aws.Context, input *kms.DecryptInput, opts ...request.Option) (*kms.DecryptOutput, error)
+}
+
+// AWSKMSKeyProvider wraps data keys with an AWS KMS key
+type AWSKMSKeyProvider struct {
+	Client IKMSClient
+	// KeyID is the key id, ARN or alias of a symmetric KMS key
+	KeyID string
+}
+
+// NewAWSKMSKeyProvider creates a new instance of AWSKMSKeyProvider
+func NewAWSKMSKeyProvider(client IKMSClient, keyID string) *AWSKMSKeyProvider {
+	return &AWSKMSKeyProvider{Client: client, KeyID: keyID}
+}
+
+// WrapKey encrypts a data key with the KMS key, returning the ARN of the key
+func (p *AWSKMSKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, *ae.AppError) {
+	output, err := p.Client.EncryptWithContext(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(p.KeyID),
+		Plaintext: dataKey,
+	})
+	if err != nil {
+		return nil, "", ae.GetAppErr(ctx, errors.Wrap(err, "kms encrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	return output.CiphertextBlob, aws.StringValue(output.KeyId), nil
+}
+
+// UnwrapKey decrypts a data key with the KMS key keyID
+func (p *AWSKMSKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, *ae.AppError) {
+	output, err := p.Client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "kms decrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	return output.Plaintext, nil
+}
+
+// GCPKMSKeyProvider wraps data keys with a Google Cloud KMS key
+type GCPKMSKeyProvider struct {
+	Service *cloudkms.Service
+	// KeyName is the crypto key resource name, projects/*/locations/*/keyRings/*/cryptoKeys/*
+	KeyName string
+}
+
+// NewGCPKMSKeyProvider creates a new instance of GCPKMSKeyProvider
+func NewGCPKMSKeyProvider(service *cloudkms.Service, keyName string) *GCPKMSKeyProvider {
+	return &GCPKMSKeyProvider{Service: service, KeyName: keyName}
+}
+
+// WrapKey encrypts a data key with the primary version of the crypto key
+func (p *GCPKMSKeyProvider) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, *ae.AppError) {
+	response, err := p.Service.Projects.Locations.KeyRings.CryptoKeys.Encrypt(p.KeyName, &cloudkms.EncryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(dataKey),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, "", ae.GetAppErr(ctx, errors.Wrap(err, "kms encrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(response.Ciphertext)
+	if err != nil {
+		return nil, "", ae.GetAppErr(ctx, errors.Wrap(err, "kms encrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	return wrapped, p.KeyName, nil
+}
+
+// UnwrapKey decrypts a data key with the crypto key keyID, KMS picking the key version that wrapped it
+func (p *GCPKMSKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, *ae.AppError) {
+	response, err := p.Service.Projects.Locations.KeyRings.CryptoKeys.Decrypt(keyID, &cloudkms.DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(wrapped),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "kms decrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(response.Plaintext)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "kms decrypt"), EncryptionKey, http.StatusInternalServerError)
+	}
+	return dataKey, nil
+}
+
+// EncryptedOption configures an EncryptedBackend
+type EncryptedOption func(*EncryptedBackend)
+
+// WithPlaintextReads returns objects written without client-side encryption as they are instead of failing, e.g.
+// while existing objects are being migrated
+func WithPlaintextReads() EncryptedOption {
+	return func(b *EncryptedBackend) {
+		b.AllowPlaintext = true
+	}
+}
+
+// EncryptedBackend is an IStorageBackend decorator encrypting object content on the client with envelope
+// encryption: every object is encrypted with its own AES-256-GCM data key, and the data key, wrapped by the
+// KeyProvider, is stored in the user metadata of the object. The wrapped backend must store user metadata.
+// Listings report the size of the encrypted content, 28 bytes more than the plaintext.
+type EncryptedBackend struct {
+	Backend        IStorageBackend
+	KeyProvider    IKeyProvider
+	AllowPlaintext bool
+}
+
+// NewEncryptedBackend creates a new instance of EncryptedBackend encrypting the objects of backend with data keys
+// wrapped by keyProvider
+func NewEncryptedBackend(backend IStorageBackend, keyProvider IKeyProvider, opts ...EncryptedOption) *EncryptedBackend {
+	b := &EncryptedBackend{
+		Backend:     backend,
+		KeyProvider: keyProvider,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the backend storing the encrypted objects
+func (b *EncryptedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the algorithm and the key provider type, never the keys
+func (b *EncryptedBackend) Describe() map[string]string {
+	return map[string]string{
+		"algorithm":      clientEncryptionAlgorithm,
+		"keyProvider":    fmt.Sprintf("%T", b.KeyProvider),
+		"allowPlaintext": fmt.Sprint(b.AllowPlaintext),
+	}
+}
+
+// GetObject retrieves and decrypts an object. Ranged reads download the whole object, as GCM can only
+// authenticate it as a whole, and return the requested range of the plaintext.
+func (b *EncryptedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, withoutRange(opts)...)
+	if appErr != nil {
+		return object, appErr
+	}
+	if object, appErr = b.decrypt(ctx, object); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return sliceRange(ctx, object, getGetOptions(opts).Range, EncryptionDecrypt)
+}
+
+// GetObjects lists all objects at the given prefix. Listings carry neither content nor the metadata holding the
+// data key, so they are returned as listed, sizes being those of the encrypted content.
+func (b *EncryptedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix, sizes being those of the encrypted content
+func (b *EncryptedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject encrypts the content with a new data key and uploads it with the wrapped data key in its metadata
+func (b *EncryptedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return ae.GetAppErr(ctx, err, EncryptionEncrypt, http.StatusInternalServerError)
+	}
+	wrapped, keyID, appErr := b.KeyProvider.WrapKey(ctx, dataKey)
+	if appErr != nil {
+		return appErr.AddErrCode(EncryptionEncrypt.Code)
+	}
+	sealed, err := sealAESGCM(dataKey, content)
+	if err != nil {
+		return ae.GetAppErr(ctx, err, EncryptionEncrypt, http.StatusInternalServerError)
+	}
+	envelope := WithMetadata(map[string]string{
+		metaEncryptionKey:       base64.StdEncoding.EncodeToString(wrapped),
+		metaEncryptionKeyID:     keyID,
+		metaEncryptionAlgorithm: clientEncryptionAlgorithm,
+	})
+	return b.Backend.PutObject(ctx, path, sealed, append(slices.Clone(opts), envelope)...)
+}
+
+// DeleteObject removes an object
+func (b *EncryptedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, the copy keeping the wrapped data key of its source
+func (b *EncryptedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// decrypt unwraps the data key of an object and decrypts its content, removing the envelope from its metadata
+func (b *EncryptedBackend) decrypt(ctx context.Context, object Object) (Object, *ae.AppError) {
+	encodedKey, ok := object.Meta.User[metaEncryptionKey]
+	if !ok {
+		if b.AllowPlaintext {
+			return object, nil
+		}
+		return object, ae.GetAppErr(ctx, fmt.Errorf("%s is not client-side encrypted", object.Path), EncryptionNotEncrypted, http.StatusInternalServerError)
+	}
+	if algorithm := object.Meta.User[metaEncryptionAlgorithm]; algorithm != clientEncryptionAlgorithm {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("%s is encrypted with unsupported algorithm %q", object.Path, algorithm), EncryptionDecrypt, http.StatusInternalServerError)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return object, ae.GetAppErr(ctx, errors.Wrapf(err, "data key of %s", object.Path), EncryptionDecrypt, http.StatusInternalServerError)
+	}
+	dataKey, appErr := b.KeyProvider.UnwrapKey(ctx, wrapped, object.Meta.User[metaEncryptionKeyID])
+	if appErr != nil {
+		return object, appErr.AddErrCode(EncryptionDecrypt.Code)
+	}
+	content, err := openAESGCM(dataKey, object.Content)
+	if err != nil {
+		return object, ae.GetAppErr(ctx, errors.Wrapf(err, "content of %s", object.Path), EncryptionDecrypt, http.StatusInternalServerError)
+	}
+	object.Content = content
+	object.Size = int64(len(content))
+	object.Meta.User = maps.Clone(object.Meta.User)
+	delete(object.Meta.User, metaEncryptionKey)
+	delete(object.Meta.User, metaEncryptionKeyID)
+	delete(object.Meta.User, metaEncryptionAlgorithm)
+	return object, nil
+}
+
+// sealAESGCM encrypts plaintext with key, prefixing the random nonce to the sealed content
+func sealAESGCM(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openAESGCM decrypts content sealed by sealAESGCM
+func openAESGCM(key, sealed []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("sealed content too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// newAESGCM returns the AES-GCM cipher of key
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -33,3 +33,625 @@ var (
 	S3CopyObject = ae.GetCustomErr("ERR_OS_S3_2005",
 		"error while copying object in s3 bucket", false)
 )
+
+// HDFS (Hadoop Distributed File System) error definitions
+var (
+	HDFSBackendClient = ae.GetCustomErr("ERR_OS_HDFS_3000",
+		"failed to initialise the hdfs client", false)
+	HDFSGetObjects = ae.GetCustomErr("ERR_OS_HDFS_3001",
+		"error while getting objects from hdfs", false)
+	HDFSGetObject = ae.GetCustomErr("ERR_OS_HDFS_3002",
+		"error while getting object from hdfs", false)
+	HDFSPutObject = ae.GetCustomErr("ERR_OS_HDFS_3003",
+		"error while putting object to hdfs", false)
+	HDFSDeleteObject = ae.GetCustomErr("ERR_OS_HDFS_3004",
+		"error while deleting object from hdfs", false)
+	HDFSCopyObject = ae.GetCustomErr("ERR_OS_HDFS_3005",
+		"error while copying object in hdfs", false)
+)
+
+// SSE (server side encryption) policy error definitions
+var (
+	SSEPolicyConfig = ae.GetCustomErr("ERR_OS_SSE_4000",
+		"invalid server side encryption policy", false)
+	SSEPutRejected = ae.GetCustomErr("ERR_OS_SSE_4001",
+		"object put rejected, no approved encryption option given", false)
+	SSEReadRejected = ae.GetCustomErr("ERR_OS_SSE_4002",
+		"object is not encrypted with an approved key", false)
+)
+
+// Download helper error definitions
+var (
+	DownloadFile = ae.GetCustomErr("ERR_OS_DOWNLOAD_5000",
+		"error while downloading object to file", false)
+	DownloadChecksumMismatch = ae.GetCustomErr("ERR_OS_DOWNLOAD_5001",
+		"downloaded object does not match the expected checksum", false)
+)
+
+// COS (Tencent Cloud Object Storage) error definitions
+var (
+	COSBackendClient = ae.GetCustomErr("ERR_OS_COS_6000",
+		"failed to initialise the cos client", false)
+	COSGetObjects = ae.GetCustomErr("ERR_OS_COS_6001",
+		"error while getting objects from cos bucket", false)
+	COSGetObject = ae.GetCustomErr("ERR_OS_COS_6002",
+		"error while getting object from cos bucket", false)
+	COSPutObject = ae.GetCustomErr("ERR_OS_COS_6003",
+		"error while putting object to cos bucket", false)
+	COSDeleteObject = ae.GetCustomErr("ERR_OS_COS_6004",
+		"error while deleting object from cos bucket", false)
+	COSCopyObject = ae.GetCustomErr("ERR_OS_COS_6005",
+		"error while copying object in cos bucket", false)
+)
+
+// Permission check error definitions
+var (
+	PermissionCheckFailed = ae.GetCustomErr("ERR_OS_PERM_7000",
+		"credentials are not allowed to perform all checked operations", false)
+	PermissionProbe = ae.GetCustomErr("ERR_OS_PERM_7001",
+		"error while probing a storage permission", false)
+)
+
+// Scheduler and lease error definitions
+var (
+	SchedulerJobConfig = ae.GetCustomErr("ERR_OS_SCHED_8000",
+		"invalid scheduled job", false)
+	LeaseAcquire = ae.GetCustomErr("ERR_OS_SCHED_8001",
+		"error while acquiring lease", true)
+	LeaseRelease = ae.GetCustomErr("ERR_OS_SCHED_8002",
+		"error while releasing lease", true)
+)
+
+// Pinning error definitions
+var (
+	ObjectPinned = ae.GetCustomErr("ERR_OS_PIN_9000",
+		"object is pinned and cannot be deleted or overwritten", false)
+	PinRegistryUpdate = ae.GetCustomErr("ERR_OS_PIN_9001",
+		"error while updating the pin registry", false)
+)
+
+// Redis error definitions
+var (
+	RedisBackendClient = ae.GetCustomErr("ERR_OS_REDIS_10000",
+		"failed to initialise the redis client", false)
+	RedisGetObjects = ae.GetCustomErr("ERR_OS_REDIS_10001",
+		"error while getting objects from redis", false)
+	RedisGetObject = ae.GetCustomErr("ERR_OS_REDIS_10002",
+		"error while getting object from redis", false)
+	RedisPutObject = ae.GetCustomErr("ERR_OS_REDIS_10003",
+		"error while putting object to redis", false)
+	RedisDeleteObject = ae.GetCustomErr("ERR_OS_REDIS_10004",
+		"error while deleting object from redis", false)
+	RedisCopyObject = ae.GetCustomErr("ERR_OS_REDIS_10005",
+		"error while copying object in redis", false)
+)
+
+// Storj error definitions
+var (
+	StorjAccessGrant = ae.GetCustomErr("ERR_OS_STORJ_11000",
+		"failed to open the storj project with the access grant", false)
+	StorjGetObjects = ae.GetCustomErr("ERR_OS_STORJ_11001",
+		"error while getting list of objects from storj", false)
+	StorjGetObject = ae.GetCustomErr("ERR_OS_STORJ_11002",
+		"error while getting single object from storj", false)
+	StorjPutObject = ae.GetCustomErr("ERR_OS_STORJ_11003",
+		"error while putting object to storj", false)
+	StorjDeleteObject = ae.GetCustomErr("ERR_OS_STORJ_11004",
+		"error while deleting object from storj", false)
+	StorjCopyObject = ae.GetCustomErr("ERR_OS_STORJ_11005",
+		"error while copying object in storj", false)
+)
+
+// RGW (Ceph RADOS Gateway) error definitions
+var (
+	RGWBackendClient = ae.GetCustomErr("ERR_OS_RGW_12000",
+		"failed to initialise the rgw client", false)
+	RGWAdminOperation = ae.GetCustomErr("ERR_OS_RGW_12001",
+		"error while calling the rgw admin api", false)
+)
+
+// Mirror error definitions
+var (
+	MirrorConfig = ae.GetCustomErr("ERR_OS_MIRROR_13000",
+		"invalid mirror configuration", false)
+	MirrorWrite = ae.GetCustomErr("ERR_OS_MIRROR_13001",
+		"error while writing to a mirror", true)
+)
+
+// Rate limit error definitions
+var (
+	RateLimitConfig = ae.GetCustomErr("ERR_OS_RATE_14000",
+		"invalid rate limit configuration", false)
+	RateLimitWait = ae.GetCustomErr("ERR_OS_RATE_14001",
+		"rate budget not available before the deadline", true)
+)
+
+// Failover error definitions
+var (
+	FailoverConfig = ae.GetCustomErr("ERR_OS_FAILOVER_15000",
+		"invalid failover configuration", false)
+	FailoverExhausted = ae.GetCustomErr("ERR_OS_FAILOVER_15001",
+		"operation failed on every failover backend", true)
+)
+
+// Inventory error definitions
+var (
+	InventoryWrite = ae.GetCustomErr("ERR_OS_INVENTORY_16000",
+		"error while writing the inventory", false)
+)
+
+// Cache error definitions
+var (
+	CacheConfig = ae.GetCustomErr("ERR_OS_CACHE_17000",
+		"invalid cache configuration", false)
+)
+
+// Client upload error definitions
+var (
+	ClientUploadInvalid = ae.GetCustomErr("ERR_OS_UPLOAD_18000",
+		"client upload failed validation", false)
+	ClientUploadOperation = ae.GetCustomErr("ERR_OS_UPLOAD_18001",
+		"error while managing a client upload", false)
+)
+
+// Disk cache error definitions
+var (
+	DiskCacheConfig = ae.GetCustomErr("ERR_OS_DISKCACHE_19000",
+		"failed to initialise the disk cache", false)
+)
+
+// Namespace export error definitions
+var (
+	NamespaceExport = ae.GetCustomErr("ERR_OS_NAMESPACE_20000",
+		"error while exporting the namespace", false)
+	NamespaceImport = ae.GetCustomErr("ERR_OS_NAMESPACE_20001",
+		"error while importing the namespace", false)
+)
+
+// Tiered backend error definitions
+var (
+	TieredConfig = ae.GetCustomErr("ERR_OS_TIERED_21000",
+		"invalid tiered backend configuration", false)
+	TieredMove = ae.GetCustomErr("ERR_OS_TIERED_21001",
+		"error while moving an object between tiers", true)
+)
+
+// Secure delete error definitions
+var (
+	SecureDeleteIncomplete = ae.GetCustomErr("ERR_OS_SECUREDELETE_22000",
+		"object could not be verified deleted", false)
+)
+
+// Sharded backend error definitions
+var (
+	ShardedConfig = ae.GetCustomErr("ERR_OS_SHARD_23000",
+		"invalid sharded backend configuration", false)
+	ShardedListObjects = ae.GetCustomErr("ERR_OS_SHARD_23001",
+		"error while listing objects across shards", false)
+)
+
+// Sub backend error definitions
+var (
+	SubBackendConfig = ae.GetCustomErr("ERR_OS_SUB_24000",
+		"invalid sub backend configuration", false)
+	SubBackendPath = ae.GetCustomErr("ERR_OS_SUB_24001",
+		"path resolves outside the sub backend", false)
+)
+
+// Access tracking error definitions
+var (
+	AccessStoreUpdate = ae.GetCustomErr("ERR_OS_ACCESS_25000",
+		"error while recording object access statistics", true)
+)
+
+// Upload deduplication error definitions
+var (
+	DedupPutWait = ae.GetCustomErr("ERR_OS_DEDUP_26000",
+		"caller stopped waiting for a shared upload", true)
+)
+
+// Listing hydration error definitions
+var (
+	ListHydrate = ae.GetCustomErr("ERR_OS_HYDRATE_27000",
+		"error while reading the attributes of listed objects", true)
+)
+
+// Retry error definitions
+var (
+	RetryConfig = ae.GetCustomErr("ERR_OS_RETRY_28000",
+		"invalid retry configuration", false)
+	RetryExhausted = ae.GetCustomErr("ERR_OS_RETRY_28001",
+		"operation failed on every attempt", true)
+	RetryBudgetExhausted = ae.GetCustomErr("ERR_OS_RETRY_28002",
+		"retry budget exhausted", true)
+)
+
+// Replication error definitions
+var (
+	ReplicationQuery = ae.GetCustomErr("ERR_OS_REPLICATION_29000",
+		"error while querying the replication status of an object", false)
+	ReplicationNotReplicated = ae.GetCustomErr("ERR_OS_REPLICATION_29001",
+		"object is not replicated", false)
+	ReplicationWait = ae.GetCustomErr("ERR_OS_REPLICATION_29002",
+		"caller stopped waiting for the replication of an object", true)
+)
+
+// Circuit breaker error definitions
+var (
+	CircuitConfig = ae.GetCustomErr("ERR_OS_CIRCUIT_30000",
+		"invalid circuit breaker configuration", false)
+	// ErrCircuitOpen is returned without calling the provider while the circuit is open
+	ErrCircuitOpen = ae.GetCustomErr("ERR_OS_CIRCUIT_30001",
+		"circuit breaker is open", true)
+)
+
+// Bucket provisioning error definitions
+var (
+	BucketProvision = ae.GetCustomErr("ERR_OS_BUCKET_31000",
+		"failed to provision bucket", true)
+	BucketSpecInvalid = ae.GetCustomErr("ERR_OS_BUCKET_31001",
+		"invalid bucket spec", false)
+)
+
+// Client-side encryption error definitions
+var (
+	EncryptionKey = ae.GetCustomErr("ERR_OS_ENCRYPTION_32000",
+		"failed to wrap or unwrap data key", true)
+	EncryptionEncrypt = ae.GetCustomErr("ERR_OS_ENCRYPTION_32001",
+		"failed to encrypt object", false)
+	EncryptionDecrypt = ae.GetCustomErr("ERR_OS_ENCRYPTION_32002",
+		"failed to decrypt object", false)
+	EncryptionNotEncrypted = ae.GetCustomErr("ERR_OS_ENCRYPTION_32003",
+		"object is not client-side encrypted", false)
+)
+
+// Transfer error definitions
+var (
+	TransferSlotWait = ae.GetCustomErr("ERR_OS_TRANSFER_33000",
+		"timed out waiting for a transfer slot", true)
+)
+
+// Compression error definitions
+var (
+	CompressionConfig = ae.GetCustomErr("ERR_OS_COMPRESSION_34000",
+		"invalid compression configuration", false)
+	CompressionEncode = ae.GetCustomErr("ERR_OS_COMPRESSION_34001",
+		"failed to compress object", false)
+	CompressionDecode = ae.GetCustomErr("ERR_OS_COMPRESSION_34002",
+		"failed to decompress object", false)
+)
+
+// Integrity error definitions
+var (
+	IntegrityConfig = ae.GetCustomErr("ERR_OS_INTEGRITY_35000",
+		"invalid integrity configuration", false)
+	// ErrChecksumMismatch is returned when the content read does not match the checksum stored with the object
+	ErrChecksumMismatch = ae.GetCustomErr("ERR_OS_INTEGRITY_35001",
+		"checksum mismatch", true)
+	IntegrityChecksumMissing = ae.GetCustomErr("ERR_OS_INTEGRITY_35002",
+		"object has no checksum", false)
+)
+
+// Path error definitions
+var (
+	PathInvalid = ae.GetCustomErr("ERR_OS_PATH_36000",
+		"invalid object path", false)
+)
+
+// Undelete error definitions
+var (
+	UndeleteRestore = ae.GetCustomErr("ERR_OS_UNDELETE_37000",
+		"failed to restore object version", true)
+)
+
+// Metrics error definitions
+var (
+	MetricsRegister = ae.GetCustomErr("ERR_OS_METRICS_38000",
+		"failed to register storage metrics", false)
+)
+
+// Cost estimate error definitions
+var (
+	CostEstimate = ae.GetCustomErr("ERR_OS_ESTIMATE_39000",
+		"failed to estimate transfer cost", false)
+)
+
+// Quota error definitions
+var (
+	// ErrQuotaExceeded is returned when a write would take a prefix beyond its quota, the error data is a
+	// QuotaViolation
+	ErrQuotaExceeded = ae.GetCustomErr("ERR_OS_QUOTA_40000",
+		"quota exceeded", false)
+	QuotaUsageStore = ae.GetCustomErr("ERR_OS_QUOTA_40001",
+		"failed to load or save quota usage", true)
+)
+
+// Audit error definitions
+var (
+	AuditWrite = ae.GetCustomErr("ERR_OS_AUDIT_41000",
+		"failed to record audit event", true)
+)
+
+// Deferred delete error definitions
+var (
+	DeferredDeleteConfig = ae.GetCustomErr("ERR_OS_DEFERRED_DELETE_42000",
+		"invalid deferred delete configuration", false)
+	DeferredDeleteTombstone = ae.GetCustomErr("ERR_OS_DEFERRED_DELETE_42001",
+		"failed to read or write delete tombstone", true)
+	DeferredDeleteObjectDeleted = ae.GetCustomErr("ERR_OS_DEFERRED_DELETE_42002",
+		"object is deleted", false)
+	DeferredDeleteReap = ae.GetCustomErr("ERR_OS_DEFERRED_DELETE_42003",
+		"failed to reap deleted object", true)
+)
+
+// Content store error definitions
+var (
+	ContentStoreDigest = ae.GetCustomErr("ERR_OS_CONTENT_STORE_43000",
+		"invalid content digest", false)
+	ContentStoreBlob = ae.GetCustomErr("ERR_OS_CONTENT_STORE_43001",
+		"failed to store or delete blob", true)
+	ContentStoreReferences = ae.GetCustomErr("ERR_OS_CONTENT_STORE_43002",
+		"failed to read or write blob references", true)
+)
+
+// Download manager error definitions
+var (
+	DownloadManagerConfig = ae.GetCustomErr("ERR_OS_DOWNLOAD_MANAGER_44000",
+		"invalid download manager configuration", false)
+	DownloadManagerBudget = ae.GetCustomErr("ERR_OS_DOWNLOAD_MANAGER_44001",
+		"download memory budget exceeded", true)
+	DownloadManagerFetch = ae.GetCustomErr("ERR_OS_DOWNLOAD_MANAGER_44002",
+		"failed to fetch object through download manager", true)
+)
+
+// Trash error definitions
+var (
+	TrashMove = ae.GetCustomErr("ERR_OS_TRASH_45000",
+		"failed to move object to trash", true)
+	TrashRestore = ae.GetCustomErr("ERR_OS_TRASH_45001",
+		"failed to restore object from trash", true)
+	TrashPurge = ae.GetCustomErr("ERR_OS_TRASH_45002",
+		"failed to purge trash", true)
+)
+
+// Versioned backend error definitions
+var (
+	VersionedConfig = ae.GetCustomErr("ERR_OS_VERSIONED_46000",
+		"invalid versioned backend configuration", false)
+	VersionedArchive = ae.GetCustomErr("ERR_OS_VERSIONED_46001",
+		"failed to keep previous object version", true)
+	VersionedNotFound = ae.GetCustomErr("ERR_OS_VERSIONED_46002",
+		"object version not kept", false)
+)
+
+// Immutability error definitions
+var (
+	// ErrImmutable is returned when a write or delete would change an object retained by an ImmutableBackend
+	ErrImmutable = ae.GetCustomErr("ERR_OS_IMMUTABLE_47000",
+		"object is immutable", false)
+)
+
+// Router backend error definitions
+var (
+	RouterConfig = ae.GetCustomErr("ERR_OS_ROUTER_48000",
+		"invalid router backend configuration", false)
+	RouterNoRoute = ae.GetCustomErr("ERR_OS_ROUTER_48001",
+		"no backend routes the path", false)
+	RouterListObjects = ae.GetCustomErr("ERR_OS_ROUTER_48002",
+		"failed to list objects across routes", true)
+)
+
+// Dry run backend error definitions
+var (
+	DryRunStat = ae.GetCustomErr("ERR_OS_DRY_RUN_49000",
+		"failed to look up the object a mutation would change", true)
+	DryRunCopySource = ae.GetCustomErr("ERR_OS_DRY_RUN_49001",
+		"source object of the copy not found", false)
+)
+
+// Chaos backend error definitions
+var (
+	ChaosConfig = ae.GetCustomErr("ERR_OS_CHAOS_50000",
+		"invalid chaos backend configuration", false)
+	ChaosInjected = ae.GetCustomErr("ERR_OS_CHAOS_50001",
+		"injected storage failure", true)
+	ChaosThrottled = ae.GetCustomErr("ERR_OS_CHAOS_50002",
+		"injected storage throttling", true)
+	ChaosPartialRead = ae.GetCustomErr("ERR_OS_CHAOS_50003",
+		"injected partial read", true)
+)
+
+// Record and replay error definitions
+var (
+	ReplayFixture = ae.GetCustomErr("ERR_OS_REPLAY_51000",
+		"invalid replay fixture", false)
+	ReplayMissing = ae.GetCustomErr("ERR_OS_REPLAY_51001",
+		"no recorded interaction for the call", false)
+)
+
+// Read deduplication error definitions
+var (
+	DedupGetWait = ae.GetCustomErr("ERR_OS_DEDUP_GET_52000",
+		"caller stopped waiting for a shared read", true)
+)
+
+// Streaming upload error definitions
+var (
+	StreamUploadSize = ae.GetCustomErr("ERR_OS_STREAM_53000",
+		"streamed content length does not match the declared size", false)
+	StreamUploadRead = ae.GetCustomErr("ERR_OS_STREAM_53001",
+		"failed to read the streamed content", false)
+)
+
+// Batch delete error definitions
+var (
+	BatchDeleteIncomplete = ae.GetCustomErr("ERR_OS_BATCH_DELETE_54000",
+		"failed to delete some objects of a batch", true)
+)
+
+// Prefix delete error definitions
+var (
+	DeletePrefixList = ae.GetCustomErr("ERR_OS_DELETE_PREFIX_55000",
+		"failed to list the objects to delete", true)
+	DeletePrefixIncomplete = ae.GetCustomErr("ERR_OS_DELETE_PREFIX_55001",
+		"failed to delete some objects at the prefix", true)
+)
+
+// Listing filter error definitions
+var (
+	ListFilter = ae.GetCustomErr("ERR_OS_LIST_FILTER_56000",
+		"invalid listing filter", false)
+)
+
+// Presigned upload error definitions
+var (
+	PresignUnsupported = ae.GetCustomErr("ERR_OS_PRESIGN_57000",
+		"presigned uploads are not supported by the backend", false)
+	PresignInvalid = ae.GetCustomErr("ERR_OS_PRESIGN_57001",
+		"invalid presigned upload request", false)
+	PresignUpload = ae.GetCustomErr("ERR_OS_PRESIGN_57002",
+		"failed to presign the upload", true)
+)
+
+// Multipart upload error definitions
+var (
+	MultipartInvalid = ae.GetCustomErr("ERR_OS_MULTIPART_58000",
+		"invalid multipart upload request", false)
+	MultipartOperation = ae.GetCustomErr("ERR_OS_MULTIPART_58001",
+		"error while managing a multipart upload", true)
+)
+
+// Append error definitions
+var (
+	AppendConflict = ae.GetCustomErr("ERR_OS_APPEND_59000",
+		"object changed while appending", true)
+	AppendOperation = ae.GetCustomErr("ERR_OS_APPEND_59001",
+		"failed to append to the object", true)
+)
+
+// ACL error definitions
+var (
+	ACLUnsupported = ae.GetCustomErr("ERR_OS_ACL_60000",
+		"object acls are not supported by the backend", false)
+	ACLInvalid = ae.GetCustomErr("ERR_OS_ACL_60001",
+		"invalid object acl", false)
+	ACLOperation = ae.GetCustomErr("ERR_OS_ACL_60002",
+		"failed to update the object acl", true)
+)
+
+// Conditional read error definitions
+var (
+	// ErrNotModified is returned by conditional reads of an object that has not changed
+	ErrNotModified = ae.GetCustomErr("ERR_OS_CONDITIONAL_61000",
+		"object not modified", false)
+)
+
+// Storage class error definitions
+var (
+	StorageClassInvalid = ae.GetCustomErr("ERR_OS_STORAGECLASS_62000",
+		"invalid storage class", false)
+	StorageClassTransition = ae.GetCustomErr("ERR_OS_STORAGECLASS_62001",
+		"failed to change the storage class of the object", true)
+)
+
+// Object version error definitions
+var (
+	VersionInvalid = ae.GetCustomErr("ERR_OS_VERSION_63000",
+		"invalid object version", false)
+	VersionOperation = ae.GetCustomErr("ERR_OS_VERSION_63001",
+		"failed to manage the object versions", true)
+)
+
+// Retention error definitions
+var (
+	RetentionInvalid = ae.GetCustomErr("ERR_OS_RETENTION_64000",
+		"invalid object retention", false)
+	RetentionOperation = ae.GetCustomErr("ERR_OS_RETENTION_64001",
+		"failed to set the object retention or legal hold", true)
+)
+
+// Customer key error definitions
+var (
+	CustomerKeyInvalid = ae.GetCustomErr("ERR_OS_CUSTOMERKEY_65000",
+		"invalid customer supplied encryption key", false)
+)
+
+// Metadata update error definitions
+var (
+	MetadataOperation = ae.GetCustomErr("ERR_OS_METADATA_66000",
+		"failed to update the object metadata", true)
+)
+
+// Upload from file error definitions
+var (
+	UploadFile = ae.GetCustomErr("ERR_OS_UPLOAD_FILE_67000",
+		"failed to upload the file", true)
+)
+
+// Transfer error definitions
+var (
+	TransferChecksumMismatch = ae.GetCustomErr("ERR_OS_TRANSFER_68000",
+		"transferred object does not match the source", false)
+	TransferOperation = ae.GetCustomErr("ERR_OS_TRANSFER_68001",
+		"failed to transfer the object", true)
+)
+
+// Prefix copy error definitions
+var (
+	CopyPrefixInvalid = ae.GetCustomErr("ERR_OS_COPY_PREFIX_69000",
+		"invalid prefix copy", false)
+	CopyPrefixList = ae.GetCustomErr("ERR_OS_COPY_PREFIX_69001",
+		"failed to list the objects to copy", true)
+	CopyPrefixIncomplete = ae.GetCustomErr("ERR_OS_COPY_PREFIX_69002",
+		"failed to copy some objects of the prefix", true)
+)
+
+// Prefix rename error definitions
+var (
+	RenamePrefixInvalid = ae.GetCustomErr("ERR_OS_RENAME_PREFIX_70000",
+		"invalid prefix rename", false)
+	RenamePrefixList = ae.GetCustomErr("ERR_OS_RENAME_PREFIX_70001",
+		"failed to list the objects to move", true)
+	RenamePrefixIncomplete = ae.GetCustomErr("ERR_OS_RENAME_PREFIX_70002",
+		"failed to move some objects of the prefix", true)
+)
+
+// Prefix statistics error definitions
+var (
+	PrefixStatsList = ae.GetCustomErr("ERR_OS_PREFIX_STATS_71000",
+		"failed to list the objects of the prefix", true)
+)
+
+// Batch upload error definitions
+var (
+	BatchPutIncomplete = ae.GetCustomErr("ERR_OS_BATCH_PUT_72000",
+		"failed to upload some objects of a batch", true)
+	BatchPutSkipped = ae.GetCustomErr("ERR_OS_BATCH_PUT_72001",
+		"upload skipped after an earlier failure", true)
+)
+
+// Batch download error definitions
+var (
+	BatchGetIncomplete = ae.GetCustomErr("ERR_OS_BATCH_GET_73000",
+		"failed to download some objects of a batch", true)
+	BatchGetSkipped = ae.GetCustomErr("ERR_OS_BATCH_GET_73001",
+		"download skipped after an earlier failure", true)
+)
+
+// Walk error definitions
+var (
+	WalkList = ae.GetCustomErr("ERR_OS_WALK_74000",
+		"failed to list the objects to walk", true)
+	WalkCallback = ae.GetCustomErr("ERR_OS_WALK_74001",
+		"walk stopped by the callback", false)
+)
+
+// Sync error definitions
+var (
+	SyncLocal = ae.GetCustomErr("ERR_OS_SYNC_75000",
+		"failed to read the local directory", false)
+	SyncList = ae.GetCustomErr("ERR_OS_SYNC_75001",
+		"failed to list the remote objects", true)
+	SyncIncomplete = ae.GetCustomErr("ERR_OS_SYNC_75002",
+		"failed to sync some files", true)
+)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	storage "github.com/piyushkumar96/generic-object-storage"
 
@@ -21,8 +22,14 @@ func main() {
 		runS3Example(ctx)
 	case "gcs":
 		runGCSExample(ctx)
+	case "cos":
+		runCOSExample(ctx)
+	case "hdfs":
+		runHDFSExample(ctx)
+	case "redis":
+		runRedisExample(ctx)
 	default:
-		fmt.Println("Set STORAGE_TYPE environment variable to 's3' or 'gcs'")
+		fmt.Println("Set STORAGE_TYPE environment variable to 's3', 'gcs', 'cos', 'hdfs' or 'redis'")
 		fmt.Println("Example: STORAGE_TYPE=gcs go run example.go")
 	}
 }
@@ -84,6 +91,58 @@ func runS3Example(ctx context.Context) {
 	demonstrateOperations(ctx, backend, "S3")
 }
 
+// runCOSExample demonstrates Tencent Cloud COS operations
+func runCOSExample(ctx context.Context) {
+	bucketName := os.Getenv("COS_BUCKET")
+	region := os.Getenv("COS_REGION")
+	if bucketName == "" || region == "" {
+		log.Fatal("COS_BUCKET and COS_REGION environment variables are required")
+	}
+
+	objectPrefix := os.Getenv("COS_PREFIX") // optional, can be empty
+
+	backend, appErr := storage.NewCOSBackend(bucketName, objectPrefix, region, os.Getenv("COS_SECRET_ID"), os.Getenv("COS_SECRET_KEY"))
+	if appErr != nil {
+		log.Fatalf("Failed to create COS backend: %v", appErr)
+	}
+
+	demonstrateOperations(ctx, backend, "COS")
+}
+
+// runHDFSExample demonstrates HDFS operations over WebHDFS
+func runHDFSExample(ctx context.Context) {
+	endpoint := os.Getenv("HDFS_ENDPOINT")
+	if endpoint == "" {
+		log.Fatal("HDFS_ENDPOINT environment variable is required (e.g. http://namenode:9870)")
+	}
+
+	objectPrefix := os.Getenv("HDFS_PREFIX") // optional, can be empty
+
+	backend, appErr := storage.NewHDFSBackend(endpoint, objectPrefix, os.Getenv("HDFS_USER"))
+	if appErr != nil {
+		log.Fatalf("Failed to create HDFS backend: %v", appErr)
+	}
+
+	demonstrateOperations(ctx, backend, "HDFS")
+}
+
+// runRedisExample demonstrates Redis operations
+func runRedisExample(ctx context.Context) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		log.Fatal("REDIS_ADDR environment variable is required (e.g. localhost:6379)")
+	}
+
+	objectPrefix := os.Getenv("REDIS_PREFIX") // optional, can be empty
+
+	backend, appErr := storage.NewRedisBackend(addr, os.Getenv("REDIS_PASSWORD"), 0, objectPrefix, time.Hour)
+	if appErr != nil {
+		log.Fatalf("Failed to create Redis backend: %v", appErr)
+	}
+
+	demonstrateOperations(ctx, backend, "Redis")
+}
+
 // demonstrateOperations shows common storage operations
 func demonstrateOperations(ctx context.Context, backend storage.IStorageBackend, providerName string) {
 	fmt.Printf("\n=== %s Storage Operations ===\n\n", providerName)
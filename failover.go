@@ -0,0 +1,277 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultFailoverProbeInterval = 30 * time.Second
+	defaultFailoverProbePath     = ".failover-probe"
+)
+
+// FailoverCondition reports whether an error of a backend should move the operation to the next backend
+type FailoverCondition func(appErr *ae.AppError) bool
+
+// FailoverOnUnavailable is the default FailoverCondition: server errors other than 501 Not Implemented, which
+// another backend of the same kind would return as well, and 429 Too Many Requests
+func FailoverOnUnavailable(appErr *ae.AppError) bool {
+	code := appErr.GetHTTPCode()
+	return code == http.StatusTooManyRequests || (code >= http.StatusInternalServerError && code != http.StatusNotImplemented)
+}
+
+// FailoverOption configures a FailoverBackend
+type FailoverOption func(*FailoverBackend)
+
+// WithFailoverCondition sets the errors on which an operation fails over to the next backend
+func WithFailoverCondition(condition FailoverCondition) FailoverOption {
+	return func(b *FailoverBackend) {
+		b.Condition = condition
+	}
+}
+
+// WithHealthProbe sets how often unhealthy backends are probed and the path probed, a missing object at path
+// counts as healthy
+func WithHealthProbe(interval time.Duration, path string) FailoverOption {
+	return func(b *FailoverBackend) {
+		b.ProbeInterval = interval
+		b.ProbePath = path
+	}
+}
+
+// FailoverBackend is an IStorageBackend routing every operation to the first healthy backend, primary first. A
+// backend failing with an error matching Condition is marked unhealthy and the operation is retried on the next
+// one. Unhealthy backends are probed in the background once Start is called and traffic fails back to them as soon
+// as they recover. Writes made during a failover only land on the secondary, so secondaries should be kept in sync
+// with the primary, e.g. by a MirrorBackend. Create it with NewFailoverBackend.
+type FailoverBackend struct {
+	// Backends are tried in order, the first one is the primary
+	Backends      []IStorageBackend
+	Condition     FailoverCondition
+	ProbeInterval time.Duration
+	ProbePath     string
+
+	mu      sync.Mutex
+	healthy []bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewFailoverBackend creates a new instance of FailoverBackend falling back from primary to secondaries in order
+func NewFailoverBackend(primary IStorageBackend, secondaries []IStorageBackend, opts ...FailoverOption) (*FailoverBackend, *ae.AppError) {
+	backends := append([]IStorageBackend{primary}, secondaries...)
+	for i, backend := range backends {
+		if backend == nil {
+			return nil, ae.GetAppErr(context.Background(), fmt.Errorf("backend %d is nil", i), FailoverConfig, http.StatusInternalServerError)
+		}
+	}
+	if len(secondaries) == 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("at least one secondary is required"), FailoverConfig, http.StatusInternalServerError)
+	}
+	b := &FailoverBackend{
+		Backends:      backends,
+		Condition:     FailoverOnUnavailable,
+		ProbeInterval: defaultFailoverProbeInterval,
+		ProbePath:     defaultFailoverProbePath,
+		healthy:       make([]bool, len(backends)),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.ProbeInterval <= 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("probe interval must be positive"), FailoverConfig, http.StatusInternalServerError)
+	}
+	for i := range b.healthy {
+		b.healthy[i] = true
+	}
+	return b, nil
+}
+
+// Start probes unhealthy backends every ProbeInterval until ctx is done or Stop is called
+func (b *FailoverBackend) Start(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return
+	}
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.wg.Add(1)
+	go b.probeLoop(ctx)
+}
+
+// Stop stops the health probes
+func (b *FailoverBackend) Stop() {
+	b.mu.Lock()
+	cancel := b.cancel
+	b.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	b.wg.Wait()
+}
+
+// Healthy reports the health of every backend, in the order of Backends
+func (b *FailoverBackend) Healthy() []bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]bool(nil), b.healthy...)
+}
+
+// Unwrap returns the primary backend
+func (b *FailoverBackend) Unwrap() IStorageBackend {
+	return b.Backends[0]
+}
+
+// Describe reports the backends with their health and the probe settings
+func (b *FailoverBackend) Describe() map[string]string {
+	healthy := b.Healthy()
+	states := make([]string, len(healthy))
+	for i, ok := range healthy {
+		states[i] = strconv.FormatBool(ok)
+	}
+	description := map[string]string{
+		"healthy":       strings.Join(states, ","),
+		"probeInterval": b.ProbeInterval.String(),
+		"probePath":     b.ProbePath,
+	}
+	for i, backend := range b.Backends[1:] {
+		description["secondary"+strconv.Itoa(i)] = DescribeBackend(backend).String()
+	}
+	return description
+}
+
+// GetObject retrieves an object from the first healthy backend
+func (b *FailoverBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	var object Object
+	appErr := b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		var appErr *ae.AppError
+		object, appErr = backend.GetObject(ctx, path, opts...)
+		return appErr
+	})
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix of the first healthy backend
+func (b *FailoverBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	var objects []Object
+	appErr := b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		var appErr *ae.AppError
+		objects, appErr = backend.GetObjects(ctx, prefix)
+		return appErr
+	})
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix of the first healthy backend. A cursor is only meaningful to the
+// backend that returned it, so paginated listings may restart when the backend changes between pages.
+func (b *FailoverBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	appErr := b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		var appErr *ae.AppError
+		result, appErr = backend.ListObjects(ctx, prefix, opts...)
+		return appErr
+	})
+	return result, appErr
+}
+
+// PutObject uploads an object to the first healthy backend
+func (b *FailoverBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		return backend.PutObject(ctx, path, content, opts...)
+	})
+}
+
+// DeleteObject removes an object from the first healthy backend
+func (b *FailoverBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		return backend.DeleteObject(ctx, path)
+	})
+}
+
+// CopyObject copies an object on the first healthy backend
+func (b *FailoverBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.route(ctx, func(backend IStorageBackend) *ae.AppError {
+		return backend.CopyObject(ctx, srcPath, dstPath)
+	})
+}
+
+// route runs op on the healthy backends in order, then on the unhealthy ones, until one succeeds or fails with
+// an error not matching Condition
+func (b *FailoverBackend) route(ctx context.Context, op func(IStorageBackend) *ae.AppError) *ae.AppError {
+	var lastErr *ae.AppError
+	for _, i := range b.order() {
+		appErr := op(b.Backends[i])
+		if appErr == nil {
+			b.setHealthy(i, true)
+			return nil
+		}
+		if !b.Condition(appErr) {
+			return appErr
+		}
+		b.setHealthy(i, false)
+		lastErr = appErr
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr.AddErrCode(FailoverExhausted.Code)
+}
+
+// order returns the indexes of the healthy backends followed by the unhealthy ones, each in configured order
+func (b *FailoverBackend) order() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	order := make([]int, 0, len(b.healthy))
+	for i, ok := range b.healthy {
+		if ok {
+			order = append(order, i)
+		}
+	}
+	for i, ok := range b.healthy {
+		if !ok {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// setHealthy records the health of backend i
+func (b *FailoverBackend) setHealthy(i int, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.healthy[i] = healthy
+}
+
+// probeLoop probes the unhealthy backends every ProbeInterval until ctx is done
+func (b *FailoverBackend) probeLoop(ctx context.Context) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for i, healthy := range b.Healthy() {
+			if !healthy {
+				b.setHealthy(i, b.probe(ctx, b.Backends[i]))
+			}
+		}
+	}
+}
+
+// probe reads ProbePath from backend, any outcome not matching Condition, including 404, counts as healthy
+func (b *FailoverBackend) probe(ctx context.Context, backend IStorageBackend) bool {
+	ctx, cancel := context.WithTimeout(ctx, b.ProbeInterval)
+	defer cancel()
+	_, appErr := backend.GetObject(ctx, b.ProbePath, WithRange(0, 1))
+	return appErr == nil || !b.Condition(appErr)
+}
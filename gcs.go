@@ -1,14 +1,18 @@
 package object_storage
 
 import (
+	"bytes"
 	"cloud.google.com/go/storage"
+	"fmt"
 	ae "github.com/piyushkumar96/app-error"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"io"
 	"net/http"
-	pathutil "path"
+	"strconv"
+	"time"
 )
 
 // IGCSClient this interface is added to make Client ins GCS BucketHandle mock compatible for tests
@@ -38,23 +42,80 @@ func NewGoogleCSBackend(ctx context.Context, bucket string, prefix string) (*Goo
 	return b, nil
 }
 
+// Describe reports the bucket and prefix the backend is bound to
+func (b GoogleCSBackend) Describe() map[string]string {
+	config := map[string]string{
+		"prefix": b.Prefix,
+	}
+	if bucket, ok := b.Client.(interface{ BucketName() string }); ok {
+		config["bucket"] = bucket.BucketName()
+	}
+	return config
+}
+
 // GetObject retrieves an object from Google Cloud Storage bucket, at prefix
-func (b GoogleCSBackend) GetObject(ctx context.Context, path string) (Object, *ae.AppError) {
+func (b GoogleCSBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
 	var object Object
 	object.Path = path
-	objectHandle := b.Client.Object(pathutil.Join(b.Prefix, path))
+	objectHandle := b.Client.Object(objectKey(b.Prefix, path))
+	if options.CustomerKey != nil {
+		if appErr := validateCustomerKey(ctx, options.CustomerKey); appErr != nil {
+			return object, appErr
+		}
+		objectHandle = objectHandle.Key(options.CustomerKey)
+	}
+	if options.VersionID != "" {
+		generation, err := strconv.ParseInt(options.VersionID, 10, 64)
+		if err != nil {
+			return object, ae.GetAppErr(ctx, errors.Wrapf(err, "invalid generation %q", options.VersionID), GCSGetObject, http.StatusBadRequest)
+		}
+		objectHandle = objectHandle.Generation(generation)
+	} else if options.versioned() {
+		generation, appErr := b.generationAt(ctx, path, options.AsOf)
+		if appErr != nil {
+			return object, appErr
+		}
+		objectHandle = objectHandle.Generation(generation)
+		object.VersionID = strconv.FormatInt(generation, 10)
+	}
 	attrs, err := objectHandle.Attrs(ctx)
 	if err != nil {
 		appErr := ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
 		if err.Error() == storage.ErrObjectNotExist.Error() {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
 		}
 		return object, appErr
 	}
-	object.LastModified = attrs.Updated
-	rc, err := objectHandle.NewReader(ctx)
+	setGCSObjectAttrs(&object, attrs)
+	if options.unchanged(object) {
+		return Object{Path: path}, notModifiedErr(ctx, path)
+	}
+	if options.conditional() {
+		// read the generation the conditions were checked against
+		objectHandle = objectHandle.Generation(attrs.Generation)
+	}
+	offset, length := int64(0), int64(-1)
+	if options.Range != nil {
+		offset = options.Range.Offset
+		// a negative offset reads the suffix, which takes a negative length
+		if options.Range.Length > 0 && offset >= 0 {
+			length = options.Range.Length
+		}
+	}
+	rc, err := objectHandle.NewRangeReader(ctx, offset, length)
 	if err != nil {
-		return object, ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
+		appErr := ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
+		if status, ok := gcsCustomerKeyStatus(err); ok {
+			appErr = appErr.SetHTTPCode(status)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		}
+		return object, appErr
 	}
 	content, err := io.ReadAll(rc)
 	if err != nil {
@@ -68,13 +129,53 @@ func (b GoogleCSBackend) GetObject(ctx context.Context, path string) (Object, *a
 	return object, nil
 }
 
+// StatObject reads the attributes of the object at path, without its content. Object.VersionID is its generation.
+func (b GoogleCSBackend) StatObject(ctx context.Context, path string) (Object, *ae.AppError) {
+	object := Object{Path: path}
+	attrs, err := b.Client.Object(objectKey(b.Prefix, path)).Attrs(ctx)
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return object, appErr
+	}
+	setGCSObjectAttrs(&object, attrs)
+	return object, nil
+}
+
 // GetObjects lists all objects in Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
-	var objects []Object
-	prefix = pathutil.Join(b.Prefix, prefix)
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects in Google Cloud Storage bucket, at prefix, honouring MaxKeys and cursor options
+func (b GoogleCSBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	prefix = listPrefix(b.Prefix, prefix)
+	options.Cursor = options.startCursor(prefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
 	listQuery := &storage.Query{
-		Prefix: prefix,
+		Prefix:    prefix,
+		Versions:  options.Versions != VersionsCurrent,
+		MatchGlob: options.providerGlob(prefix),
+	}
+	if options.Cursor != "" {
+		// StartOffset is inclusive, the cursor holds the last key already returned
+		listQuery.StartOffset = options.Cursor + "\x00"
 	}
+	// lastKey is the name of the last listed object; completeKey and completeCount describe the listing up to the
+	// last object whose generations are all listed, which is where an interrupted version listing resumes
+	var lastKey, completeKey string
+	var completeCount int
 	it := b.Client.Objects(ctx, listQuery)
 	for {
 		attrs, err := it.Next()
@@ -85,45 +186,198 @@ func (b GoogleCSBackend) GetObjects(ctx context.Context, prefix string) ([]Objec
 			appErr := ae.GetAppErr(ctx, err, GCSGetObjects, http.StatusInternalServerError)
 			if err.Error() == storage.ErrObjectNotExist.Error() {
 				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if gcsAccessDenied(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if retryAfter, ok := gcsRetryAfter(err); ok {
+				appErr = throttled(appErr, retryAfter)
+			}
+			if options.Versions != VersionsCurrent {
+				result.Objects = result.Objects[:completeCount]
+				lastKey = completeKey
 			}
-			return objects, appErr
+			result.interrupted(lastKey, options)
+			if options.Versions != VersionsCurrent {
+				sortVersionsNewestFirst(result.Objects)
+			}
+			return result, appErr
+		}
+		// all generations of an object are kept on the same page, as the cursor only holds the object name
+		if attrs.Name != lastKey && options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = lastKey
+			break
 		}
+		if attrs.Name != lastKey {
+			completeKey, completeCount = lastKey, len(result.Objects)
+		}
+		result.Scanned++
+		lastKey = attrs.Name
 		path := removePrefixFromObjectPath(prefix, attrs.Name)
 		object := Object{
 			Path:         path,
 			Content:      []byte{},
 			LastModified: attrs.Updated,
+			Size:         attrs.Size,
+			StorageClass: attrs.StorageClass,
+			ETag:         attrs.Etag,
+			CRC32C:       gcsCRC32C(attrs.CRC32C),
+			VersionID:    strconv.FormatInt(attrs.Generation, 10),
+		}
+		if options.Hydrate > 0 && options.Versions == VersionsCurrent {
+			// listings return all attributes of an object, hydrating them costs no extra request
+			object.ContentType = attrs.ContentType
+			object.CacheControl = attrs.CacheControl
+			object.ContentEncoding = attrs.ContentEncoding
+			object.ContentDisposition = attrs.ContentDisposition
+			object.ContentLanguage = attrs.ContentLanguage
+			object.Encryption = gcsEncryption(attrs)
+			object.Meta.User = attrs.Metadata
+		}
+		if options.Versions != VersionsCurrent {
+			// GCS has no delete markers, a noncurrent generation carries its deletion time instead
+			object.IsLatest = attrs.Deleted.IsZero()
+		}
+		if options.matches(object) {
+			result.Objects = append(result.Objects, object)
+		}
+	}
+	if options.Versions != VersionsCurrent {
+		sortVersionsNewestFirst(result.Objects)
+	}
+	return result, nil
+}
+
+// ListDir lists one level of prefix in Google Cloud Storage bucket, grouping the objects below it by subdirectory
+// with a delimiter, honouring MaxKeys and cursor options
+func (b GoogleCSBackend) ListDir(ctx context.Context, prefix string, opts ...ListOption) (DirListing, *ae.AppError) {
+	var listing DirListing
+	options := getListOptions(opts)
+	fullPrefix := dirKey(b.Prefix, prefix)
+	listQuery := &storage.Query{
+		Prefix:    fullPrefix,
+		Delimiter: dirDelimiter,
+	}
+	if options.Cursor != "" {
+		// StartOffset is inclusive, the cursor holds the last entry already returned
+		listQuery.StartOffset = fullPrefix + dirStartAfter(options.Cursor) + "\x00"
+	}
+	it := b.Client.Objects(ctx, listQuery)
+	if options.MaxKeys > 0 {
+		it.PageInfo().MaxSize = options.MaxKeys
+	}
+	// a page returns its objects before its prefixes, so entries are taken in lexical order a page at a time
+	var page DirListing
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, GCSGetObjects, http.StatusInternalServerError)
+			if err.Error() == storage.ErrObjectNotExist.Error() {
+				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if gcsAccessDenied(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if retryAfter, ok := gcsRetryAfter(err); ok {
+				appErr = throttled(appErr, retryAfter)
+			}
+			listing.interrupted(options)
+			return listing, appErr
+		}
+		if attrs.Prefix != "" {
+			page.Prefixes = append(page.Prefixes, removePrefixFromObjectPath(fullPrefix, attrs.Prefix))
+		} else if path := removePrefixFromObjectPath(fullPrefix, attrs.Name); path != "" {
+			page.Objects = append(page.Objects, Object{
+				Path:         path,
+				Content:      []byte{},
+				LastModified: attrs.Updated,
+				Size:         attrs.Size,
+				StorageClass: attrs.StorageClass,
+				ETag:         attrs.Etag,
+				CRC32C:       gcsCRC32C(attrs.CRC32C),
+				VersionID:    strconv.FormatInt(attrs.Generation, 10),
+			})
+		}
+		if it.PageInfo().Remaining() == 0 {
+			if listing.take(page, options) {
+				break
+			}
+			page = DirListing{}
 		}
-		objects = append(objects, object)
 	}
-	return objects, nil
+	return listing, nil
 }
 
 // PutObject uploads an object to Google Cloud Storage bucket, at prefix
-func (b GoogleCSBackend) PutObject(ctx context.Context, path string, content []byte) *ae.AppError {
-	wc := b.Client.Object(pathutil.Join(b.Prefix, path)).NewWriter(ctx)
-	_, err := wc.Write(content)
+func (b GoogleCSBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.write(ctx, path, bytes.NewReader(content), getPutOptions(opts))
+}
+
+// PutObjectStream uploads the content read from r to Google Cloud Storage bucket, at prefix, in chunks, without
+// holding it in memory. A negative size means the length is unknown.
+func (b GoogleCSBackend) PutObjectStream(ctx context.Context, path string, r io.Reader, size int64, opts ...PutOption) *ae.AppError {
+	body := newSizedReader(r, size)
+	appErr := b.write(ctx, path, body, getPutOptions(opts))
+	if readErr := body.appErr(ctx, path); readErr != nil {
+		return readErr
+	}
+	return appErr
+}
+
+// write uploads body to path with the attributes and encryption of options. A failure reading body cancels the
+// upload, so that no partial object is stored.
+func (b GoogleCSBackend) write(ctx context.Context, path string, body io.Reader, options PutOptions) *ae.AppError {
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objectHandle := b.Client.Object(objectKey(b.Prefix, path))
+	if options.customerKeyed() {
+		if appErr := validateCustomerKey(ctx, options.Encryption.CustomerKey); appErr != nil {
+			return appErr
+		}
+		objectHandle = objectHandle.Key(options.Encryption.CustomerKey)
+	}
+	wc := objectHandle.NewWriter(writeCtx)
+	if appErr := applyGCSWriterOptions(ctx, wc, options); appErr != nil {
+		return appErr
+	}
+	_, err := io.Copy(wc, body)
 	if err != nil {
+		cancel()
 		appErr := ae.GetAppErr(ctx, err, GCSPutObject, http.StatusInternalServerError)
 		if err.Error() == storage.ErrObjectNotExist.Error() {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
 		}
 		return appErr
 	}
 	err = wc.Close()
 	if err != nil {
-		return ae.GetAppErr(ctx, err, GCSPutObject, http.StatusInternalServerError)
+		// writes are buffered, so a refused upload usually fails on close
+		appErr := ae.GetAppErr(ctx, err, GCSPutObject, http.StatusInternalServerError)
+		if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
 	}
 	return nil
 }
 
 // DeleteObject removes an object from Google Cloud Storage bucket, at prefix
 func (b GoogleCSBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
-	err := b.Client.Object(pathutil.Join(b.Prefix, path)).Delete(ctx)
+	err := b.Client.Object(objectKey(b.Prefix, path)).Delete(ctx)
 	if err != nil {
 		appErr := ae.GetAppErr(ctx, err, GCSDeleteObject, http.StatusInternalServerError)
 		if err.Error() == storage.ErrObjectNotExist.Error() {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsAccessDenied(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
 		}
 		return appErr
 	}
@@ -132,14 +386,93 @@ func (b GoogleCSBackend) DeleteObject(ctx context.Context, path string) *ae.AppE
 
 // CopyObject copy an object from Google Cloud Storage bucket one path to another
 func (b GoogleCSBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
-	src := b.Client.Object(srcPath)
-	dst := b.Client.Object(dstPath)
-	if _, err := dst.CopierFrom(src).Run(ctx); err != nil {
-		appErr := ae.GetAppErr(ctx, err, GCSCopyObject, http.StatusInternalServerError)
-		if err.Error() == storage.ErrObjectNotExist.Error() {
-			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	// metadata and content headers are copied by GCS, the storage class and CMEK would fall back to the bucket
+	// defaults
+	return b.copyFrom(ctx, b, srcPath, dstPath, true, nil)
+}
+
+// applyGCSWriterOptions maps the put options onto the object writer
+func applyGCSWriterOptions(ctx context.Context, wc *storage.Writer, options PutOptions) *ae.AppError {
+	if len(options.Tags) > 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("object tags are not supported by gcs, use metadata"), GCSPutObject, http.StatusNotImplemented)
+	}
+	wc.ContentType = options.ContentType
+	wc.CacheControl = options.CacheControl
+	wc.ContentEncoding = options.ContentEncoding
+	wc.ContentDisposition = options.ContentDisposition
+	wc.ContentLanguage = options.ContentLanguage
+	wc.Metadata = options.Metadata
+	wc.StorageClass = options.StorageClass
+	if options.Encryption != nil {
+		switch options.Encryption.Type {
+		case EncryptionKMS:
+			wc.KMSKeyName = options.Encryption.KMSKeyID
+		case EncryptionNone, EncryptionProviderManaged:
+			// GCS always encrypts with google managed keys unless a CMEK is given
+		case EncryptionCustomerKey:
+			// customer supplied keys are given to the object handle the writer is created from
+		default:
+			return ae.GetAppErr(ctx, fmt.Errorf("unsupported encryption type %q", options.Encryption.Type), GCSPutObject, http.StatusBadRequest)
 		}
-		return appErr
 	}
 	return nil
 }
+
+// setGCSObjectAttrs sets the attributes of object from its GCS attributes
+func setGCSObjectAttrs(object *Object, attrs *storage.ObjectAttrs) {
+	object.LastModified = attrs.Updated
+	object.Encryption = gcsEncryption(attrs)
+	object.ContentType = attrs.ContentType
+	object.CacheControl = attrs.CacheControl
+	object.ContentEncoding = attrs.ContentEncoding
+	object.ContentDisposition = attrs.ContentDisposition
+	object.ContentLanguage = attrs.ContentLanguage
+	object.StorageClass = attrs.StorageClass
+	object.ETag = attrs.Etag
+	object.CRC32C = gcsCRC32C(attrs.CRC32C)
+	object.VersionID = strconv.FormatInt(attrs.Generation, 10)
+	object.Retention = gcsRetention(attrs.Retention)
+	object.LegalHold = attrs.TemporaryHold
+	object.Meta.User = attrs.Metadata
+	object.Size = attrs.Size
+}
+
+// gcsCRC32C returns the hex form of a GCS CRC32C checksum
+func gcsCRC32C(checksum uint32) string {
+	return fmt.Sprintf("%08x", checksum)
+}
+
+// gcsEncryption reports the encryption of an object from its attributes
+func gcsEncryption(attrs *storage.ObjectAttrs) Encryption {
+	if attrs.KMSKeyName != "" {
+		return Encryption{Type: EncryptionKMS, KMSKeyID: attrs.KMSKeyName}
+	}
+	if attrs.CustomerKeySHA256 != "" {
+		return Encryption{Type: EncryptionCustomerKey}
+	}
+	return Encryption{Type: EncryptionProviderManaged}
+}
+
+// gcsPreconditionFailed reports whether err is GCS rejecting a request whose precondition failed
+func gcsPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// gcsAccessDenied reports whether err is GCS refusing a request for missing credentials or permissions
+func gcsAccessDenied(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && (apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden)
+}
+
+// gcsRetryAfter reports whether err is GCS throttling the request, with the delay asked by its Retry-After header
+func gcsRetryAfter(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if retryAfter, ok := parseRetryAfter(apiErr.Header.Get("Retry-After"), time.Now()); ok {
+		return retryAfter, true
+	}
+	return defaultThrottleRetryAfter, true
+}
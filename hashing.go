@@ -0,0 +1,102 @@
+package object_storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/zeebo/xxh3"
+	"lukechampine.com/blake3"
+)
+
+// IHasher is a digest algorithm used for checksums and content deduplication
+type IHasher interface {
+	// Name identifies the algorithm, e.g. in the metadata key of a checksum
+	Name() string
+	// New returns a hash computing a digest
+	New() hash.Hash
+}
+
+// hasher is an IHasher built from a hash constructor
+type hasher struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+// Name returns the name of the algorithm
+func (h hasher) Name() string {
+	return h.name
+}
+
+// New returns a new hash
+func (h hasher) New() hash.Hash {
+	return h.newHash()
+}
+
+// NewHasher creates an IHasher named name, e.g. to register a digest algorithm not built in
+func NewHasher(name string, newHash func() hash.Hash) IHasher {
+	return hasher{name: name, newHash: newHash}
+}
+
+var (
+	// HashSHA256 is SHA-256, the default of every subsystem
+	HashSHA256 = NewHasher("sha256", sha256.New)
+	// HashBLAKE3 is the 256 bit BLAKE3, cryptographic like SHA-256 and several times faster on large content
+	HashBLAKE3 = NewHasher("blake3", func() hash.Hash { return blake3.New(32, nil) })
+	// HashXXH3 is the 64 bit XXH3, the fastest but not cryptographic: it detects corruption, not tampering
+	HashXXH3 = NewHasher("xxh3", func() hash.Hash { return xxh3.New() })
+	// HashCRC32C is CRC32 with the Castagnoli polynomial, the checksum of GCS and S3 additional checksums
+	HashCRC32C = NewHasher("crc32c", func() hash.Hash { return crc32.New(crc32cTable) })
+)
+
+// crc32cTable is the Castagnoli table of CRC32C checksums
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = map[string]IHasher{}
+)
+
+func init() {
+	for _, h := range []IHasher{HashSHA256, HashBLAKE3, HashXXH3, HashCRC32C} {
+		RegisterHasher(h)
+	}
+}
+
+// RegisterHasher makes h known by its name, so that checksums written with it are verified on read. Registering a
+// name again replaces the hasher.
+func RegisterHasher(h IHasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	hashers[h.Name()] = h
+}
+
+// HasherByName returns the registered hasher of an algorithm name
+func HasherByName(name string) (IHasher, bool) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	h, ok := hashers[name]
+	return h, ok
+}
+
+// registeredHashers returns every registered hasher, sorted by name
+func registeredHashers() []IHasher {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	registered := make([]IHasher, 0, len(hashers))
+	for _, name := range slices.Sorted(maps.Keys(hashers)) {
+		registered = append(registered, hashers[name])
+	}
+	return registered
+}
+
+// digest returns the hex encoded digest of content computed with h
+func digest(h IHasher, content []byte) string {
+	hash := h.New()
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,399 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	pathutil "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const webHDFSPathPrefix = "/webhdfs/v1"
+
+// IHTTPClient interface for HTTP client operations - allows mocking in tests
+type IHTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HDFSKerberosConfig holds the kerberos settings used to authenticate WebHDFS requests using SPNEGO.
+// Credentials are taken from KeytabPath, then CCachePath, then Password, whichever is set first.
+type HDFSKerberosConfig struct {
+	Krb5ConfPath         string
+	Username             string
+	Realm                string
+	KeytabPath           string
+	CCachePath           string
+	Password             string
+	ServicePrincipalName string // defaults to HTTP/<namenode host> when empty
+}
+
+// HDFSBackend is a storage backend for Hadoop Distributed File System, accessed over the WebHDFS REST API
+type HDFSBackend struct {
+	Endpoint string
+	Prefix   string
+	User     string
+	Client   IHTTPClient
+}
+
+// NewHDFSBackend creates a new instance of HDFSBackend using simple (user.name) authentication.
+// endpoint is the namenode HTTP address, e.g. http://namenode:9870
+func NewHDFSBackend(endpoint string, prefix string, user string) (*HDFSBackend, *ae.AppError) {
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, ae.GetAppErr(context.Background(), err, HDFSBackendClient, http.StatusInternalServerError)
+	}
+	return &HDFSBackend{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Prefix:   cleanPrefix(prefix),
+		User:     user,
+		Client:   &http.Client{},
+	}, nil
+}
+
+// NewHDFSBackendWithKerberos creates a new instance of HDFSBackend for kerberized clusters
+func NewHDFSBackendWithKerberos(endpoint string, prefix string, kerberos HDFSKerberosConfig) (*HDFSBackend, *ae.AppError) {
+	ctx := context.Background()
+	endpointURL, err := url.ParseRequestURI(endpoint)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, err, HDFSBackendClient, http.StatusInternalServerError)
+	}
+	krb5Conf, err := config.Load(kerberos.Krb5ConfPath)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to load krb5 config"), HDFSBackendClient, http.StatusInternalServerError)
+	}
+
+	var krbClient *client.Client
+	switch {
+	case kerberos.KeytabPath != "":
+		kt, err := keytab.Load(kerberos.KeytabPath)
+		if err != nil {
+			return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to load keytab"), HDFSBackendClient, http.StatusInternalServerError)
+		}
+		krbClient = client.NewWithKeytab(kerberos.Username, kerberos.Realm, kt, krb5Conf)
+	case kerberos.CCachePath != "":
+		ccache, err := credentials.LoadCCache(kerberos.CCachePath)
+		if err != nil {
+			return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to load credentials cache"), HDFSBackendClient, http.StatusInternalServerError)
+		}
+		krbClient, err = client.NewFromCCache(ccache, krb5Conf)
+		if err != nil {
+			return nil, ae.GetAppErr(ctx, err, HDFSBackendClient, http.StatusInternalServerError)
+		}
+	default:
+		krbClient = client.NewWithPassword(kerberos.Username, kerberos.Realm, kerberos.Password, krb5Conf)
+	}
+	if err := krbClient.Login(); err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "kerberos login failed"), HDFSBackendClient, http.StatusUnauthorized)
+	}
+
+	spn := kerberos.ServicePrincipalName
+	if spn == "" {
+		spn = "HTTP/" + endpointURL.Hostname()
+	}
+	return &HDFSBackend{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Prefix:   cleanPrefix(prefix),
+		Client:   spnego.NewClient(krbClient, nil, spn),
+	}, nil
+}
+
+// hdfsFileStatus mirrors the WebHDFS FileStatus JSON object
+type hdfsFileStatus struct {
+	PathSuffix       string `json:"pathSuffix"`
+	Type             string `json:"type"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+}
+
+// hdfsEntry is a file or directory visited while walking a listing
+type hdfsEntry struct {
+	fullPath string
+	isDir    bool
+	modified time.Time
+	size     int64
+}
+
+// sortKey orders directories by their content so that a depth first walk yields files in lexical order
+func (e hdfsEntry) sortKey() string {
+	if e.isDir {
+		return e.fullPath + "/"
+	}
+	return e.fullPath
+}
+
+// beforeCursor reports whether the entry, including everything below it, was already returned before cursor
+func (e hdfsEntry) beforeCursor(cursor string) bool {
+	if e.isDir {
+		return e.sortKey() < cursor && !strings.HasPrefix(cursor, e.sortKey())
+	}
+	return e.fullPath <= cursor
+}
+
+// hdfsRemoteException mirrors the WebHDFS RemoteException JSON error body
+type hdfsRemoteException struct {
+	RemoteException struct {
+		Exception string `json:"exception"`
+		Message   string `json:"message"`
+	} `json:"RemoteException"`
+}
+
+// Describe reports the namenode endpoint, prefix and authentication mode of the backend
+func (b *HDFSBackend) Describe() map[string]string {
+	auth := "simple"
+	if _, ok := b.Client.(*spnego.Client); ok {
+		auth = "kerberos"
+	}
+	return map[string]string{
+		"endpoint": b.Endpoint,
+		"prefix":   b.Prefix,
+		"auth":     auth,
+	}
+}
+
+// GetObject retrieves a file from HDFS, at prefix
+func (b *HDFSBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	var object Object
+	object.Path = path
+	if options.versioned() {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("hdfs does not keep object versions"), HDFSGetObject, http.StatusNotImplemented)
+	}
+	fullPath := objectKey(b.Prefix, path)
+
+	var status struct {
+		FileStatus hdfsFileStatus `json:"FileStatus"`
+	}
+	if appErr := b.doJSON(ctx, http.MethodGet, fullPath, "GETFILESTATUS", nil, nil, &status, HDFSGetObject); appErr != nil {
+		return object, appErr
+	}
+	if status.FileStatus.Type == "DIRECTORY" {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("%s is a directory", fullPath), HDFSGetObject, http.StatusBadRequest)
+	}
+	object.LastModified = time.UnixMilli(status.FileStatus.ModificationTime)
+	object.Size = status.FileStatus.Length
+	if options.unchanged(object) {
+		return Object{Path: path}, notModifiedErr(ctx, path)
+	}
+
+	params := url.Values{}
+	if options.Range != nil {
+		// WebHDFS takes offsets from the start, suffix ranges start from the size read above
+		byteRange := options.Range.from(object.Size)
+		params.Set("offset", strconv.FormatInt(byteRange.Offset, 10))
+		if byteRange.Length > 0 {
+			params.Set("length", strconv.FormatInt(byteRange.Length, 10))
+		}
+	}
+	resp, appErr := b.do(ctx, http.MethodGet, fullPath, "OPEN", params, nil, HDFSGetObject)
+	if appErr != nil {
+		return object, appErr
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return object, ae.GetAppErr(ctx, errors.Wrap(err, "failed to read from reader stream"), HDFSGetObject, http.StatusInternalServerError)
+	}
+	object.Content = content
+	return object, nil
+}
+
+// GetObjects recursively lists all files in HDFS under the given prefix
+func (b *HDFSBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects recursively lists files in HDFS under the given prefix in lexical path order,
+// honouring MaxKeys and cursor options
+func (b *HDFSBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	fullPrefix := objectKey(b.Prefix, prefix)
+	options.Cursor = options.startCursor(fullPrefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Versions != VersionsCurrent {
+		return result, ae.GetAppErr(ctx, fmt.Errorf("hdfs does not keep object versions"), HDFSGetObjects, http.StatusNotImplemented)
+	}
+
+	// depth first walk; entries are pushed in reverse order so that files pop out sorted by full path
+	var lastKey string
+	stack := []hdfsEntry{{fullPath: fullPrefix, isDir: true}}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !entry.isDir {
+			if options.limitReached(len(result.Objects)) {
+				result.Truncated = true
+				result.NextCursor = lastKey
+				return result, nil
+			}
+			lastKey = entry.fullPath
+			object := Object{
+				Path:         removePrefixFromObjectPath(fullPrefix, entry.fullPath),
+				Content:      []byte{},
+				LastModified: entry.modified,
+				Size:         entry.size,
+			}
+			if options.matches(object) {
+				result.Objects = append(result.Objects, object)
+			}
+			continue
+		}
+
+		var listing struct {
+			FileStatuses struct {
+				FileStatus []hdfsFileStatus `json:"FileStatus"`
+			} `json:"FileStatuses"`
+		}
+		if appErr := b.doJSON(ctx, http.MethodGet, entry.fullPath, "LISTSTATUS", nil, nil, &listing, HDFSGetObjects); appErr != nil {
+			// files are returned in key order, so every file not returned yet sorts after lastKey
+			result.interrupted(lastKey, options)
+			return result, appErr
+		}
+
+		var children []hdfsEntry
+		for _, status := range listing.FileStatuses.FileStatus {
+			result.Scanned++
+			child := hdfsEntry{
+				fullPath: entry.fullPath,
+				isDir:    status.Type == "DIRECTORY",
+				modified: time.UnixMilli(status.ModificationTime),
+				size:     status.Length,
+			}
+			// LISTSTATUS on a file returns the file itself with an empty suffix
+			if status.PathSuffix != "" {
+				child.fullPath = pathutil.Join(entry.fullPath, status.PathSuffix)
+			}
+			if options.Cursor != "" && child.beforeCursor(options.Cursor) {
+				continue
+			}
+			children = append(children, child)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].sortKey() > children[j].sortKey()
+		})
+		stack = append(stack, children...)
+	}
+	return result, nil
+}
+
+// PutObject writes a file to HDFS, at prefix, overwriting any existing file
+func (b *HDFSBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	options := getPutOptions(opts)
+	if options.Encryption != nil && options.Encryption.Type != EncryptionNone {
+		// HDFS encrypts transparently per encryption zone, it cannot be requested per file
+		return ae.GetAppErr(ctx, fmt.Errorf("per object encryption is not supported by hdfs, use encryption zones"), HDFSPutObject, http.StatusNotImplemented)
+	}
+	if attributes := options.attributesSet(); len(attributes) > 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("%s not supported by hdfs", strings.Join(attributes, ", ")), HDFSPutObject, http.StatusNotImplemented)
+	}
+	params := url.Values{"overwrite": []string{"true"}}
+	// The namenode redirects CREATE to a datanode; both the plain and the SPNEGO client replay the body on redirect
+	resp, appErr := b.do(ctx, http.MethodPut, objectKey(b.Prefix, path), "CREATE", params, content, HDFSPutObject)
+	if appErr != nil {
+		return appErr
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DeleteObject removes a file from HDFS, at prefix
+func (b *HDFSBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	fullPath := objectKey(b.Prefix, path)
+	var result struct {
+		Boolean bool `json:"boolean"`
+	}
+	if appErr := b.doJSON(ctx, http.MethodDelete, fullPath, "DELETE", nil, nil, &result, HDFSDeleteObject); appErr != nil {
+		return appErr
+	}
+	if !result.Boolean {
+		return ae.GetAppErr(ctx, fmt.Errorf("file %s does not exist", fullPath), HDFSDeleteObject, http.StatusNotFound)
+	}
+	return nil
+}
+
+// CopyObject copies a file within HDFS; WebHDFS has no server side copy so the content is read and written back
+func (b *HDFSBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	object, appErr := b.GetObject(ctx, srcPath)
+	if appErr != nil {
+		return appErr.AddErrCode(HDFSCopyObject.Code)
+	}
+	if appErr := b.PutObject(ctx, dstPath, object.Content); appErr != nil {
+		return appErr.AddErrCode(HDFSCopyObject.Code)
+	}
+	return nil
+}
+
+// doJSON executes a WebHDFS operation and decodes the JSON response into out
+func (b *HDFSBackend) doJSON(ctx context.Context, method, fullPath, op string, params url.Values, body []byte, out interface{}, customErr *ae.CustomErr) *ae.AppError {
+	resp, appErr := b.do(ctx, method, fullPath, op, params, body, customErr)
+	if appErr != nil {
+		return appErr
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to decode webhdfs response"), customErr, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// do executes a WebHDFS operation and converts non 2xx responses into an AppError
+func (b *HDFSBackend) do(ctx context.Context, method, fullPath, op string, params url.Values, body []byte, customErr *ae.CustomErr) (*http.Response, *ae.AppError) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	if b.User != "" {
+		params.Set("user.name", b.User)
+	}
+	reqURL := b.Endpoint + webHDFSPathPrefix + "/" + strings.TrimPrefix(fullPath, "/") + "?" + params.Encode()
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, bodyReader)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, err, customErr, http.StatusInternalServerError)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, err, customErr, http.StatusInternalServerError)
+	}
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var remoteErr hdfsRemoteException
+	err = fmt.Errorf("webhdfs %s %s returned status %d", op, fullPath, resp.StatusCode)
+	if json.NewDecoder(resp.Body).Decode(&remoteErr) == nil && remoteErr.RemoteException.Exception != "" {
+		err = fmt.Errorf("%s: %s", remoteErr.RemoteException.Exception, remoteErr.RemoteException.Message)
+	}
+	appErr := ae.GetAppErr(ctx, err, customErr, http.StatusInternalServerError)
+	if resp.StatusCode == http.StatusNotFound || remoteErr.RemoteException.Exception == "FileNotFoundException" {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	}
+	return nil, appErr
+}
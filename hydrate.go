@@ -0,0 +1,87 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"golang.org/x/sync/errgroup"
+)
+
+// hydrateObjects reads the attributes of objects listed at prefix, up to concurrency at a time, and returns them
+// without the objects deleted since they were listed. On error the objects are returned as listed, some of them
+// hydrated.
+func hydrateObjects(ctx context.Context, statter IObjectStatter, prefix string, objects []Object, concurrency int) ([]Object, *ae.AppError) {
+	tagger, _ := statter.(IObjectTagger)
+	deleted := make([]bool, len(objects))
+	var mu sync.Mutex
+	var firstErr *ae.AppError
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(concurrency)
+	for i := range objects {
+		group.Go(func() error {
+			appErr := hydrateObject(groupCtx, statter, tagger, objectKey(prefix, objects[i].Path), &objects[i])
+			if appErr == nil {
+				return nil
+			}
+			if appErr.GetHTTPCode() == http.StatusNotFound {
+				deleted[i] = true
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if firstErr == nil {
+				firstErr = appErr.AddErrCode(ListHydrate.Code)
+			}
+			return appErr.GetErr()
+		})
+	}
+	if group.Wait() != nil {
+		return objects, firstErr
+	}
+
+	hydrated := objects[:0]
+	for i, object := range objects {
+		if !deleted[i] {
+			hydrated = append(hydrated, object)
+		}
+	}
+	return hydrated, nil
+}
+
+// hydrateObject fills the attributes of object, stored at path, and its tags when the backend has them
+func hydrateObject(ctx context.Context, statter IObjectStatter, tagger IObjectTagger, path string, object *Object) *ae.AppError {
+	stat, appErr := statter.StatObject(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	object.ContentType = stat.ContentType
+	object.CacheControl = stat.CacheControl
+	object.ContentEncoding = stat.ContentEncoding
+	object.ContentDisposition = stat.ContentDisposition
+	object.ContentLanguage = stat.ContentLanguage
+	object.Meta.User = stat.Meta.User
+	object.Encryption = stat.Encryption
+	object.Retention = stat.Retention
+	object.LegalHold = stat.LegalHold
+	if stat.CRC32C != "" {
+		object.CRC32C = stat.CRC32C
+	}
+	if stat.StorageClass != "" {
+		object.StorageClass = stat.StorageClass
+	}
+	if tagger == nil {
+		return nil
+	}
+	tags, appErr := tagger.GetObjectTags(ctx, path)
+	if appErr != nil {
+		// providers without object tagging have no tags to report
+		if appErr.GetHTTPCode() == http.StatusNotImplemented {
+			return nil
+		}
+		return appErr
+	}
+	object.Meta.Tags = tags
+	return nil
+}
@@ -0,0 +1,132 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// MetaRetainUntil is the user metadata key of the time, in RFC 3339, until which an ImmutableBackend refuses to
+// overwrite or delete an object
+const MetaRetainUntil = "retain-until"
+
+// WithRetainUntil stores the time until which an ImmutableBackend keeps the object from being overwritten or deleted
+func WithRetainUntil(until time.Time) PutOption {
+	return WithMetadata(map[string]string{MetaRetainUntil: until.UTC().Format(time.RFC3339)})
+}
+
+// ImmutableOption configures an ImmutableBackend
+type ImmutableOption func(*ImmutableBackend)
+
+// WithDefaultRetention sets the retention of objects written without WithRetainUntil, which are otherwise kept
+// forever
+func WithDefaultRetention(retention time.Duration) ImmutableOption {
+	return func(b *ImmutableBackend) {
+		b.DefaultRetention = retention
+	}
+}
+
+// ImmutableBackend is an IStorageBackend decorator making objects write-once, e.g. for audit logs: overwriting or
+// deleting an existing object fails with ErrImmutable. An object stored with a MetaRetainUntil time, see
+// WithRetainUntil, is only protected until then. The protection only holds for writes made through the decorator;
+// for tamper-proof storage use a bucket with object lock or a retention policy.
+type ImmutableBackend struct {
+	Backend IStorageBackend
+	// DefaultRetention, when set, is the retention of objects written without a retention time
+	DefaultRetention time.Duration
+}
+
+// NewImmutableBackend creates a new instance of ImmutableBackend
+func NewImmutableBackend(backend IStorageBackend, opts ...ImmutableOption) *ImmutableBackend {
+	b := &ImmutableBackend{Backend: backend}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the protected backend
+func (b *ImmutableBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the default retention, zero keeping objects forever
+func (b *ImmutableBackend) Describe() map[string]string {
+	return map[string]string{
+		"defaultRetention": b.DefaultRetention.String(),
+	}
+}
+
+// GetObject retrieves an object
+func (b *ImmutableBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *ImmutableBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *ImmutableBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object unless one is retained at path
+func (b *ImmutableBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.checkMutable(ctx, path); appErr != nil {
+		return appErr
+	}
+	if _, ok := getPutOptions(opts).Metadata[MetaRetainUntil]; !ok && b.DefaultRetention > 0 {
+		opts = append(opts, WithRetainUntil(time.Now().Add(b.DefaultRetention)))
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object unless it is retained
+func (b *ImmutableBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.checkMutable(ctx, path); appErr != nil {
+		return appErr
+	}
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object unless one is retained at dstPath, the copy keeps the retention of the source
+func (b *ImmutableBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.checkMutable(ctx, dstPath); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// checkMutable fails with ErrImmutable when an object exists at path and its retention did not expire
+func (b *ImmutableBackend) checkMutable(ctx context.Context, path string) *ae.AppError {
+	object, appErr := b.Backend.GetObject(ctx, path, WithRange(0, 1))
+	if appErr != nil && appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+		// providers refuse ranged reads of empty objects
+		object, appErr = b.Backend.GetObject(ctx, path)
+	}
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return nil
+		}
+		return appErr
+	}
+	retainUntil, ok := object.Meta.User[MetaRetainUntil]
+	if !ok {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s is immutable", path), ErrImmutable, http.StatusConflict)
+	}
+	until, err := time.Parse(time.RFC3339, retainUntil)
+	if err != nil {
+		// an unreadable retention protects the object rather than expiring it
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "object %s has an invalid retention %q", path, retainUntil), ErrImmutable, http.StatusConflict)
+	}
+	if time.Now().Before(until) {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s is retained until %s", path, retainUntil), ErrImmutable, http.StatusConflict)
+	}
+	return nil
+}
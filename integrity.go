@@ -0,0 +1,146 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// ChecksumAlgorithm is the algorithm of the content checksums stored by IntegrityBackend, the name of a registered
+// IHasher
+type ChecksumAlgorithm string
+
+const (
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+	ChecksumCRC32C ChecksumAlgorithm = "crc32c"
+	ChecksumBLAKE3 ChecksumAlgorithm = "blake3"
+	ChecksumXXH3   ChecksumAlgorithm = "xxh3"
+)
+
+// checksumMetaPrefix prefixes the algorithm in the user metadata key of a checksum, e.g. checksum-sha256
+const checksumMetaPrefix = "checksum-"
+
+// IntegrityOption configures an IntegrityBackend
+type IntegrityOption func(*IntegrityBackend)
+
+// WithChecksumRequired fails reads of objects stored without a checksum instead of returning them unverified
+func WithChecksumRequired() IntegrityOption {
+	return func(b *IntegrityBackend) {
+		b.Required = true
+	}
+}
+
+// IntegrityBackend is an IStorageBackend decorator verifying content end to end: PutObject stores a checksum of the
+// content in the user metadata of the object, and reads fail with ErrChecksumMismatch when the content does not
+// match it, e.g. when a proxy corrupted it. Objects stored without a checksum are returned unverified unless
+// Required is set. The wrapped backend must store user metadata.
+type IntegrityBackend struct {
+	Backend   IStorageBackend
+	Algorithm ChecksumAlgorithm
+	Required  bool
+
+	hasher IHasher
+}
+
+// NewIntegrityBackend creates a new instance of IntegrityBackend storing checksums computed with algorithm
+func NewIntegrityBackend(backend IStorageBackend, algorithm ChecksumAlgorithm, opts ...IntegrityOption) (*IntegrityBackend, *ae.AppError) {
+	b := &IntegrityBackend{
+		Backend:   backend,
+		Algorithm: algorithm,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	hasher, ok := HasherByName(string(b.Algorithm))
+	if !ok {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("unsupported checksum algorithm %q", b.Algorithm), IntegrityConfig, http.StatusInternalServerError)
+	}
+	b.hasher = hasher
+	return b, nil
+}
+
+// Unwrap returns the backend storing the objects
+func (b *IntegrityBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the checksum algorithm and whether checksums are required
+func (b *IntegrityBackend) Describe() map[string]string {
+	return map[string]string{
+		"algorithm": string(b.Algorithm),
+		"required":  fmt.Sprint(b.Required),
+	}
+}
+
+// GetObject retrieves an object and verifies its checksum. Ranged reads download the whole object, as the checksum
+// covers the whole content, and return the requested range once it is verified.
+func (b *IntegrityBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, withoutRange(opts)...)
+	if appErr != nil {
+		return object, appErr
+	}
+	if object, appErr = b.verify(ctx, object); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return sliceRange(ctx, object, getGetOptions(opts).Range, ErrChecksumMismatch)
+}
+
+// GetObjects lists all objects at the given prefix. Listings carry neither content nor checksums, so they are not
+// verified.
+func (b *IntegrityBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *IntegrityBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object with the checksum of its content in its metadata
+func (b *IntegrityBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	checksum := WithMetadata(map[string]string{checksumMetaPrefix + b.hasher.Name(): digest(b.hasher, content)})
+	return b.Backend.PutObject(ctx, path, content, append(slices.Clone(opts), checksum)...)
+}
+
+// DeleteObject removes an object
+func (b *IntegrityBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, the copy keeping the checksum of its source
+func (b *IntegrityBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// verify checks the content of an object against every checksum of a registered algorithm stored with it and
+// removes them from its metadata
+func (b *IntegrityBackend) verify(ctx context.Context, object Object) (Object, *ae.AppError) {
+	verified := false
+	hashers := registeredHashers()
+	for _, hasher := range hashers {
+		expected, ok := object.Meta.User[checksumMetaPrefix+hasher.Name()]
+		if !ok {
+			continue
+		}
+		if actual := digest(hasher, object.Content); actual != expected {
+			err := fmt.Errorf("%s checksum of %s is %s, expected %s", hasher.Name(), object.Path, actual, expected)
+			return object, ae.GetAppErr(ctx, err, ErrChecksumMismatch, http.StatusUnprocessableEntity)
+		}
+		verified = true
+	}
+	if !verified {
+		if b.Required {
+			return object, ae.GetAppErr(ctx, fmt.Errorf("%s has no checksum", object.Path), IntegrityChecksumMissing, http.StatusUnprocessableEntity)
+		}
+		return object, nil
+	}
+	object.Meta.User = maps.Clone(object.Meta.User)
+	for _, hasher := range hashers {
+		delete(object.Meta.User, checksumMetaPrefix+hasher.Name())
+	}
+	return object, nil
+}
@@ -0,0 +1,132 @@
+package object_storage
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// IWrapperBackend is implemented by decorators so that a composed backend can be inspected layer by layer
+type IWrapperBackend interface {
+	IStorageBackend
+	// Unwrap returns the backend this decorator delegates to
+	Unwrap() IStorageBackend
+}
+
+// transparentDecorator is implemented by decorators enforcing nothing on the objects they wrap, such as retries,
+// metrics and caches, so that operations they do not implement may run on the layer they wrap. Decorators checking
+// writes, such as ImmutableBackend or PathPolicyBackend, must not implement it, or the operation would skip their
+// checks.
+type transparentDecorator interface {
+	IWrapperBackend
+	transparent()
+}
+
+// IDescribedBackend is implemented by backends and decorators able to report their active configuration.
+// Describe must never include credentials or other secrets.
+type IDescribedBackend interface {
+	Describe() map[string]string
+}
+
+// BackendLayer describes one layer of a composed backend
+type BackendLayer struct {
+	Type   string
+	Config map[string]string
+}
+
+// String formats the layer as Type{key=value, ...} with keys in sorted order
+func (l BackendLayer) String() string {
+	keys := make([]string, 0, len(l.Config))
+	for key := range l.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+l.Config[key])
+	}
+	return l.Type + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// BackendChain is the ordered list of layers of a composed backend, outermost decorator first
+type BackendChain []BackendLayer
+
+// String formats the chain as "Outer{...} -> Inner{...}"
+func (c BackendChain) String() string {
+	layers := make([]string, 0, len(c))
+	for _, layer := range c {
+		layers = append(layers, layer.String())
+	}
+	return strings.Join(layers, " -> ")
+}
+
+// DescribeBackend walks a composed backend from the outermost decorator down to the storage backend,
+// collecting the type and configuration of every layer
+func DescribeBackend(backend IStorageBackend) BackendChain {
+	var chain BackendChain
+	for backend != nil {
+		layer := BackendLayer{Type: backendTypeName(backend)}
+		if described, ok := backend.(IDescribedBackend); ok {
+			layer.Config = described.Describe()
+		}
+		chain = append(chain, layer)
+
+		wrapper, ok := backend.(IWrapperBackend)
+		if !ok {
+			break
+		}
+		backend = wrapper.Unwrap()
+	}
+	return chain
+}
+
+// IChainReporter receives the description of a composed backend, e.g. to log it or export it as telemetry
+type IChainReporter interface {
+	ReportChain(name string, chain BackendChain)
+}
+
+// ChainReporterFunc adapts a function to IChainReporter
+type ChainReporterFunc func(name string, chain BackendChain)
+
+// ReportChain calls f(name, chain)
+func (f ChainReporterFunc) ReportChain(name string, chain BackendChain) {
+	f(name, chain)
+}
+
+// LogChainReporter writes backend chains to a standard logger, log.Default() when Logger is nil
+type LogChainReporter struct {
+	Logger *log.Logger
+}
+
+// ReportChain logs the chain on a single line
+func (r LogChainReporter) ReportChain(name string, chain BackendChain) {
+	logger := r.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("storage backend %q: %s", name, chain)
+}
+
+// ReportBackend describes backend and hands the result to every reporter, typically called once at startup
+// for each storage target so operators can verify which layers are active
+func ReportBackend(name string, backend IStorageBackend, reporters ...IChainReporter) BackendChain {
+	chain := DescribeBackend(backend)
+	for _, reporter := range reporters {
+		reporter.ReportChain(name, chain)
+	}
+	return chain
+}
+
+// backendTypeName returns the bare type name of a backend, e.g. S3Backend for *object_storage.S3Backend
+func backendTypeName(backend IStorageBackend) string {
+	t := reflect.TypeOf(backend)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return fmt.Sprintf("%T", backend)
+	}
+	return t.Name()
+}
@@ -0,0 +1,176 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const inventoryPageSize = 1000
+
+// InventoryRecord is one row of a bucket inventory. The parquet tags describe its schema for parquet writers
+// taking tagged structs, such as github.com/xitongsys/parquet-go.
+type InventoryRecord struct {
+	Path           string `parquet:"name=path, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Size           int64  `parquet:"name=size, type=INT64"`
+	LastModified   int64  `parquet:"name=last_modified, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	ETag           string `parquet:"name=etag, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StorageClass   string `parquet:"name=storage_class, type=BYTE_ARRAY, convertedtype=UTF8"`
+	VersionID      string `parquet:"name=version_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsLatest       bool   `parquet:"name=is_latest, type=BOOLEAN"`
+	IsDeleteMarker bool   `parquet:"name=is_delete_marker, type=BOOLEAN"`
+}
+
+// inventoryColumns are the CSV header of InventoryRecord, in field order
+var inventoryColumns = []string{"path", "size", "last_modified", "etag", "storage_class", "version_id", "is_latest", "is_delete_marker"}
+
+// IInventoryWriter receives inventory records, Close flushes what was written
+type IInventoryWriter interface {
+	WriteRecord(record InventoryRecord) error
+	Close() error
+}
+
+// CSVInventoryWriter writes inventory records as CSV with a header row, times in RFC 3339
+type CSVInventoryWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+// NewCSVInventoryWriter creates a new instance of CSVInventoryWriter writing to w
+func NewCSVInventoryWriter(w io.Writer) *CSVInventoryWriter {
+	return &CSVInventoryWriter{writer: csv.NewWriter(w)}
+}
+
+// WriteRecord writes one CSV row, preceded by the header on the first call
+func (w *CSVInventoryWriter) WriteRecord(record InventoryRecord) error {
+	if !w.headerWritten {
+		if err := w.writer.Write(inventoryColumns); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	return w.writer.Write([]string{
+		record.Path,
+		strconv.FormatInt(record.Size, 10),
+		inventoryTime(record.LastModified),
+		record.ETag,
+		record.StorageClass,
+		record.VersionID,
+		strconv.FormatBool(record.IsLatest),
+		strconv.FormatBool(record.IsDeleteMarker),
+	})
+}
+
+// Close flushes the buffered rows, it does not close the underlying writer
+func (w *CSVInventoryWriter) Close() error {
+	if !w.headerWritten {
+		if err := w.writer.Write(inventoryColumns); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// IParquetRowWriter is the row interface of parquet writers taking tagged structs, such as the ParquetWriter of
+// github.com/xitongsys/parquet-go created with new(InventoryRecord) as schema
+type IParquetRowWriter interface {
+	Write(row interface{}) error
+	WriteStop() error
+}
+
+// ParquetInventoryWriter adapts a parquet row writer to IInventoryWriter
+type ParquetInventoryWriter struct {
+	Writer IParquetRowWriter
+}
+
+// WriteRecord writes one row
+func (w ParquetInventoryWriter) WriteRecord(record InventoryRecord) error {
+	return w.Writer.Write(record)
+}
+
+// Close writes the parquet footer, it does not close the underlying file
+func (w ParquetInventoryWriter) Close() error {
+	return w.Writer.WriteStop()
+}
+
+// InventoryExport is the outcome of ExportInventory
+type InventoryExport struct {
+	// Records is the number of records written
+	Records int
+	// NextCursor resumes an interrupted export when passed to WithCursor
+	NextCursor string
+}
+
+// ExportInventory streams the listing of prefix page by page into writer and closes it. List options such as
+// WithVersions select what is exported. When the listing fails, the records exported so far are kept, the writer
+// is left open and the export can be resumed from the returned NextCursor; records of a page interrupted by a
+// write error are written again on resume.
+func ExportInventory(ctx context.Context, backend IStorageBackend, prefix string, writer IInventoryWriter, opts ...ListOption) (InventoryExport, *ae.AppError) {
+	var export InventoryExport
+	options := getListOptions(opts)
+	pageSize := options.MaxKeys
+	if pageSize <= 0 {
+		pageSize = inventoryPageSize
+	}
+	cursor := options.Cursor
+	for {
+		page, appErr := backend.ListObjects(ctx, prefix, slices.Concat(opts, []ListOption{WithMaxKeys(pageSize), WithCursor(cursor)})...)
+		for _, object := range page.Objects {
+			if err := writer.WriteRecord(inventoryRecord(object)); err != nil {
+				// the page is exported again on resume
+				export.NextCursor = cursor
+				return export, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to write inventory record of %s", object.Path), InventoryWrite, http.StatusInternalServerError)
+			}
+			export.Records++
+		}
+		if appErr != nil {
+			export.NextCursor = cursor
+			if page.Truncated {
+				export.NextCursor = page.NextCursor
+			}
+			return export, appErr
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if err := writer.Close(); err != nil {
+		return export, ae.GetAppErr(ctx, errors.Wrap(err, "failed to close inventory writer"), InventoryWrite, http.StatusInternalServerError)
+	}
+	return export, nil
+}
+
+// inventoryRecord converts a listed object to an inventory record
+func inventoryRecord(object Object) InventoryRecord {
+	record := InventoryRecord{
+		Path:           object.Path,
+		Size:           object.Size,
+		ETag:           object.ETag,
+		StorageClass:   object.StorageClass,
+		VersionID:      object.VersionID,
+		IsLatest:       object.IsLatest,
+		IsDeleteMarker: object.IsDeleteMarker,
+	}
+	if !object.LastModified.IsZero() {
+		record.LastModified = object.LastModified.UnixMilli()
+	}
+	return record
+}
+
+// inventoryTime formats a unix millisecond time as RFC 3339, empty when unknown
+func inventoryTime(millis int64) string {
+	if millis == 0 {
+		return ""
+	}
+	return time.UnixMilli(millis).UTC().Format(time.RFC3339Nano)
+}
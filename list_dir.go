@@ -0,0 +1,158 @@
+package object_storage
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	// dirDelimiter separates the levels of the folder hierarchy ListDir shows
+	dirDelimiter = "/"
+	// listDirPageSize is the number of objects listed at a time by ListDir on backends without delimiter support
+	listDirPageSize = 1000
+)
+
+// DirListing is the outcome of a ListDir call, one level of the folder hierarchy of a prefix
+type DirListing struct {
+	// Objects are the objects directly at the prefix
+	Objects []Object
+	// Prefixes are the subdirectories of the prefix, relative to it and ending with a slash
+	Prefixes []string
+	// Truncated is true when more entries exist at the prefix than were returned
+	Truncated bool
+	// NextCursor is an opaque value to pass to WithCursor to continue the listing, empty when not truncated
+	NextCursor string
+}
+
+// IDirLister is implemented by backends able to list one level of a prefix on the provider side
+type IDirLister interface {
+	ListDir(ctx context.Context, prefix string, opts ...ListOption) (DirListing, *ae.AppError)
+}
+
+// ListDir lists prefix of backend as a folder, e.g. for a file browser: the objects directly at it and the common
+// prefixes, "subdirectories", of the objects below, in lexical order. MaxKeys limits objects and prefixes together,
+// and a truncated listing resumes with WithCursor(NextCursor); other list options are ignored. Backends implementing
+// IDirLister, S3 and GCS, group the objects on the provider side with a delimiter; other backends, and decorators,
+// list every object below the prefix and group them as they go. A listing failing part way returns the entries
+// listed so far with a cursor resuming after them, as ListObjects does.
+func ListDir(ctx context.Context, backend IStorageBackend, prefix string, opts ...ListOption) (DirListing, *ae.AppError) {
+	if lister, ok := backend.(IDirLister); ok {
+		return lister.ListDir(ctx, prefix, opts...)
+	}
+	return listDirEach(ctx, backend, prefix, getListOptions(opts))
+}
+
+// listDirEach lists one level of prefix from a listing of every object below it. Paging starts after the cursor
+// with WithStartAfter, and entries up to the cursor are skipped for decorators ignoring it.
+func listDirEach(ctx context.Context, backend IStorageBackend, prefix string, options ListOptions) (DirListing, *ae.AppError) {
+	var listing DirListing
+	prefix = dirKey("", prefix)
+	cursor := ""
+	for {
+		page, appErr := backend.ListObjects(ctx, prefix, WithMaxKeys(listDirPageSize), WithCursor(cursor),
+			WithStartAfter(dirStartAfter(options.Cursor)))
+		for _, object := range page.Objects {
+			entry, isDir := dirEntry(object.Path)
+			lastEntry := listing.lastEntry()
+			if entry == "" || entry == lastEntry || (options.Cursor != "" && entry <= options.Cursor) {
+				continue
+			}
+			if options.limitReached(len(listing.Objects) + len(listing.Prefixes)) {
+				listing.Truncated, listing.NextCursor = true, lastEntry
+				return listing, nil
+			}
+			listing.add(object, entry, isDir)
+		}
+		if appErr != nil {
+			listing.interrupted(options)
+			return listing, appErr
+		}
+		if !page.Truncated {
+			return listing, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// add appends an entry to the listing, a prefix when isDir
+func (l *DirListing) add(object Object, entry string, isDir bool) {
+	if isDir {
+		l.Prefixes = append(l.Prefixes, entry)
+		return
+	}
+	object.Path = entry
+	l.Objects = append(l.Objects, object)
+}
+
+// take appends the objects and prefixes of a page of a provider listing in lexical order, up to the MaxKeys limit of
+// options. When the limit cuts the page short, the listing is marked truncated and true is returned.
+func (l *DirListing) take(page DirListing, options ListOptions) bool {
+	i, j := 0, 0
+	for i < len(page.Objects) || j < len(page.Prefixes) {
+		if options.limitReached(len(l.Objects) + len(l.Prefixes)) {
+			l.Truncated, l.NextCursor = true, l.lastEntry()
+			return true
+		}
+		if j == len(page.Prefixes) || (i < len(page.Objects) && page.Objects[i].Path < page.Prefixes[j]) {
+			l.Objects = append(l.Objects, page.Objects[i])
+			i++
+		} else {
+			l.Prefixes = append(l.Prefixes, page.Prefixes[j])
+			j++
+		}
+	}
+	return false
+}
+
+// lastEntry returns the last object path or prefix listed, empty when nothing was listed
+func (l *DirListing) lastEntry() string {
+	var last string
+	if len(l.Objects) > 0 {
+		last = l.Objects[len(l.Objects)-1].Path
+	}
+	if len(l.Prefixes) > 0 {
+		last = max(last, l.Prefixes[len(l.Prefixes)-1])
+	}
+	return last
+}
+
+// interrupted marks a listing stopped by an error as truncated, resuming after the last entry listed or, when
+// nothing was listed yet, from the cursor the listing started at
+func (l *DirListing) interrupted(options ListOptions) {
+	l.Truncated = true
+	l.NextCursor = l.lastEntry()
+	if l.NextCursor == "" {
+		l.NextCursor = options.Cursor
+	}
+}
+
+// dirKey returns the key of prefix as a folder of a backend with the given prefix, ending with a slash unless it is
+// the root
+func dirKey(backendPrefix, prefix string) string {
+	key := strings.TrimSuffix(objectKey(backendPrefix, prefix), dirDelimiter)
+	if key == "" {
+		return ""
+	}
+	return key + dirDelimiter
+}
+
+// dirEntry returns the entry of a folder listing an object path relative to the folder belongs to: the path itself,
+// or the subdirectory holding it
+func dirEntry(path string) (string, bool) {
+	if i := strings.Index(path, dirDelimiter); i >= 0 {
+		return path[:i+1], true
+	}
+	return path, false
+}
+
+// dirStartAfter returns the path a folder listing resumed at cursor starts after, past every object of the
+// subdirectory when the cursor is one
+func dirStartAfter(cursor string) string {
+	if strings.HasSuffix(cursor, dirDelimiter) {
+		return cursor + string(utf8.MaxRune)
+	}
+	return cursor
+}
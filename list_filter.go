@@ -0,0 +1,149 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// globMeta are the characters with a meaning in a glob
+const globMeta = `*?[]{}\,`
+
+// WithGlob only lists objects whose path, relative to the listed prefix, matches pattern: "*" matches any run of
+// characters but "/", "**" any run including "/", "?" one character but "/", "[a-z]" and "[!a-z]" a character of a
+// class or outside it, "{json,yaml}" one of the alternatives, and "\" escapes the next character. GCS filters
+// listings of a folder on the provider side, other backends filter the objects as they list them, so that pages may
+// come back shorter than MaxKeys.
+func WithGlob(pattern string) ListOption {
+	return func(o *ListOptions) {
+		o.Glob = pattern
+	}
+}
+
+// WithPattern only lists objects whose path, relative to the listed prefix, matches pattern. Objects are filtered
+// as they are listed.
+func WithPattern(pattern *regexp.Regexp) ListOption {
+	return func(o *ListOptions) {
+		o.Pattern = pattern
+	}
+}
+
+// WithModifiedAfter only lists objects modified after t. Objects are filtered as they are listed.
+func WithModifiedAfter(t time.Time) ListOption {
+	return func(o *ListOptions) {
+		o.ModifiedAfter = t
+	}
+}
+
+// WithModifiedBefore only lists objects modified before t. Objects are filtered as they are listed.
+func WithModifiedBefore(t time.Time) ListOption {
+	return func(o *ListOptions) {
+		o.ModifiedBefore = t
+	}
+}
+
+// withFiltersOf sets the filters of options, for listings built from other listings of the same prefix
+func withFiltersOf(options ListOptions) ListOption {
+	return func(o *ListOptions) {
+		o.Glob, o.Pattern = options.Glob, options.Pattern
+		o.ModifiedAfter, o.ModifiedBefore = options.ModifiedAfter, options.ModifiedBefore
+	}
+}
+
+// filterErr returns the error of a listing with an invalid glob, nil when its filters are valid
+func (o ListOptions) filterErr(ctx context.Context) *ae.AppError {
+	if o.globErr == nil {
+		return nil
+	}
+	return ae.GetAppErr(ctx, errors.Wrapf(o.globErr, "invalid glob %q", o.Glob), ListFilter, http.StatusBadRequest)
+}
+
+// matchesPath reports whether a path, relative to the listed prefix, passes the path filters
+func (o ListOptions) matchesPath(path string) bool {
+	return (o.glob == nil || o.glob.MatchString(path)) && (o.Pattern == nil || o.Pattern.MatchString(path))
+}
+
+// matches reports whether a listed object passes the filters
+func (o ListOptions) matches(object Object) bool {
+	return o.matchesPath(object.Path) &&
+		(o.ModifiedAfter.IsZero() || object.LastModified.After(o.ModifiedAfter)) &&
+		(o.ModifiedBefore.IsZero() || object.LastModified.Before(o.ModifiedBefore))
+}
+
+// providerGlob returns the glob a provider matching whole keys filters a listing of fullPrefix with, empty when the
+// listing is not of a folder or the glob uses syntax providers may read differently
+func (o ListOptions) providerGlob(fullPrefix string) string {
+	if o.Glob == "" || o.globErr != nil || (fullPrefix != "" && !strings.HasSuffix(fullPrefix, "/")) ||
+		strings.ContainsAny(fullPrefix, globMeta) || strings.ContainsAny(o.Glob, `[]\`) {
+		return ""
+	}
+	return fullPrefix + o.Glob
+}
+
+// compileGlob converts a glob to an anchored regular expression
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	inAlternatives := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, fmt.Errorf("trailing escape")
+			}
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case '{':
+			if inAlternatives {
+				return nil, fmt.Errorf("nested alternatives")
+			}
+			inAlternatives = true
+			expr.WriteString("(?:")
+		case '}':
+			if !inAlternatives {
+				return nil, fmt.Errorf("unmatched }")
+			}
+			inAlternatives = false
+			expr.WriteString(")")
+		case ',':
+			if inAlternatives {
+				expr.WriteString("|")
+			} else {
+				expr.WriteString(",")
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if inAlternatives {
+		return nil, fmt.Errorf("unterminated alternatives")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,144 @@
+package object_storage
+
+import (
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ListResult is the outcome of a ListObjects call. Unlike the bare slice returned by GetObjects it tells
+// the caller whether the listing is complete and, when it is not, where to resume from. When the listing fails
+// part way, the objects listed before the error are returned along with the error, Truncated and a NextCursor
+// resuming right after them.
+type ListResult struct {
+	Objects []Object
+	// Truncated is true when more objects exist under the prefix than were returned
+	Truncated bool
+	// Scanned is the number of entries examined on the provider side to build this result
+	Scanned int
+	// NextCursor is an opaque value to pass to WithCursor to continue the listing, empty when not truncated
+	NextCursor string
+}
+
+// VersionMode selects which object versions a listing returns on versioned buckets
+type VersionMode int
+
+const (
+	// VersionsCurrent returns only the current version of live objects, exactly as on an unversioned bucket
+	VersionsCurrent VersionMode = iota
+	// VersionsAll returns current and noncurrent versions of every object
+	VersionsAll
+	// VersionsAllWithDeleteMarkers returns current and noncurrent versions plus delete markers (S3)
+	VersionsAllWithDeleteMarkers
+)
+
+// ListOptions holds the settings applied to a ListObjects call
+type ListOptions struct {
+	MaxKeys int
+	Cursor  string
+	// StartAfter is the path, relative to the listed prefix, the listing starts after when no cursor is set
+	StartAfter string
+	Versions   VersionMode
+	// Hydrate is the number of concurrent calls reading the attributes of listed objects, zero skips them
+	Hydrate int
+	// Glob, Pattern, ModifiedAfter and ModifiedBefore filter the listed objects, when set
+	Glob           string
+	Pattern        *regexp.Regexp
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// glob is Glob compiled, globErr why it does not compile
+	glob    *regexp.Regexp
+	globErr error
+}
+
+// ListOption configures a ListObjects call
+type ListOption func(*ListOptions)
+
+// WithMaxKeys limits the number of objects returned by a single ListObjects call, zero means no limit
+func WithMaxKeys(maxKeys int) ListOption {
+	return func(o *ListOptions) {
+		o.MaxKeys = maxKeys
+	}
+}
+
+// WithCursor resumes a listing after the position described by a previous ListResult.NextCursor
+func WithCursor(cursor string) ListOption {
+	return func(o *ListOptions) {
+		o.Cursor = cursor
+	}
+}
+
+// WithStartAfter starts a listing after path, relative to the listed prefix, e.g. to jump to a page of a large
+// prefix from a path shown to the user rather than from a cursor. The path need not exist, and it is ignored when a
+// cursor is set. Decorators merging several listings into one, RouterBackend, ShardedBackend and TieredBackend,
+// return the merged objects whose path sorts after it. Use ListDir for pages of one folder level.
+func WithStartAfter(path string) ListOption {
+	return func(o *ListOptions) {
+		o.StartAfter = path
+	}
+}
+
+// WithVersions selects which object versions are listed on versioned buckets, VersionsCurrent by default.
+// Entries of the same path are returned newest first with VersionID, IsLatest and IsDeleteMarker set.
+func WithVersions(mode VersionMode) ListOption {
+	return func(o *ListOptions) {
+		o.Versions = mode
+	}
+}
+
+// WithHydratedMetadata fills the content headers, user metadata and, where supported, tags of every listed object,
+// reading the attributes of up to concurrency objects at a time. Listings otherwise only report what the provider
+// listing returns, such as size and modification time. Objects deleted while being read are left out of the result.
+// Version listings and backends storing no attributes, HDFS and Redis, ignore it.
+func WithHydratedMetadata(concurrency int) ListOption {
+	return func(o *ListOptions) {
+		o.Hydrate = concurrency
+	}
+}
+
+// getListOptions applies the given options over the defaults
+func getListOptions(opts []ListOption) ListOptions {
+	var options ListOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Glob != "" {
+		options.glob, options.globErr = compileGlob(options.Glob)
+	}
+	return options
+}
+
+// limitReached reports whether a listing holding count objects has hit the MaxKeys limit
+func (o ListOptions) limitReached(count int) bool {
+	return o.MaxKeys > 0 && count >= o.MaxKeys
+}
+
+// startCursor returns the cursor a listing of fullPrefix starts from, the key of StartAfter when no cursor is set,
+// as storage backends use the key of the last listed object as cursor
+func (o ListOptions) startCursor(fullPrefix string) string {
+	if o.Cursor != "" || o.StartAfter == "" {
+		return o.Cursor
+	}
+	return listedKey(fullPrefix, o.StartAfter)
+}
+
+// interrupted marks a listing stopped by an error as truncated, resuming after resumeKey or, when nothing was
+// listed yet, from the cursor the listing started at
+func (r *ListResult) interrupted(resumeKey string, options ListOptions) {
+	r.Truncated = true
+	r.NextCursor = resumeKey
+	if resumeKey == "" {
+		r.NextCursor = options.Cursor
+	}
+}
+
+// sortVersionsNewestFirst orders version entries by path, newest version of each path first
+func sortVersionsNewestFirst(objects []Object) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Path != objects[j].Path {
+			return objects[i].Path < objects[j].Path
+		}
+		return objects[i].LastModified.After(objects[j].LastModified)
+	})
+}
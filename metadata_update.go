@@ -0,0 +1,185 @@
+package object_storage
+
+import (
+	"context"
+	"maps"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// MetadataUpdate lists the stored attributes UpdateObjectMetadata changes, nil fields are left as they are
+type MetadataUpdate struct {
+	ContentType        *string
+	CacheControl       *string
+	ContentEncoding    *string
+	ContentDisposition *string
+	ContentLanguage    *string
+	// User sets the given user metadata keys, keeping the others; a key given an empty value is removed
+	User map[string]string
+}
+
+// applyTo returns object with the attributes of the update applied
+func (u MetadataUpdate) applyTo(object Object) Object {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{u.ContentType, &object.ContentType},
+		{u.CacheControl, &object.CacheControl},
+		{u.ContentEncoding, &object.ContentEncoding},
+		{u.ContentDisposition, &object.ContentDisposition},
+		{u.ContentLanguage, &object.ContentLanguage},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if u.User != nil {
+		user := maps.Clone(object.Meta.User)
+		if user == nil {
+			user = map[string]string{}
+		}
+		for key, value := range u.User {
+			if value == "" {
+				delete(user, key)
+			} else {
+				user[key] = value
+			}
+		}
+		object.Meta.User = user
+	}
+	return object
+}
+
+// IMetadataUpdater is implemented by backends able to change the stored attributes of an object without uploading
+// its content again
+type IMetadataUpdater interface {
+	UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError
+}
+
+// UpdateObjectMetadata changes the content headers and user metadata of the object at path of backend, e.g. to fix
+// the Content-Type of a large object, keeping its content, other attributes, tags and encryption. S3 copies the
+// object onto itself, in parts above 5 GiB, and GCS patches its attributes; both fail with 409 Conflict when the
+// object changes meanwhile. Transparent decorators such as caches and retries are passed through to the layer they
+// wrap, dropping the object from caches afterwards. Other backends and decorators, so that checks such as those of
+// ImmutableBackend or PathPolicyBackend run, get the object read and written back.
+func UpdateObjectMetadata(ctx context.Context, backend IStorageBackend, path string, update MetadataUpdate) *ae.AppError {
+	if updater, ok := backend.(IMetadataUpdater); ok {
+		return updater.UpdateObjectMetadata(ctx, path, update)
+	}
+	if wrapper, ok := backend.(transparentDecorator); ok {
+		appErr := UpdateObjectMetadata(ctx, wrapper.Unwrap(), path, update)
+		if invalidator, ok := backend.(cacheInvalidator); ok {
+			invalidator.Invalidate(path)
+		}
+		return appErr
+	}
+	object, appErr := backend.GetObject(ctx, path)
+	if appErr != nil {
+		return appErr.AddErrCode(MetadataOperation.Code)
+	}
+	opts, appErr := preservedPutOptions(ctx, backend, path, update.applyTo(object), PreserveAll())
+	if appErr != nil {
+		return appErr.AddErrCode(MetadataOperation.Code)
+	}
+	if object.Encryption.Type != EncryptionNone {
+		opts = append(opts, WithEncryption(object.Encryption))
+	}
+	return backend.PutObject(ctx, path, object.Content, opts...)
+}
+
+// UpdateObjectMetadata changes the attributes of an object in Amazon S3 bucket by copying it onto itself with the
+// metadata directive REPLACE
+func (b *S3Backend) UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError {
+	current, appErr := b.StatObject(ctx, path)
+	if appErr != nil {
+		return appErr.AddErrCode(MetadataOperation.Code)
+	}
+	return b.rewriteInPlace(ctx, path, current, update.applyTo(current), MetadataOperation)
+}
+
+// UpdateObjectMetadata changes the attributes of an object in Google Cloud Storage bucket by patching them,
+// conditional on its metageneration
+func (b GoogleCSBackend) UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError {
+	object := b.Client.Object(objectKey(b.Prefix, path))
+	attrs, err := object.Attrs(ctx)
+	if err == nil {
+		updated := update.applyTo(Object{Meta: Metadata{User: attrs.Metadata}})
+		attrsToUpdate := storage.ObjectAttrsToUpdate{}
+		if update.ContentType != nil {
+			attrsToUpdate.ContentType = *update.ContentType
+		}
+		if update.CacheControl != nil {
+			attrsToUpdate.CacheControl = *update.CacheControl
+		}
+		if update.ContentEncoding != nil {
+			attrsToUpdate.ContentEncoding = *update.ContentEncoding
+		}
+		if update.ContentDisposition != nil {
+			attrsToUpdate.ContentDisposition = *update.ContentDisposition
+		}
+		if update.ContentLanguage != nil {
+			attrsToUpdate.ContentLanguage = *update.ContentLanguage
+		}
+		if update.User != nil {
+			attrsToUpdate.Metadata = updated.Meta.User
+			if removesKeys(attrs.Metadata, updated.Meta.User) {
+				// patches merge user metadata, so removing keys takes clearing it first
+				attrs, err = object.If(storage.Conditions{MetagenerationMatch: attrs.Metageneration}).Update(ctx, storage.ObjectAttrsToUpdate{
+					Metadata: map[string]string{},
+				})
+			}
+		}
+		if err == nil {
+			_, err = object.If(storage.Conditions{MetagenerationMatch: attrs.Metageneration}).Update(ctx, attrsToUpdate)
+		}
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, MetadataOperation, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsPreconditionFailed(err) {
+			appErr.SetErr(withSentinel(err, ErrPreconditionFailed))
+			appErr = appErr.SetHTTPCode(http.StatusConflict)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
+
+// removesKeys reports whether updated lacks keys of current
+func removesKeys(current, updated map[string]string) bool {
+	for key := range current {
+		if _, ok := updated[key]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateObjectMetadata changes the attributes of an object below the prefix
+func (b *SubBackend) UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return UpdateObjectMetadata(ctx, b.Parent, key, update)
+}
+
+// UpdateObjectMetadata changes the attributes of an object in its shard
+func (b *ShardedBackend) UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError {
+	return UpdateObjectMetadata(ctx, b.ShardFor(path).Backend, path, update)
+}
+
+// UpdateObjectMetadata changes the attributes of an object in the backend of its route
+func (b *RouterBackend) UpdateObjectMetadata(ctx context.Context, path string, update MetadataUpdate) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return UpdateObjectMetadata(ctx, backend, path, update)
+}
@@ -0,0 +1,193 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "object_storage"
+	// metricsUpload and metricsDownload are the values of the direction label of the bytes counter
+	metricsUpload   = "upload"
+	metricsDownload = "download"
+)
+
+// StorageMetrics are the Prometheus metrics recorded by MetricsBackend, labelled with the backend and bucket of every
+// MetricsBackend sharing them and the operation
+type StorageMetrics struct {
+	latency  *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewStorageMetrics creates the storage metrics and registers them with registerer, e.g. prometheus.DefaultRegisterer.
+// Create them once per registry and share them between every MetricsBackend.
+func NewStorageMetrics(registerer prometheus.Registerer) (*StorageMetrics, *ae.AppError) {
+	m := &StorageMetrics{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of storage operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "bucket", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_errors_total",
+			Help:      "Failed storage operations by error code.",
+		}, []string{"backend", "bucket", "operation", "code"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "transferred_bytes_total",
+			Help:      "Object content uploaded and downloaded.",
+		}, []string{"backend", "bucket", "direction"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "operations_in_flight",
+			Help:      "Storage operations in progress.",
+		}, []string{"backend", "bucket", "operation"}),
+	}
+	for _, collector := range []prometheus.Collector{m.latency, m.errors, m.bytes, m.inFlight} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, ae.GetAppErr(context.Background(), errors.Wrap(err, "failed to register storage metrics"), MetricsRegister, http.StatusInternalServerError)
+		}
+	}
+	return m, nil
+}
+
+// MetricsOption configures a MetricsBackend
+type MetricsOption func(*MetricsBackend)
+
+// WithMetricsLabels sets the backend and bucket labels instead of those found in the decorated backend
+func WithMetricsLabels(backend, bucket string) MetricsOption {
+	return func(b *MetricsBackend) {
+		b.BackendLabel = backend
+		b.BucketLabel = bucket
+	}
+}
+
+// MetricsBackend is an IStorageBackend decorator recording Prometheus metrics of every operation: its latency, its
+// errors by error code, the operations in flight and the bytes of content uploaded and downloaded
+type MetricsBackend struct {
+	Backend IStorageBackend
+	Metrics *StorageMetrics
+	// BackendLabel and BucketLabel label the metrics of this backend, by default the type of the storage backend
+	// and its bucket as reported by DescribeBackend
+	BackendLabel string
+	BucketLabel  string
+}
+
+// NewMetricsBackend creates a new instance of MetricsBackend recording into metrics
+func NewMetricsBackend(backend IStorageBackend, metrics *StorageMetrics, opts ...MetricsOption) *MetricsBackend {
+	chain := DescribeBackend(backend)
+	storage := chain[len(chain)-1]
+	b := &MetricsBackend{
+		Backend:      backend,
+		Metrics:      metrics,
+		BackendLabel: storage.Type,
+		BucketLabel:  storage.Config["bucket"],
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the measured backend
+func (b *MetricsBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations without metrics run on the wrapped backend
+func (b *MetricsBackend) transparent() {}
+
+// Describe reports the labels of the metrics
+func (b *MetricsBackend) Describe() map[string]string {
+	return map[string]string{
+		"backend": b.BackendLabel,
+		"bucket":  b.BucketLabel,
+	}
+}
+
+// GetObject retrieves an object, counting its content as downloaded
+func (b *MetricsBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	done := b.start("get")
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	done(appErr)
+	if appErr == nil {
+		b.transferred(metricsDownload, len(object.Content))
+	}
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix, counting the content returned as downloaded
+func (b *MetricsBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	done := b.start("get_objects")
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	done(appErr)
+	for _, object := range objects {
+		b.transferred(metricsDownload, len(object.Content))
+	}
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix
+func (b *MetricsBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	done := b.start("list")
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	done(appErr)
+	return result, appErr
+}
+
+// PutObject uploads an object, counting its content as uploaded once stored
+func (b *MetricsBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	done := b.start("put")
+	appErr := b.Backend.PutObject(ctx, path, content, opts...)
+	done(appErr)
+	if appErr == nil {
+		b.transferred(metricsUpload, len(content))
+	}
+	return appErr
+}
+
+// DeleteObject removes an object
+func (b *MetricsBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	done := b.start("delete")
+	appErr := b.Backend.DeleteObject(ctx, path)
+	done(appErr)
+	return appErr
+}
+
+// CopyObject copies an object
+func (b *MetricsBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	done := b.start("copy")
+	appErr := b.Backend.CopyObject(ctx, srcPath, dstPath)
+	done(appErr)
+	return appErr
+}
+
+// start counts an operation as in flight, the returned function records its outcome once it completed
+func (b *MetricsBackend) start(operation string) func(appErr *ae.AppError) {
+	inFlight := b.Metrics.inFlight.WithLabelValues(b.BackendLabel, b.BucketLabel, operation)
+	inFlight.Inc()
+	started := time.Now()
+	return func(appErr *ae.AppError) {
+		inFlight.Dec()
+		b.Metrics.latency.WithLabelValues(b.BackendLabel, b.BucketLabel, operation).Observe(time.Since(started).Seconds())
+		if appErr != nil {
+			b.Metrics.errors.WithLabelValues(b.BackendLabel, b.BucketLabel, operation, appErr.GetErrCode()).Inc()
+		}
+	}
+}
+
+// transferred adds size bytes of content to the bytes counter of direction
+func (b *MetricsBackend) transferred(direction string, size int) {
+	if size > 0 {
+		b.Metrics.bytes.WithLabelValues(b.BackendLabel, b.BucketLabel, direction).Add(float64(size))
+	}
+}
@@ -0,0 +1,155 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// MirrorMode selects how MirrorBackend treats writes failing on a mirror
+type MirrorMode int
+
+const (
+	// MirrorAllMustSucceed fails a write unless it succeeded on the primary and every mirror
+	MirrorAllMustSucceed MirrorMode = iota
+	// MirrorBestEffort fails a write only when it failed on the primary, mirror failures go to OnMirrorError
+	MirrorBestEffort
+)
+
+// String returns the name of the mode
+func (m MirrorMode) String() string {
+	if m == MirrorBestEffort {
+		return "best-effort"
+	}
+	return "all-must-succeed"
+}
+
+// MirrorErrorFunc is called with the mirror and operation of a failed mirror write
+type MirrorErrorFunc func(ctx context.Context, mirror IStorageBackend, operation Operation, path string, appErr *ae.AppError)
+
+// MirrorBackend is an IStorageBackend replicating writes, e.g. dual writing to S3 and GCS during a migration.
+// PutObject, DeleteObject and CopyObject run on the primary and every mirror in parallel, reads are served by the
+// primary only. Writes are not rolled back, so with MirrorAllMustSucceed a failed write may still have landed on
+// some of the backends and should be retried.
+type MirrorBackend struct {
+	Primary IStorageBackend
+	Mirrors []IStorageBackend
+	Mode    MirrorMode
+	// OnMirrorError, when set, is called for every failed mirror write, e.g. to log it or queue a repair
+	OnMirrorError MirrorErrorFunc
+}
+
+// NewMirrorBackend creates a new instance of MirrorBackend reading from primary and replicating writes to mirrors
+func NewMirrorBackend(mode MirrorMode, primary IStorageBackend, mirrors ...IStorageBackend) (*MirrorBackend, *ae.AppError) {
+	if primary == nil || len(mirrors) == 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("a primary and at least one mirror are required"), MirrorConfig, http.StatusInternalServerError)
+	}
+	for i, mirror := range mirrors {
+		if mirror == nil {
+			return nil, ae.GetAppErr(context.Background(), fmt.Errorf("mirror %d is nil", i), MirrorConfig, http.StatusInternalServerError)
+		}
+	}
+	return &MirrorBackend{
+		Primary: primary,
+		Mirrors: mirrors,
+		Mode:    mode,
+	}, nil
+}
+
+// Unwrap returns the primary backend
+func (b *MirrorBackend) Unwrap() IStorageBackend {
+	return b.Primary
+}
+
+// Describe reports the mode and the chain of every mirror
+func (b *MirrorBackend) Describe() map[string]string {
+	description := map[string]string{
+		"mode":    b.Mode.String(),
+		"mirrors": strconv.Itoa(len(b.Mirrors)),
+	}
+	for i, mirror := range b.Mirrors {
+		description["mirror"+strconv.Itoa(i)] = DescribeBackend(mirror).String()
+	}
+	return description
+}
+
+// GetObject retrieves an object from the primary
+func (b *MirrorBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Primary.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix of the primary
+func (b *MirrorBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Primary.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix of the primary
+func (b *MirrorBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Primary.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object to the primary and every mirror
+func (b *MirrorBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.fanOut(ctx, OperationPut, path, func(backend IStorageBackend) *ae.AppError {
+		return backend.PutObject(ctx, path, content, opts...)
+	})
+}
+
+// DeleteObject removes an object from the primary and every mirror. An object missing on a mirror, e.g. one
+// written before mirroring started, counts as deleted there.
+func (b *MirrorBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.fanOut(ctx, OperationDelete, path, func(backend IStorageBackend) *ae.AppError {
+		appErr := backend.DeleteObject(ctx, path)
+		if appErr != nil && backend != b.Primary && appErr.GetHTTPCode() == http.StatusNotFound {
+			return nil
+		}
+		return appErr
+	})
+}
+
+// CopyObject copies an object on the primary and every mirror
+func (b *MirrorBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.fanOut(ctx, OperationCopy, dstPath, func(backend IStorageBackend) *ae.AppError {
+		return backend.CopyObject(ctx, srcPath, dstPath)
+	})
+}
+
+// fanOut runs write on the primary and the mirrors in parallel and combines the outcome according to Mode. The
+// error of the primary takes precedence; otherwise the first failing mirror's error is returned with MirrorWrite.
+func (b *MirrorBackend) fanOut(ctx context.Context, operation Operation, path string, write func(IStorageBackend) *ae.AppError) *ae.AppError {
+	mirrorErrs := make([]*ae.AppError, len(b.Mirrors))
+	var wg sync.WaitGroup
+	for i, mirror := range b.Mirrors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mirrorErrs[i] = write(mirror)
+		}()
+	}
+	primaryErr := write(b.Primary)
+	wg.Wait()
+
+	var firstMirrorErr *ae.AppError
+	for i, appErr := range mirrorErrs {
+		if appErr == nil {
+			continue
+		}
+		if b.OnMirrorError != nil {
+			b.OnMirrorError(ctx, b.Mirrors[i], operation, path, appErr)
+		}
+		if firstMirrorErr == nil {
+			firstMirrorErr = appErr
+		}
+	}
+	if primaryErr != nil {
+		return primaryErr
+	}
+	if firstMirrorErr != nil && b.Mode == MirrorAllMustSucceed {
+		return firstMirrorErr.AddErrCode(MirrorWrite.Code)
+	}
+	return nil
+}
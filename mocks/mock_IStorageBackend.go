@@ -56,9 +56,16 @@ func (_m *MockIStorageBackend) DeleteObject(ctx context.Context, path string) *a
 	return r0
 }
 
-// GetObject provides a mock function with given fields: ctx, path
-func (_m *MockIStorageBackend) GetObject(ctx context.Context, path string) (object_storage.Object, *ae.AppError) {
-	ret := _m.Called(ctx, path)
+// GetObject provides a mock function with given fields: ctx, path, opts
+func (_m *MockIStorageBackend) GetObject(ctx context.Context, path string, opts ...object_storage.GetOption) (object_storage.Object, *ae.AppError) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, path)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetObject")
@@ -66,17 +73,17 @@ func (_m *MockIStorageBackend) GetObject(ctx context.Context, path string) (obje
 
 	var r0 object_storage.Object
 	var r1 *ae.AppError
-	if rf, ok := ret.Get(0).(func(context.Context, string) (object_storage.Object, *ae.AppError)); ok {
-		return rf(ctx, path)
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...object_storage.GetOption) (object_storage.Object, *ae.AppError)); ok {
+		return rf(ctx, path, opts...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string) object_storage.Object); ok {
-		r0 = rf(ctx, path)
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...object_storage.GetOption) object_storage.Object); ok {
+		r0 = rf(ctx, path, opts...)
 	} else {
 		r0 = ret.Get(0).(object_storage.Object)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string) *ae.AppError); ok {
-		r1 = rf(ctx, path)
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...object_storage.GetOption) *ae.AppError); ok {
+		r1 = rf(ctx, path, opts...)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(*ae.AppError)
@@ -118,17 +125,61 @@ func (_m *MockIStorageBackend) GetObjects(ctx context.Context, prefix string) ([
 	return r0, r1
 }
 
-// PutObject provides a mock function with given fields: ctx, path, content
-func (_m *MockIStorageBackend) PutObject(ctx context.Context, path string, content []byte) *ae.AppError {
-	ret := _m.Called(ctx, path, content)
+// ListObjects provides a mock function with given fields: ctx, prefix, opts
+func (_m *MockIStorageBackend) ListObjects(ctx context.Context, prefix string, opts ...object_storage.ListOption) (object_storage.ListResult, *ae.AppError) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, prefix)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListObjects")
+	}
+
+	var r0 object_storage.ListResult
+	var r1 *ae.AppError
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...object_storage.ListOption) (object_storage.ListResult, *ae.AppError)); ok {
+		return rf(ctx, prefix, opts...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, ...object_storage.ListOption) object_storage.ListResult); ok {
+		r0 = rf(ctx, prefix, opts...)
+	} else {
+		r0 = ret.Get(0).(object_storage.ListResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, ...object_storage.ListOption) *ae.AppError); ok {
+		r1 = rf(ctx, prefix, opts...)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*ae.AppError)
+		}
+	}
+
+	return r0, r1
+}
+
+// PutObject provides a mock function with given fields: ctx, path, content, opts
+func (_m *MockIStorageBackend) PutObject(ctx context.Context, path string, content []byte, opts ...object_storage.PutOption) *ae.AppError {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, path, content)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for PutObject")
 	}
 
 	var r0 *ae.AppError
-	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) *ae.AppError); ok {
-		r0 = rf(ctx, path, content)
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte, ...object_storage.PutOption) *ae.AppError); ok {
+		r0 = rf(ctx, path, content, opts...)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*ae.AppError)
@@ -0,0 +1,420 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// gcsMultipartPrefix is the folder, below the backend prefix, holding the parts of GCS multipart uploads
+	gcsMultipartPrefix = ".multipart"
+	// gcsMultipartPathMeta is the metadata key of the upload marker naming the object being uploaded
+	gcsMultipartPathMeta = "multipart-path"
+	// gcsComposeLimit is the most sources a GCS compose request accepts
+	gcsComposeLimit = 32
+)
+
+// MultipartPart is a part of a multipart upload stored by the provider
+type MultipartPart struct {
+	PartNumber   int64
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// IMultipartUploader is implemented by backends able to upload an object in parts sent separately, so that an
+// interrupted upload of a large object resumes where it stopped: keep the upload id, list the parts stored with
+// ListParts, upload the missing ones and complete the upload. Parts are numbered from 1 to 10000 and uploading a part
+// again replaces it.
+type IMultipartUploader interface {
+	// InitiateMultipart starts an upload to path with the attributes and encryption of opts and returns its id
+	InitiateMultipart(ctx context.Context, path string, opts ...PutOption) (string, *ae.AppError)
+	// UploadPart stores a part of the upload and returns it
+	UploadPart(ctx context.Context, path string, uploadID string, partNumber int64, content []byte) (MultipartPart, *ae.AppError)
+	// ListParts returns the parts stored so far in part number order
+	ListParts(ctx context.Context, path string, uploadID string) ([]MultipartPart, *ae.AppError)
+	// CompleteMultipart assembles the given parts, in order, into the object and ends the upload
+	CompleteMultipart(ctx context.Context, path string, uploadID string, parts []MultipartPart) *ae.AppError
+	// AbortMultipart ends the upload and deletes its parts
+	AbortMultipart(ctx context.Context, path string, uploadID string) *ae.AppError
+}
+
+// validatePartNumber checks the number of a part against the S3 limits, which GCS uploads share
+func validatePartNumber(ctx context.Context, partNumber int64) *ae.AppError {
+	if partNumber < 1 || partNumber > s3MaxParts {
+		return ae.GetAppErr(ctx, fmt.Errorf("part number %d outside 1-%d", partNumber, s3MaxParts), MultipartInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// checkCompletedParts checks that the parts given to complete an upload are in ascending order and match the parts
+// stored, listed by part number
+func checkCompletedParts(ctx context.Context, uploadID string, parts []MultipartPart, stored map[int64]MultipartPart) *ae.AppError {
+	if len(parts) == 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("upload %s has no parts", uploadID), MultipartInvalid, http.StatusBadRequest)
+	}
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d follows part %d, parts must be in ascending order", part.PartNumber, parts[i-1].PartNumber), MultipartInvalid, http.StatusBadRequest)
+		}
+		storedPart, ok := stored[part.PartNumber]
+		if !ok {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d was not uploaded", part.PartNumber), MultipartInvalid, http.StatusBadRequest)
+		}
+		if unquoteETag(storedPart.ETag) != unquoteETag(part.ETag) {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d etag mismatch, it was uploaded again", part.PartNumber), MultipartInvalid, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// InitiateMultipart starts a multipart upload to Amazon S3 bucket and returns its upload id
+func (b *S3Backend) InitiateMultipart(ctx context.Context, path string, opts ...PutOption) (string, *ae.AppError) {
+	options := getPutOptions(opts)
+	if options.customerKeyed() {
+		// every part would have to carry the key
+		return "", ae.GetAppErr(ctx, fmt.Errorf("customer supplied keys are not supported by multipart uploads"), MultipartOperation, http.StatusNotImplemented)
+	}
+	upload, appErr := b.uploadInput(ctx, path, nil, options)
+	if appErr != nil {
+		return "", appErr.AddErrCode(MultipartOperation.Code)
+	}
+	output, err := b.Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+	})
+	if err != nil {
+		return "", s3MultipartErr(ctx, err)
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+// UploadPart uploads a part of a multipart upload to Amazon S3 bucket. Every part but the last must be at least
+// 5 MiB.
+func (b *S3Backend) UploadPart(ctx context.Context, path string, uploadID string, partNumber int64, content []byte) (MultipartPart, *ae.AppError) {
+	if appErr := validatePartNumber(ctx, partNumber); appErr != nil {
+		return MultipartPart{}, appErr
+	}
+	req, output := b.Client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:        aws.String(b.Bucket),
+		Key:           aws.String(objectKey(b.Prefix, path)),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(partNumber),
+		Body:          bytes.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+	})
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return MultipartPart{}, s3MultipartErr(ctx, err)
+	}
+	return MultipartPart{
+		PartNumber:   partNumber,
+		ETag:         unquoteETag(aws.StringValue(output.ETag)),
+		Size:         int64(len(content)),
+		LastModified: time.Now(),
+	}, nil
+}
+
+// ListParts lists the parts of a multipart upload to Amazon S3 bucket stored so far
+func (b *S3Backend) ListParts(ctx context.Context, path string, uploadID string) ([]MultipartPart, *ae.AppError) {
+	var parts []MultipartPart
+	err := b.Client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(b.Bucket),
+		Key:      aws.String(objectKey(b.Prefix, path)),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, MultipartPart{
+				PartNumber:   aws.Int64Value(part.PartNumber),
+				ETag:         unquoteETag(aws.StringValue(part.ETag)),
+				Size:         aws.Int64Value(part.Size),
+				LastModified: aws.TimeValue(part.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, s3MultipartErr(ctx, err)
+	}
+	return parts, nil
+}
+
+// CompleteMultipart completes a multipart upload to Amazon S3 bucket from the given parts, after checking them
+// against the parts stored. A failed check leaves the upload open.
+func (b *S3Backend) CompleteMultipart(ctx context.Context, path string, uploadID string, parts []MultipartPart) *ae.AppError {
+	listed, appErr := b.ListParts(ctx, path, uploadID)
+	if appErr != nil {
+		return appErr
+	}
+	stored := make(map[int64]MultipartPart, len(listed))
+	for _, part := range listed {
+		stored[part.PartNumber] = part
+	}
+	if appErr := checkCompletedParts(ctx, uploadID, parts, stored); appErr != nil {
+		return appErr
+	}
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		if i < len(parts)-1 && stored[part.PartNumber].Size < s3MinPartSize {
+			return ae.GetAppErr(ctx, fmt.Errorf("part %d has %d bytes, only the last part may be smaller than %d", part.PartNumber, stored[part.PartNumber].Size, s3MinPartSize), MultipartInvalid, http.StatusBadRequest)
+		}
+		completed[i] = &s3.CompletedPart{
+			PartNumber: aws.Int64(part.PartNumber),
+			ETag:       aws.String(stored[part.PartNumber].ETag),
+		}
+	}
+	_, err := b.Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.Bucket),
+		Key:             aws.String(objectKey(b.Prefix, path)),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return s3MultipartErr(ctx, err)
+	}
+	return nil
+}
+
+// AbortMultipart aborts a multipart upload to Amazon S3 bucket and frees its parts
+func (b *S3Backend) AbortMultipart(ctx context.Context, path string, uploadID string) *ae.AppError {
+	_, err := b.Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.Bucket),
+		Key:      aws.String(objectKey(b.Prefix, path)),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return s3MultipartErr(ctx, err)
+	}
+	return nil
+}
+
+// s3MultipartErr maps an S3 multipart upload error, an unknown upload id is reported as 404
+func s3MultipartErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, MultipartOperation, http.StatusInternalServerError)
+	if isS3NotFoundError(err) || contains(err.Error(), s3.ErrCodeNoSuchUpload) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if isS3NotImplementedError(err) {
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	} else if contains(err.Error(), "EntityTooLarge") {
+		appErr = appErr.SetHTTPCode(http.StatusRequestEntityTooLarge)
+	} else if isS3ThrottlingError(err) {
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// InitiateMultipart starts a multipart upload to Google Cloud Storage bucket and returns its upload id. GCS has
+// no multipart uploads, parts are stored as objects below .multipart at the backend prefix, along with a marker
+// holding the attributes of the upload, and composed into the object on completion.
+func (b GoogleCSBackend) InitiateMultipart(ctx context.Context, path string, opts ...PutOption) (string, *ae.AppError) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", ae.GetAppErr(ctx, err, MultipartOperation, http.StatusInternalServerError)
+	}
+	uploadID := hex.EncodeToString(id)
+	options := getPutOptions(opts)
+	if options.customerKeyed() {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("customer supplied keys are not supported by multipart uploads"), MultipartOperation, http.StatusNotImplemented)
+	}
+	options.Metadata = maps.Clone(options.Metadata)
+	if options.Metadata == nil {
+		options.Metadata = map[string]string{}
+	}
+	options.Metadata[gcsMultipartPathMeta] = objectKey(b.Prefix, path)
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := b.Client.Object(b.multipartKey(uploadID, "upload")).NewWriter(writeCtx)
+	if appErr := applyGCSWriterOptions(ctx, wc, options); appErr != nil {
+		return "", appErr.AddErrCode(MultipartOperation.Code)
+	}
+	if err := wc.Close(); err != nil {
+		return "", gcsMultipartErr(ctx, err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart stores a part of a multipart upload to Google Cloud Storage bucket as an object
+func (b GoogleCSBackend) UploadPart(ctx context.Context, path string, uploadID string, partNumber int64, content []byte) (MultipartPart, *ae.AppError) {
+	if appErr := validatePartNumber(ctx, partNumber); appErr != nil {
+		return MultipartPart{}, appErr
+	}
+	if _, appErr := b.multipartUpload(ctx, path, uploadID); appErr != nil {
+		return MultipartPart{}, appErr
+	}
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wc := b.Client.Object(b.multipartKey(uploadID, gcsPartName(partNumber))).NewWriter(writeCtx)
+	if _, err := wc.Write(content); err != nil {
+		cancel()
+		return MultipartPart{}, gcsMultipartErr(ctx, err)
+	}
+	if err := wc.Close(); err != nil {
+		return MultipartPart{}, gcsMultipartErr(ctx, err)
+	}
+	attrs := wc.Attrs()
+	return MultipartPart{PartNumber: partNumber, ETag: attrs.Etag, Size: attrs.Size, LastModified: attrs.Updated}, nil
+}
+
+// ListParts lists the parts of a multipart upload to Google Cloud Storage bucket stored so far
+func (b GoogleCSBackend) ListParts(ctx context.Context, path string, uploadID string) ([]MultipartPart, *ae.AppError) {
+	if _, appErr := b.multipartUpload(ctx, path, uploadID); appErr != nil {
+		return nil, appErr
+	}
+	partPrefix := b.multipartKey(uploadID, "part-")
+	var parts []MultipartPart
+	it := b.Client.Objects(ctx, &storage.Query{Prefix: partPrefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, gcsMultipartErr(ctx, err)
+		}
+		partNumber, err := strconv.ParseInt(strings.TrimPrefix(attrs.Name, partPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, MultipartPart{PartNumber: partNumber, ETag: attrs.Etag, Size: attrs.Size, LastModified: attrs.Updated})
+	}
+	return parts, nil
+}
+
+// CompleteMultipart composes the given parts of a multipart upload into the object in Google Cloud Storage bucket,
+// with the attributes given when the upload started, then deletes the parts. Uploads of more than 32 parts are
+// composed in rounds, through intermediate objects. A failed check of the parts leaves the upload open.
+func (b GoogleCSBackend) CompleteMultipart(ctx context.Context, path string, uploadID string, parts []MultipartPart) *ae.AppError {
+	listed, appErr := b.ListParts(ctx, path, uploadID)
+	if appErr != nil {
+		return appErr
+	}
+	stored := make(map[int64]MultipartPart, len(listed))
+	for _, part := range listed {
+		stored[part.PartNumber] = part
+	}
+	if appErr := checkCompletedParts(ctx, uploadID, parts, stored); appErr != nil {
+		return appErr
+	}
+	marker, appErr := b.multipartUpload(ctx, path, uploadID)
+	if appErr != nil {
+		return appErr
+	}
+
+	sources := make([]*storage.ObjectHandle, len(parts))
+	for i, part := range parts {
+		sources[i] = b.Client.Object(b.multipartKey(uploadID, gcsPartName(part.PartNumber)))
+	}
+	for round := 0; len(sources) > gcsComposeLimit; round++ {
+		var composed []*storage.ObjectHandle
+		for start := 0; start < len(sources); start += gcsComposeLimit {
+			dst := b.Client.Object(b.multipartKey(uploadID, fmt.Sprintf("compose-%d-%05d", round, len(composed))))
+			if _, err := dst.ComposerFrom(sources[start:min(start+gcsComposeLimit, len(sources))]...).Run(ctx); err != nil {
+				return gcsMultipartErr(ctx, err)
+			}
+			composed = append(composed, dst)
+		}
+		sources = composed
+	}
+	composer := b.Client.Object(objectKey(b.Prefix, path)).ComposerFrom(sources...)
+	composer.ContentType = marker.ContentType
+	composer.CacheControl = marker.CacheControl
+	composer.ContentEncoding = marker.ContentEncoding
+	composer.ContentDisposition = marker.ContentDisposition
+	composer.ContentLanguage = marker.ContentLanguage
+	composer.StorageClass = marker.StorageClass
+	composer.KMSKeyName = marker.KMSKeyName
+	composer.Metadata = maps.Clone(marker.Metadata)
+	delete(composer.Metadata, gcsMultipartPathMeta)
+	if _, err := composer.Run(ctx); err != nil {
+		return gcsMultipartErr(ctx, err)
+	}
+	// the object is complete, parts left behind by a failed cleanup are only wasted space
+	_ = b.deleteMultipart(ctx, uploadID)
+	return nil
+}
+
+// AbortMultipart deletes the parts of a multipart upload to Google Cloud Storage bucket
+func (b GoogleCSBackend) AbortMultipart(ctx context.Context, path string, uploadID string) *ae.AppError {
+	if _, appErr := b.multipartUpload(ctx, path, uploadID); appErr != nil {
+		return appErr
+	}
+	return b.deleteMultipart(ctx, uploadID)
+}
+
+// multipartUpload returns the attributes of the marker of an upload, failing with 404 when the upload is unknown
+// and 400 when it uploads another path
+func (b GoogleCSBackend) multipartUpload(ctx context.Context, path string, uploadID string) (*storage.ObjectAttrs, *ae.AppError) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("invalid upload id %q", uploadID), MultipartInvalid, http.StatusBadRequest)
+	}
+	attrs, err := b.Client.Object(b.multipartKey(uploadID, "upload")).Attrs(ctx)
+	if err != nil {
+		return nil, gcsMultipartErr(ctx, err)
+	}
+	if key := objectKey(b.Prefix, path); attrs.Metadata[gcsMultipartPathMeta] != key {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("upload %s is not an upload of %s", uploadID, key), MultipartInvalid, http.StatusBadRequest)
+	}
+	return attrs, nil
+}
+
+// deleteMultipart deletes the marker, parts and intermediate objects of an upload
+func (b GoogleCSBackend) deleteMultipart(ctx context.Context, uploadID string) *ae.AppError {
+	it := b.Client.Objects(ctx, &storage.Query{Prefix: b.multipartKey(uploadID, "")})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return gcsMultipartErr(ctx, err)
+		}
+		if err := b.Client.Object(attrs.Name).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+			return gcsMultipartErr(ctx, err)
+		}
+	}
+}
+
+// multipartKey returns the key of an object of an upload, the marker, a part or an intermediate object
+func (b GoogleCSBackend) multipartKey(uploadID string, name string) string {
+	return objectKey(b.Prefix, gcsMultipartPrefix+"/"+uploadID) + "/" + name
+}
+
+// gcsPartName returns the name of a part object, zero padded so that parts list in part number order
+func gcsPartName(partNumber int64) string {
+	return fmt.Sprintf("part-%05d", partNumber)
+}
+
+// gcsMultipartErr maps a GCS error of a multipart upload, an unknown upload is reported as 404
+func gcsMultipartErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, MultipartOperation, http.StatusInternalServerError)
+	if err.Error() == storage.ErrObjectNotExist.Error() {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if retryAfter, ok := gcsRetryAfter(err); ok {
+		appErr = throttled(appErr, retryAfter)
+	}
+	return appErr
+}
@@ -0,0 +1,276 @@
+package object_storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	pathutil "path"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const (
+	namespaceManifestName = "manifest.json"
+	namespaceObjectsDir   = "objects/"
+	// namespacePAXAttributes is the tar PAX record holding the NamespaceEntry of an object
+	namespacePAXAttributes = "GOS.attributes"
+	namespacePageSize      = 1000
+)
+
+// NamespaceEntry describes one object of an exported namespace
+type NamespaceEntry struct {
+	// Path is relative to the exported prefix
+	Path               string            `json:"path"`
+	Size               int64             `json:"size"`
+	SHA256             string            `json:"sha256"`
+	LastModified       time.Time         `json:"lastModified"`
+	ContentType        string            `json:"contentType,omitempty"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	ContentLanguage    string            `json:"contentLanguage,omitempty"`
+	StorageClass       string            `json:"storageClass,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+}
+
+// NamespaceManifest lists the objects of an exported namespace, e.g. the data of a tenant
+type NamespaceManifest struct {
+	Prefix     string           `json:"prefix"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Objects    []NamespaceEntry `json:"objects"`
+}
+
+// ExportNamespace writes every object under prefix of src, with its attributes, to w as a gzip compressed tar
+// archive, e.g. to answer a data portability request or offboard a tenant. Objects are stored under objects/ with
+// their attributes and SHA-256 in PAX records, followed by a manifest.json listing them all. Tags are exported
+// when src implements IObjectTagger.
+func ExportNamespace(ctx context.Context, src IStorageBackend, prefix string, w io.Writer) (NamespaceManifest, *ae.AppError) {
+	manifest := NamespaceManifest{Prefix: prefix, ExportedAt: time.Now().UTC()}
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	appErr := walkNamespace(ctx, src, prefix, func(object Object, entry NamespaceEntry) *ae.AppError {
+		attributes, err := json.Marshal(entry)
+		if err != nil {
+			return ae.GetAppErr(ctx, err, NamespaceExport, http.StatusInternalServerError)
+		}
+		header := &tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       namespaceObjectsDir + entry.Path,
+			Size:       entry.Size,
+			Mode:       0o644,
+			ModTime:    entry.LastModified,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{namespacePAXAttributes: string(attributes)},
+		}
+		if strings.HasSuffix(entry.Path, "/") {
+			// tar only allows a trailing slash on directories, so folder markers must be empty
+			if entry.Size > 0 {
+				return ae.GetAppErr(ctx, fmt.Errorf("folder marker %s has content", entry.Path), NamespaceExport, http.StatusInternalServerError)
+			}
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to archive %s", entry.Path), NamespaceExport, http.StatusInternalServerError)
+		}
+		if _, err := archive.Write(object.Content); err != nil {
+			return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to archive %s", entry.Path), NamespaceExport, http.StatusInternalServerError)
+		}
+		manifest.Objects = append(manifest.Objects, entry)
+		return nil
+	})
+	if appErr != nil {
+		return manifest, appErr
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, ae.GetAppErr(ctx, err, NamespaceExport, http.StatusInternalServerError)
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     namespaceManifestName,
+		Size:     int64(len(content)),
+		Mode:     0o644,
+		ModTime:  manifest.ExportedAt,
+	}
+	if err := archive.WriteHeader(header); err == nil {
+		_, err = archive.Write(content)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return manifest, ae.GetAppErr(ctx, errors.Wrap(err, "failed to write the archive"), NamespaceExport, http.StatusInternalServerError)
+	}
+	return manifest, nil
+}
+
+// ExportNamespaceToBackend copies every object under prefix of src to dstPrefix of dst, keeping the attributes
+// selected by preserve, and writes the manifest to manifest.json under dstPrefix
+func ExportNamespaceToBackend(ctx context.Context, src IStorageBackend, prefix string, dst IStorageBackend, dstPrefix string, preserve PreserveAttributes) (NamespaceManifest, *ae.AppError) {
+	manifest := NamespaceManifest{Prefix: prefix, ExportedAt: time.Now().UTC()}
+	appErr := walkNamespace(ctx, src, prefix, func(object Object, entry NamespaceEntry) *ae.AppError {
+		if appErr := dst.PutObject(ctx, objectKey(pathutil.Join(dstPrefix, namespaceObjectsDir), entry.Path), object.Content, entryPutOptions(entry, preserve)...); appErr != nil {
+			return appErr.AddErrCode(NamespaceExport.Code)
+		}
+		manifest.Objects = append(manifest.Objects, entry)
+		return nil
+	})
+	if appErr != nil {
+		return manifest, appErr
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, ae.GetAppErr(ctx, err, NamespaceExport, http.StatusInternalServerError)
+	}
+	if appErr := dst.PutObject(ctx, pathutil.Join(dstPrefix, namespaceManifestName), content, WithContentType("application/json")); appErr != nil {
+		return manifest, appErr.AddErrCode(NamespaceExport.Code)
+	}
+	return manifest, nil
+}
+
+// ImportNamespace restores an archive written by ExportNamespace under prefix of dst, with the attributes selected
+// by preserve. Every object is checked against its recorded SHA-256 before it is written, and the import fails
+// unless the archive ends with a manifest matching the imported objects. Objects imported before a failure are
+// left in place.
+func ImportNamespace(ctx context.Context, r io.Reader, dst IStorageBackend, prefix string, preserve PreserveAttributes) (NamespaceManifest, *ae.AppError) {
+	var manifest NamespaceManifest
+	invalid := func(err error) (NamespaceManifest, *ae.AppError) {
+		return manifest, ae.GetAppErr(ctx, err, NamespaceImport, http.StatusBadRequest)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return invalid(errors.Wrap(err, "invalid archive"))
+	}
+	archive := tar.NewReader(gz)
+	imported := map[string]string{}
+	manifestRead := false
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return invalid(errors.Wrap(err, "invalid archive"))
+		}
+		if header.Name == namespaceManifestName {
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return invalid(errors.Wrap(err, "invalid manifest"))
+			}
+			manifestRead = true
+			continue
+		}
+		path, ok := strings.CutPrefix(header.Name, namespaceObjectsDir)
+		isMarker := header.Typeflag == tar.TypeDir && strings.HasSuffix(path, "/")
+		if !ok || (header.Typeflag != tar.TypeReg && !isMarker) || !isRelativeObjectPath(path) {
+			return invalid(fmt.Errorf("unexpected archive entry %q", header.Name))
+		}
+		var entry NamespaceEntry
+		if err := json.Unmarshal([]byte(header.PAXRecords[namespacePAXAttributes]), &entry); err != nil || entry.Path != path {
+			return invalid(fmt.Errorf("archive entry %q has no valid attributes", header.Name))
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return invalid(errors.Wrapf(err, "failed to read %s", path))
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return invalid(fmt.Errorf("checksum mismatch for %s", path))
+		}
+		if appErr := dst.PutObject(ctx, objectKey(prefix, path), content, entryPutOptions(entry, preserve)...); appErr != nil {
+			return manifest, appErr.AddErrCode(NamespaceImport.Code)
+		}
+		imported[path] = entry.SHA256
+	}
+
+	if !manifestRead {
+		return invalid(fmt.Errorf("archive has no manifest"))
+	}
+	if len(manifest.Objects) != len(imported) {
+		return invalid(fmt.Errorf("manifest lists %d objects, archive holds %d", len(manifest.Objects), len(imported)))
+	}
+	for _, entry := range manifest.Objects {
+		if imported[entry.Path] != entry.SHA256 {
+			return invalid(fmt.Errorf("manifest entry %s does not match the archive", entry.Path))
+		}
+	}
+	return manifest, nil
+}
+
+// walkNamespace reads every object under prefix of src, page by page, and calls fn with it and its entry
+func walkNamespace(ctx context.Context, src IStorageBackend, prefix string, fn func(Object, NamespaceEntry) *ae.AppError) *ae.AppError {
+	tagger, _ := src.(IObjectTagger)
+	cursor := ""
+	for {
+		page, appErr := src.ListObjects(ctx, prefix, WithMaxKeys(namespacePageSize), WithCursor(cursor))
+		if appErr != nil {
+			return appErr.AddErrCode(NamespaceExport.Code)
+		}
+		for _, listed := range page.Objects {
+			path := objectKey(prefix, listed.Path)
+			object, appErr := src.GetObject(ctx, path)
+			if appErr != nil {
+				return appErr.AddErrCode(NamespaceExport.Code)
+			}
+			sum := sha256.Sum256(object.Content)
+			entry := NamespaceEntry{
+				Path:               listed.Path,
+				Size:               int64(len(object.Content)),
+				SHA256:             hex.EncodeToString(sum[:]),
+				LastModified:       object.LastModified.UTC(),
+				ContentType:        object.ContentType,
+				CacheControl:       object.CacheControl,
+				ContentEncoding:    object.ContentEncoding,
+				ContentDisposition: object.ContentDisposition,
+				ContentLanguage:    object.ContentLanguage,
+				StorageClass:       object.StorageClass,
+				Metadata:           object.Meta.User,
+			}
+			if tagger != nil {
+				if entry.Tags, appErr = tagger.GetObjectTags(ctx, path); appErr != nil {
+					return appErr.AddErrCode(NamespaceExport.Code)
+				}
+			}
+			if appErr := fn(object, entry); appErr != nil {
+				return appErr
+			}
+		}
+		if !page.Truncated {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// entryPutOptions returns the put options restoring the attributes of entry selected by preserve
+func entryPutOptions(entry NamespaceEntry, preserve PreserveAttributes) []PutOption {
+	return attributePutOptions(Object{
+		Meta:               Metadata{User: entry.Metadata},
+		ContentType:        entry.ContentType,
+		CacheControl:       entry.CacheControl,
+		ContentEncoding:    entry.ContentEncoding,
+		ContentDisposition: entry.ContentDisposition,
+		ContentLanguage:    entry.ContentLanguage,
+		StorageClass:       entry.StorageClass,
+	}, entry.Tags, preserve)
+}
+
+// isRelativeObjectPath reports whether path stays below the prefix it is joined to
+func isRelativeObjectPath(path string) bool {
+	return path != "" && !strings.HasPrefix(path, "/") && !hasParentSegment(path)
+}
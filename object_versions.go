@@ -0,0 +1,273 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// WithVersionID reads the version versionID of the object, an S3 version id or a GCS generation as reported by
+// ListObjectVersions and version aware listings. Backends keeping no versions fail with 501 Not Implemented, caches
+// are bypassed.
+func WithVersionID(versionID string) GetOption {
+	return func(o *GetOptions) {
+		o.VersionID = versionID
+	}
+}
+
+// IObjectVersioner is implemented by backends and decorators able to list and delete the versions of an object
+type IObjectVersioner interface {
+	ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError)
+	DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError
+}
+
+// ListObjectVersions returns the versions of the object at path of backend on a versioned S3 or GCS bucket, newest
+// first, with VersionID, IsLatest and, for S3 delete markers, IsDeleteMarker set. Transparent decorators are passed
+// through to the layer they wrap, as by DeleteObjectVersion; other decorators not implementing IObjectVersioner and
+// backends keeping no versions fail with 501 Not Implemented.
+func ListObjectVersions(ctx context.Context, backend IStorageBackend, path string) ([]Object, *ae.AppError) {
+	if versioner, ok := backend.(IObjectVersioner); ok {
+		return versioner.ListObjectVersions(ctx, path)
+	}
+	wrapper, ok := backend.(transparentDecorator)
+	if !ok {
+		return nil, versionsUnsupportedErr(ctx)
+	}
+	return ListObjectVersions(ctx, wrapper.Unwrap(), path)
+}
+
+// GetObjectVersion retrieves the version versionID of the object at path of backend, see WithVersionID
+func GetObjectVersion(ctx context.Context, backend IStorageBackend, path string, versionID string, opts ...GetOption) (Object, *ae.AppError) {
+	return backend.GetObject(ctx, path, append(opts, WithVersionID(versionID))...)
+}
+
+// DeleteObjectVersion permanently deletes the version versionID of the object at path of backend. Deleting the
+// current version makes the previous one current, and deleting an S3 delete marker undeletes the object.
+// Transparent decorators, such as caches and retries, are passed through to the layer they wrap, dropping the object
+// from caches afterwards. Other decorators not implementing IObjectVersioner, such as PinnedBackend or
+// ImmutableBackend, fail with 501 Not Implemented, since deleting a version below them would skip their checks.
+func DeleteObjectVersion(ctx context.Context, backend IStorageBackend, path string, versionID string) *ae.AppError {
+	if versioner, ok := backend.(IObjectVersioner); ok {
+		return versioner.DeleteObjectVersion(ctx, path, versionID)
+	}
+	wrapper, ok := backend.(transparentDecorator)
+	if !ok {
+		return versionsUnsupportedErr(ctx)
+	}
+	appErr := DeleteObjectVersion(ctx, wrapper.Unwrap(), path, versionID)
+	if invalidator, ok := backend.(cacheInvalidator); ok {
+		invalidator.Invalidate(path)
+	}
+	return appErr
+}
+
+// versionsUnsupportedErr returns the error of a version operation on a backend keeping no versions, or on a
+// decorator which cannot let it through
+func versionsUnsupportedErr(ctx context.Context) *ae.AppError {
+	return ae.GetAppErr(ctx, fmt.Errorf("backend does not support object version operations"), VersionOperation, http.StatusNotImplemented)
+}
+
+// ListObjectVersions lists the versions and delete markers of an object in Amazon S3 bucket, newest first
+func (b *S3Backend) ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	if b.Compat.NoVersionListing {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("object versions are not supported by %s", b.Compat.Provider), VersionOperation, http.StatusNotImplemented)
+	}
+	key := objectKey(b.Prefix, path)
+	var versions []Object
+	s3Input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(key),
+	}
+	for {
+		s3Result, err := b.Client.ListObjectVersionsWithContext(ctx, s3Input)
+		if err != nil {
+			return nil, s3VersionErr(ctx, err)
+		}
+		// keys sort after their own prefix, so the versions of key come before those of longer keys
+		otherKeys := false
+		for _, version := range s3Result.Versions {
+			if aws.StringValue(version.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versions = append(versions, Object{
+				Path:         path,
+				Content:      []byte{},
+				LastModified: aws.TimeValue(version.LastModified),
+				Size:         aws.Int64Value(version.Size),
+				StorageClass: aws.StringValue(version.StorageClass),
+				ETag:         unquoteETag(aws.StringValue(version.ETag)),
+				VersionID:    aws.StringValue(version.VersionId),
+				IsLatest:     aws.BoolValue(version.IsLatest),
+			})
+		}
+		for _, marker := range s3Result.DeleteMarkers {
+			if aws.StringValue(marker.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versions = append(versions, Object{
+				Path:           path,
+				Content:        []byte{},
+				LastModified:   aws.TimeValue(marker.LastModified),
+				VersionID:      aws.StringValue(marker.VersionId),
+				IsLatest:       aws.BoolValue(marker.IsLatest),
+				IsDeleteMarker: true,
+			})
+		}
+		if otherKeys || !aws.BoolValue(s3Result.IsTruncated) {
+			break
+		}
+		s3Input.KeyMarker = s3Result.NextKeyMarker
+		s3Input.VersionIdMarker = s3Result.NextVersionIdMarker
+	}
+	sortVersionsNewestFirst(versions)
+	return versions, nil
+}
+
+// DeleteObjectVersion permanently deletes a version or delete marker of an object in Amazon S3 bucket
+func (b *S3Backend) DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	if b.Compat.NoVersionListing {
+		return ae.GetAppErr(ctx, fmt.Errorf("object versions are not supported by %s", b.Compat.Provider), VersionOperation, http.StatusNotImplemented)
+	}
+	if versionID == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("version id is required"), VersionInvalid, http.StatusBadRequest)
+	}
+	_, err := b.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(b.Bucket),
+		Key:       aws.String(objectKey(b.Prefix, path)),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		return s3VersionErr(ctx, errors.Wrapf(err, "failed to delete version %s of %s", versionID, path))
+	}
+	return nil
+}
+
+// s3VersionErr maps an S3 error of a version operation
+func s3VersionErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, VersionOperation, http.StatusInternalServerError)
+	switch {
+	case isS3NotFoundError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	case contains(err.Error(), "InvalidArgument"):
+		appErr = appErr.SetHTTPCode(http.StatusBadRequest)
+	case isS3NotImplementedError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	case isS3ThrottlingError(err):
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// ListObjectVersions lists the generations of an object in Google Cloud Storage bucket, newest first. GCS has no
+// delete markers, the generations of a deleted object are all noncurrent.
+func (b GoogleCSBackend) ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	key := objectKey(b.Prefix, path)
+	var versions []Object
+	it := b.Client.Objects(ctx, &storage.Query{Prefix: key, Versions: true})
+	for {
+		attrs, err := it.Next()
+		// objects are listed by name, so the generations of key come before those of longer names
+		if err == iterator.Done || (err == nil && attrs.Name != key) {
+			break
+		}
+		if err != nil {
+			return nil, gcsVersionErr(ctx, err)
+		}
+		versions = append(versions, Object{
+			Path:         path,
+			Content:      []byte{},
+			LastModified: attrs.Updated,
+			Size:         attrs.Size,
+			StorageClass: attrs.StorageClass,
+			ETag:         attrs.Etag,
+			CRC32C:       gcsCRC32C(attrs.CRC32C),
+			VersionID:    strconv.FormatInt(attrs.Generation, 10),
+			IsLatest:     attrs.Deleted.IsZero(),
+		})
+	}
+	sortVersionsNewestFirst(versions)
+	return versions, nil
+}
+
+// DeleteObjectVersion permanently deletes a generation of an object in Google Cloud Storage bucket
+func (b GoogleCSBackend) DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	generation, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "invalid generation %q", versionID), VersionInvalid, http.StatusBadRequest)
+	}
+	if err := b.Client.Object(objectKey(b.Prefix, path)).Generation(generation).Delete(ctx); err != nil {
+		return gcsVersionErr(ctx, errors.Wrapf(err, "failed to delete generation %d of %s", generation, path))
+	}
+	return nil
+}
+
+// gcsVersionErr maps a GCS error of a version operation
+func gcsVersionErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, VersionOperation, http.StatusInternalServerError)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if retryAfter, ok := gcsRetryAfter(err); ok {
+		appErr = throttled(appErr, retryAfter)
+	}
+	return appErr
+}
+
+// ListObjectVersions lists the versions of an object below the prefix
+func (b *SubBackend) ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return nil, appErr
+	}
+	versions, appErr := ListObjectVersions(ctx, b.Parent, key)
+	for i := range versions {
+		versions[i].Path = path
+	}
+	return versions, appErr
+}
+
+// DeleteObjectVersion deletes a version of an object below the prefix
+func (b *SubBackend) DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return DeleteObjectVersion(ctx, b.Parent, key, versionID)
+}
+
+// ListObjectVersions lists the versions of an object in its shard
+func (b *ShardedBackend) ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	return ListObjectVersions(ctx, b.ShardFor(path).Backend, path)
+}
+
+// DeleteObjectVersion deletes a version of an object in its shard
+func (b *ShardedBackend) DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	return DeleteObjectVersion(ctx, b.ShardFor(path).Backend, path, versionID)
+}
+
+// ListObjectVersions lists the versions of an object in the backend of its route
+func (b *RouterBackend) ListObjectVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return ListObjectVersions(ctx, backend, path)
+}
+
+// DeleteObjectVersion deletes a version of an object in the backend of its route
+func (b *RouterBackend) DeleteObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return DeleteObjectVersion(ctx, backend, path, versionID)
+}
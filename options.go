@@ -0,0 +1,307 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// EncryptionType identifies how an object is encrypted at rest by the provider
+type EncryptionType string
+
+const (
+	// EncryptionNone means no server side encryption was requested or reported
+	EncryptionNone EncryptionType = ""
+	// EncryptionProviderManaged is encryption with keys owned by the provider (S3 SSE-S3, GCS default encryption)
+	EncryptionProviderManaged EncryptionType = "provider-managed"
+	// EncryptionKMS is encryption with a customer managed KMS key (S3 SSE-KMS, GCS CMEK)
+	EncryptionKMS EncryptionType = "kms"
+	// EncryptionCustomerKey is encryption with a key the client supplies with every request (S3 SSE-C, GCS
+	// customer-supplied encryption keys)
+	EncryptionCustomerKey EncryptionType = "customer-key"
+)
+
+// Encryption describes the server side encryption of an object
+type Encryption struct {
+	Type EncryptionType
+	// KMSKeyID is the S3 KMS key ARN/ID or the GCS CMEK key name, set when Type is EncryptionKMS
+	KMSKeyID string
+	// CustomerKey is the 256-bit AES key of EncryptionCustomerKey, given on writes and never reported by reads
+	CustomerKey []byte
+}
+
+// PutOptions holds the settings applied to a PutObject call
+type PutOptions struct {
+	Encryption   *Encryption
+	ContentType  string
+	CacheControl string
+	// ContentEncoding, ContentDisposition and ContentLanguage are the other content headers the object is served with
+	ContentEncoding    string
+	ContentDisposition string
+	ContentLanguage    string
+	// Metadata is user metadata stored with the object (S3 x-amz-meta-*, GCS metadata, COS x-cos-meta-*)
+	Metadata map[string]string
+	// Tags are S3 object tags, not supported by the other providers
+	Tags map[string]string
+	// StorageClass is the provider storage class name, e.g. STANDARD_IA on S3 or NEARLINE on GCS
+	StorageClass string
+}
+
+// PutOption configures a PutObject call
+type PutOption func(*PutOptions)
+
+// WithEncryption requests server side encryption for the uploaded object
+func WithEncryption(encryption Encryption) PutOption {
+	return func(o *PutOptions) {
+		o.Encryption = &encryption
+	}
+}
+
+// WithKMSKey requests encryption with the given customer managed key (S3 KMS key ARN or GCS CMEK key name)
+func WithKMSKey(keyID string) PutOption {
+	return WithEncryption(Encryption{Type: EncryptionKMS, KMSKeyID: keyID})
+}
+
+// WithContentType sets the Content-Type the object is served with
+func WithContentType(contentType string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// WithCacheControl sets the Cache-Control header the object is served with
+func WithCacheControl(cacheControl string) PutOption {
+	return func(o *PutOptions) {
+		o.CacheControl = cacheControl
+	}
+}
+
+// WithContentEncoding sets the Content-Encoding header the object is served with, e.g. gzip for content stored
+// compressed
+func WithContentEncoding(contentEncoding string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentEncoding = contentEncoding
+	}
+}
+
+// WithContentDisposition sets the Content-Disposition header the object is served with, e.g.
+// `attachment; filename="report.pdf"` to have browsers download it
+func WithContentDisposition(contentDisposition string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentDisposition = contentDisposition
+	}
+}
+
+// WithContentLanguage sets the Content-Language header the object is served with
+func WithContentLanguage(contentLanguage string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentLanguage = contentLanguage
+	}
+}
+
+// WithMetadata adds user metadata to the object, keys given by earlier options are kept unless overridden
+func WithMetadata(metadata map[string]string) PutOption {
+	return func(o *PutOptions) {
+		o.Metadata = mergeStringMaps(o.Metadata, metadata)
+	}
+}
+
+// WithTags adds object tags, keys given by earlier options are kept unless overridden
+func WithTags(tags map[string]string) PutOption {
+	return func(o *PutOptions) {
+		o.Tags = mergeStringMaps(o.Tags, tags)
+	}
+}
+
+// WithStorageClass sets the storage class the object is written to
+func WithStorageClass(storageClass string) PutOption {
+	return func(o *PutOptions) {
+		o.StorageClass = storageClass
+	}
+}
+
+// attributesSet returns the names of the object attributes, other than encryption, set by the options. Backends
+// unable to store object attributes reject puts setting any.
+func (o PutOptions) attributesSet() []string {
+	var names []string
+	if o.ContentType != "" {
+		names = append(names, "content type")
+	}
+	if o.CacheControl != "" {
+		names = append(names, "cache control")
+	}
+	if o.ContentEncoding != "" {
+		names = append(names, "content encoding")
+	}
+	if o.ContentDisposition != "" {
+		names = append(names, "content disposition")
+	}
+	if o.ContentLanguage != "" {
+		names = append(names, "content language")
+	}
+	if len(o.Metadata) > 0 {
+		names = append(names, "metadata")
+	}
+	if len(o.Tags) > 0 {
+		names = append(names, "tags")
+	}
+	if o.StorageClass != "" {
+		names = append(names, "storage class")
+	}
+	return names
+}
+
+// invalidHeaderMetadataKey returns a user metadata key of the options that cannot be sent as part of an HTTP header
+// name, as S3 and COS store metadata, and false when every key can
+func (o PutOptions) invalidHeaderMetadataKey() (string, bool) {
+	for key := range o.Metadata {
+		if key == "" || strings.IndexFunc(key, func(r rune) bool {
+			return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+		}) >= 0 {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// mergeStringMaps returns a copy of base with the entries of override added, override winning on conflicts
+func mergeStringMaps(base, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// getPutOptions applies the given options over the defaults
+func getPutOptions(opts []PutOption) PutOptions {
+	var options PutOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// ByteRange selects length bytes starting at Offset, a non positive Length reads to the end of the object. A
+// negative Offset selects the last -Offset bytes of the object, ignoring Length.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// from returns the range counted from the start of an object of size bytes, turning a suffix range into the
+// offset it starts at
+func (r ByteRange) from(size int64) ByteRange {
+	if r.Offset >= 0 {
+		return r
+	}
+	return ByteRange{Offset: max(size+r.Offset, 0)}
+}
+
+// GetOptions holds the settings applied to a GetObject call
+type GetOptions struct {
+	Range *ByteRange
+	// AsOf, when set, reads the version of the object current at that time
+	AsOf time.Time
+	// VersionID, when set, reads that version of the object, see WithVersionID
+	VersionID string
+	// IfNoneMatch and IfModifiedSince, when set, only read the object when it changed, see WithIfNoneMatch
+	IfNoneMatch     string
+	IfModifiedSince time.Time
+	// CustomerKey decrypts an object encrypted with a customer supplied key, see WithDecryptionKey
+	CustomerKey []byte
+}
+
+// GetOption configures a GetObject call
+type GetOption func(*GetOptions)
+
+// WithRange reads only part of the object, Object.Size still reports the size of the whole object. A negative
+// offset reads the last -offset bytes, e.g. WithRange(-8, 0) reads the footer length and magic of a Parquet file.
+func WithRange(offset, length int64) GetOption {
+	return func(o *GetOptions) {
+		o.Range = &ByteRange{Offset: offset, Length: length}
+	}
+}
+
+// WithVersionAt reads the version of the object that was current at asOf on versioned S3 and GCS buckets, e.g. for
+// pipelines reprocessing data as of a point in time. Objects deleted or not yet written at asOf are not found,
+// Object.VersionID reports the version read. Backends keeping no versions fail with 501 Not Implemented, caches
+// are bypassed.
+func WithVersionAt(asOf time.Time) GetOption {
+	return func(o *GetOptions) {
+		o.AsOf = asOf
+	}
+}
+
+// versioned reports whether the options read a past version of the object rather than the current one
+func (o GetOptions) versioned() bool {
+	return !o.AsOf.IsZero() || o.VersionID != ""
+}
+
+// uncached reports whether the read must bypass caches: past versions, and content decrypted with a customer key,
+// which must not be served to readers without the key
+func (o GetOptions) uncached() bool {
+	return o.versioned() || o.CustomerKey != nil
+}
+
+// getGetOptions applies the given options over the defaults
+func getGetOptions(opts []GetOption) GetOptions {
+	var options GetOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// describeGetOptions describes the options of a GetObject call changing its outcome
+func describeGetOptions(opts []GetOption) string {
+	options := getGetOptions(opts)
+	var request []string
+	if options.Range != nil {
+		request = append(request, fmt.Sprintf("range=%d+%d", options.Range.Offset, options.Range.Length))
+	}
+	if !options.AsOf.IsZero() {
+		request = append(request, "asOf="+options.AsOf.UTC().Format(time.RFC3339Nano))
+	}
+	if options.VersionID != "" {
+		request = append(request, "versionId="+options.VersionID)
+	}
+	if options.IfNoneMatch != "" {
+		request = append(request, "ifNoneMatch="+options.IfNoneMatch)
+	}
+	if !options.IfModifiedSince.IsZero() {
+		request = append(request, "ifModifiedSince="+options.IfModifiedSince.UTC().Format(time.RFC3339Nano))
+	}
+	if options.CustomerKey != nil {
+		// the key itself must not leak into recordings
+		request = append(request, "customerKeySHA256="+customerKeySHA256(options.CustomerKey))
+	}
+	return strings.Join(request, ",")
+}
+
+// withoutRange returns the options reading the whole object, for decorators transforming the content before the
+// range can be taken
+func withoutRange(opts []GetOption) []GetOption {
+	return append(slices.Clone(opts), func(o *GetOptions) { o.Range = nil })
+}
+
+// sliceRange keeps the part of the content of a whole object selected by byteRange, if any
+func sliceRange(ctx context.Context, object Object, byteRange *ByteRange, customErr *ae.CustomErr) (Object, *ae.AppError) {
+	if byteRange == nil {
+		return object, nil
+	}
+	ranged, ok := rangeObject(object, *byteRange)
+	if !ok {
+		return Object{Path: object.Path}, ae.GetAppErr(ctx, fmt.Errorf("range offset %d beyond object size %d", byteRange.from(object.Size).Offset, object.Size), customErr, http.StatusRequestedRangeNotSatisfiable)
+	}
+	return ranged, nil
+}
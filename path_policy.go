@@ -0,0 +1,133 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// PathMode is how a PathPolicyBackend treats the object paths and listing prefixes given by callers
+type PathMode int
+
+const (
+	// PathModeClean normalizes paths the way every backend resolves them: leading slashes are removed and the path is
+	// cleaned, so "/a//b/./c" is a/b/c. Paths resolving above the root, such as "../a", are rejected.
+	PathModeClean PathMode = iota
+	// PathModeStrict rejects paths not already in normalized form, e.g. "/a", "a//b" or "a/./b", catching callers
+	// mixing path conventions
+	PathModeStrict
+)
+
+// String returns the name of the mode
+func (m PathMode) String() string {
+	if m == PathModeStrict {
+		return "strict"
+	}
+	return "clean"
+}
+
+// NormalizePath returns path in the form every backend resolves it to below its prefix: cleaned, without leading
+// slash, keeping a trailing slash, and empty for the root ("", "/" or ".")
+func NormalizePath(path string) string {
+	return objectKey("", path)
+}
+
+// PathPolicyBackend is an IStorageBackend decorator applying a PathMode to every path and prefix before they reach
+// the wrapped backend, so that decorators keyed by path, such as caches and pins, see one form of every path. Put it
+// outermost.
+type PathPolicyBackend struct {
+	Backend IStorageBackend
+	Mode    PathMode
+}
+
+// NewPathPolicyBackend creates a new instance of PathPolicyBackend applying mode to the paths given to backend
+func NewPathPolicyBackend(backend IStorageBackend, mode PathMode) *PathPolicyBackend {
+	return &PathPolicyBackend{
+		Backend: backend,
+		Mode:    mode,
+	}
+}
+
+// Unwrap returns the backend receiving the normalized paths
+func (b *PathPolicyBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the mode
+func (b *PathPolicyBackend) Describe() map[string]string {
+	return map[string]string{
+		"mode": b.Mode.String(),
+	}
+}
+
+// GetObject retrieves an object
+func (b *PathPolicyBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	normalized, appErr := b.normalize(ctx, path)
+	if appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return b.Backend.GetObject(ctx, normalized, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *PathPolicyBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	normalized, appErr := b.normalize(ctx, prefix)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return b.Backend.GetObjects(ctx, normalized)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *PathPolicyBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	normalized, appErr := b.normalize(ctx, prefix)
+	if appErr != nil {
+		return ListResult{}, appErr
+	}
+	return b.Backend.ListObjects(ctx, normalized, opts...)
+}
+
+// PutObject uploads an object
+func (b *PathPolicyBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	normalized, appErr := b.normalize(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, normalized, content, opts...)
+}
+
+// DeleteObject removes an object
+func (b *PathPolicyBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	normalized, appErr := b.normalize(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Backend.DeleteObject(ctx, normalized)
+}
+
+// CopyObject copies an object
+func (b *PathPolicyBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	src, appErr := b.normalize(ctx, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	dst, appErr := b.normalize(ctx, dstPath)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, src, dst)
+}
+
+// normalize applies the mode to a path, rejecting paths resolving above the root
+func (b *PathPolicyBackend) normalize(ctx context.Context, path string) (string, *ae.AppError) {
+	normalized := NormalizePath(path)
+	if normalized == ".." || hasParentSegment(normalized) {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("path %q resolves above the root", path), PathInvalid, http.StatusBadRequest)
+	}
+	if b.Mode == PathModeStrict && normalized != path {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("path %q is not normalized, use %q", path, normalized), PathInvalid, http.StatusBadRequest)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,75 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePath(t *testing.T) {
+	for _, c := range keyCases {
+		if c.prefix != "" {
+			continue
+		}
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.key, NormalizePath(c.path))
+		})
+	}
+}
+
+func TestPathPolicyModes(t *testing.T) {
+	ctx := context.Background()
+	// the keys reached below the prefix logs in each mode, an empty key meaning the path is rejected
+	cases := []struct {
+		name   string
+		path   string
+		clean  string
+		strict string
+	}{
+		{name: "normalized", path: "a/b", clean: "logs/a/b", strict: "logs/a/b"},
+		{name: "leading slash", path: "/foo", clean: "logs/foo", strict: ""},
+		{name: "dot", path: "./a", clean: "logs/a", strict: ""},
+		{name: "repeated slashes", path: "a//b", clean: "logs/a/b", strict: ""},
+		{name: "trailing slash", path: "dir/", clean: "logs/dir/", strict: "logs/dir/"},
+		{name: "parent escape", path: "../secret", clean: "", strict: ""},
+		{name: "parent", path: "..", clean: "", strict: ""},
+		{name: "parent back in", path: "a/../b", clean: "logs/b", strict: ""},
+		{name: "sibling name", path: "logs-archive/a", clean: "logs/logs-archive/a", strict: "logs/logs-archive/a"},
+	}
+	for _, mode := range []PathMode{PathModeClean, PathModeStrict} {
+		for _, c := range cases {
+			t.Run(mode.String()+"/"+c.name, func(t *testing.T) {
+				expected := c.clean
+				if mode == PathModeStrict {
+					expected = c.strict
+				}
+				for name, backend := range keyBackends(t, "logs", nil) {
+					_, appErr := NewPathPolicyBackend(backend, mode).GetObject(ctx, c.path)
+					if expected == "" {
+						require.NotNil(t, appErr, name)
+						assert.Equal(t, http.StatusBadRequest, appErr.GetHTTPCode(), name)
+						assert.Empty(t, backend.keys(), name)
+						continue
+					}
+					assert.Equal(t, []string{expected}, backend.keys(), name)
+				}
+			})
+		}
+	}
+}
+
+func TestPathPolicyListingPrefixes(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []PathMode{PathModeClean, PathModeStrict} {
+		t.Run(mode.String(), func(t *testing.T) {
+			for name, backend := range keyBackends(t, "logs", nil) {
+				_, appErr := NewPathPolicyBackend(backend, mode).ListObjects(ctx, "")
+				require.Nil(t, appErr, name)
+				assert.Equal(t, []string{"logs/"}, backend.prefixes(), name)
+			}
+		})
+	}
+}
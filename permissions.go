@@ -0,0 +1,188 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// Operation names an IStorageBackend operation whose permission can be checked
+type Operation string
+
+const (
+	OperationGet    Operation = "get"
+	OperationList   Operation = "list"
+	OperationPut    Operation = "put"
+	OperationDelete Operation = "delete"
+	OperationCopy   Operation = "copy"
+)
+
+// PermissionStatus is the outcome of a permission check for one operation
+type PermissionStatus string
+
+const (
+	PermissionAllowed PermissionStatus = "allowed"
+	PermissionDenied  PermissionStatus = "denied"
+	// PermissionUnknown is reported when the probe failed for a reason other than authorization
+	PermissionUnknown PermissionStatus = "unknown"
+)
+
+// PermissionResult is the outcome of the permission check of a single operation
+type PermissionResult struct {
+	Operation Operation
+	Status    PermissionStatus
+	// Err is the error returned by the probe, nil when the operation is allowed
+	Err *ae.AppError
+}
+
+// PermissionReport lists the permission check results in the order the operations were requested
+type PermissionReport []PermissionResult
+
+// Allowed reports whether every checked operation is allowed
+func (r PermissionReport) Allowed() bool {
+	for _, result := range r {
+		if result.Status != PermissionAllowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Denied returns the operations the credentials are not allowed to perform
+func (r PermissionReport) Denied() []Operation {
+	var denied []Operation
+	for _, result := range r {
+		if result.Status == PermissionDenied {
+			denied = append(denied, result.Operation)
+		}
+	}
+	return denied
+}
+
+// IPermissionChecker is implemented by backends able to check permissions without touching data, e.g. by
+// policy simulation. CheckPermissions uses it instead of probing when available.
+type IPermissionChecker interface {
+	CheckPermissions(ctx context.Context, prefix string, ops []Operation) (PermissionReport, *ae.AppError)
+}
+
+// CheckPermissions reports which of ops the backend credentials can perform under prefix, so misconfigured
+// credentials are caught by health checks rather than by failing production flows. Unless the backend
+// implements IPermissionChecker, cheap probes are run: a small object is written under prefix (and removed)
+// when put, copy or delete is checked, and reads and deletes of a missing key count as allowed when the
+// backend answers not found. The error is nil only when every operation is allowed.
+func CheckPermissions(ctx context.Context, backend IStorageBackend, prefix string, ops []Operation) (PermissionReport, *ae.AppError) {
+	var report PermissionReport
+	if checker, ok := backend.(IPermissionChecker); ok {
+		var appErr *ae.AppError
+		report, appErr = checker.CheckPermissions(ctx, prefix, ops)
+		if appErr != nil {
+			return report, appErr
+		}
+	} else {
+		report = probePermissions(ctx, backend, prefix, ops)
+	}
+	return report, permissionReportErr(ctx, report)
+}
+
+// probePermissions runs one probe per operation against a uniquely named probe object
+func probePermissions(ctx context.Context, backend IStorageBackend, prefix string, ops []Operation) PermissionReport {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	probePath := pathutil.Join(prefix, ".permission-probe-"+hex.EncodeToString(suffix))
+	copyPath := probePath + "-copy"
+
+	requested := make(map[Operation]bool, len(ops))
+	for _, op := range ops {
+		requested[op] = true
+	}
+	// the probe object backs the get, copy and delete probes, so it is written whenever one of them is checked
+	probeWritten := false
+	var putErr *ae.AppError
+	if requested[OperationPut] || requested[OperationCopy] || requested[OperationDelete] {
+		putErr = backend.PutObject(ctx, probePath, []byte{})
+		probeWritten = putErr == nil
+	}
+
+	results := make(map[Operation]*ae.AppError, len(ops))
+	for _, op := range ops {
+		switch op {
+		case OperationPut:
+			results[op] = putErr
+		case OperationList:
+			_, results[op] = backend.ListObjects(ctx, prefix, WithMaxKeys(1))
+		case OperationGet:
+			_, results[op] = backend.GetObject(ctx, probePath)
+		case OperationCopy:
+			if !probeWritten {
+				results[op] = ae.GetAppErr(ctx, fmt.Errorf("copy not probed, the probe object could not be written"), PermissionProbe, http.StatusInternalServerError)
+				continue
+			}
+			results[op] = backend.CopyObject(ctx, probePath, copyPath)
+			if results[op] == nil {
+				_ = backend.DeleteObject(ctx, copyPath)
+			}
+		}
+	}
+	// delete runs last as it removes the probe object the other probes read
+	if requested[OperationDelete] {
+		results[OperationDelete] = backend.DeleteObject(ctx, probePath)
+		probeWritten = probeWritten && results[OperationDelete] != nil
+	}
+	if probeWritten {
+		_ = backend.DeleteObject(ctx, probePath)
+	}
+
+	report := make(PermissionReport, 0, len(ops))
+	for _, op := range ops {
+		appErr, known := results[op]
+		if !known {
+			appErr = ae.GetAppErr(ctx, fmt.Errorf("unknown operation %q", op), PermissionProbe, http.StatusBadRequest)
+		}
+		report = append(report, PermissionResult{Operation: op, Status: permissionStatus(appErr), Err: appErr})
+	}
+	return report
+}
+
+// permissionStatus classifies the error returned by a probe. Not found means the request was authorized.
+func permissionStatus(appErr *ae.AppError) PermissionStatus {
+	if appErr == nil || appErr.GetHTTPCode() == http.StatusNotFound {
+		return PermissionAllowed
+	}
+	if appErr.GetHTTPCode() == http.StatusForbidden || appErr.GetHTTPCode() == http.StatusUnauthorized {
+		return PermissionDenied
+	}
+	if err := appErr.GetErr(); err != nil {
+		msg := err.Error()
+		for _, marker := range []string{"AccessDenied", "Forbidden", "AccessControlException", "Error 403", "status code: 403"} {
+			if strings.Contains(msg, marker) {
+				return PermissionDenied
+			}
+		}
+	}
+	return PermissionUnknown
+}
+
+// permissionReportErr summarises a report as an error, 403 when an operation is denied
+func permissionReportErr(ctx context.Context, report PermissionReport) *ae.AppError {
+	if report.Allowed() {
+		return nil
+	}
+	var failed []string
+	httpCode := http.StatusInternalServerError
+	for _, result := range report {
+		if result.Status == PermissionAllowed {
+			continue
+		}
+		if result.Status == PermissionDenied {
+			httpCode = http.StatusForbidden
+		}
+		failed = append(failed, string(result.Operation)+"="+string(result.Status))
+	}
+	return ae.GetAppErr(ctx, fmt.Errorf("operations not allowed: %s", strings.Join(failed, ", ")), PermissionCheckFailed, httpCode)
+}
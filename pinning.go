@@ -0,0 +1,188 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	pathutil "path"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// IPinRegistry records which objects are pinned, i.e. protected from deletion
+type IPinRegistry interface {
+	Pin(ctx context.Context, path string) *ae.AppError
+	Unpin(ctx context.Context, path string) *ae.AppError
+	IsPinned(ctx context.Context, path string) (bool, *ae.AppError)
+}
+
+// ObjectPinRegistry is an IPinRegistry keeping one empty marker object per pinned path under Prefix of a
+// backend. Prefix must lie outside the prefixes cleaned up by bulk jobs, or live in another backend.
+type ObjectPinRegistry struct {
+	Backend IStorageBackend
+	Prefix  string
+}
+
+// NewObjectPinRegistry creates a new instance of ObjectPinRegistry storing pin markers under prefix
+func NewObjectPinRegistry(backend IStorageBackend, prefix string) *ObjectPinRegistry {
+	return &ObjectPinRegistry{
+		Backend: backend,
+		Prefix:  prefix,
+	}
+}
+
+// Pin writes the pin marker of path
+func (r *ObjectPinRegistry) Pin(ctx context.Context, path string) *ae.AppError {
+	if appErr := r.Backend.PutObject(ctx, r.markerPath(path), []byte{}); appErr != nil {
+		return appErr.AddErrCode(PinRegistryUpdate.Code)
+	}
+	return nil
+}
+
+// Unpin removes the pin marker of path, unpinning an object that is not pinned is not an error
+func (r *ObjectPinRegistry) Unpin(ctx context.Context, path string) *ae.AppError {
+	if appErr := r.Backend.DeleteObject(ctx, r.markerPath(path)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(PinRegistryUpdate.Code)
+	}
+	return nil
+}
+
+// IsPinned reports whether the pin marker of path exists
+func (r *ObjectPinRegistry) IsPinned(ctx context.Context, path string) (bool, *ae.AppError) {
+	_, appErr := r.Backend.GetObject(ctx, r.markerPath(path))
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return false, nil
+		}
+		return false, appErr
+	}
+	return true, nil
+}
+
+// markerPath returns the path of the pin marker of path
+func (r *ObjectPinRegistry) markerPath(path string) string {
+	return pathutil.Join(r.Prefix, path)
+}
+
+// PinnedBackend is an IStorageBackend decorator refusing to delete or overwrite pinned objects, so critical objects
+// inside otherwise expendable prefixes survive bulk cleanup. Bulk operations going through the decorator, such as
+// sync deletes or prefix copies, report pinned objects among their failures.
+type PinnedBackend struct {
+	Backend IStorageBackend
+	Pins    IPinRegistry
+}
+
+// NewPinnedBackend creates a new instance of PinnedBackend protecting the objects pinned in pins
+func NewPinnedBackend(backend IStorageBackend, pins IPinRegistry) *PinnedBackend {
+	return &PinnedBackend{
+		Backend: backend,
+		Pins:    pins,
+	}
+}
+
+// PinObject protects the object at path from deletion
+func (b *PinnedBackend) PinObject(ctx context.Context, path string) *ae.AppError {
+	return b.Pins.Pin(ctx, path)
+}
+
+// UnpinObject lifts the deletion protection of the object at path
+func (b *PinnedBackend) UnpinObject(ctx context.Context, path string) *ae.AppError {
+	return b.Pins.Unpin(ctx, path)
+}
+
+// IsPinned reports whether the object at path is pinned
+func (b *PinnedBackend) IsPinned(ctx context.Context, path string) (bool, *ae.AppError) {
+	return b.Pins.IsPinned(ctx, path)
+}
+
+// Unwrap returns the backend whose objects are protected
+func (b *PinnedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the pin registry in use
+func (b *PinnedBackend) Describe() map[string]string {
+	description := map[string]string{
+		"registry": fmt.Sprintf("%T", b.Pins),
+	}
+	if registry, ok := b.Pins.(*ObjectPinRegistry); ok {
+		description["registryPrefix"] = registry.Prefix
+	}
+	return description
+}
+
+// GetObject retrieves an object
+func (b *PinnedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *PinnedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *PinnedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object unless it would overwrite a pinned object, in which case 423 Locked is returned
+func (b *PinnedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.refusePinned(ctx, path); appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object unless it is pinned, in which case 423 Locked is returned
+func (b *PinnedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.refusePinned(ctx, path); appErr != nil {
+		return appErr
+	}
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object unless the copy would overwrite a pinned object, in which case 423 Locked is returned
+func (b *PinnedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.refusePinned(ctx, dstPath); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// SecureDeleteObject securely deletes an object from the wrapped backend unless it is pinned, see SecureDelete
+func (b *PinnedBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	if appErr := b.refusePinned(ctx, path); appErr != nil {
+		return SecureDeleteReport{}, appErr
+	}
+	return SecureDelete(ctx, b.Backend, path)
+}
+
+// refusePinned returns 423 Locked when path is pinned
+func (b *PinnedBackend) refusePinned(ctx context.Context, path string) *ae.AppError {
+	pinned, appErr := b.Pins.IsPinned(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	if pinned {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s is pinned", path), ObjectPinned, http.StatusLocked)
+	}
+	return nil
+}
+
+// IsObjectPinned reports whether path is pinned in any PinnedBackend layer of a composed backend. SecureDelete
+// calls it to refuse pinned objects before it starts overwriting them; custom cleanup jobs can call it to skip
+// pinned objects rather than fail on them.
+func IsObjectPinned(ctx context.Context, backend IStorageBackend, path string) (bool, *ae.AppError) {
+	for backend != nil {
+		if pinned, ok := backend.(*PinnedBackend); ok {
+			return pinned.IsPinned(ctx, path)
+		}
+		wrapper, ok := backend.(IWrapperBackend)
+		if !ok {
+			break
+		}
+		backend = wrapper.Unwrap()
+	}
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	ae "github.com/piyushkumar96/app-error"
+	"google.golang.org/api/iterator"
+)
+
+// prefixStatsPageSize is the number of objects PrefixStats lists at a time
+const prefixStatsPageSize = 1000
+
+// IPrefixStatter is implemented by backends and decorators able to count the objects and bytes at a prefix without
+// a full listing, or with a leaner one
+type IPrefixStatter interface {
+	PrefixStats(ctx context.Context, prefix string) (int64, int64, *ae.AppError)
+}
+
+// PrefixStats returns the number of objects at prefix of backend and their total size, e.g. the storage used by a
+// tenant for a dashboard, holding one page of the listing in memory at a time. Only current versions count.
+// GCS lists names and sizes only, and a QuotaBackend answers from the usage it tracks for the prefixes with a quota,
+// which misses objects written around it until Recalculate. Other backends and decorators are listed page by page,
+// so that decorators hiding objects from listings, such as TrashBackend, leave them out.
+func PrefixStats(ctx context.Context, backend IStorageBackend, prefix string) (int64, int64, *ae.AppError) {
+	if statter, ok := backend.(IPrefixStatter); ok {
+		return statter.PrefixStats(ctx, prefix)
+	}
+	var count, bytes int64
+	cursor := ""
+	for {
+		page, appErr := backend.ListObjects(ctx, prefix, WithMaxKeys(prefixStatsPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return count, bytes, appErr.AddErrCode(PrefixStatsList.Code)
+		}
+		for _, object := range page.Objects {
+			count++
+			bytes += object.Size
+		}
+		if !page.Truncated {
+			return count, bytes, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// PrefixStats counts the objects at prefix of Google Cloud Storage bucket, listing their names and sizes only
+func (b GoogleCSBackend) PrefixStats(ctx context.Context, prefix string) (int64, int64, *ae.AppError) {
+	var count, bytes int64
+	query := &storage.Query{Prefix: listPrefix(b.Prefix, prefix)}
+	if err := query.SetAttrSelection([]string{"Name", "Size"}); err != nil {
+		return count, bytes, ae.GetAppErr(ctx, err, PrefixStatsList, http.StatusInternalServerError)
+	}
+	it := b.Client.Objects(ctx, query)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return count, bytes, nil
+		}
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, GCSGetObjects, http.StatusInternalServerError)
+			if err.Error() == storage.ErrObjectNotExist.Error() {
+				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if gcsAccessDenied(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if retryAfter, ok := gcsRetryAfter(err); ok {
+				appErr = throttled(appErr, retryAfter)
+			}
+			return count, bytes, appErr.AddErrCode(PrefixStatsList.Code)
+		}
+		count++
+		bytes += attrs.Size
+	}
+}
+
+// PrefixStats returns the tracked usage of a prefix with a quota, counting the objects below it as a folder, and
+// counts other prefixes in the wrapped backend
+func (b *QuotaBackend) PrefixStats(ctx context.Context, prefix string) (int64, int64, *ae.AppError) {
+	b.mu.Lock()
+	usage, ok := b.usage[cleanPrefix(prefix)]
+	b.mu.Unlock()
+	if ok {
+		return usage.Objects, usage.Bytes, nil
+	}
+	return PrefixStats(ctx, b.Backend, prefix)
+}
+
+// PrefixStats counts the objects at a prefix below the prefix
+func (b *SubBackend) PrefixStats(ctx context.Context, prefix string) (int64, int64, *ae.AppError) {
+	key := b.Prefix + "/"
+	if prefix != "" {
+		var appErr *ae.AppError
+		if key, appErr = b.resolve(ctx, prefix); appErr != nil {
+			return 0, 0, appErr
+		}
+	}
+	return PrefixStats(ctx, b.Parent, key)
+}
+
+// PrefixStats sums the objects at a prefix over every shard
+func (b *ShardedBackend) PrefixStats(ctx context.Context, prefix string) (int64, int64, *ae.AppError) {
+	var count, bytes int64
+	for _, shard := range b.shards {
+		shardCount, shardBytes, appErr := PrefixStats(ctx, shard.Backend, prefix)
+		if appErr != nil {
+			return count, bytes, appErr
+		}
+		count += shardCount
+		bytes += shardBytes
+	}
+	return count, bytes, nil
+}
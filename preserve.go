@@ -0,0 +1,103 @@
+package object_storage
+
+import (
+	"context"
+	"maps"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// IObjectTagger is implemented by backends able to read the tags of an object, which GetObject does not return
+type IObjectTagger interface {
+	GetObjectTags(ctx context.Context, path string) (map[string]string, *ae.AppError)
+}
+
+// PreserveAttributes selects the object attributes carried over when an object is copied between backends.
+// Content, including zero-byte objects and directory markers ending in "/", is always copied.
+type PreserveAttributes struct {
+	Metadata     bool
+	ContentType  bool
+	CacheControl bool
+	// ContentHeaders are Content-Encoding, Content-Disposition and Content-Language
+	ContentHeaders bool
+	// Tags are read from sources implementing IObjectTagger, other sources have none to carry over
+	Tags         bool
+	StorageClass bool
+}
+
+// PreserveAll preserves every attribute, the destination backend must support all of them
+func PreserveAll() PreserveAttributes {
+	return PreserveAttributes{
+		Metadata:       true,
+		ContentType:    true,
+		CacheControl:   true,
+		ContentHeaders: true,
+		Tags:           true,
+		StorageClass:   true,
+	}
+}
+
+// CopyObjectBetween copies the object at srcPath of src to dstPath of dst, carrying over the attributes selected
+// by preserve. Copies within one backend use its CopyObject, which keeps every attribute the provider stores.
+// Attributes the destination cannot store fail the copy with the destination's 501 error rather than being
+// dropped silently.
+func CopyObjectBetween(ctx context.Context, src IStorageBackend, srcPath string, dst IStorageBackend, dstPath string, preserve PreserveAttributes) *ae.AppError {
+	if src == dst {
+		return src.CopyObject(ctx, srcPath, dstPath)
+	}
+	object, appErr := src.GetObject(ctx, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	opts, appErr := preservedPutOptions(ctx, src, srcPath, object, preserve)
+	if appErr != nil {
+		return appErr
+	}
+	content := object.Content
+	if content == nil {
+		content = []byte{}
+	}
+	return dst.PutObject(ctx, dstPath, content, opts...)
+}
+
+// preservedPutOptions returns the put options recreating the selected attributes of object
+func preservedPutOptions(ctx context.Context, src IStorageBackend, srcPath string, object Object, preserve PreserveAttributes) ([]PutOption, *ae.AppError) {
+	var tags map[string]string
+	if tagger, ok := src.(IObjectTagger); ok && preserve.Tags {
+		var appErr *ae.AppError
+		if tags, appErr = tagger.GetObjectTags(ctx, srcPath); appErr != nil {
+			return nil, appErr
+		}
+	}
+	return attributePutOptions(object, tags, preserve), nil
+}
+
+// attributePutOptions returns the put options setting the attributes of object and tags selected by preserve
+func attributePutOptions(object Object, tags map[string]string, preserve PreserveAttributes) []PutOption {
+	var opts []PutOption
+	if preserve.Metadata && len(object.Meta.User) > 0 {
+		opts = append(opts, WithMetadata(maps.Clone(object.Meta.User)))
+	}
+	if preserve.ContentType && object.ContentType != "" {
+		opts = append(opts, WithContentType(object.ContentType))
+	}
+	if preserve.CacheControl && object.CacheControl != "" {
+		opts = append(opts, WithCacheControl(object.CacheControl))
+	}
+	if preserve.ContentHeaders && object.ContentEncoding != "" {
+		opts = append(opts, WithContentEncoding(object.ContentEncoding))
+	}
+	if preserve.ContentHeaders && object.ContentDisposition != "" {
+		opts = append(opts, WithContentDisposition(object.ContentDisposition))
+	}
+	if preserve.ContentHeaders && object.ContentLanguage != "" {
+		opts = append(opts, WithContentLanguage(object.ContentLanguage))
+	}
+	if preserve.StorageClass && object.StorageClass != "" {
+		opts = append(opts, WithStorageClass(object.StorageClass))
+	}
+	if preserve.Tags && len(tags) > 0 {
+		opts = append(opts, WithTags(maps.Clone(tags)))
+	}
+	return opts
+}
@@ -0,0 +1,232 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxPresignExpiry is the longest validity of a presigned upload on S3 and GCS
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// s3MaxPutSize is the largest object a single S3 upload accepts, the upper bound of a size range without MaxSize
+	s3MaxPutSize = 5 << 30
+	// s3PostPolicyAlgorithm is the signing algorithm of S3 POST policies
+	s3PostPolicyAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// UploadConstraints restrict what a client may upload with a presigned upload
+type UploadConstraints struct {
+	// ContentType, when set, is the only content type accepted
+	ContentType string
+	// MinSize and MaxSize bound the size of the upload in bytes, MaxSize zero means no upper bound
+	MinSize int64
+	MaxSize int64
+}
+
+// sizeLimited reports whether the constraints bound the size of the upload
+func (c UploadConstraints) sizeLimited() bool {
+	return c.MinSize > 0 || c.MaxSize > 0
+}
+
+// PresignedUpload is what a client needs to upload an object directly to the provider
+type PresignedUpload struct {
+	// Method is PUT when the content is sent as the body of a request to URL, POST when it is sent as the file
+	// field of an HTML form posted to URL
+	Method string
+	URL    string
+	// Headers must be sent with a PUT upload
+	Headers map[string]string
+	// Fields must be sent as form fields before the file field of a POST upload
+	Fields  map[string]string
+	Expires time.Time
+}
+
+// IUploadPresigner is implemented by backends able to sign uploads sent directly to the provider by clients
+type IUploadPresigner interface {
+	PresignPutURL(ctx context.Context, path string, expiry time.Duration, constraints UploadConstraints) (PresignedUpload, *ae.AppError)
+}
+
+// PresignPutURL signs an upload of path to backend, valid for expiry, so that a client such as a browser sends the
+// content straight to the provider. Without size limits it is a PUT URL, with the content type signed in when set;
+// size limits need an HTML form upload, an S3 POST policy or a GCS signed policy document, as a PUT URL cannot
+// bound the size. The provider rejects uploads breaking the constraints. Presigned uploads bypass decorators, so
+// only backends implementing IUploadPresigner, S3 and GCS, support them; others fail with 501 Not Implemented.
+func PresignPutURL(ctx context.Context, backend IStorageBackend, path string, expiry time.Duration, constraints UploadConstraints) (PresignedUpload, *ae.AppError) {
+	presigner, ok := backend.(IUploadPresigner)
+	if !ok {
+		return PresignedUpload{}, ae.GetAppErr(ctx, fmt.Errorf("presigned uploads are not supported by %T", backend), PresignUnsupported, http.StatusNotImplemented)
+	}
+	return presigner.PresignPutURL(ctx, path, expiry, constraints)
+}
+
+// validatePresign checks the expiry and constraints of a presigned upload
+func validatePresign(ctx context.Context, expiry time.Duration, constraints UploadConstraints) *ae.AppError {
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		return ae.GetAppErr(ctx, fmt.Errorf("expiry %s must be positive and at most %s", expiry, maxPresignExpiry), PresignInvalid, http.StatusBadRequest)
+	}
+	if constraints.MinSize < 0 || constraints.MaxSize < 0 || (constraints.MaxSize > 0 && constraints.MaxSize < constraints.MinSize) {
+		return ae.GetAppErr(ctx, fmt.Errorf("invalid size range %d-%d", constraints.MinSize, constraints.MaxSize), PresignInvalid, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// PresignPutURL signs an upload to Amazon S3 bucket, a PUT URL or, with size limits, a POST policy
+func (b *S3Backend) PresignPutURL(ctx context.Context, path string, expiry time.Duration, constraints UploadConstraints) (PresignedUpload, *ae.AppError) {
+	if appErr := validatePresign(ctx, expiry, constraints); appErr != nil {
+		return PresignedUpload{}, appErr
+	}
+	if constraints.sizeLimited() && b.Compat.NoPostPolicy {
+		return PresignedUpload{}, ae.GetAppErr(ctx, fmt.Errorf("size limited uploads are not supported by %s", b.Compat.Provider), PresignUnsupported, http.StatusNotImplemented)
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	}
+	if constraints.ContentType != "" {
+		input.ContentType = aws.String(constraints.ContentType)
+	}
+	req, _ := b.Client.PutObjectRequest(input)
+	req.SetContext(ctx)
+	upload := PresignedUpload{Expires: time.Now().Add(expiry)}
+	if !constraints.sizeLimited() {
+		url, err := req.Presign(expiry)
+		if err != nil {
+			return PresignedUpload{}, ae.GetAppErr(ctx, err, PresignUpload, http.StatusInternalServerError)
+		}
+		upload.Method, upload.URL = http.MethodPut, url
+		if constraints.ContentType != "" {
+			upload.Headers = map[string]string{"Content-Type": constraints.ContentType}
+		}
+		return upload, nil
+	}
+
+	if err := req.Build(); err != nil {
+		return PresignedUpload{}, ae.GetAppErr(ctx, err, PresignUpload, http.StatusInternalServerError)
+	}
+	creds, err := req.Config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		return PresignedUpload{}, ae.GetAppErr(ctx, errors.Wrap(err, "reading the signing credentials"), PresignUpload, http.StatusInternalServerError)
+	}
+	// the form is posted to the bucket, virtual hosted or path style as requests to the key are
+	bucketURL := *req.HTTPRequest.URL
+	bucketURL.Path = strings.TrimSuffix(bucketURL.Path, aws.StringValue(input.Key))
+	bucketURL.RawPath, bucketURL.RawQuery = "", ""
+	upload.Method, upload.URL = http.MethodPost, bucketURL.String()
+	upload.Fields = s3PostPolicy(b.Bucket, aws.StringValue(input.Key), aws.StringValue(req.Config.Region), creds.AccessKeyID,
+		creds.SecretAccessKey, creds.SessionToken, upload.Expires, constraints)
+	return upload, nil
+}
+
+// s3PostPolicy returns the form fields of an S3 POST upload of key, signed with Signature Version 4
+func s3PostPolicy(bucket, key, region, accessKeyID, secretAccessKey, sessionToken string, expires time.Time, constraints UploadConstraints) map[string]string {
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	credential := strings.Join([]string{accessKeyID, date, region, "s3", "aws4_request"}, "/")
+	fields := map[string]string{
+		"key":              key,
+		"x-amz-algorithm":  s3PostPolicyAlgorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if sessionToken != "" {
+		fields["x-amz-security-token"] = sessionToken
+	}
+	if constraints.ContentType != "" {
+		fields["Content-Type"] = constraints.ContentType
+	}
+	conditions := []interface{}{map[string]string{"bucket": bucket}}
+	for name, value := range fields {
+		conditions = append(conditions, []string{"eq", "$" + name, value})
+	}
+	maxSize := constraints.MaxSize
+	if maxSize == 0 {
+		maxSize = s3MaxPutSize
+	}
+	conditions = append(conditions, []interface{}{"content-length-range", constraints.MinSize, maxSize})
+	policy, _ := json.Marshal(map[string]interface{}{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+
+	signingKey := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, fields["policy"]))
+	return fields
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcsUploadSigner is implemented by bucket handles able to sign requests with the credentials of the client
+type gcsUploadSigner interface {
+	SignedURL(object string, opts *storage.SignedURLOptions) (string, error)
+	GenerateSignedPostPolicyV4(object string, opts *storage.PostPolicyV4Options) (*storage.PostPolicyV4, error)
+}
+
+// PresignPutURL signs an upload to Google Cloud Storage bucket, a V4 signed PUT URL or, with size limits, a signed
+// policy document. The client credentials must be able to sign, e.g. a service account key or a service account
+// allowed to call signBlob.
+func (b GoogleCSBackend) PresignPutURL(ctx context.Context, path string, expiry time.Duration, constraints UploadConstraints) (PresignedUpload, *ae.AppError) {
+	if appErr := validatePresign(ctx, expiry, constraints); appErr != nil {
+		return PresignedUpload{}, appErr
+	}
+	signer, ok := b.Client.(gcsUploadSigner)
+	if !ok {
+		return PresignedUpload{}, ae.GetAppErr(ctx, fmt.Errorf("the gcs client cannot sign uploads"), PresignUnsupported, http.StatusNotImplemented)
+	}
+	key := objectKey(b.Prefix, path)
+	upload := PresignedUpload{Expires: time.Now().Add(expiry)}
+	if !constraints.sizeLimited() {
+		url, err := signer.SignedURL(key, &storage.SignedURLOptions{
+			Method:      http.MethodPut,
+			Expires:     upload.Expires,
+			ContentType: constraints.ContentType,
+			Scheme:      storage.SigningSchemeV4,
+		})
+		if err != nil {
+			return PresignedUpload{}, ae.GetAppErr(ctx, err, PresignUpload, http.StatusInternalServerError)
+		}
+		upload.Method, upload.URL = http.MethodPut, url
+		if constraints.ContentType != "" {
+			upload.Headers = map[string]string{"Content-Type": constraints.ContentType}
+		}
+		return upload, nil
+	}
+
+	maxSize := constraints.MaxSize
+	if maxSize == 0 {
+		// GCS caps objects at 5 TiB
+		maxSize = 5 << 40
+	}
+	policy, err := signer.GenerateSignedPostPolicyV4(key, &storage.PostPolicyV4Options{
+		Expires:    upload.Expires,
+		Fields:     &storage.PolicyV4Fields{ContentType: constraints.ContentType},
+		Conditions: []storage.PostPolicyV4Condition{storage.ConditionContentLengthRange(uint64(constraints.MinSize), uint64(maxSize))},
+	})
+	if err != nil {
+		return PresignedUpload{}, ae.GetAppErr(ctx, err, PresignUpload, http.StatusInternalServerError)
+	}
+	upload.Method, upload.URL, upload.Fields = http.MethodPost, policy.URL, policy.Fields
+	return upload, nil
+}
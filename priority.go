@@ -0,0 +1,129 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// Priority is the class of a storage operation, carried by its context. Waiting for rate budget tokens or transfer
+// slots, operations of a higher priority go first, so interactive requests preempt batch traffic of the same
+// process.
+type Priority int
+
+const (
+	// PriorityBatch is the priority of background work such as scheduled jobs, syncs and exports
+	PriorityBatch Priority = -1
+	// PriorityNormal is the priority of operations whose context carries none
+	PriorityNormal Priority = 0
+	// PriorityInteractive is the priority of operations a user is waiting on
+	PriorityInteractive Priority = 1
+)
+
+// priorityLevels is the number of distinct priorities, used to index per priority state
+const priorityLevels = 3
+
+// String returns the name of the priority
+func (p Priority) String() string {
+	switch p.level() {
+	case 0:
+		return "batch"
+	case 2:
+		return "interactive"
+	}
+	return "normal"
+}
+
+// level maps the priority to an index from 0 (batch) to priorityLevels-1 (interactive), clamping unknown values
+func (p Priority) level() int {
+	return min(max(int(p), int(PriorityBatch)), int(PriorityInteractive)) - int(PriorityBatch)
+}
+
+// priorityKey is the context key of the priority
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx carrying priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority carried by ctx, PriorityNormal when it carries none
+func PriorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// TransferSlots limits the concurrent transfers of a process, e.g. the ranged reads of every download. Free slots
+// go to the waiter of the highest priority, first come first served within a priority. It is safe for concurrent
+// use.
+type TransferSlots struct {
+	mu    sync.Mutex
+	slots int
+	used  int
+	// waiters are the channels of the callers waiting for a slot, per priority level
+	waiters [priorityLevels][]chan struct{}
+}
+
+// NewTransferSlots creates a new instance of TransferSlots allowing slots concurrent transfers, at least one
+func NewTransferSlots(slots int) *TransferSlots {
+	return &TransferSlots{slots: slots}
+}
+
+// acquire blocks until a slot is granted to the caller or ctx is done
+func (s *TransferSlots) acquire(ctx context.Context) *ae.AppError {
+	if err := s.wait(ctx); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "waiting for a transfer slot"), TransferSlotWait, http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// wait blocks until a slot is granted to the caller, by the priority of ctx, or ctx is done. The zero value grants
+// one slot at a time.
+func (s *TransferSlots) wait(ctx context.Context) error {
+	level := PriorityFromContext(ctx).level()
+	s.mu.Lock()
+	if s.used < max(s.slots, 1) {
+		s.used++
+		s.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	s.waiters[level] = append(s.waiters[level], granted)
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	if i := slices.Index(s.waiters[level], granted); i >= 0 {
+		s.waiters[level] = slices.Delete(s.waiters[level], i, i+1)
+		s.mu.Unlock()
+	} else {
+		// the slot was granted while ctx was done, hand it on
+		s.mu.Unlock()
+		s.release()
+	}
+	return ctx.Err()
+}
+
+// release returns a slot, granting it to the first waiter of the highest priority
+func (s *TransferSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for level := priorityLevels - 1; level >= 0; level-- {
+		if len(s.waiters[level]) > 0 {
+			close(s.waiters[level][0])
+			s.waiters[level] = s.waiters[level][1:]
+			return
+		}
+	}
+	s.used--
+}
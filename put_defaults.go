@@ -0,0 +1,90 @@
+package object_storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// PutDefaultsBackend is an IStorageBackend decorator applying platform defaults (content headers, metadata, tags,
+// storage class, encryption) to every PutObject, so they are enforced in one place instead of at every call site.
+// Options given to a call override the defaults; metadata and tags are merged key by key. Copies keep the
+// attributes of their source.
+type PutDefaultsBackend struct {
+	Backend  IStorageBackend
+	Defaults []PutOption
+}
+
+// NewPutDefaultsBackend creates a new instance of PutDefaultsBackend applying defaults to puts on backend
+func NewPutDefaultsBackend(backend IStorageBackend, defaults ...PutOption) *PutDefaultsBackend {
+	return &PutDefaultsBackend{
+		Backend:  backend,
+		Defaults: defaults,
+	}
+}
+
+// Unwrap returns the backend the defaults are applied to
+func (b *PutDefaultsBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the default attributes, listing only the keys of metadata and tags
+func (b *PutDefaultsBackend) Describe() map[string]string {
+	defaults := getPutOptions(b.Defaults)
+	description := map[string]string{
+		"contentType":        defaults.ContentType,
+		"cacheControl":       defaults.CacheControl,
+		"contentEncoding":    defaults.ContentEncoding,
+		"contentDisposition": defaults.ContentDisposition,
+		"contentLanguage":    defaults.ContentLanguage,
+		"storageClass":       defaults.StorageClass,
+		"metadataKeys":       strings.Join(sortedKeys(defaults.Metadata), ","),
+		"tagKeys":            strings.Join(sortedKeys(defaults.Tags), ","),
+	}
+	if defaults.Encryption != nil {
+		description["encryption"] = string(defaults.Encryption.Type)
+	}
+	return description
+}
+
+// GetObject retrieves an object
+func (b *PutDefaultsBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *PutDefaultsBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *PutDefaultsBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object with the defaults applied before the given options
+func (b *PutDefaultsBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.Backend.PutObject(ctx, path, content, slices.Concat(b.Defaults, opts)...)
+}
+
+// DeleteObject removes an object
+func (b *PutDefaultsBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object
+func (b *PutDefaultsBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
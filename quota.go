@@ -0,0 +1,413 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// quotaPageSize is the listing page size used to recalculate the usage of a prefix
+const quotaPageSize = 1000
+
+// QuotaLimit caps the content stored under a prefix, a zero field is no limit
+type QuotaLimit struct {
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxObjects int64 `json:"maxObjects"`
+}
+
+// QuotaUsage is the content stored under a prefix
+type QuotaUsage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// QuotaViolation is the data of an ErrQuotaExceeded error, describing the quota a write would exceed
+type QuotaViolation struct {
+	Prefix string
+	Limit  QuotaLimit
+	// Usage is the usage of the prefix the write would have resulted in
+	Usage QuotaUsage
+}
+
+// QuotaBackend is an IStorageBackend decorator enforcing quotas on the bytes and objects stored under prefixes,
+// e.g. one prefix per tenant of a SaaS. Writes taking a prefix beyond its limits fail with ErrQuotaExceeded. The
+// usage of every prefix is tracked as objects are written and deleted through the decorator and saved as JSON in
+// the object at UsagePath after every change; the object does not count towards any quota. A write reserves its
+// share of the quotas before it runs and gives it back when it fails, so writes of different paths run concurrently
+// while writes of the same path are serialized. Objects written around the decorator are only accounted for by
+// Recalculate, which lists without blocking writes: writes overlapping a recount are counted as far as its listing
+// saw them.
+type QuotaBackend struct {
+	Backend   IStorageBackend
+	UsagePath string
+
+	mu     sync.Mutex
+	limits map[string]QuotaLimit
+	usage  map[string]QuotaUsage
+	paths  map[string]*quotaPathLock
+	// generations counts the recounts of every prefix, a reservation replaced by a recount is never given back
+	generations map[string]int64
+	// changes counts the changes of usage, saved the changes the usage object holds; saved is guarded by saveMu
+	changes int64
+	saveMu  sync.Mutex
+	saved   int64
+}
+
+// quotaPathLock serializes the writes of a path, whose accounting depends on the object stored before them
+type quotaPathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewQuotaBackend creates a new instance of QuotaBackend enforcing limits by prefix, an empty prefix being the whole
+// backend. The usage is loaded from the object at usagePath, or recalculated by listing every prefix when it does
+// not exist yet.
+func NewQuotaBackend(ctx context.Context, backend IStorageBackend, usagePath string, limits map[string]QuotaLimit) (*QuotaBackend, *ae.AppError) {
+	b := &QuotaBackend{
+		Backend:   backend,
+		UsagePath: NormalizePath(usagePath),
+		limits:    map[string]QuotaLimit{},
+		usage:     map[string]QuotaUsage{},
+		paths:     map[string]*quotaPathLock{},
+
+		generations: map[string]int64{},
+	}
+	for prefix, limit := range limits {
+		b.limits[cleanPrefix(prefix)] = limit
+	}
+	object, appErr := backend.GetObject(ctx, b.UsagePath)
+	if appErr != nil {
+		if appErr.GetHTTPCode() != http.StatusNotFound {
+			return nil, appErr.AddErrCode(QuotaUsageStore.Code)
+		}
+		return b, b.Recalculate(ctx)
+	}
+	if err := json.Unmarshal(object.Content, &b.usage); err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to decode quota usage %s", b.UsagePath), QuotaUsageStore, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the backend holding the objects
+func (b *QuotaBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the usage object and the number of prefixes with a quota
+func (b *QuotaBackend) Describe() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return map[string]string{
+		"usagePath": b.UsagePath,
+		"prefixes":  strconv.Itoa(len(b.limits)),
+	}
+}
+
+// SetLimit sets the quota of a prefix. The usage of a prefix new to the decorator is recalculated first, the quota
+// applying once it is counted.
+func (b *QuotaBackend) SetLimit(ctx context.Context, prefix string, limit QuotaLimit) *ae.AppError {
+	prefix = cleanPrefix(prefix)
+	b.mu.Lock()
+	_, counted := b.usage[prefix]
+	if counted {
+		b.limits[prefix] = limit
+	}
+	b.mu.Unlock()
+	if counted {
+		return nil
+	}
+	usage, appErr := b.listUsage(ctx, prefix)
+	if appErr != nil {
+		return appErr
+	}
+	b.mu.Lock()
+	b.limits[prefix] = limit
+	// a concurrent SetLimit of the prefix may have counted it first
+	if _, ok := b.usage[prefix]; !ok {
+		b.usage[prefix] = usage
+		b.changes++
+	}
+	b.mu.Unlock()
+	return b.save(ctx)
+}
+
+// Usage returns the usage of a prefix with a quota
+func (b *QuotaBackend) Usage(prefix string) QuotaUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage[cleanPrefix(prefix)]
+}
+
+// Recalculate lists every prefix with a quota to rebuild its usage, e.g. after objects were written around the
+// decorator, and saves it. The prefixes are listed without holding mu and their usage replaced once all are
+// listed, so writes go on meanwhile.
+func (b *QuotaBackend) Recalculate(ctx context.Context) *ae.AppError {
+	b.mu.Lock()
+	prefixes := slices.Collect(maps.Keys(b.limits))
+	b.mu.Unlock()
+	usage := map[string]QuotaUsage{}
+	for _, prefix := range prefixes {
+		prefixUsage, appErr := b.listUsage(ctx, prefix)
+		if appErr != nil {
+			return appErr
+		}
+		usage[prefix] = prefixUsage
+	}
+
+	b.mu.Lock()
+	for prefix := range b.usage {
+		if _, ok := b.limits[prefix]; !ok {
+			delete(b.usage, prefix)
+		}
+	}
+	for prefix, prefixUsage := range usage {
+		b.usage[prefix] = prefixUsage
+		b.generations[prefix]++
+	}
+	b.changes++
+	b.mu.Unlock()
+	return b.save(ctx)
+}
+
+// GetObject retrieves an object
+func (b *QuotaBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *QuotaBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *QuotaBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object when it keeps every prefix holding it within its quota
+func (b *QuotaBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.write(ctx, path, int64(len(content)), func() *ae.AppError {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	})
+}
+
+// DeleteObject removes an object and releases its share of the quotas
+func (b *QuotaBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	prefixes := b.prefixesOf(path)
+	if len(prefixes) == 0 {
+		return b.Backend.DeleteObject(ctx, path)
+	}
+	defer b.lockPath(path)()
+	size, exists, appErr := objectSize(ctx, b.Backend, path)
+	if appErr != nil {
+		return appErr
+	}
+	generations := b.generationsOf(prefixes)
+	if appErr := b.Backend.DeleteObject(ctx, path); appErr != nil {
+		return appErr
+	}
+	if !exists {
+		return nil
+	}
+	b.apply(generations, QuotaUsage{Bytes: -size, Objects: -1})
+	return b.save(ctx)
+}
+
+// CopyObject copies an object when the copy keeps every prefix holding it within its quota
+func (b *QuotaBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if len(b.prefixesOf(dstPath)) == 0 {
+		return b.Backend.CopyObject(ctx, srcPath, dstPath)
+	}
+	size, exists, appErr := objectSize(ctx, b.Backend, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	if !exists {
+		// the backend reports the missing source
+		return b.Backend.CopyObject(ctx, srcPath, dstPath)
+	}
+	return b.write(ctx, dstPath, size, func() *ae.AppError {
+		return b.Backend.CopyObject(ctx, srcPath, dstPath)
+	})
+}
+
+// write reserves the share of the quotas of storing size bytes at path, failing when a prefix would go over its
+// quota, then runs the write without holding mu, saving the usage when it succeeds and giving the reservation back
+// when it fails, to the prefixes not recounted meanwhile
+func (b *QuotaBackend) write(ctx context.Context, path string, size int64, run func() *ae.AppError) *ae.AppError {
+	prefixes := b.prefixesOf(path)
+	if len(prefixes) == 0 {
+		return run()
+	}
+	defer b.lockPath(path)()
+	previous, exists, appErr := objectSize(ctx, b.Backend, path)
+	if appErr != nil {
+		return appErr
+	}
+	delta := QuotaUsage{Bytes: size - previous}
+	if !exists {
+		delta.Objects = 1
+	}
+	generations, appErr := b.reserve(ctx, path, prefixes, delta)
+	if appErr != nil {
+		return appErr
+	}
+	if appErr := run(); appErr != nil {
+		// a save of another write may have stored the reservation, the next save stores it given back
+		b.apply(generations, QuotaUsage{Bytes: -delta.Bytes, Objects: -delta.Objects})
+		return appErr
+	}
+	return b.save(ctx)
+}
+
+// reserve adds delta to the usage of prefixes when it keeps every one of them within its quota, returning the
+// generations of the prefixes it was added to
+func (b *QuotaBackend) reserve(ctx context.Context, path string, prefixes []string, delta QuotaUsage) (map[string]int64, *ae.AppError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	updated := map[string]QuotaUsage{}
+	for _, prefix := range prefixes {
+		usage := b.usage[prefix]
+		usage = QuotaUsage{Bytes: usage.Bytes + delta.Bytes, Objects: usage.Objects + delta.Objects}
+		limit := b.limits[prefix]
+		// writes shrinking the usage are let through even over the quota, e.g. after a limit was lowered
+		if (limit.MaxBytes > 0 && delta.Bytes > 0 && usage.Bytes > limit.MaxBytes) ||
+			(limit.MaxObjects > 0 && delta.Objects > 0 && usage.Objects > limit.MaxObjects) {
+			err := fmt.Errorf("writing %s would take prefix %q to %d bytes and %d objects, over its quota (max %d bytes, %d objects, 0 is no limit)",
+				path, prefix, usage.Bytes, usage.Objects, limit.MaxBytes, limit.MaxObjects)
+			return nil, ae.GetAppErr(ctx, err, ErrQuotaExceeded, http.StatusInsufficientStorage).SetData(QuotaViolation{Prefix: prefix, Limit: limit, Usage: usage})
+		}
+		updated[prefix] = usage
+	}
+	maps.Copy(b.usage, updated)
+	b.changes++
+	generations := map[string]int64{}
+	for _, prefix := range prefixes {
+		generations[prefix] = b.generations[prefix]
+	}
+	return generations, nil
+}
+
+// apply adds delta to the usage of the prefixes still at the given generations, never taking it below zero. A
+// prefix recounted since holds the usage its listing saw, which the change is either part of or never made.
+func (b *QuotaBackend) apply(generations map[string]int64, delta QuotaUsage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for prefix, generation := range generations {
+		if b.generations[prefix] != generation {
+			continue
+		}
+		usage := b.usage[prefix]
+		b.usage[prefix] = QuotaUsage{Bytes: max(usage.Bytes+delta.Bytes, 0), Objects: max(usage.Objects+delta.Objects, 0)}
+	}
+	b.changes++
+}
+
+// generationsOf returns the recount generations of prefixes
+func (b *QuotaBackend) generationsOf(prefixes []string) map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	generations := map[string]int64{}
+	for _, prefix := range prefixes {
+		generations[prefix] = b.generations[prefix]
+	}
+	return generations
+}
+
+// lockPath serializes the writes of path, returning the function releasing it
+func (b *QuotaBackend) lockPath(path string) func() {
+	path = NormalizePath(path)
+	b.mu.Lock()
+	lock, ok := b.paths[path]
+	if !ok {
+		lock = &quotaPathLock{}
+		b.paths[path] = lock
+	}
+	lock.refs++
+	b.mu.Unlock()
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(b.paths, path)
+		}
+	}
+}
+
+// prefixesOf returns the prefixes with a quota holding path, none for the usage object itself
+func (b *QuotaBackend) prefixesOf(path string) []string {
+	path = NormalizePath(path)
+	if path == b.UsagePath {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var prefixes []string
+	for prefix := range b.limits {
+		if prefix == "" || strings.HasPrefix(path, prefix+"/") {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	slices.Sort(prefixes)
+	return prefixes
+}
+
+// listUsage lists a prefix as a folder to calculate its usage, leaving out the usage object
+func (b *QuotaBackend) listUsage(ctx context.Context, prefix string) (QuotaUsage, *ae.AppError) {
+	var usage QuotaUsage
+	prefix = dirKey("", prefix)
+	cursor := ""
+	for {
+		page, appErr := b.Backend.ListObjects(ctx, prefix, WithMaxKeys(quotaPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return usage, appErr.AddErrCode(QuotaUsageStore.Code)
+		}
+		for _, object := range page.Objects {
+			if objectKey(prefix, object.Path) == b.UsagePath {
+				continue
+			}
+			usage.Bytes += object.Size
+			usage.Objects++
+		}
+		if !page.Truncated {
+			return usage, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// save writes the usage of every prefix to the usage object. Saves run one at a time, so that an older usage never
+// overwrites a newer one, and a save finding the changes it follows already saved by another returns right away.
+func (b *QuotaBackend) save(ctx context.Context) *ae.AppError {
+	b.mu.Lock()
+	changes := b.changes
+	b.mu.Unlock()
+	b.saveMu.Lock()
+	defer b.saveMu.Unlock()
+	if b.saved >= changes {
+		return nil
+	}
+	b.mu.Lock()
+	content, err := json.Marshal(b.usage)
+	changes = b.changes
+	b.mu.Unlock()
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrap(err, "failed to encode quota usage"), QuotaUsageStore, http.StatusInternalServerError)
+	}
+	if appErr := b.Backend.PutObject(ctx, b.UsagePath, content, WithContentType("application/json")); appErr != nil {
+		return appErr.AddErrCode(QuotaUsageStore.Code)
+	}
+	b.saved = changes
+	return nil
+}
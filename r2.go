@@ -0,0 +1,39 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// r2Region is the only region accepted by Cloudflare R2 S3 API
+const r2Region = "auto"
+
+// r2Compat lists the S3 features Cloudflare R2 does not implement
+var r2Compat = S3Compat{
+	Provider:         "r2",
+	NoKMSEncryption:  true,
+	NoVersionListing: true,
+	NoPostPolicy:     true,
+	NoObjectACL:      true,
+	NoObjectLock:     true,
+}
+
+// NewR2Backend creates a new instance of S3Backend for a Cloudflare R2 bucket. It targets the account
+// endpoint with region auto and path-style addressing. Features R2 lacks, such as KMS encryption or version
+// listing, fail with 501 Not Implemented.
+func NewR2Backend(accountID string, bucket string, prefix string, creds *credentials.Credentials) (*S3Backend, *ae.AppError) {
+	if accountID == "" || bucket == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("account id and bucket are required"), S3BackendClient, http.StatusInternalServerError)
+	}
+	endpoint := fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+	backend, appErr := NewS3BackendWithEndpoint(bucket, prefix, r2Region, endpoint, false, creds)
+	if appErr != nil {
+		return nil, appErr
+	}
+	backend.Compat = r2Compat
+	return backend, nil
+}
@@ -0,0 +1,193 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// RateBudget is a request rate and bandwidth budget. One budget can be shared by any number of
+// RateLimitedBackend instances, e.g. one per tenant, to keep the aggregate traffic of the process under provider
+// and network limits. Operations waiting for the budget yield to operations of a higher Priority. It is safe for
+// concurrent use.
+type RateBudget struct {
+	// Requests limits backend operations per second, nil means unlimited
+	Requests *rate.Limiter
+	// Bytes limits uploaded and downloaded bytes per second, nil means unlimited
+	Bytes *rate.Limiter
+
+	// requestTurn and bytesTurn let one waiter at a time, by priority, wait on each limiter
+	requestTurn TransferSlots
+	bytesTurn   TransferSlots
+}
+
+// NewRateBudget creates a new instance of RateBudget allowing requestsPerSecond operations and bytesPerSecond
+// transferred bytes, a value of zero or less leaves that dimension unlimited. Bursts of up to one second are allowed.
+func NewRateBudget(requestsPerSecond float64, bytesPerSecond int64) *RateBudget {
+	budget := &RateBudget{}
+	if requestsPerSecond > 0 {
+		budget.Requests = rate.NewLimiter(rate.Limit(requestsPerSecond), int(math.Max(1, math.Ceil(requestsPerSecond))))
+	}
+	if bytesPerSecond > 0 {
+		budget.Bytes = rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, math.MaxInt32)))
+	}
+	return budget
+}
+
+// waitRequest blocks until the budget allows one more operation, operations of a higher priority going first
+func (r *RateBudget) waitRequest(ctx context.Context) *ae.AppError {
+	if r == nil || r.Requests == nil {
+		return nil
+	}
+	if err := r.requestTurn.wait(ctx); err != nil {
+		appErr := ae.GetAppErr(ctx, errors.Wrap(err, "waiting for request budget"), RateLimitWait, http.StatusTooManyRequests)
+		return throttled(appErr, limiterRetryAfter(r.Requests, 1))
+	}
+	defer r.requestTurn.release()
+	if err := r.Requests.Wait(ctx); err != nil {
+		appErr := ae.GetAppErr(ctx, errors.Wrap(err, "waiting for request budget"), RateLimitWait, http.StatusTooManyRequests)
+		return throttled(appErr, limiterRetryAfter(r.Requests, 1))
+	}
+	return nil
+}
+
+// waitBytes blocks until the budget allows n more bytes, in chunks no larger than the burst so that objects
+// bigger than one second of bandwidth are paced instead of rejected. Chunks of transfers of a higher priority go
+// first.
+func (r *RateBudget) waitBytes(ctx context.Context, n int) *ae.AppError {
+	if r == nil || r.Bytes == nil {
+		return nil
+	}
+	for n > 0 {
+		chunk := min(n, r.Bytes.Burst())
+		if err := r.bytesTurn.wait(ctx); err != nil {
+			appErr := ae.GetAppErr(ctx, errors.Wrap(err, "waiting for bandwidth budget"), RateLimitWait, http.StatusTooManyRequests)
+			return throttled(appErr, limiterRetryAfter(r.Bytes, n))
+		}
+		err := r.Bytes.WaitN(ctx, chunk)
+		r.bytesTurn.release()
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, errors.Wrap(err, "waiting for bandwidth budget"), RateLimitWait, http.StatusTooManyRequests)
+			return throttled(appErr, limiterRetryAfter(r.Bytes, n))
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// limiterRetryAfter returns the time limiter takes to allow n more events
+func limiterRetryAfter(limiter *rate.Limiter, n int) time.Duration {
+	if limiter.Limit() == rate.Inf || limiter.Limit() <= 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(limiter.Limit()) * float64(time.Second))
+}
+
+// RateLimitedBackend is an IStorageBackend decorator drawing every operation from a RateBudget, and the content
+// of uploads and downloads from its bandwidth budget. The size of a download is unknown until it completes, so its
+// content is drawn once read, holding the download back until the budget allows it and pacing the transfers
+// after it.
+type RateLimitedBackend struct {
+	Backend IStorageBackend
+	Budget  *RateBudget
+}
+
+// NewRateLimitedBackend creates a new instance of RateLimitedBackend limiting backend to budget
+func NewRateLimitedBackend(backend IStorageBackend, budget *RateBudget) (*RateLimitedBackend, *ae.AppError) {
+	if budget == nil {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("rate budget is required"), RateLimitConfig, http.StatusInternalServerError)
+	}
+	return &RateLimitedBackend{
+		Backend: backend,
+		Budget:  budget,
+	}, nil
+}
+
+// Unwrap returns the backend being limited
+func (b *RateLimitedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations without rate limits run on the wrapped backend
+func (b *RateLimitedBackend) transparent() {}
+
+// Describe reports the limits of the budget
+func (b *RateLimitedBackend) Describe() map[string]string {
+	description := map[string]string{
+		"requestsPerSecond": "unlimited",
+		"bytesPerSecond":    "unlimited",
+		"budget":            fmt.Sprintf("%p", b.Budget),
+	}
+	if b.Budget.Requests != nil {
+		description["requestsPerSecond"] = strconv.FormatFloat(float64(b.Budget.Requests.Limit()), 'f', -1, 64)
+	}
+	if b.Budget.Bytes != nil {
+		description["bytesPerSecond"] = strconv.FormatFloat(float64(b.Budget.Bytes.Limit()), 'f', -1, 64)
+	}
+	return description
+}
+
+// GetObject retrieves an object, then draws its content from the bandwidth budget
+func (b *RateLimitedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	if appErr != nil {
+		return object, appErr
+	}
+	if appErr := b.Budget.waitBytes(ctx, len(object.Content)); appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return object, nil
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *RateLimitedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return nil, appErr
+	}
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *RateLimitedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return ListResult{}, appErr
+	}
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object once the budget allows the request and its content
+func (b *RateLimitedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return appErr
+	}
+	if appErr := b.Budget.waitBytes(ctx, len(content)); appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object
+func (b *RateLimitedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return appErr
+	}
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, server side copies do not draw from the bandwidth budget
+func (b *RateLimitedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.Budget.waitRequest(ctx); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
@@ -0,0 +1,265 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/redis/go-redis/v9"
+)
+
+// redis hash fields an object is stored in
+const (
+	redisFieldContent  = "content"
+	redisFieldModified = "modified"
+	redisFieldSize     = "size"
+	redisScanCount     = 1000
+)
+
+// IRedisClient interface for Redis client operations - allows mocking in tests
+type IRedisClient interface {
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Copy(ctx context.Context, sourceKey string, destKey string, db int, replace bool) *redis.IntCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// RedisBackend is a storage backend for small, hot objects such as session blobs or cached renders. Every object
+// is a Redis hash holding its content and modification time, optionally expiring after TTL.
+type RedisBackend struct {
+	Client IRedisClient
+	// DB is the database index of Client, used by CopyObject
+	DB     int
+	Prefix string
+	// TTL expires objects this long after they were last written, zero keeps them until deleted
+	TTL time.Duration
+}
+
+// NewRedisBackend creates a new instance of RedisBackend connected to a single Redis server
+func NewRedisBackend(addr string, password string, db int, prefix string, ttl time.Duration) (*RedisBackend, *ae.AppError) {
+	if addr == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("redis address is required"), RedisBackendClient, http.StatusInternalServerError)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	return &RedisBackend{
+		Client: client,
+		DB:     db,
+		Prefix: cleanPrefix(prefix),
+		TTL:    ttl,
+	}, nil
+}
+
+// Describe reports the database, prefix and ttl the backend is bound to
+func (b *RedisBackend) Describe() map[string]string {
+	return map[string]string{
+		"db":     strconv.Itoa(b.DB),
+		"prefix": b.Prefix,
+		"ttl":    b.TTL.String(),
+	}
+}
+
+// GetObject retrieves an object from Redis, at prefix
+func (b *RedisBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	var object Object
+	object.Path = path
+	if options.versioned() {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("redis does not keep object versions"), RedisGetObject, http.StatusNotImplemented)
+	}
+
+	fields, err := b.Client.HGetAll(ctx, objectKey(b.Prefix, path)).Result()
+	if err != nil {
+		return object, ae.GetAppErr(ctx, err, RedisGetObject, http.StatusInternalServerError)
+	}
+	content, ok := fields[redisFieldContent]
+	if !ok {
+		return object, ae.GetAppErr(ctx, fmt.Errorf("object %s not found", path), RedisGetObject, http.StatusNotFound)
+	}
+	object.Content = []byte(content)
+	object.Size = int64(len(content))
+	object.LastModified = redisModified(fields[redisFieldModified])
+	if options.unchanged(object) {
+		return Object{Path: path}, notModifiedErr(ctx, path)
+	}
+
+	if options.Range != nil {
+		byteRange := options.Range.from(object.Size)
+		if byteRange.Offset >= object.Size && object.Size > 0 {
+			return Object{Path: path}, ae.GetAppErr(ctx, fmt.Errorf("range offset %d beyond object size %d", byteRange.Offset, object.Size), RedisGetObject, http.StatusRequestedRangeNotSatisfiable)
+		}
+		end := object.Size
+		if byteRange.Length > 0 && byteRange.Offset+byteRange.Length < end {
+			end = byteRange.Offset + byteRange.Length
+		}
+		object.Content = object.Content[min(byteRange.Offset, object.Size):end]
+	}
+	return object, nil
+}
+
+// GetObjects lists all objects in Redis, at prefix
+func (b *RedisBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects in Redis at the given prefix, honouring MaxKeys and cursor options. Keys are
+// scanned in full and sorted, which suits the small keyspaces this backend is meant for.
+func (b *RedisBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	fullPrefix := listPrefix(b.Prefix, prefix)
+	options.Cursor = options.startCursor(fullPrefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Versions != VersionsCurrent {
+		return result, ae.GetAppErr(ctx, fmt.Errorf("redis does not keep object versions"), RedisGetObjects, http.StatusNotImplemented)
+	}
+
+	var keys []string
+	var cursor uint64
+	for {
+		page, next, err := b.Client.Scan(ctx, cursor, redisGlobEscape(fullPrefix)+"*", redisScanCount).Result()
+		if err != nil {
+			result.interrupted("", options)
+			return result, ae.GetAppErr(ctx, err, RedisGetObjects, http.StatusInternalServerError)
+		}
+		for _, key := range page {
+			result.Scanned++
+			if (options.Cursor == "" || key > options.Cursor) && options.matchesPath(removePrefixFromObjectPath(fullPrefix, key)) {
+				keys = append(keys, key)
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	// SCAN may return a key more than once
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	if options.MaxKeys > 0 && len(keys) > options.MaxKeys {
+		keys = keys[:options.MaxKeys]
+		result.Truncated = true
+		result.NextCursor = keys[len(keys)-1]
+	}
+
+	cmds := make([]*redis.SliceCmd, len(keys))
+	_, err := b.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.HMGet(ctx, key, redisFieldModified, redisFieldSize)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		result.interrupted("", options)
+		return result, ae.GetAppErr(ctx, err, RedisGetObjects, http.StatusInternalServerError)
+	}
+	for i, key := range keys {
+		values, err := cmds[i].Result()
+		if err != nil || len(values) != 2 || values[0] == nil {
+			// expired between the scan and the read
+			continue
+		}
+		modified, _ := values[0].(string)
+		size, _ := values[1].(string)
+		objectSize, _ := strconv.ParseInt(size, 10, 64)
+		object := Object{
+			Path:         removePrefixFromObjectPath(fullPrefix, key),
+			Content:      []byte{},
+			LastModified: redisModified(modified),
+			Size:         objectSize,
+		}
+		// time filters apply once the page is cut, leaving it shorter
+		if options.matches(object) {
+			result.Objects = append(result.Objects, object)
+		}
+	}
+	return result, nil
+}
+
+// PutObject stores an object in Redis, at prefix, expiring it after TTL when set
+func (b *RedisBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	options := getPutOptions(opts)
+	if options.Encryption != nil && options.Encryption.Type != EncryptionNone {
+		return ae.GetAppErr(ctx, fmt.Errorf("encryption is not supported by redis"), RedisPutObject, http.StatusNotImplemented)
+	}
+	if attributes := options.attributesSet(); len(attributes) > 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("%s not supported by redis", strings.Join(attributes, ", ")), RedisPutObject, http.StatusNotImplemented)
+	}
+
+	key := objectKey(b.Prefix, path)
+	_, err := b.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			redisFieldContent, content,
+			redisFieldModified, strconv.FormatInt(time.Now().UnixNano(), 10),
+			redisFieldSize, strconv.Itoa(len(content)))
+		if b.TTL > 0 {
+			pipe.PExpire(ctx, key, b.TTL)
+		} else {
+			pipe.Persist(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return ae.GetAppErr(ctx, err, RedisPutObject, http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// DeleteObject removes an object from Redis, at prefix
+func (b *RedisBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	deleted, err := b.Client.Del(ctx, objectKey(b.Prefix, path)).Result()
+	if err != nil {
+		return ae.GetAppErr(ctx, err, RedisDeleteObject, http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s not found", path), RedisDeleteObject, http.StatusNotFound)
+	}
+	return nil
+}
+
+// CopyObject copies an object within Redis using COPY (Redis 6.2 or later), keeping the source ttl
+func (b *RedisBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	copied, err := b.Client.Copy(ctx, objectKey(b.Prefix, srcPath), objectKey(b.Prefix, dstPath), b.DB, true).Result()
+	if err != nil {
+		return ae.GetAppErr(ctx, err, RedisCopyObject, http.StatusInternalServerError)
+	}
+	if copied == 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s not found", srcPath), RedisCopyObject, http.StatusNotFound)
+	}
+	return nil
+}
+
+// redisModified parses the modification time stored with an object
+func redisModified(value string) time.Time {
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// redisGlobEscape escapes the glob special characters of a key prefix used in a SCAN MATCH pattern
+func redisGlobEscape(prefix string) string {
+	var escaped strings.Builder
+	for _, r := range prefix {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,153 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// RenameFailure is an object RenamePrefix failed to move
+type RenameFailure struct {
+	Path string
+	// Copied is set when the object was copied but its source not deleted, so it is at both paths
+	Copied bool
+	Err    *ae.AppError
+}
+
+// RenamePrefixReport describes the objects handled by RenamePrefix so far
+type RenamePrefixReport struct {
+	Listed int
+	Moved  int
+	// Bytes is the size of the objects moved
+	Bytes    int64
+	Failures []RenameFailure
+}
+
+// RenameOptions holds the settings applied to a prefix rename
+type RenameOptions struct {
+	// Concurrency is the number of objects moved at a time
+	Concurrency int
+	// Retry configures the retries of the copies and deletes
+	Retry []RetryOption
+	// Progress, when set, is called after every page of objects
+	Progress func(RenamePrefixReport)
+}
+
+// RenameOption configures a prefix rename
+type RenameOption func(*RenameOptions)
+
+// WithRenameConcurrency sets the number of objects moved at a time, 16 by default
+func WithRenameConcurrency(concurrency int) RenameOption {
+	return func(o *RenameOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithRenameRetry configures the retries of the copies and deletes, 3 attempts on transient errors by default
+func WithRenameRetry(opts ...RetryOption) RenameOption {
+	return func(o *RenameOptions) {
+		o.Retry = opts
+	}
+}
+
+// WithRenameProgress has RenamePrefix call progress with the report so far after every page of objects
+func WithRenameProgress(progress func(RenamePrefixReport)) RenameOption {
+	return func(o *RenameOptions) {
+		o.Progress = progress
+	}
+}
+
+// getRenameOptions applies the given options over the defaults
+func getRenameOptions(opts []RenameOption) RenameOptions {
+	options := RenameOptions{Concurrency: defaultCopyPrefixConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// RenamePrefix moves every object below the folder from of backend to the same path below to, copying each object
+// with CopyObject, on the provider side for S3 and GCS, and deleting it once copied. Copies and deletes failing with
+// a transient error are retried as a RetryBackend does. Object stores have no atomic rename: readers may see an
+// object at both paths, or, while the move runs, some objects moved and others not. Objects failing to move do not
+// stop the rename: once every page is done the error counts them and the report lists them, telling those left at
+// both paths, while a listing failure stops it at once. Running the rename again carries on with the objects left.
+// A to inside from fails with 400 Bad Request.
+func RenamePrefix(ctx context.Context, backend IStorageBackend, from, to string, opts ...RenameOption) (RenamePrefixReport, *ae.AppError) {
+	var report RenamePrefixReport
+	options := getRenameOptions(opts)
+	src, dst, appErr := prefixPair(ctx, from, to, RenamePrefixInvalid)
+	if appErr != nil {
+		return report, appErr
+	}
+	retried, appErr := NewRetryBackend(backend, options.Retry...)
+	if appErr != nil {
+		return report, appErr.AddErrCode(RenamePrefixInvalid.Code)
+	}
+	cursor := ""
+	for {
+		page, appErr := retried.ListObjects(ctx, src+"/", WithMaxKeys(copyPrefixPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return report, appErr.AddErrCode(RenamePrefixList.Code)
+		}
+		report.Listed += len(page.Objects)
+		for i, failure := range moveEach(ctx, retried, src, dst, page.Objects, options.Concurrency) {
+			if failure.Err != nil {
+				report.Failures = append(report.Failures, failure)
+			} else {
+				report.Moved++
+				report.Bytes += page.Objects[i].Size
+			}
+		}
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+		if !page.Truncated {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(report.Failures) > 0 {
+		first := report.Failures[0].Err
+		err := fmt.Errorf("%d of %d objects at %s not moved, first: %s", len(report.Failures), report.Listed, from, first.Error())
+		return report, ae.GetAppErr(ctx, err, RenamePrefixIncomplete, first.GetHTTPCode())
+	}
+	return report, nil
+}
+
+// moveEach moves the objects listed below the folder src to dst, up to concurrency at a time, and returns the
+// outcome of every object, in order, with a nil Err for the objects moved
+func moveEach(ctx context.Context, backend IStorageBackend, src, dst string, objects []Object, concurrency int) []RenameFailure {
+	results := make([]RenameFailure, len(objects))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, object := range objects {
+		srcPath := objectKey(src, object.Path)
+		results[i].Path = srcPath
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ae.GetAppErr(ctx, ctx.Err(), RenamePrefixIncomplete, http.StatusRequestTimeout)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if appErr := backend.CopyObject(ctx, srcPath, objectKey(dst, object.Path)); appErr != nil {
+				results[i].Err = appErr
+				return
+			}
+			if appErr := backend.DeleteObject(ctx, srcPath); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+				results[i].Copied = true
+				results[i].Err = appErr
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
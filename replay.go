@@ -0,0 +1,316 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// Interaction is a call to a backend and its outcome, recorded by a RecordingBackend and served by a ReplayBackend
+type Interaction struct {
+	// Method is the IStorageBackend method called, e.g. GetObject
+	Method string `json:"method"`
+	// Path is the path of the object, or the listed prefix
+	Path       string `json:"path"`
+	SourcePath string `json:"sourcePath,omitempty"`
+	// Request describes the options of the call that change its outcome, e.g. a range or a listing cursor
+	Request string       `json:"request,omitempty"`
+	Object  *Object      `json:"object,omitempty"`
+	Objects []Object     `json:"objects,omitempty"`
+	List    *ListResult  `json:"list,omitempty"`
+	Error   *RecordedErr `json:"error,omitempty"`
+}
+
+// RecordedErr is an *ae.AppError as stored in a fixture, RetryAfter is its retry hint if any
+type RecordedErr struct {
+	Code       string         `json:"code"`
+	Codes      []string       `json:"codes,omitempty"`
+	Message    string         `json:"message"`
+	HTTPCode   int            `json:"httpCode"`
+	Err        string         `json:"err"`
+	RetryAfter *time.Duration `json:"retryAfter,omitempty"`
+}
+
+// Fixture is the recorded interactions with a backend, in call order
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// RecordingBackend is an IStorageBackend decorator recording every call and its outcome, content included, so that
+// Save can write them to a fixture file for a ReplayBackend. Record against a real provider once, then run the
+// integration tests hermetically on the fixture. It is safe for concurrent use.
+type RecordingBackend struct {
+	Backend IStorageBackend
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecordingBackend creates a new instance of RecordingBackend
+func NewRecordingBackend(backend IStorageBackend) *RecordingBackend {
+	return &RecordingBackend{Backend: backend}
+}
+
+// Unwrap returns the backend being recorded
+func (b *RecordingBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the number of interactions recorded
+func (b *RecordingBackend) Describe() map[string]string {
+	return map[string]string{
+		"interactions": strconv.Itoa(len(b.Fixture().Interactions)),
+	}
+}
+
+// Fixture returns the interactions recorded so far
+func (b *RecordingBackend) Fixture() Fixture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Fixture{Interactions: append([]Interaction(nil), b.interactions...)}
+}
+
+// Save writes the interactions recorded so far to w as JSON
+func (b *RecordingBackend) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b.Fixture())
+}
+
+// GetObject retrieves an object and records it
+func (b *RecordingBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	recorded := object
+	b.record(Interaction{Method: "GetObject", Path: path, Request: describeGetOptions(opts), Object: &recorded}, appErr)
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix and records them
+func (b *RecordingBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	b.record(Interaction{Method: "GetObjects", Path: prefix, Objects: objects}, appErr)
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix and records the page
+func (b *RecordingBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	recorded := result
+	b.record(Interaction{Method: "ListObjects", Path: prefix, Request: describeListOptions(opts), List: &recorded}, appErr)
+	return result, appErr
+}
+
+// PutObject uploads an object and records the outcome, the content is not recorded
+func (b *RecordingBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	appErr := b.Backend.PutObject(ctx, path, content, opts...)
+	b.record(Interaction{Method: "PutObject", Path: path}, appErr)
+	return appErr
+}
+
+// DeleteObject removes an object and records the outcome
+func (b *RecordingBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	appErr := b.Backend.DeleteObject(ctx, path)
+	b.record(Interaction{Method: "DeleteObject", Path: path}, appErr)
+	return appErr
+}
+
+// CopyObject copies an object and records the outcome
+func (b *RecordingBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	appErr := b.Backend.CopyObject(ctx, srcPath, dstPath)
+	b.record(Interaction{Method: "CopyObject", Path: dstPath, SourcePath: srcPath}, appErr)
+	return appErr
+}
+
+// record appends an interaction failed with appErr, if any
+func (b *RecordingBackend) record(interaction Interaction, appErr *ae.AppError) {
+	if appErr != nil {
+		interaction.Error = recordErr(appErr)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.interactions = append(b.interactions, interaction)
+}
+
+// ReplayBackend is an IStorageBackend serving the interactions of a fixture recorded by a RecordingBackend, for
+// hermetic tests. A call is answered by the next recorded interaction with the same method, paths and request
+// options, in recorded order, and the last one is repeated once they are used up. Mutations change nothing, so
+// reads return what was recorded whatever was written since. Calls never recorded fail with ReplayMissing. It is
+// safe for concurrent use.
+type ReplayBackend struct {
+	mu sync.Mutex
+	// interactions are the recorded interactions by call key
+	interactions map[string][]Interaction
+	// served is the number of interactions served by call key
+	served map[string]int
+}
+
+// NewReplayBackend creates a new instance of ReplayBackend serving the fixture written to r by RecordingBackend.Save
+func NewReplayBackend(r io.Reader) (*ReplayBackend, *ae.AppError) {
+	var fixture Fixture
+	if err := json.NewDecoder(r).Decode(&fixture); err != nil {
+		return nil, ae.GetAppErr(context.Background(), errors.Wrap(err, "invalid fixture"), ReplayFixture, http.StatusInternalServerError)
+	}
+	return NewReplayBackendFromFixture(fixture), nil
+}
+
+// NewReplayBackendFromFixture creates a new instance of ReplayBackend serving fixture
+func NewReplayBackendFromFixture(fixture Fixture) *ReplayBackend {
+	b := &ReplayBackend{
+		interactions: map[string][]Interaction{},
+		served:       map[string]int{},
+	}
+	for _, interaction := range fixture.Interactions {
+		key := interactionKey(interaction)
+		b.interactions[key] = append(b.interactions[key], interaction)
+	}
+	return b
+}
+
+// Describe reports the number of distinct calls recorded
+func (b *ReplayBackend) Describe() map[string]string {
+	return map[string]string{
+		"calls": strconv.Itoa(len(b.interactions)),
+	}
+}
+
+// GetObject returns the recorded object
+func (b *ReplayBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	interaction, appErr := b.replay(ctx, Interaction{Method: "GetObject", Path: path, Request: describeGetOptions(opts)})
+	if interaction.Object == nil {
+		return Object{Path: path}, appErr
+	}
+	return *interaction.Object, appErr
+}
+
+// GetObjects returns the recorded objects
+func (b *ReplayBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	interaction, appErr := b.replay(ctx, Interaction{Method: "GetObjects", Path: prefix})
+	return interaction.Objects, appErr
+}
+
+// ListObjects returns the recorded page
+func (b *ReplayBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	interaction, appErr := b.replay(ctx, Interaction{Method: "ListObjects", Path: prefix, Request: describeListOptions(opts)})
+	if interaction.List == nil {
+		return ListResult{}, appErr
+	}
+	return *interaction.List, appErr
+}
+
+// PutObject returns the recorded outcome of the upload
+func (b *ReplayBackend) PutObject(ctx context.Context, path string, _ []byte, _ ...PutOption) *ae.AppError {
+	_, appErr := b.replay(ctx, Interaction{Method: "PutObject", Path: path})
+	return appErr
+}
+
+// DeleteObject returns the recorded outcome of the removal
+func (b *ReplayBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	_, appErr := b.replay(ctx, Interaction{Method: "DeleteObject", Path: path})
+	return appErr
+}
+
+// CopyObject returns the recorded outcome of the copy
+func (b *ReplayBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	_, appErr := b.replay(ctx, Interaction{Method: "CopyObject", Path: dstPath, SourcePath: srcPath})
+	return appErr
+}
+
+// replay returns the next recorded interaction matching call, and its error
+func (b *ReplayBackend) replay(ctx context.Context, call Interaction) (Interaction, *ae.AppError) {
+	key := interactionKey(call)
+	b.mu.Lock()
+	recorded := b.interactions[key]
+	if len(recorded) == 0 {
+		b.mu.Unlock()
+		return call, ae.GetAppErr(ctx, fmt.Errorf("no recorded interaction for %s", key), ReplayMissing, http.StatusInternalServerError)
+	}
+	interaction := recorded[min(b.served[key], len(recorded)-1)]
+	b.served[key]++
+	b.mu.Unlock()
+	if interaction.Error != nil {
+		return interaction, interaction.Error.appErr(ctx)
+	}
+	return interaction, nil
+}
+
+// interactionKey returns the key matching calls to their recorded interactions
+func interactionKey(interaction Interaction) string {
+	key := []string{interaction.Method, NormalizePath(interaction.Path)}
+	if interaction.SourcePath != "" {
+		key = append(key, "from "+NormalizePath(interaction.SourcePath))
+	}
+	if interaction.Request != "" {
+		key = append(key, interaction.Request)
+	}
+	return strings.Join(key, " ")
+}
+
+// describeListOptions describes the options of a ListObjects call changing its outcome
+func describeListOptions(opts []ListOption) string {
+	options := getListOptions(opts)
+	var request []string
+	if options.MaxKeys > 0 {
+		request = append(request, fmt.Sprintf("maxKeys=%d", options.MaxKeys))
+	}
+	if options.Cursor != "" {
+		request = append(request, "cursor="+options.Cursor)
+	}
+	if options.StartAfter != "" {
+		request = append(request, "startAfter="+options.StartAfter)
+	}
+	if options.Versions != VersionsCurrent {
+		request = append(request, fmt.Sprintf("versions=%v", options.Versions))
+	}
+	if options.Hydrate > 0 {
+		request = append(request, "hydrate")
+	}
+	if options.Glob != "" {
+		request = append(request, "glob="+options.Glob)
+	}
+	if options.Pattern != nil {
+		request = append(request, "pattern="+options.Pattern.String())
+	}
+	if !options.ModifiedAfter.IsZero() {
+		request = append(request, "modifiedAfter="+options.ModifiedAfter.UTC().Format(time.RFC3339Nano))
+	}
+	if !options.ModifiedBefore.IsZero() {
+		request = append(request, "modifiedBefore="+options.ModifiedBefore.UTC().Format(time.RFC3339Nano))
+	}
+	return strings.Join(request, ",")
+}
+
+// recordErr converts appErr for a fixture
+func recordErr(appErr *ae.AppError) *RecordedErr {
+	recorded := &RecordedErr{
+		Code:     appErr.GetErrCode(),
+		Codes:    appErr.GetErrCodes(),
+		Message:  appErr.GetMsg(),
+		HTTPCode: appErr.GetHTTPCode(),
+		Err:      appErr.Error(),
+	}
+	if retryAfter, ok := RetryAfter(appErr); ok {
+		recorded.RetryAfter = &retryAfter
+	}
+	return recorded
+}
+
+// appErr rebuilds the recorded error, the underlying error only keeps its message
+func (r *RecordedErr) appErr(ctx context.Context) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, errors.New(r.Err), ae.GetCustomErr(r.Code, r.Message, false), r.HTTPCode)
+	if len(r.Codes) > 0 {
+		appErr.ErrorCodes = append([]string(nil), r.Codes...)
+	}
+	if r.RetryAfter != nil {
+		appErr = withRetryHint(appErr, *r.RetryAfter)
+	}
+	return appErr
+}
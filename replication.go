@@ -0,0 +1,171 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const (
+	// gcsDefaultReplicationTarget is the time within which default replication copies every new object to the
+	// second region of a dual-region or multi-region bucket
+	gcsDefaultReplicationTarget = 12 * time.Hour
+	// gcsTurboReplicationTarget is the same target with turbo replication
+	gcsTurboReplicationTarget = 15 * time.Minute
+)
+
+// ReplicationState is the cross-region replication state of an object
+type ReplicationState string
+
+const (
+	// ReplicationNone means the object is not replicated to another region
+	ReplicationNone ReplicationState = ""
+	// ReplicationPending means the object is not replicated yet
+	ReplicationPending ReplicationState = "pending"
+	// ReplicationComplete means the object is replicated to every destination
+	ReplicationComplete ReplicationState = "complete"
+	// ReplicationFailed means the replication of the object failed (S3)
+	ReplicationFailed ReplicationState = "failed"
+	// ReplicationReplica means the object is itself a replica written by replication (S3)
+	ReplicationReplica ReplicationState = "replica"
+)
+
+// ReplicationStatus is the cross-region replication status of an object
+type ReplicationStatus struct {
+	Path  string
+	State ReplicationState
+	// LocationType is the GCS bucket location type: region, dual-region or multi-region
+	LocationType string
+	// RPO is the GCS bucket replication policy, DEFAULT or ASYNC_TURBO
+	RPO string
+	// ReplicatedBy is, on GCS, the time by which the replication target guarantees the object is replicated
+	ReplicatedBy time.Time
+}
+
+// Replicated reports whether the object can be read from another region
+func (s ReplicationStatus) Replicated() bool {
+	return s.State == ReplicationComplete || s.State == ReplicationReplica
+}
+
+// IReplicationStatusProvider is implemented by backends able to report the replication status of an object
+type IReplicationStatusProvider interface {
+	ReplicationStatus(ctx context.Context, path string) (ReplicationStatus, *ae.AppError)
+}
+
+// GetReplicationStatus returns the replication status of an object of backend, looking through decorators for a
+// backend implementing IReplicationStatusProvider
+func GetReplicationStatus(ctx context.Context, backend IStorageBackend, path string) (ReplicationStatus, *ae.AppError) {
+	for backend != nil {
+		if provider, ok := backend.(IReplicationStatusProvider); ok {
+			return provider.ReplicationStatus(ctx, path)
+		}
+		wrapper, ok := backend.(IWrapperBackend)
+		if !ok {
+			break
+		}
+		backend = wrapper.Unwrap()
+	}
+	return ReplicationStatus{Path: path}, ae.GetAppErr(ctx, fmt.Errorf("backend does not report replication status"), ReplicationQuery, http.StatusNotImplemented)
+}
+
+// WaitForReplication polls the replication status of an object every interval until it is replicated, e.g. before
+// flipping traffic to another region. It fails at once when the object is not replicated at all or its replication
+// failed, and when ctx is done.
+func WaitForReplication(ctx context.Context, backend IStorageBackend, path string, interval time.Duration) (ReplicationStatus, *ae.AppError) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, appErr := GetReplicationStatus(ctx, backend, path)
+		if appErr != nil {
+			return status, appErr
+		}
+		switch status.State {
+		case ReplicationComplete, ReplicationReplica:
+			return status, nil
+		case ReplicationNone, ReplicationFailed:
+			return status, ae.GetAppErr(ctx, fmt.Errorf("%s is not being replicated, replication state %q", path, status.State), ReplicationNotReplicated, http.StatusConflict)
+		}
+		select {
+		case <-ctx.Done():
+			return status, ae.GetAppErr(ctx, errors.Wrapf(ctx.Err(), "waiting for the replication of %s", path), ReplicationWait, http.StatusRequestTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReplicationStatus reports the S3 replication status of an object, ReplicationNone when no replication rule
+// applies to it
+func (b *S3Backend) ReplicationStatus(ctx context.Context, path string) (ReplicationStatus, *ae.AppError) {
+	status := ReplicationStatus{Path: path}
+	head, err := b.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	})
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError)
+		if isS3NotFoundError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		}
+		return status, appErr.AddErrCode(ReplicationQuery.Code)
+	}
+	switch aws.StringValue(head.ReplicationStatus) {
+	case s3.ReplicationStatusPending:
+		status.State = ReplicationPending
+	case s3.ReplicationStatusComplete, s3.ReplicationStatusCompleted:
+		status.State = ReplicationComplete
+	case s3.ReplicationStatusFailed:
+		status.State = ReplicationFailed
+	case s3.ReplicationStatusReplica:
+		status.State = ReplicationReplica
+	}
+	return status, nil
+}
+
+// ReplicationStatus reports the replication of an object of a dual-region or multi-region GCS bucket. GCS does not
+// report the replication of single objects, so the object counts as replicated once the replication target of the
+// bucket elapsed since it was written: 15 minutes with turbo replication and 12 hours otherwise. Objects of
+// single region buckets are not replicated. The client must be a bucket handle to read the bucket location.
+func (b GoogleCSBackend) ReplicationStatus(ctx context.Context, path string) (ReplicationStatus, *ae.AppError) {
+	status := ReplicationStatus{Path: path}
+	bucket, ok := b.Client.(interface {
+		Attrs(ctx context.Context) (*storage.BucketAttrs, error)
+	})
+	if !ok {
+		return status, ae.GetAppErr(ctx, fmt.Errorf("the gcs client does not expose bucket attributes"), ReplicationQuery, http.StatusNotImplemented)
+	}
+	bucketAttrs, err := bucket.Attrs(ctx)
+	if err != nil {
+		return status, ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError).AddErrCode(ReplicationQuery.Code)
+	}
+	attrs, err := b.Client.Object(objectKey(b.Prefix, path)).Attrs(ctx)
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		}
+		return status, appErr.AddErrCode(ReplicationQuery.Code)
+	}
+
+	status.LocationType = bucketAttrs.LocationType
+	status.RPO = bucketAttrs.RPO.String()
+	if status.LocationType != "dual-region" && status.LocationType != "multi-region" {
+		return status, nil
+	}
+	target := gcsDefaultReplicationTarget
+	if bucketAttrs.RPO == storage.RPOAsyncTurbo {
+		target = gcsTurboReplicationTarget
+	}
+	status.ReplicatedBy = attrs.Created.Add(target)
+	status.State = ReplicationPending
+	if !time.Now().Before(status.ReplicatedBy) {
+		status.State = ReplicationComplete
+	}
+	return status, nil
+}
@@ -0,0 +1,264 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// RetentionMode is the mode of an object retention, named as in S3 Object Lock
+type RetentionMode string
+
+const (
+	// RetentionGovernance retentions can be shortened or removed with Retention.Bypass, an unlocked retention on GCS
+	RetentionGovernance RetentionMode = "GOVERNANCE"
+	// RetentionCompliance retentions can only be extended until they expire, a locked retention on GCS
+	RetentionCompliance RetentionMode = "COMPLIANCE"
+)
+
+// gcsRetentionModes maps the retention modes to GCS object retention modes
+var gcsRetentionModes = map[RetentionMode]string{
+	RetentionGovernance: "Unlocked",
+	RetentionCompliance: "Locked",
+}
+
+// Retention keeps an object version from being overwritten or deleted until RetainUntil
+type Retention struct {
+	Mode        RetentionMode
+	RetainUntil time.Time
+	// Bypass allows shortening or removing a governance retention, which needs the s3:BypassGovernanceRetention
+	// permission on S3
+	Bypass bool
+}
+
+// IRetentionManager is implemented by backends and decorators able to set the retention and legal hold of objects
+type IRetentionManager interface {
+	SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError
+	SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError
+}
+
+// SetRetention sets the retention of the object at path of backend, e.g. to enforce WORM storage of records from
+// application code, on an S3 bucket with Object Lock enabled or a GCS bucket with object retention enabled. A zero
+// Retention with Bypass set removes a governance retention. Buckets without object lock fail with 409 Conflict, and
+// shortening a retention without the permission to with 403 Forbidden. Transparent decorators, such as retries or
+// caches, are passed through to the layer they wrap; other decorators not implementing IRetentionManager, such as
+// DryRunBackend or ImmutableBackend, and other backends fail with 501 Not Implemented.
+func SetRetention(ctx context.Context, backend IStorageBackend, path string, retention Retention) *ae.AppError {
+	if retention.Mode != "" {
+		if _, ok := gcsRetentionModes[retention.Mode]; !ok {
+			return ae.GetAppErr(ctx, fmt.Errorf("unknown retention mode %q", retention.Mode), RetentionInvalid, http.StatusBadRequest)
+		}
+	}
+	if (retention.Mode == "") != retention.RetainUntil.IsZero() {
+		return ae.GetAppErr(ctx, fmt.Errorf("retention mode and retain until date go together"), RetentionInvalid, http.StatusBadRequest)
+	}
+	manager, appErr := retentionManager(ctx, backend)
+	if appErr != nil {
+		return appErr
+	}
+	return manager.SetRetention(ctx, path, retention)
+}
+
+// SetLegalHold places or releases a legal hold on the object at path of backend, a GCS temporary hold on GCS. A held
+// object cannot be overwritten or deleted, whatever its retention, until the hold is released.
+func SetLegalHold(ctx context.Context, backend IStorageBackend, path string, hold bool) *ae.AppError {
+	manager, appErr := retentionManager(ctx, backend)
+	if appErr != nil {
+		return appErr
+	}
+	return manager.SetLegalHold(ctx, path, hold)
+}
+
+// retentionManager returns the first layer of backend implementing IRetentionManager below transparent decorators,
+// failing with 501 when there is none
+func retentionManager(ctx context.Context, backend IStorageBackend) (IRetentionManager, *ae.AppError) {
+	for {
+		if manager, ok := backend.(IRetentionManager); ok {
+			return manager, nil
+		}
+		wrapper, ok := backend.(transparentDecorator)
+		if !ok {
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("object retention is not supported by %T", backend), RetentionOperation, http.StatusNotImplemented)
+		}
+		backend = wrapper.Unwrap()
+	}
+}
+
+// SetRetention sets the Object Lock retention of an object in Amazon S3 bucket
+func (b *S3Backend) SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError {
+	if b.Compat.NoObjectLock {
+		return ae.GetAppErr(ctx, fmt.Errorf("object lock is not supported by %s", b.Compat.Provider), RetentionOperation, http.StatusNotImplemented)
+	}
+	input := &s3.PutObjectRetentionInput{
+		Bucket:    aws.String(b.Bucket),
+		Key:       aws.String(objectKey(b.Prefix, path)),
+		Retention: &s3.ObjectLockRetention{},
+	}
+	if retention.Mode != "" {
+		input.Retention.Mode = aws.String(string(retention.Mode))
+		input.Retention.RetainUntilDate = aws.Time(retention.RetainUntil.UTC())
+	}
+	if retention.Bypass {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	if _, err := b.Client.PutObjectRetentionWithContext(ctx, input); err != nil {
+		return s3RetentionErr(ctx, err)
+	}
+	return nil
+}
+
+// SetLegalHold places or releases the Object Lock legal hold of an object in Amazon S3 bucket
+func (b *S3Backend) SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError {
+	if b.Compat.NoObjectLock {
+		return ae.GetAppErr(ctx, fmt.Errorf("object lock is not supported by %s", b.Compat.Provider), RetentionOperation, http.StatusNotImplemented)
+	}
+	status := s3.ObjectLockLegalHoldStatusOff
+	if hold {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+	_, err := b.Client.PutObjectLegalHoldWithContext(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(b.Bucket),
+		Key:       aws.String(objectKey(b.Prefix, path)),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(status)},
+	})
+	if err != nil {
+		return s3RetentionErr(ctx, err)
+	}
+	return nil
+}
+
+// s3RetentionErr maps an S3 error of an Object Lock request, a bucket without Object Lock is reported as 409
+func s3RetentionErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, RetentionOperation, http.StatusInternalServerError)
+	switch {
+	case contains(err.Error(), "InvalidRequest") && contains(err.Error(), "Object Lock"):
+		appErr = appErr.SetHTTPCode(http.StatusConflict)
+	case contains(err.Error(), "AccessDenied"):
+		appErr = appErr.SetHTTPCode(http.StatusForbidden)
+	case isS3NotFoundError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	case isS3NotImplementedError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	case isS3ThrottlingError(err):
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// s3Retention returns the retention reported by the Object Lock headers of an object
+func s3Retention(mode *string, retainUntil *time.Time) Retention {
+	if mode == nil {
+		return Retention{}
+	}
+	return Retention{Mode: RetentionMode(aws.StringValue(mode)), RetainUntil: aws.TimeValue(retainUntil)}
+}
+
+// SetRetention sets the object retention of an object in Google Cloud Storage bucket
+func (b GoogleCSBackend) SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError {
+	object := b.Client.Object(objectKey(b.Prefix, path))
+	if retention.Bypass {
+		object = object.OverrideUnlockedRetention(true)
+	}
+	gcsRetention := &storage.ObjectRetention{}
+	if retention.Mode != "" {
+		gcsRetention.Mode = gcsRetentionModes[retention.Mode]
+		gcsRetention.RetainUntil = retention.RetainUntil
+	}
+	if _, err := object.Update(ctx, storage.ObjectAttrsToUpdate{Retention: gcsRetention}); err != nil {
+		return gcsRetentionErr(ctx, err)
+	}
+	return nil
+}
+
+// SetLegalHold places or releases the temporary hold of an object in Google Cloud Storage bucket
+func (b GoogleCSBackend) SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError {
+	_, err := b.Client.Object(objectKey(b.Prefix, path)).Update(ctx, storage.ObjectAttrsToUpdate{TemporaryHold: hold})
+	if err != nil {
+		return gcsRetentionErr(ctx, err)
+	}
+	return nil
+}
+
+// gcsRetentionErr maps a GCS error of a retention update, a bucket without object retention is reported as 409
+func gcsRetentionErr(ctx context.Context, err error) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, RetentionOperation, http.StatusInternalServerError)
+	var apiErr *googleapi.Error
+	if err.Error() == storage.ErrObjectNotExist.Error() {
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	} else if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		appErr = appErr.SetHTTPCode(http.StatusForbidden)
+	} else if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(apiErr.Message), "retention") {
+		appErr = appErr.SetHTTPCode(http.StatusConflict)
+	} else if retryAfter, ok := gcsRetryAfter(err); ok {
+		appErr = throttled(appErr, retryAfter)
+	}
+	return appErr
+}
+
+// gcsRetention returns the retention reported by the attributes of an object
+func gcsRetention(retention *storage.ObjectRetention) Retention {
+	if retention == nil || retention.Mode == "" {
+		return Retention{}
+	}
+	mode := RetentionGovernance
+	if retention.Mode == gcsRetentionModes[RetentionCompliance] {
+		mode = RetentionCompliance
+	}
+	return Retention{Mode: mode, RetainUntil: retention.RetainUntil}
+}
+
+// SetRetention sets the retention of an object below the prefix
+func (b *SubBackend) SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return SetRetention(ctx, b.Parent, key, retention)
+}
+
+// SetLegalHold places or releases the legal hold of an object below the prefix
+func (b *SubBackend) SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return SetLegalHold(ctx, b.Parent, key, hold)
+}
+
+// SetRetention sets the retention of an object in its shard
+func (b *ShardedBackend) SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError {
+	return SetRetention(ctx, b.ShardFor(path).Backend, path, retention)
+}
+
+// SetLegalHold places or releases the legal hold of an object in its shard
+func (b *ShardedBackend) SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError {
+	return SetLegalHold(ctx, b.ShardFor(path).Backend, path, hold)
+}
+
+// SetRetention sets the retention of an object in the backend of its route
+func (b *RouterBackend) SetRetention(ctx context.Context, path string, retention Retention) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return SetRetention(ctx, backend, path, retention)
+}
+
+// SetLegalHold places or releases the legal hold of an object in the backend of its route
+func (b *RouterBackend) SetLegalHold(ctx context.Context, path string, hold bool) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return SetLegalHold(ctx, backend, path, hold)
+}
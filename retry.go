@@ -0,0 +1,295 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+)
+
+// transientErrorMarkers are fragments of provider and network error messages reported for failures worth retrying,
+// as backends report most provider errors as 500 Internal Server Error
+var transientErrorMarkers = []string{
+	"SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests", "rateLimitExceeded",
+	"RequestTimeout", "ServiceUnavailable", "InternalError", "backendError", "connection reset", "broken pipe",
+	"connection refused", "unexpected EOF",
+}
+
+// RetryCondition reports whether a failed operation should be retried
+type RetryCondition func(op Operation, appErr *ae.AppError) bool
+
+// RetryOnTransient is the default RetryCondition: throttling (429), timeouts (408, 504), 502 and 503, and 500
+// errors caused by throttling, provider internal errors or connection failures such as resets. Errors such as 404
+// or access denied are returned at once.
+func RetryOnTransient(_ Operation, appErr *ae.AppError) bool {
+	switch appErr.GetHTTPCode() {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	case http.StatusInternalServerError:
+		return isTransientError(appErr.GetErr())
+	}
+	return false
+}
+
+// isTransientError reports whether err is a network failure or a provider error known to be transient
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	message := err.Error()
+	for _, marker := range transientErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryBudget caps retries to a share of the operations of every RetryBackend sharing it, so retries cannot
+// multiply the load on a struggling provider. Every operation adds Ratio tokens, up to MaxTokens, and every retry
+// takes one. Create it with NewRetryBudget.
+type RetryBudget struct {
+	Ratio     float64
+	MaxTokens float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget creates a new instance of RetryBudget allowing ratio retries per operation, e.g. 0.1, and bursts
+// of up to maxTokens retries. The budget starts full.
+func NewRetryBudget(ratio float64, maxTokens int) *RetryBudget {
+	return &RetryBudget{
+		Ratio:     ratio,
+		MaxTokens: float64(maxTokens),
+		tokens:    float64(maxTokens),
+	}
+}
+
+// deposit credits the budget for an operation
+func (r *RetryBudget) deposit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+r.Ratio, r.MaxTokens)
+}
+
+// withdraw takes a token for a retry, reporting false when the budget is spent
+func (r *RetryBudget) withdraw() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// RetryOption configures a RetryBackend
+type RetryOption func(*RetryBackend)
+
+// WithMaxAttempts sets how many times an operation is tried, the first attempt included
+func WithMaxAttempts(attempts int) RetryOption {
+	return func(b *RetryBackend) {
+		b.MaxAttempts = attempts
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every retry up to maxDelay
+func WithBackoff(baseDelay, maxDelay time.Duration) RetryOption {
+	return func(b *RetryBackend) {
+		b.BaseDelay = baseDelay
+		b.MaxDelay = maxDelay
+	}
+}
+
+// WithRetryBudget shares a retry budget, typically between all backends talking to the same provider
+func WithRetryBudget(budget *RetryBudget) RetryOption {
+	return func(b *RetryBackend) {
+		b.Budget = budget
+	}
+}
+
+// WithRetryCondition sets the errors an operation is retried on
+func WithRetryCondition(condition RetryCondition) RetryOption {
+	return func(b *RetryBackend) {
+		b.Condition = condition
+	}
+}
+
+// RetryBackend is an IStorageBackend decorator retrying operations failing with a transient error, waiting an
+// exponential backoff with full jitter between attempts: a random delay up to BaseDelay doubled on every retry and
+// capped at MaxDelay, and at least the retry hint of the error, up to MaxDelay. Retries stop when the context is
+// done, and, when a Budget is set, when the budget is spent. Every operation of the interface is idempotent, so all
+// of them are retried; a ListObjects call is retried as a whole.
+type RetryBackend struct {
+	Backend     IStorageBackend
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Budget is optional, without it every failed attempt matching Condition is retried
+	Budget    *RetryBudget
+	Condition RetryCondition
+}
+
+// NewRetryBackend creates a new instance of RetryBackend, trying operations 3 times with a backoff from 100ms up
+// to 5s by default
+func NewRetryBackend(backend IStorageBackend, opts ...RetryOption) (*RetryBackend, *ae.AppError) {
+	b := &RetryBackend{
+		Backend:     backend,
+		MaxAttempts: defaultRetryAttempts,
+		BaseDelay:   defaultRetryBaseDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		Condition:   RetryOnTransient,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.MaxAttempts < 1 || b.BaseDelay < 0 || b.MaxDelay < b.BaseDelay || b.Condition == nil {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("attempts must be positive, delays not negative and the base delay not above the max delay"), RetryConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the retried backend
+func (b *RetryBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations without retries run on the wrapped backend
+func (b *RetryBackend) transparent() {}
+
+// Describe reports the attempts and backoff delays
+func (b *RetryBackend) Describe() map[string]string {
+	description := map[string]string{
+		"maxAttempts": strconv.Itoa(b.MaxAttempts),
+		"baseDelay":   b.BaseDelay.String(),
+		"maxDelay":    b.MaxDelay.String(),
+	}
+	if b.Budget != nil {
+		description["budgetRatio"] = strconv.FormatFloat(b.Budget.Ratio, 'f', -1, 64)
+	}
+	return description
+}
+
+// GetObject retrieves an object, retrying transient failures
+func (b *RetryBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	var object Object
+	appErr := b.retry(ctx, OperationGet, func() *ae.AppError {
+		var appErr *ae.AppError
+		object, appErr = b.Backend.GetObject(ctx, path, opts...)
+		return appErr
+	})
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix, retrying transient failures
+func (b *RetryBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	var objects []Object
+	appErr := b.retry(ctx, OperationList, func() *ae.AppError {
+		var appErr *ae.AppError
+		objects, appErr = b.Backend.GetObjects(ctx, prefix)
+		return appErr
+	})
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix, retrying transient failures. The partial result of the last
+// attempt is returned when all attempts failed.
+func (b *RetryBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	appErr := b.retry(ctx, OperationList, func() *ae.AppError {
+		var appErr *ae.AppError
+		result, appErr = b.Backend.ListObjects(ctx, prefix, opts...)
+		return appErr
+	})
+	return result, appErr
+}
+
+// PutObject uploads an object, retrying transient failures
+func (b *RetryBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.retry(ctx, OperationPut, func() *ae.AppError {
+		return b.Backend.PutObject(ctx, path, content, opts...)
+	})
+}
+
+// DeleteObject removes an object, retrying transient failures
+func (b *RetryBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.retry(ctx, OperationDelete, func() *ae.AppError {
+		return b.Backend.DeleteObject(ctx, path)
+	})
+}
+
+// CopyObject copies an object, retrying transient failures
+func (b *RetryBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.retry(ctx, OperationCopy, func() *ae.AppError {
+		return b.Backend.CopyObject(ctx, srcPath, dstPath)
+	})
+}
+
+// retry runs attempt until it succeeds, fails with an error not matching Condition, or no retry is left
+func (b *RetryBackend) retry(ctx context.Context, op Operation, attempt func() *ae.AppError) *ae.AppError {
+	if b.Budget != nil {
+		b.Budget.deposit()
+	}
+	for tries := 1; ; tries++ {
+		appErr := attempt()
+		if appErr == nil || !b.Condition(op, appErr) {
+			return appErr
+		}
+		if tries >= b.MaxAttempts {
+			return appErr.AddErrCode(RetryExhausted.Code)
+		}
+		if b.Budget != nil && !b.Budget.withdraw() {
+			return appErr.AddErrCode(RetryBudgetExhausted.Code)
+		}
+		delay := b.backoff(tries)
+		if retryAfter, ok := RetryAfter(appErr); ok {
+			delay = max(delay, min(retryAfter, b.MaxDelay))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return appErr
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random delay before retry number retry, up to BaseDelay doubled per earlier retry
+func (b *RetryBackend) backoff(retry int) time.Duration {
+	if b.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := b.MaxDelay
+	if shift := retry - 1; shift < 32 {
+		if delay := b.BaseDelay << shift; delay > 0 && delay < ceiling {
+			ceiling = delay
+		}
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
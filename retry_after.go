@@ -0,0 +1,63 @@
+package object_storage
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// defaultThrottleRetryAfter is the retry hint of provider throttling errors not telling when to retry
+const defaultThrottleRetryAfter = time.Second
+
+// RetryHint is the data of errors of throttled or rejected operations, telling when the operation may be retried
+type RetryHint struct {
+	RetryAfter time.Duration
+}
+
+// withRetryHint attaches a retry hint to appErr
+func withRetryHint(appErr *ae.AppError, retryAfter time.Duration) *ae.AppError {
+	return appErr.SetData(RetryHint{RetryAfter: max(retryAfter, 0)})
+}
+
+// throttled marks appErr as a throttling error, 429 Too Many Requests, that may be retried after retryAfter
+func throttled(appErr *ae.AppError, retryAfter time.Duration) *ae.AppError {
+	return withRetryHint(appErr.SetHTTPCode(http.StatusTooManyRequests), retryAfter)
+}
+
+// RetryAfter returns how long to wait before retrying the operation that failed with appErr, false when the error
+// carries no retry hint
+func RetryAfter(appErr *ae.AppError) (time.Duration, bool) {
+	if appErr == nil {
+		return 0, false
+	}
+	hint, ok := appErr.GetData().(RetryHint)
+	return hint.RetryAfter, ok
+}
+
+// SetRetryAfterHeader sets the Retry-After header of an HTTP response reporting appErr, in whole seconds rounded
+// up, and reports whether the error carried a retry hint. Respond with appErr.GetHTTPCode(), 429 for throttling.
+func SetRetryAfterHeader(header http.Header, appErr *ae.AppError) bool {
+	retryAfter, ok := RetryAfter(appErr)
+	if !ok {
+		return false
+	}
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header, a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,197 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// rgwRegion is the zonegroup name of a default Ceph RGW deployment, used to sign requests
+const rgwRegion = "default"
+
+// BucketStats is the usage of a bucket as accounted by the provider
+type BucketStats struct {
+	Objects int64
+	// Bytes is the logical size of the stored objects
+	Bytes int64
+	// BytesActual is the space used including allocation overhead
+	BytesActual int64
+}
+
+// BucketQuota is the quota configured on a bucket, a negative limit means unlimited
+type BucketQuota struct {
+	Enabled    bool
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// IBucketStatsProvider is implemented by backends able to report bucket usage without listing it
+type IBucketStatsProvider interface {
+	BucketStats(ctx context.Context) (BucketStats, *ae.AppError)
+}
+
+// IBucketQuotaProvider is implemented by backends able to report the quota of their bucket
+type IBucketQuotaProvider interface {
+	BucketQuota(ctx context.Context) (BucketQuota, *ae.AppError)
+}
+
+// RGWBackend is a storage backend for Ceph RADOS Gateway. It is an S3Backend that addresses tenant buckets as
+// tenant:bucket, keeps user metadata keys readable through the Swift API and exposes the RGW admin operations
+// for bucket usage and quota through IBucketStatsProvider and IBucketQuotaProvider.
+type RGWBackend struct {
+	*S3Backend
+	// Tenant is the RGW tenant owning the bucket, empty for the default tenant
+	Tenant string
+	// AdminEndpoint is the RGW admin API root, e.g. https://rgw.example.com/admin
+	AdminEndpoint string
+	// AdminCredentials sign admin requests and need the buckets=read capability
+	AdminCredentials *credentials.Credentials
+	AdminClient      IHTTPClient
+}
+
+// rgwBucketStats is the part of the admin bucket stats reply used by RGWBackend
+type rgwBucketStats struct {
+	Usage map[string]struct {
+		Size       int64 `json:"size"`
+		SizeActual int64 `json:"size_actual"`
+		NumObjects int64 `json:"num_objects"`
+	} `json:"usage"`
+	BucketQuota struct {
+		Enabled    bool  `json:"enabled"`
+		MaxSize    int64 `json:"max_size"`
+		MaxObjects int64 `json:"max_objects"`
+	} `json:"bucket_quota"`
+}
+
+// NewRGWBackend creates a new instance of RGWBackend for the bucket of tenant (empty for the default tenant)
+// served at endpoint. The same credentials are used for admin operations.
+func NewRGWBackend(endpoint string, tenant string, bucket string, prefix string, creds *credentials.Credentials) (*RGWBackend, *ae.AppError) {
+	if endpoint == "" || bucket == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("endpoint and bucket are required"), RGWBackendClient, http.StatusInternalServerError)
+	}
+	bucketName := bucket
+	if tenant != "" {
+		bucketName = tenant + ":" + bucket
+	}
+	// tenant:bucket is not a valid host name, so path-style addressing is required
+	backend, appErr := NewS3BackendWithEndpoint(bucketName, prefix, rgwRegion, endpoint, strings.HasPrefix(endpoint, "http://"), creds)
+	if appErr != nil {
+		return nil, appErr.AddErrCode(RGWBackendClient.Code)
+	}
+	backend.Compat = S3Compat{Provider: "rgw"}
+	return &RGWBackend{
+		S3Backend:        backend,
+		Tenant:           tenant,
+		AdminEndpoint:    strings.TrimSuffix(endpoint, "/") + "/admin",
+		AdminCredentials: creds,
+		AdminClient:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Describe reports the tenant, bucket and prefix the backend is bound to
+func (b *RGWBackend) Describe() map[string]string {
+	description := b.S3Backend.Describe()
+	description["tenant"] = b.Tenant
+	return description
+}
+
+// PutObject uploads an object, normalising user metadata keys to the lower case, dash separated form the Swift
+// API exposes them as, so the object reads the same over S3 and Swift
+func (b *RGWBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.S3Backend.PutObject(ctx, path, content, append(opts, swiftCompatibleMetadata)...)
+}
+
+// BucketStats returns the object count and size of the bucket from the RGW admin API
+func (b *RGWBackend) BucketStats(ctx context.Context) (BucketStats, *ae.AppError) {
+	var stats BucketStats
+	reply, appErr := b.bucketAdminStats(ctx)
+	if appErr != nil {
+		return stats, appErr
+	}
+	// usage is split by category, rgw.main holds the objects and rgw.multimeta pending multipart uploads
+	for _, usage := range reply.Usage {
+		stats.Objects += usage.NumObjects
+		stats.Bytes += usage.Size
+		stats.BytesActual += usage.SizeActual
+	}
+	return stats, nil
+}
+
+// BucketQuota returns the quota of the bucket from the RGW admin API
+func (b *RGWBackend) BucketQuota(ctx context.Context) (BucketQuota, *ae.AppError) {
+	reply, appErr := b.bucketAdminStats(ctx)
+	if appErr != nil {
+		return BucketQuota{}, appErr
+	}
+	return BucketQuota{
+		Enabled:    reply.BucketQuota.Enabled,
+		MaxBytes:   reply.BucketQuota.MaxSize,
+		MaxObjects: reply.BucketQuota.MaxObjects,
+	}, nil
+}
+
+// bucketAdminStats calls the admin bucket stats operation, which reports usage and quota together
+func (b *RGWBackend) bucketAdminStats(ctx context.Context) (rgwBucketStats, *ae.AppError) {
+	var reply rgwBucketStats
+	bucket := strings.TrimPrefix(b.Bucket, b.Tenant+":")
+	query := url.Values{
+		"bucket": []string{bucket},
+		"stats":  []string{"true"},
+		"format": []string{"json"},
+	}
+	if b.Tenant != "" {
+		query.Set("tenant", b.Tenant)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.AdminEndpoint+"/bucket?"+query.Encode(), nil)
+	if err != nil {
+		return reply, ae.GetAppErr(ctx, err, RGWAdminOperation, http.StatusInternalServerError)
+	}
+	if _, err := v4.NewSigner(b.AdminCredentials).Sign(req, nil, "s3", rgwRegion, time.Now()); err != nil {
+		return reply, ae.GetAppErr(ctx, errors.Wrap(err, "failed to sign admin request"), RGWAdminOperation, http.StatusInternalServerError)
+	}
+
+	resp, err := b.AdminClient.Do(req)
+	if err != nil {
+		return reply, ae.GetAppErr(ctx, err, RGWAdminOperation, http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return reply, ae.GetAppErr(ctx, errors.Wrap(err, "failed to read from reader stream"), RGWAdminOperation, http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		appErr := ae.GetAppErr(ctx, fmt.Errorf("rgw admin api returned %d: %s", resp.StatusCode, strings.TrimSpace(string(content))), RGWAdminOperation, http.StatusInternalServerError)
+		switch resp.StatusCode {
+		case http.StatusNotFound, http.StatusForbidden:
+			appErr = appErr.SetHTTPCode(resp.StatusCode)
+		}
+		return reply, appErr
+	}
+	if err := json.Unmarshal(content, &reply); err != nil {
+		return reply, ae.GetAppErr(ctx, errors.Wrap(err, "invalid rgw admin api reply"), RGWAdminOperation, http.StatusInternalServerError)
+	}
+	return reply, nil
+}
+
+// swiftCompatibleMetadata rewrites user metadata keys to lower case with underscores replaced by dashes, as
+// Swift header names cannot hold underscores
+func swiftCompatibleMetadata(o *PutOptions) {
+	if len(o.Metadata) == 0 {
+		return
+	}
+	metadata := make(map[string]string, len(o.Metadata))
+	for key, value := range o.Metadata {
+		metadata[strings.ReplaceAll(strings.ToLower(key), "_", "-")] = value
+	}
+	o.Metadata = metadata
+}
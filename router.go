@@ -0,0 +1,304 @@
+package object_storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// Route sends the objects under Prefix to Backend, paths are passed to the backend unchanged
+type Route struct {
+	Prefix  string
+	Backend IStorageBackend
+}
+
+// routerCursor is the position of a listing spanning several backends of a RouterBackend
+type routerCursor struct {
+	// Segment is the index of the backend being listed
+	Segment int `json:"segment,omitempty"`
+	// Cursor is the cursor of the next page of that backend
+	Cursor string `json:"cursor,omitempty"`
+	// StartAfter is the StartAfter option of the listing, kept as backends are not listed in path order
+	StartAfter string `json:"startAfter,omitempty"`
+}
+
+// routerSegment is the part of a listing served by one backend of a RouterBackend
+type routerSegment struct {
+	backend IStorageBackend
+	// prefix is the prefix listed on the backend
+	prefix string
+	// route is the prefix of the route of the backend, empty for the default backend
+	route string
+}
+
+// RouterBackend is an IStorageBackend sending every operation to a backend chosen by the prefix of its path, e.g.
+// images/ to S3 and reports/ to GCS, so that one handle spans several providers. The longest matching route wins,
+// and paths matching no route go to the default backend. Copies between backends read the object and write it
+// with all its attributes. Listings spanning routes return the objects of the backend holding the prefix, then of
+// every route below it in prefix order, rather than in path order. Create it with NewRouterBackend.
+type RouterBackend struct {
+	// Default holds the paths matching no route, nil rejects them
+	Default IStorageBackend
+
+	// routes are ordered by prefix
+	routes []Route
+}
+
+// NewRouterBackend creates a new instance of RouterBackend sending paths under the prefix of each route to its
+// backend and other paths to defaultBackend, which may be nil when every path must match a route
+func NewRouterBackend(defaultBackend IStorageBackend, routes ...Route) (*RouterBackend, *ae.AppError) {
+	ctx := context.Background()
+	b := &RouterBackend{Default: defaultBackend}
+	for i, route := range routes {
+		route.Prefix = cleanPrefix(route.Prefix)
+		if route.Prefix == "" || route.Backend == nil {
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("route %d needs a prefix and a backend", i), RouterConfig, http.StatusInternalServerError)
+		}
+		b.routes = append(b.routes, route)
+	}
+	slices.SortFunc(b.routes, func(x, y Route) int { return cmp.Compare(x.Prefix, y.Prefix) })
+	for i := 1; i < len(b.routes); i++ {
+		if b.routes[i-1].Prefix == b.routes[i].Prefix {
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("route prefix %s is used twice", b.routes[i].Prefix), RouterConfig, http.StatusInternalServerError)
+		}
+	}
+	if len(b.routes) == 0 && defaultBackend == nil {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("a route or a default backend is required"), RouterConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Routes returns the routes, ordered by prefix
+func (b *RouterBackend) Routes() []Route {
+	return slices.Clone(b.routes)
+}
+
+// BackendFor returns the backend holding path and the prefix of its route, empty for the default backend. The
+// backend is nil when no route matches and there is no default backend.
+func (b *RouterBackend) BackendFor(path string) (IStorageBackend, string) {
+	path = NormalizePath(path)
+	var match *Route
+	for i, route := range b.routes {
+		if strings.HasPrefix(path, route.Prefix+"/") && (match == nil || len(route.Prefix) > len(match.Prefix)) {
+			match = &b.routes[i]
+		}
+	}
+	if match == nil {
+		return b.Default, ""
+	}
+	return match.Backend, match.Prefix
+}
+
+// Describe reports the chain of every route and of the default backend
+func (b *RouterBackend) Describe() map[string]string {
+	prefixes := make([]string, len(b.routes))
+	description := map[string]string{}
+	for i, route := range b.routes {
+		prefixes[i] = route.Prefix
+		description["route."+route.Prefix] = DescribeBackend(route.Backend).String()
+	}
+	description["routes"] = strings.Join(prefixes, ",")
+	if b.Default != nil {
+		description["default"] = DescribeBackend(b.Default).String()
+	}
+	return description
+}
+
+// GetObject retrieves an object from its backend
+func (b *RouterBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	return backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix, across the backends it spans
+func (b *RouterBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	var objects []Object
+	cursor := ""
+	for {
+		page, appErr := b.ListObjects(ctx, prefix, WithCursor(cursor))
+		objects = append(objects, page.Objects...)
+		if appErr != nil || !page.Truncated {
+			return objects, appErr
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// ListObjects lists objects at the given prefix on the backend holding it, then on every other route below it, one
+// after the other. Objects stored on a backend under the prefix of another route are left out, as they cannot be
+// reached through the router.
+func (b *RouterBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	segments := b.segments(prefix)
+	if len(segments) == 1 && segments[0].prefix == prefix {
+		// no other route lies below the prefix
+		return segments[0].backend.ListObjects(ctx, prefix, opts...)
+	}
+	cursor, err := parseRouterCursor(options.Cursor)
+	if err != nil {
+		return result, ae.GetAppErr(ctx, err, RouterListObjects, http.StatusBadRequest)
+	}
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Cursor == "" {
+		cursor.StartAfter = options.StartAfter
+	}
+	for cursor.Segment < len(segments) {
+		segment := segments[cursor.Segment]
+		maxKeys := 0
+		if options.MaxKeys > 0 {
+			maxKeys = options.MaxKeys - len(result.Objects)
+		}
+		segmentOpts := []ListOption{WithMaxKeys(maxKeys), WithCursor(cursor.Cursor), WithVersions(options.Versions),
+			WithHydratedMetadata(options.Hydrate)}
+		if segment.prefix == prefix {
+			// the backend holding the prefix lists the same paths, so it can start after the path itself
+			segmentOpts = append(segmentOpts, WithStartAfter(cursor.StartAfter))
+		}
+		page, appErr := segment.backend.ListObjects(ctx, segment.prefix, segmentOpts...)
+		result.Scanned += page.Scanned
+		for _, object := range page.Objects {
+			key := listedKey(segment.prefix, object.Path)
+			// objects of a backend under the prefix of another route cannot be reached through the router
+			if _, route := b.BackendFor(key); route != segment.route {
+				continue
+			}
+			object.Path = removePrefixFromObjectPath(prefix, key)
+			// segments are listed from their own prefix, so filters apply to the paths relative to the listed one
+			if object.Path > cursor.StartAfter && options.matches(object) {
+				result.Objects = append(result.Objects, object)
+			}
+		}
+		if appErr != nil || page.Truncated {
+			cursor.Cursor = page.NextCursor
+			result.Truncated = true
+			result.NextCursor = cursor.String()
+			if appErr != nil {
+				return result, appErr.AddErrCode(RouterListObjects.Code)
+			}
+			return result, nil
+		}
+		cursor = routerCursor{Segment: cursor.Segment + 1, StartAfter: cursor.StartAfter}
+		if options.limitReached(len(result.Objects)) && cursor.Segment < len(segments) {
+			result.Truncated = true
+			result.NextCursor = cursor.String()
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// PutObject uploads an object to its backend
+func (b *RouterBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object from its backend
+func (b *RouterBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, within a backend when both paths route to it and otherwise by reading it from one
+// backend and writing it with all its attributes to the other
+func (b *RouterBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	src, appErr := b.route(ctx, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	dst, appErr := b.route(ctx, dstPath)
+	if appErr != nil {
+		return appErr
+	}
+	return CopyObjectBetween(ctx, src, srcPath, dst, dstPath, PreserveAll())
+}
+
+// SecureDeleteObject securely deletes an object from its backend
+func (b *RouterBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return SecureDeleteReport{}, appErr
+	}
+	return SecureDelete(ctx, backend, path)
+}
+
+// route returns the backend holding path, failing when no route matches and there is no default backend
+func (b *RouterBackend) route(ctx context.Context, path string) (IStorageBackend, *ae.AppError) {
+	backend, _ := b.BackendFor(path)
+	if backend == nil {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("no route for %s", path), RouterNoRoute, http.StatusBadRequest)
+	}
+	return backend, nil
+}
+
+// segments returns the backends a listing of prefix spans: the backend holding the prefix, then every other route
+// below it
+func (b *RouterBackend) segments(prefix string) []routerSegment {
+	var segments []routerSegment
+	owner, ownerRoute := b.BackendFor(prefix)
+	if owner != nil {
+		segments = append(segments, routerSegment{backend: owner, prefix: prefix, route: ownerRoute})
+	}
+	listed := strings.TrimLeft(prefix, "/")
+	for _, route := range b.routes {
+		if route.Prefix != ownerRoute && strings.HasPrefix(route.Prefix+"/", listed) {
+			segments = append(segments, routerSegment{backend: route.Backend, prefix: route.Prefix + "/", route: route.Prefix})
+		}
+	}
+	return segments
+}
+
+// listedKey returns the key of an object listed at prefix. Backends only strip prefixes ending at a folder
+// boundary, so a path already starting with the prefix is taken as the key.
+func listedKey(prefix string, path string) string {
+	trimmed := cleanPrefix(prefix)
+	if !strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, trimmed) {
+		return path
+	}
+	return objectKey(trimmed, path)
+}
+
+// String encodes the cursor for ListResult.NextCursor
+func (c routerCursor) String() string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// parseRouterCursor decodes a cursor returned by RouterBackend.ListObjects, an empty cursor starts the listing
+func parseRouterCursor(cursor string) (routerCursor, error) {
+	var parsed routerCursor
+	if cursor == "" {
+		return parsed, nil
+	}
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(content, &parsed)
+	}
+	if err != nil {
+		return parsed, errors.Wrap(err, "invalid cursor")
+	}
+	if parsed.Segment < 0 {
+		return parsed, fmt.Errorf("invalid cursor: negative segment %d", parsed.Segment)
+	}
+	return parsed, nil
+}
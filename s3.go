@@ -3,10 +3,14 @@ package object_storage
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	pathutil "path"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -17,12 +21,29 @@ import (
 	ae "github.com/piyushkumar96/app-error"
 )
 
+// s3DeleteBatchSize is the most keys a DeleteObjects request accepts
+const s3DeleteBatchSize = 1000
+
 // IS3Client interface for S3 client operations - allows mocking in tests
 type IS3Client interface {
 	ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error)
+	ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error)
 	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+	GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error)
 	DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+	DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error)
 	CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error)
+	CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartRequest(input *s3.UploadPartInput) (*request.Request, *s3.UploadPartOutput)
+	UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error)
+	PutObjectRequest(input *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput)
+	PutObjectAclWithContext(ctx aws.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error)
+	PutObjectRetentionWithContext(ctx aws.Context, input *s3.PutObjectRetentionInput, opts ...request.Option) (*s3.PutObjectRetentionOutput, error)
+	PutObjectLegalHoldWithContext(ctx aws.Context, input *s3.PutObjectLegalHoldInput, opts ...request.Option) (*s3.PutObjectLegalHoldOutput, error)
+	ListPartsPagesWithContext(ctx aws.Context, input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool, opts ...request.Option) error
+	CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error)
 }
 
 // IS3Uploader interface for S3 upload operations - allows mocking in tests
@@ -37,6 +58,25 @@ type S3Backend struct {
 	Downloader *s3manager.Downloader
 	Prefix     string
 	Uploader   IS3Uploader
+	// Compat lists the S3 features missing on an S3 compatible provider, the zero value means Amazon S3
+	Compat S3Compat
+}
+
+// S3Compat describes the S3 features an S3 compatible provider does not implement, so that requests needing
+// them fail upfront with 501 Not Implemented instead of an opaque provider error
+type S3Compat struct {
+	// Provider names the service in errors and in Describe, e.g. r2
+	Provider string
+	// NoKMSEncryption is set when SSE-KMS uploads are not available
+	NoKMSEncryption bool
+	// NoVersionListing is set when ListObjectVersions is not available
+	NoVersionListing bool
+	// NoPostPolicy is set when browser form uploads signed with a POST policy are not available
+	NoPostPolicy bool
+	// NoObjectACL is set when object ACLs are not available
+	NoObjectACL bool
+	// NoObjectLock is set when object lock retention and legal holds are not available
+	NoObjectLock bool
 }
 
 // NewS3Backend creates a new instance of S3Backend using default credentials
@@ -100,21 +140,70 @@ func NewS3BackendWithEndpoint(bucket string, prefix string, region string, endpo
 	}, nil
 }
 
+// Describe reports the bucket and prefix the backend is bound to
+func (b *S3Backend) Describe() map[string]string {
+	description := map[string]string{
+		"bucket": b.Bucket,
+		"prefix": b.Prefix,
+	}
+	if b.Compat.Provider != "" {
+		description["provider"] = b.Compat.Provider
+	}
+	return description
+}
+
 // GetObject retrieves an object from Amazon S3 bucket
-func (b *S3Backend) GetObject(ctx context.Context, path string) (Object, *ae.AppError) {
+func (b *S3Backend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
 	var object Object
 	object.Path = path
 
 	s3Input := &s3.GetObjectInput{
-		Bucket: aws.String(b.Bucket),
-		Key:    aws.String(pathutil.Join(b.Prefix, path)),
+		Bucket:       aws.String(b.Bucket),
+		Key:          aws.String(objectKey(b.Prefix, path)),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	}
+	if options.Range != nil {
+		s3Input.Range = aws.String(httpRangeHeader(*options.Range))
+	}
+	if options.CustomerKey != nil {
+		if appErr := validateCustomerKey(ctx, options.CustomerKey); appErr != nil {
+			return object, appErr
+		}
+		s3Input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		s3Input.SSECustomerKey = aws.String(string(options.CustomerKey))
+	}
+	if options.IfNoneMatch != "" {
+		s3Input.IfNoneMatch = aws.String(`"` + options.IfNoneMatch + `"`)
+	} else if !options.IfModifiedSince.IsZero() {
+		s3Input.IfModifiedSince = aws.Time(options.IfModifiedSince)
+	}
+	if options.VersionID != "" {
+		s3Input.VersionId = aws.String(options.VersionID)
+		object.VersionID = options.VersionID
+	} else if options.versioned() {
+		versionID, appErr := b.versionIDAt(ctx, path, options.AsOf)
+		if appErr != nil {
+			return object, appErr
+		}
+		s3Input.VersionId = aws.String(versionID)
+		object.VersionID = versionID
 	}
 
 	s3Result, err := b.Client.GetObjectWithContext(ctx, s3Input)
+	if err != nil && contains(err.Error(), "NotModified") {
+		return object, notModifiedErr(ctx, path)
+	}
 	if err != nil {
 		appErr := ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError)
 		if isS3NotFoundError(err) {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if contains(err.Error(), "InvalidRange") {
+			appErr = appErr.SetHTTPCode(http.StatusRequestedRangeNotSatisfiable)
+		} else if status, ok := s3CustomerKeyStatus(err); ok {
+			appErr = appErr.SetHTTPCode(status)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
 		}
 		return object, appErr
 	}
@@ -129,68 +218,384 @@ func (b *S3Backend) GetObject(ctx context.Context, path string) (Object, *ae.App
 	if s3Result.LastModified != nil {
 		object.LastModified = *s3Result.LastModified
 	}
+	object.Encryption = s3Encryption(s3Result.ServerSideEncryption, s3Result.SSEKMSKeyId)
+	if s3Result.SSECustomerAlgorithm != nil {
+		object.Encryption = Encryption{Type: EncryptionCustomerKey}
+	}
+	object.ContentType = aws.StringValue(s3Result.ContentType)
+	object.CacheControl = aws.StringValue(s3Result.CacheControl)
+	object.ContentEncoding = aws.StringValue(s3Result.ContentEncoding)
+	object.ContentDisposition = aws.StringValue(s3Result.ContentDisposition)
+	object.ContentLanguage = aws.StringValue(s3Result.ContentLanguage)
+	object.StorageClass = aws.StringValue(s3Result.StorageClass)
+	object.ETag = unquoteETag(aws.StringValue(s3Result.ETag))
+	object.CRC32C = s3CRC32C(s3Result.ChecksumCRC32C)
+	object.Retention = s3Retention(s3Result.ObjectLockMode, s3Result.ObjectLockRetainUntilDate)
+	object.LegalHold = aws.StringValue(s3Result.ObjectLockLegalHoldStatus) == s3.ObjectLockLegalHoldStatusOn
+	if object.VersionID == "" {
+		object.VersionID = aws.StringValue(s3Result.VersionId)
+	}
+	if len(s3Result.Metadata) > 0 {
+		object.Meta.User = s3UserMetadata(s3Result.Metadata)
+	}
+	object.Size = int64(len(content))
+	if total, ok := totalSizeFromContentRange(aws.StringValue(s3Result.ContentRange)); ok {
+		object.Size = total
+	}
 	return object, nil
 }
 
 // GetObjects lists all objects in Amazon S3 bucket at the given prefix
 func (b *S3Backend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
-	var objects []Object
-	fullPrefix := pathutil.Join(b.Prefix, prefix)
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects in Amazon S3 bucket at the given prefix, honouring MaxKeys and cursor options
+func (b *S3Backend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	fullPrefix := listPrefix(b.Prefix, prefix)
+	options.Cursor = options.startCursor(fullPrefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Versions != VersionsCurrent {
+		if b.Compat.NoVersionListing {
+			return result, ae.GetAppErr(ctx, fmt.Errorf("version listing is not supported by %s", b.Compat.Provider), S3GetObjects, http.StatusNotImplemented)
+		}
+		return b.listObjectVersions(ctx, fullPrefix, options)
+	}
 
 	s3Input := &s3.ListObjectsInput{
 		Bucket: aws.String(b.Bucket),
 		Prefix: aws.String(fullPrefix),
 	}
+	if options.Cursor != "" {
+		s3Input.Marker = aws.String(options.Cursor)
+	}
 
 	for {
+		if options.MaxKeys > 0 {
+			s3Input.MaxKeys = aws.Int64(int64(options.MaxKeys - len(result.Objects)))
+		}
 		s3Result, err := b.Client.ListObjectsWithContext(ctx, s3Input)
 		if err != nil {
 			appErr := ae.GetAppErr(ctx, err, S3GetObjects, http.StatusInternalServerError)
 			if isS3NotFoundError(err) {
 				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if isS3AccessDeniedError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if isS3ThrottlingError(err) {
+				appErr = throttled(appErr, defaultThrottleRetryAfter)
 			}
-			return objects, appErr
+			result.interrupted(aws.StringValue(s3Input.Marker), options)
+			return result, appErr
 		}
 
 		for _, obj := range s3Result.Contents {
+			result.Scanned++
 			path := removePrefixFromObjectPath(fullPrefix, *obj.Key)
 			object := Object{
 				Path:         path,
 				Content:      []byte{},
-				LastModified: *obj.LastModified,
+				LastModified: aws.TimeValue(obj.LastModified),
+				Size:         aws.Int64Value(obj.Size),
+				StorageClass: aws.StringValue(obj.StorageClass),
+				ETag:         unquoteETag(aws.StringValue(obj.ETag)),
+			}
+			if options.matches(object) {
+				result.Objects = append(result.Objects, object)
 			}
-			objects = append(objects, object)
 		}
 
-		if s3Result.IsTruncated == nil || !*s3Result.IsTruncated {
+		if !aws.BoolValue(s3Result.IsTruncated) {
+			break
+		}
+		// NextMarker is only returned when a delimiter is used, otherwise the last key is the marker
+		nextMarker := aws.StringValue(s3Result.NextMarker)
+		if nextMarker == "" && len(s3Result.Contents) > 0 {
+			nextMarker = aws.StringValue(s3Result.Contents[len(s3Result.Contents)-1].Key)
+		}
+		if nextMarker == "" || options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = nextMarker
 			break
 		}
-		s3Input.Marker = s3Result.Contents[len(s3Result.Contents)-1].Key
+		s3Input.Marker = aws.String(nextMarker)
 	}
 
-	return objects, nil
+	if options.Hydrate > 0 {
+		var appErr *ae.AppError
+		result.Objects, appErr = hydrateObjects(ctx, b, prefix, result.Objects, options.Hydrate)
+		return result, appErr
+	}
+	return result, nil
 }
 
-// PutObject uploads an object to Amazon S3 bucket
-func (b *S3Backend) PutObject(ctx context.Context, path string, content []byte) *ae.AppError {
-	s3Input := &s3manager.UploadInput{
+// listObjectVersions lists object versions, and optionally delete markers, using ListObjectVersions.
+// The cursor holds the key and version id markers separated by a newline.
+func (b *S3Backend) listObjectVersions(ctx context.Context, fullPrefix string, options ListOptions) (ListResult, *ae.AppError) {
+	var result ListResult
+	s3Input := &s3.ListObjectVersionsInput{
 		Bucket: aws.String(b.Bucket),
-		Key:    aws.String(pathutil.Join(b.Prefix, path)),
-		Body:   bytes.NewBuffer(content),
+		Prefix: aws.String(fullPrefix),
+	}
+	if options.Cursor != "" {
+		keyMarker, versionMarker, _ := strings.Cut(options.Cursor, "\n")
+		s3Input.KeyMarker = aws.String(keyMarker)
+		if versionMarker != "" {
+			s3Input.VersionIdMarker = aws.String(versionMarker)
+		}
+	}
+
+	for {
+		if options.MaxKeys > 0 {
+			s3Input.MaxKeys = aws.Int64(int64(options.MaxKeys - len(result.Objects)))
+		}
+		s3Result, err := b.Client.ListObjectVersionsWithContext(ctx, s3Input)
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, S3GetObjects, http.StatusInternalServerError)
+			if isS3NotFoundError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if isS3NotImplementedError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+			} else if isS3AccessDeniedError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if isS3ThrottlingError(err) {
+				appErr = throttled(appErr, defaultThrottleRetryAfter)
+			}
+			if s3Input.KeyMarker != nil {
+				result.interrupted(aws.StringValue(s3Input.KeyMarker)+"\n"+aws.StringValue(s3Input.VersionIdMarker), options)
+			} else {
+				result.interrupted("", options)
+			}
+			return result, appErr
+		}
+
+		var page []Object
+		for _, version := range s3Result.Versions {
+			page = append(page, Object{
+				Path:         removePrefixFromObjectPath(fullPrefix, aws.StringValue(version.Key)),
+				Content:      []byte{},
+				LastModified: aws.TimeValue(version.LastModified),
+				Size:         aws.Int64Value(version.Size),
+				StorageClass: aws.StringValue(version.StorageClass),
+				ETag:         unquoteETag(aws.StringValue(version.ETag)),
+				VersionID:    aws.StringValue(version.VersionId),
+				IsLatest:     aws.BoolValue(version.IsLatest),
+			})
+		}
+		if options.Versions == VersionsAllWithDeleteMarkers {
+			for _, marker := range s3Result.DeleteMarkers {
+				page = append(page, Object{
+					Path:           removePrefixFromObjectPath(fullPrefix, aws.StringValue(marker.Key)),
+					Content:        []byte{},
+					LastModified:   aws.TimeValue(marker.LastModified),
+					VersionID:      aws.StringValue(marker.VersionId),
+					IsLatest:       aws.BoolValue(marker.IsLatest),
+					IsDeleteMarker: true,
+				})
+			}
+		}
+		result.Scanned += len(s3Result.Versions) + len(s3Result.DeleteMarkers)
+		sortVersionsNewestFirst(page)
+		for _, object := range page {
+			if options.matches(object) {
+				result.Objects = append(result.Objects, object)
+			}
+		}
+
+		if !aws.BoolValue(s3Result.IsTruncated) {
+			break
+		}
+		if options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = aws.StringValue(s3Result.NextKeyMarker) + "\n" + aws.StringValue(s3Result.NextVersionIdMarker)
+			break
+		}
+		s3Input.KeyMarker = s3Result.NextKeyMarker
+		s3Input.VersionIdMarker = s3Result.NextVersionIdMarker
+	}
+	return result, nil
+}
+
+// ListDir lists one level of prefix in Amazon S3 bucket, grouping the objects below it by subdirectory with a
+// delimiter, honouring MaxKeys and cursor options
+func (b *S3Backend) ListDir(ctx context.Context, prefix string, opts ...ListOption) (DirListing, *ae.AppError) {
+	var listing DirListing
+	options := getListOptions(opts)
+	fullPrefix := dirKey(b.Prefix, prefix)
+	s3Input := &s3.ListObjectsInput{
+		Bucket:    aws.String(b.Bucket),
+		Prefix:    aws.String(fullPrefix),
+		Delimiter: aws.String(dirDelimiter),
+	}
+	if options.Cursor != "" {
+		s3Input.Marker = aws.String(fullPrefix + dirStartAfter(options.Cursor))
+	}
+
+	for {
+		if options.MaxKeys > 0 {
+			s3Input.MaxKeys = aws.Int64(int64(options.MaxKeys - len(listing.Objects) - len(listing.Prefixes)))
+		}
+		s3Result, err := b.Client.ListObjectsWithContext(ctx, s3Input)
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, S3GetObjects, http.StatusInternalServerError)
+			if isS3NotFoundError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if isS3AccessDeniedError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusForbidden)
+			} else if isS3ThrottlingError(err) {
+				appErr = throttled(appErr, defaultThrottleRetryAfter)
+			}
+			listing.interrupted(options)
+			return listing, appErr
+		}
+
+		var page DirListing
+		for _, obj := range s3Result.Contents {
+			path := removePrefixFromObjectPath(fullPrefix, aws.StringValue(obj.Key))
+			if path == "" {
+				// the marker object of the folder itself
+				continue
+			}
+			page.Objects = append(page.Objects, Object{
+				Path:         path,
+				Content:      []byte{},
+				LastModified: aws.TimeValue(obj.LastModified),
+				Size:         aws.Int64Value(obj.Size),
+				StorageClass: aws.StringValue(obj.StorageClass),
+				ETag:         unquoteETag(aws.StringValue(obj.ETag)),
+			})
+		}
+		for _, commonPrefix := range s3Result.CommonPrefixes {
+			page.Prefixes = append(page.Prefixes, removePrefixFromObjectPath(fullPrefix, aws.StringValue(commonPrefix.Prefix)))
+		}
+		if listing.take(page, options) || !aws.BoolValue(s3Result.IsTruncated) {
+			break
+		}
+		if options.limitReached(len(listing.Objects) + len(listing.Prefixes)) {
+			listing.Truncated, listing.NextCursor = true, listing.lastEntry()
+			break
+		}
+		// resuming after the last subdirectory skips the objects below it, whatever marker the provider returns
+		nextMarker := aws.StringValue(s3Result.NextMarker)
+		if lastEntry := listing.lastEntry(); lastEntry != "" {
+			nextMarker = fullPrefix + dirStartAfter(lastEntry)
+		}
+		s3Input.Marker = aws.String(nextMarker)
+	}
+	return listing, nil
+}
+
+// PutObject uploads an object to Amazon S3 bucket
+func (b *S3Backend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.upload(ctx, path, bytes.NewBuffer(content), getPutOptions(opts))
+}
+
+// PutObjectStream uploads the content read from r to Amazon S3 bucket, at prefix, in parts when it is large,
+// without holding it in memory. A negative size means the length is unknown.
+func (b *S3Backend) PutObjectStream(ctx context.Context, path string, r io.Reader, size int64, opts ...PutOption) *ae.AppError {
+	body := newSizedReader(r, size)
+	appErr := b.upload(ctx, path, body, getPutOptions(opts))
+	if readErr := body.appErr(ctx, path); readErr != nil {
+		return readErr
+	}
+	return appErr
+}
+
+// upload uploads body to path with the attributes and encryption of options
+func (b *S3Backend) upload(ctx context.Context, path string, body io.Reader, options PutOptions) *ae.AppError {
+	s3Input, appErr := b.uploadInput(ctx, path, body, options)
+	if appErr != nil {
+		return appErr
 	}
 
 	_, err := b.Uploader.UploadWithContext(ctx, s3Input)
 	if err != nil {
-		return ae.GetAppErr(ctx, err, S3PutObject, http.StatusInternalServerError)
+		appErr := ae.GetAppErr(ctx, err, S3PutObject, http.StatusInternalServerError)
+		if isS3NotImplementedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+		} else if contains(err.Error(), "EntityTooLarge") {
+			appErr = appErr.SetHTTPCode(http.StatusRequestEntityTooLarge)
+		} else if isS3AccessDeniedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		return appErr
 	}
 	return nil
 }
 
+// uploadInput builds the upload of body to path with the attributes and encryption of options
+func (b *S3Backend) uploadInput(ctx context.Context, path string, body io.Reader, options PutOptions) (*s3manager.UploadInput, *ae.AppError) {
+	s3Input := &s3manager.UploadInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+		Body:   body,
+	}
+	if options.ContentType != "" {
+		s3Input.ContentType = aws.String(options.ContentType)
+	}
+	if options.CacheControl != "" {
+		s3Input.CacheControl = aws.String(options.CacheControl)
+	}
+	if options.ContentEncoding != "" {
+		s3Input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if options.ContentDisposition != "" {
+		s3Input.ContentDisposition = aws.String(options.ContentDisposition)
+	}
+	if options.ContentLanguage != "" {
+		s3Input.ContentLanguage = aws.String(options.ContentLanguage)
+	}
+	if key, ok := options.invalidHeaderMetadataKey(); ok {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("invalid metadata key %q", key), S3PutObject, http.StatusBadRequest)
+	}
+	if len(options.Metadata) > 0 {
+		s3Input.Metadata = aws.StringMap(options.Metadata)
+	}
+	if len(options.Tags) > 0 {
+		tagging := url.Values{}
+		for key, value := range options.Tags {
+			tagging.Set(key, value)
+		}
+		s3Input.Tagging = aws.String(tagging.Encode())
+	}
+	if options.StorageClass != "" {
+		s3Input.StorageClass = aws.String(options.StorageClass)
+	}
+	if options.Encryption != nil {
+		switch options.Encryption.Type {
+		case EncryptionKMS:
+			if b.Compat.NoKMSEncryption {
+				return nil, ae.GetAppErr(ctx, fmt.Errorf("kms encryption is not supported by %s", b.Compat.Provider), S3PutObject, http.StatusNotImplemented)
+			}
+			s3Input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			s3Input.SSEKMSKeyId = aws.String(options.Encryption.KMSKeyID)
+		case EncryptionProviderManaged:
+			s3Input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+		case EncryptionCustomerKey:
+			if appErr := validateCustomerKey(ctx, options.Encryption.CustomerKey); appErr != nil {
+				return nil, appErr
+			}
+			s3Input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+			s3Input.SSECustomerKey = aws.String(string(options.Encryption.CustomerKey))
+		case EncryptionNone:
+		default:
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("unsupported encryption type %q", options.Encryption.Type), S3PutObject, http.StatusBadRequest)
+		}
+	}
+	return s3Input, nil
+}
+
 // DeleteObject removes an object from Amazon S3 bucket
 func (b *S3Backend) DeleteObject(ctx context.Context, path string) *ae.AppError {
 	s3Input := &s3.DeleteObjectInput{
 		Bucket: aws.String(b.Bucket),
-		Key:    aws.String(pathutil.Join(b.Prefix, path)),
+		Key:    aws.String(objectKey(b.Prefix, path)),
 	}
 
 	_, err := b.Client.DeleteObjectWithContext(ctx, s3Input)
@@ -198,30 +603,205 @@ func (b *S3Backend) DeleteObject(ctx context.Context, path string) *ae.AppError
 		appErr := ae.GetAppErr(ctx, err, S3DeleteObject, http.StatusInternalServerError)
 		if isS3NotFoundError(err) {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if isS3AccessDeniedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
 		}
 		return appErr
 	}
 	return nil
 }
 
-// CopyObject copies an object within Amazon S3 bucket
+// DeleteObjects removes objects from Amazon S3 bucket with DeleteObjects requests of up to 1000 keys, up to the
+// concurrency of opts at a time. Providers not implementing DeleteObjects get one DeleteObject call per key.
+func (b *S3Backend) DeleteObjects(ctx context.Context, paths []string, opts ...DeleteOption) ([]DeleteResult, *ae.AppError) {
+	options := getDeleteOptions(opts)
+	results := make([]DeleteResult, len(paths))
+	slots := make(chan struct{}, options.Concurrency)
+	var wg sync.WaitGroup
+	for start := 0; start < len(paths); start += s3DeleteBatchSize {
+		batch := results[start:min(start+s3DeleteBatchSize, len(paths))]
+		for i := range batch {
+			batch[i].Path = paths[start+i]
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			for i := range batch {
+				batch[i].Err = ae.GetAppErr(ctx, ctx.Err(), BatchDeleteIncomplete, http.StatusRequestTimeout)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			b.deleteBatch(ctx, batch)
+		}()
+	}
+	wg.Wait()
+	return results, batchDeleteErr(ctx, results)
+}
+
+// deleteBatch removes the objects of batch, of up to 1000 keys, with one DeleteObjects request and sets their errors
+func (b *S3Backend) deleteBatch(ctx context.Context, batch []DeleteResult) {
+	indexes := make(map[string][]int, len(batch))
+	identifiers := make([]*s3.ObjectIdentifier, 0, len(batch))
+	for i, result := range batch {
+		key := objectKey(b.Prefix, result.Path)
+		if _, ok := indexes[key]; !ok {
+			identifiers = append(identifiers, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+	output, err := b.Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(b.Bucket),
+		Delete: &s3.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		if isS3NotImplementedError(err) {
+			for i := range batch {
+				if appErr := b.DeleteObject(ctx, batch[i].Path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+					batch[i].Err = appErr
+				}
+			}
+			return
+		}
+		appErr := ae.GetAppErr(ctx, err, S3DeleteObject, http.StatusInternalServerError)
+		if isS3AccessDeniedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		for i := range batch {
+			batch[i].Err = appErr
+		}
+		return
+	}
+	for _, keyErr := range output.Errors {
+		code := aws.StringValue(keyErr.Code)
+		if code == "NoSuchKey" {
+			continue
+		}
+		err := fmt.Errorf("%s: %s", code, aws.StringValue(keyErr.Message))
+		appErr := ae.GetAppErr(ctx, err, S3DeleteObject, http.StatusInternalServerError)
+		if code == "AccessDenied" {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		for _, i := range indexes[aws.StringValue(keyErr.Key)] {
+			batch[i].Err = appErr
+		}
+	}
+}
+
+// CopyObject copies an object within Amazon S3 bucket, in parts above 5 GiB. Metadata, content headers and tags are
+// copied by S3, the storage class is read from the source as S3 would otherwise write the copy as STANDARD.
 func (b *S3Backend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
-	copySource := pathutil.Join(b.Bucket, b.Prefix, srcPath)
-	copyObjectInput := &s3.CopyObjectInput{
-		Bucket:     aws.String(b.Bucket),
-		CopySource: aws.String(url.PathEscape(copySource)),
-		Key:        aws.String(pathutil.Join(b.Prefix, dstPath)),
+	// the copy would otherwise get the bucket default encryption rather than the key of the source
+	return b.copyFrom(ctx, b, srcPath, dstPath, true, nil)
+}
+
+// StatObject reads the attributes of the object at path with a HEAD request, without its content
+func (b *S3Backend) StatObject(ctx context.Context, path string) (Object, *ae.AppError) {
+	object := Object{Path: path}
+	head, err := b.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(b.Bucket),
+		Key:          aws.String(objectKey(b.Prefix, path)),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError)
+		if isS3NotFoundError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if status, ok := s3CustomerKeyStatus(err); ok {
+			// objects encrypted with a customer key can only be stated with the key
+			appErr = appErr.SetHTTPCode(status)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		return object, appErr
 	}
+	object.LastModified = aws.TimeValue(head.LastModified)
+	object.Encryption = s3Encryption(head.ServerSideEncryption, head.SSEKMSKeyId)
+	if head.SSECustomerAlgorithm != nil {
+		object.Encryption = Encryption{Type: EncryptionCustomerKey}
+	}
+	object.ContentType = aws.StringValue(head.ContentType)
+	object.CacheControl = aws.StringValue(head.CacheControl)
+	object.ContentEncoding = aws.StringValue(head.ContentEncoding)
+	object.ContentDisposition = aws.StringValue(head.ContentDisposition)
+	object.ContentLanguage = aws.StringValue(head.ContentLanguage)
+	object.StorageClass = aws.StringValue(head.StorageClass)
+	object.ETag = unquoteETag(aws.StringValue(head.ETag))
+	object.VersionID = aws.StringValue(head.VersionId)
+	object.CRC32C = s3CRC32C(head.ChecksumCRC32C)
+	object.Retention = s3Retention(head.ObjectLockMode, head.ObjectLockRetainUntilDate)
+	object.LegalHold = aws.StringValue(head.ObjectLockLegalHoldStatus) == s3.ObjectLockLegalHoldStatusOn
+	if len(head.Metadata) > 0 {
+		object.Meta.User = s3UserMetadata(head.Metadata)
+	}
+	object.Size = aws.Int64Value(head.ContentLength)
+	return object, nil
+}
 
-	_, err := b.Client.CopyObjectWithContext(ctx, copyObjectInput)
+// GetObjectTags returns the tags of the object at path
+func (b *S3Backend) GetObjectTags(ctx context.Context, path string) (map[string]string, *ae.AppError) {
+	output, err := b.Client.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(objectKey(b.Prefix, path)),
+	})
 	if err != nil {
-		appErr := ae.GetAppErr(ctx, err, S3CopyObject, http.StatusInternalServerError)
+		appErr := ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError)
 		if isS3NotFoundError(err) {
 			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if isS3NotImplementedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+		} else if isS3AccessDeniedError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusForbidden)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
 		}
-		return appErr
+		return nil, appErr
 	}
-	return nil
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// s3Encryption reports the encryption of an object from the S3 response headers
+func s3Encryption(serverSideEncryption *string, kmsKeyID *string) Encryption {
+	switch aws.StringValue(serverSideEncryption) {
+	case s3.ServerSideEncryptionAwsKms, s3.ServerSideEncryptionAwsKmsDsse:
+		return Encryption{Type: EncryptionKMS, KMSKeyID: aws.StringValue(kmsKeyID)}
+	case s3.ServerSideEncryptionAes256:
+		return Encryption{Type: EncryptionProviderManaged}
+	}
+	return Encryption{}
+}
+
+// s3UserMetadata returns the user metadata of an S3 response with lower case keys, as the SDK returns them in the
+// canonical header form, e.g. "Retain-Until"
+func s3UserMetadata(metadata map[string]*string) map[string]string {
+	user := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		user[strings.ToLower(key)] = aws.StringValue(value)
+	}
+	return user
+}
+
+// s3CRC32C returns the hex CRC32C of the whole content from the base64 checksum S3 reports, empty when there is
+// none or it is the checksum of the parts of a multipart upload
+func s3CRC32C(checksum *string) string {
+	sum, err := base64.StdEncoding.DecodeString(aws.StringValue(checksum))
+	if err != nil || len(sum) != 4 {
+		return ""
+	}
+	return hex.EncodeToString(sum)
 }
 
 // isS3NotFoundError checks if the error is an S3 not found error
@@ -233,6 +813,42 @@ func isS3NotFoundError(err error) bool {
 	return contains(errStr, "NoSuchKey") || contains(errStr, "NotFound") || contains(errStr, "404")
 }
 
+// isS3ThrottlingError checks if the error is S3 asking to reduce the request rate
+func isS3ThrottlingError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	return contains(errStr, "SlowDown") || contains(errStr, "Throttling") || contains(errStr, "RequestLimitExceeded") ||
+		contains(errStr, "TooManyRequests")
+}
+
+// isS3NotImplementedError checks if the error is returned by an S3 compatible provider for a feature it lacks
+func isS3NotImplementedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return contains(err.Error(), "NotImplemented")
+}
+
+// isS3PreconditionError checks if the error is S3 rejecting a request whose condition failed
+func isS3PreconditionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	return contains(errStr, "PreconditionFailed") || contains(errStr, "ConditionalRequestConflict")
+}
+
+// isS3AccessDeniedError checks if the error is S3 refusing a request for missing credentials or permissions
+func isS3AccessDeniedError(err error) bool {
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	return contains(errStr, "AccessDenied") || contains(errStr, "InvalidAccessKeyId") || contains(errStr, "SignatureDoesNotMatch")
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsSubstring(s, substr))
 }
@@ -0,0 +1,57 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// spacesSigningRegion is the region DigitalOcean Spaces expects in request signatures, the datacenter is
+// selected by the endpoint
+const spacesSigningRegion = "us-east-1"
+
+// spacesCompat lists the S3 features DigitalOcean Spaces does not implement
+var spacesCompat = S3Compat{
+	Provider:        "spaces",
+	NoKMSEncryption: true,
+}
+
+// wasabiCompat lists the S3 features Wasabi does not implement
+var wasabiCompat = S3Compat{
+	Provider:        "wasabi",
+	NoKMSEncryption: true,
+}
+
+// NewSpacesBackend creates a new instance of S3Backend for a DigitalOcean Spaces bucket in the given
+// datacenter region, e.g. nyc3 or fra1
+func NewSpacesBackend(region string, bucket string, prefix string, creds *credentials.Credentials) (*S3Backend, *ae.AppError) {
+	if region == "" || bucket == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("region and bucket are required"), S3BackendClient, http.StatusInternalServerError)
+	}
+	endpoint := fmt.Sprintf("https://%s.digitaloceanspaces.com", region)
+	backend, appErr := NewS3BackendWithEndpoint(bucket, prefix, spacesSigningRegion, endpoint, false, creds)
+	if appErr != nil {
+		return nil, appErr
+	}
+	backend.Compat = spacesCompat
+	return backend, nil
+}
+
+// NewWasabiBackend creates a new instance of S3Backend for a Wasabi bucket in the given region,
+// e.g. us-east-1 or eu-central-1
+func NewWasabiBackend(region string, bucket string, prefix string, creds *credentials.Credentials) (*S3Backend, *ae.AppError) {
+	if region == "" || bucket == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("region and bucket are required"), S3BackendClient, http.StatusInternalServerError)
+	}
+	// requests are signed with the bucket region, which must match the regional endpoint
+	endpoint := fmt.Sprintf("https://s3.%s.wasabisys.com", region)
+	backend, appErr := NewS3BackendWithEndpoint(bucket, prefix, region, endpoint, false, creds)
+	if appErr != nil {
+		return nil, appErr
+	}
+	backend.Compat = wasabiCompat
+	return backend, nil
+}
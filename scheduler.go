@@ -0,0 +1,257 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/robfig/cron/v3"
+)
+
+// JobFunc is the work run by a scheduled job
+type JobFunc func(ctx context.Context) *ae.AppError
+
+// Job is a recurring storage job such as garbage collection, scrubbing, lifecycle emulation or sync
+type Job struct {
+	Name string
+	// Spec is a standard five field cron expression or a descriptor such as @hourly or @every 10m
+	Spec string
+	// Jitter delays every run by a random duration up to Jitter, spreading runs of many instances
+	Jitter time.Duration
+	// Singleton runs the job on one instance only, guarded by the scheduler lease
+	Singleton bool
+	// Timeout bounds a single run, one hour when zero. Singleton jobs hold the lease for Timeout plus Jitter, so
+	// instances firing later in the same slot find it taken.
+	Timeout time.Duration
+	Run     JobFunc
+}
+
+// JobResult is the outcome of a job trigger
+type JobResult string
+
+const (
+	JobSucceeded JobResult = "succeeded"
+	JobFailed    JobResult = "failed"
+	// JobSkipped is reported when the previous run is still going or another instance holds the lease
+	JobSkipped JobResult = "skipped"
+)
+
+// ISchedulerMetrics receives job outcomes, e.g. to export them as metrics
+type ISchedulerMetrics interface {
+	ObserveJob(name string, result JobResult, duration time.Duration)
+}
+
+// JobStats holds the run history of a job
+type JobStats struct {
+	Name      string
+	Runs      int
+	Failures  int
+	Skips     int
+	LastRun   time.Time
+	LastError *ae.AppError
+	NextRun   time.Time
+}
+
+const defaultJobTimeout = time.Hour
+
+// SchedulerOption configures a Scheduler
+type SchedulerOption func(*Scheduler)
+
+// WithLease sets the lease used to run singleton jobs on one instance only
+func WithLease(lease ILease) SchedulerOption {
+	return func(s *Scheduler) {
+		s.lease = lease
+	}
+}
+
+// WithSchedulerMetrics sets the receiver of job outcomes
+func WithSchedulerMetrics(metrics ISchedulerMetrics) SchedulerOption {
+	return func(s *Scheduler) {
+		s.metrics = metrics
+	}
+}
+
+// Scheduler runs recurring storage jobs from cron like specs within the process, so the package jobs do not
+// each need their own cron deployment
+type Scheduler struct {
+	lease   ILease
+	metrics ISchedulerMetrics
+
+	mu      sync.Mutex
+	jobs    []*scheduledJob
+	started bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// scheduledJob is a job with its parsed schedule and run state
+type scheduledJob struct {
+	job      Job
+	schedule cron.Schedule
+	running  sync.Mutex
+	stats    JobStats
+}
+
+// NewScheduler creates a new instance of Scheduler
+func NewScheduler(opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// AddJob registers a job, it must be called before Start
+func (s *Scheduler) AddJob(job Job) *ae.AppError {
+	ctx := context.Background()
+	if job.Name == "" || job.Run == nil {
+		return ae.GetAppErr(ctx, fmt.Errorf("job name and run function are required"), SchedulerJobConfig, http.StatusInternalServerError)
+	}
+	if job.Singleton && s.lease == nil {
+		return ae.GetAppErr(ctx, fmt.Errorf("singleton job %s needs a scheduler lease", job.Name), SchedulerJobConfig, http.StatusInternalServerError)
+	}
+	schedule, err := cron.ParseStandard(job.Spec)
+	if err != nil {
+		return ae.GetAppErr(ctx, fmt.Errorf("job %s: %s", job.Name, err), SchedulerJobConfig, http.StatusInternalServerError)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return ae.GetAppErr(ctx, fmt.Errorf("job %s added after the scheduler started", job.Name), SchedulerJobConfig, http.StatusInternalServerError)
+	}
+	for _, existing := range s.jobs {
+		if existing.job.Name == job.Name {
+			return ae.GetAppErr(ctx, fmt.Errorf("job %s is already registered", job.Name), SchedulerJobConfig, http.StatusInternalServerError)
+		}
+	}
+	s.jobs = append(s.jobs, &scheduledJob{job: job, schedule: schedule, stats: JobStats{Name: job.Name}})
+	return nil
+}
+
+// Start runs the registered jobs in the background until ctx is done or Stop is called
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Stop stops triggering jobs and waits for running jobs to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Stats returns the run history of every registered job
+func (s *Scheduler) Stats() []JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]JobStats, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		stats = append(stats, job.stats)
+	}
+	return stats
+}
+
+// loop triggers a job at every scheduled time until ctx is done
+func (s *Scheduler) loop(ctx context.Context, job *scheduledJob) {
+	defer s.wg.Done()
+	for {
+		next := job.schedule.Next(time.Now())
+		if job.job.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(job.job.Jitter))))
+		}
+		s.mu.Lock()
+		job.stats.NextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		// runs never overlap the schedule, a slow run makes the next triggers skip rather than queue up
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.trigger(ctx, job)
+		}()
+	}
+}
+
+// trigger runs a job once, unless the previous run is still going or the lease is held elsewhere
+func (s *Scheduler) trigger(ctx context.Context, job *scheduledJob) {
+	start := time.Now()
+	if !job.running.TryLock() {
+		s.record(job, JobSkipped, start, nil)
+		return
+	}
+	defer job.running.Unlock()
+
+	if job.job.Singleton {
+		// the lease is left to expire rather than released after the run, as an instance with a longer jitter
+		// would otherwise take it and run the slot again; the holder renews it on its next trigger
+		acquired, appErr := s.lease.Acquire(ctx, "scheduler-"+job.job.Name, job.job.Timeout+job.job.Jitter)
+		if appErr != nil || !acquired {
+			s.record(job, JobSkipped, start, appErr)
+			return
+		}
+	}
+
+	// jobs are batch traffic, a job can raise the priority of its own operations with WithPriority
+	runCtx, cancel := context.WithTimeout(WithPriority(ctx, PriorityBatch), job.job.Timeout)
+	defer cancel()
+	if appErr := job.job.Run(runCtx); appErr != nil {
+		s.record(job, JobFailed, start, appErr)
+		return
+	}
+	s.record(job, JobSucceeded, start, nil)
+}
+
+// record updates the job stats and reports the outcome to the metrics receiver
+func (s *Scheduler) record(job *scheduledJob, result JobResult, start time.Time, appErr *ae.AppError) {
+	duration := time.Since(start)
+	s.mu.Lock()
+	switch result {
+	case JobSkipped:
+		job.stats.Skips++
+		if appErr != nil {
+			job.stats.LastError = appErr
+		}
+	case JobFailed:
+		job.stats.Runs++
+		job.stats.Failures++
+		job.stats.LastRun = start
+		job.stats.LastError = appErr
+	case JobSucceeded:
+		job.stats.Runs++
+		job.stats.LastRun = start
+		job.stats.LastError = nil
+	}
+	s.mu.Unlock()
+	if s.metrics != nil {
+		s.metrics.ObserveJob(job.job.Name, result, duration)
+	}
+}
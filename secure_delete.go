@@ -0,0 +1,372 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// secureDeleteChunk is the size of the zero buffer used to overwrite local files
+const secureDeleteChunk = 1 << 20
+
+// SecureDeleteReport describes what a secure delete did, e.g. to record it in a data destruction log
+type SecureDeleteReport struct {
+	// Overwritten is true when a local copy of the content was overwritten with zeros before it was removed
+	Overwritten bool
+	// VersionsPurged is the number of object versions and delete markers permanently deleted
+	VersionsPurged int
+	// Verified is true once the object, and every version of it on backends keeping versions, was confirmed gone
+	Verified bool
+}
+
+// merge adds the outcome of another secure delete of the same object
+func (r SecureDeleteReport) merge(other SecureDeleteReport) SecureDeleteReport {
+	return SecureDeleteReport{
+		Overwritten:    r.Overwritten || other.Overwritten,
+		VersionsPurged: r.VersionsPurged + other.VersionsPurged,
+		Verified:       r.Verified && other.Verified,
+	}
+}
+
+// ISecureDeleter is implemented by backends and decorators able to destroy an object beyond a plain delete,
+// overwriting local copies or purging every version. A missing object counts as deleted.
+type ISecureDeleter interface {
+	SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError)
+}
+
+// SecureDelete deletes path from backend for data destruction workflows and only succeeds once the object was
+// verified gone. Backends and decorators implementing ISecureDeleter do the work themselves. Transparent decorators,
+// such as retries or caches, are passed through to the layer they wrap, dropping the object from caches afterwards;
+// other decorators, such as DryRunBackend or ImmutableBackend, fail with 501 Not Implemented, since deleting below
+// them would skip their checks. A storage backend not implementing ISecureDeleter is verified by reading the object
+// back. A missing object counts as deleted, a pinned object is refused with 423 Locked.
+func SecureDelete(ctx context.Context, backend IStorageBackend, path string) (SecureDeleteReport, *ae.AppError) {
+	pinned, appErr := IsObjectPinned(ctx, backend, path)
+	if appErr != nil {
+		return SecureDeleteReport{}, appErr
+	}
+	if pinned {
+		return SecureDeleteReport{}, ae.GetAppErr(ctx, fmt.Errorf("object %s is pinned", path), ObjectPinned, http.StatusLocked)
+	}
+	if deleter, ok := backend.(ISecureDeleter); ok {
+		return deleter.SecureDeleteObject(ctx, path)
+	}
+	if wrapper, ok := backend.(transparentDecorator); ok {
+		// a DeleteObject through the decorator would leave a new delete marker on versioned buckets
+		report, appErr := SecureDelete(ctx, wrapper.Unwrap(), path)
+		if invalidator, ok := backend.(cacheInvalidator); ok {
+			invalidator.Invalidate(path)
+		}
+		return report, appErr
+	}
+	if _, ok := backend.(IWrapperBackend); ok {
+		return SecureDeleteReport{}, ae.GetAppErr(ctx, fmt.Errorf("%T does not support secure deletes", backend), SecureDeleteIncomplete, http.StatusNotImplemented)
+	}
+	if appErr := backend.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return SecureDeleteReport{}, appErr.AddErrCode(SecureDeleteIncomplete.Code)
+	}
+	_, appErr = backend.GetObject(ctx, path, WithRange(0, 1))
+	if appErr == nil {
+		return SecureDeleteReport{}, ae.GetAppErr(ctx, fmt.Errorf("%s still exists after delete", path), SecureDeleteIncomplete, http.StatusInternalServerError)
+	}
+	if appErr.GetHTTPCode() != http.StatusNotFound {
+		return SecureDeleteReport{}, appErr.AddErrCode(SecureDeleteIncomplete.Code)
+	}
+	return SecureDeleteReport{Verified: true}, nil
+}
+
+// cacheInvalidator is implemented by caching decorators such as CachedBackend
+type cacheInvalidator interface {
+	Invalidate(path string)
+}
+
+// SecureDeleteBackend is an IStorageBackend decorator running SecureDelete for every DeleteObject, e.g. for a
+// bucket holding personal data that must be destroyed on request
+type SecureDeleteBackend struct {
+	Backend IStorageBackend
+	// OnDeleted, when set, is called with the report of every completed secure delete, e.g. to write an audit log
+	OnDeleted func(ctx context.Context, path string, report SecureDeleteReport)
+}
+
+// NewSecureDeleteBackend creates a new instance of SecureDeleteBackend
+func NewSecureDeleteBackend(backend IStorageBackend) *SecureDeleteBackend {
+	return &SecureDeleteBackend{Backend: backend}
+}
+
+// Unwrap returns the decorated backend
+func (b *SecureDeleteBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports whether deletes are audited
+func (b *SecureDeleteBackend) Describe() map[string]string {
+	return map[string]string{
+		"audited": strconv.FormatBool(b.OnDeleted != nil),
+	}
+}
+
+// GetObject retrieves an object
+func (b *SecureDeleteBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *SecureDeleteBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *SecureDeleteBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object
+func (b *SecureDeleteBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject securely deletes an object, a missing object counts as deleted
+func (b *SecureDeleteBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	_, appErr := b.SecureDeleteObject(ctx, path)
+	return appErr
+}
+
+// CopyObject copies an object
+func (b *SecureDeleteBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// SecureDeleteObject securely deletes an object from the decorated backend and reports it to OnDeleted
+func (b *SecureDeleteBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	report, appErr := SecureDelete(ctx, b.Backend, path)
+	if appErr == nil && b.OnDeleted != nil {
+		b.OnDeleted(ctx, path, report)
+	}
+	return report, appErr
+}
+
+// SecureDeleteObject permanently deletes every version and delete marker of an object in Amazon S3 bucket and
+// verifies none is left. Versions under an object lock retention fail the delete. On providers without version
+// listing the object is deleted and verified gone with a HEAD request.
+func (b *S3Backend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	var report SecureDeleteReport
+	key := objectKey(b.Prefix, path)
+	if b.Compat.NoVersionListing {
+		if appErr := b.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return report, appErr.AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		_, err := b.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(b.Bucket), Key: aws.String(key)})
+		if err == nil {
+			return report, ae.GetAppErr(ctx, fmt.Errorf("%s still exists after delete", path), SecureDeleteIncomplete, http.StatusInternalServerError)
+		}
+		if !isS3NotFoundError(err) {
+			return report, ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError).AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		report.Verified = true
+		return report, nil
+	}
+
+	versionIDs, appErr := b.objectVersionIDs(ctx, key)
+	if appErr != nil {
+		return report, appErr
+	}
+	for _, versionID := range versionIDs {
+		_, err := b.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(b.Bucket),
+			Key:       aws.String(key),
+			VersionId: aws.String(versionID),
+		})
+		if err != nil && !isS3NotFoundError(err) {
+			return report, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to delete version %s", versionID), S3DeleteObject, http.StatusInternalServerError).AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		report.VersionsPurged++
+	}
+	remaining, appErr := b.objectVersionIDs(ctx, key)
+	if appErr != nil {
+		return report, appErr
+	}
+	if len(remaining) > 0 {
+		return report, ae.GetAppErr(ctx, fmt.Errorf("%d versions of %s remain after delete", len(remaining), path), SecureDeleteIncomplete, http.StatusInternalServerError)
+	}
+	report.Verified = true
+	return report, nil
+}
+
+// objectVersionIDs returns the version ids of every version and delete marker of key
+func (b *S3Backend) objectVersionIDs(ctx context.Context, key string) ([]string, *ae.AppError) {
+	var versionIDs []string
+	s3Input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(key),
+	}
+	for {
+		s3Result, err := b.Client.ListObjectVersionsWithContext(ctx, s3Input)
+		if err != nil {
+			return nil, ae.GetAppErr(ctx, err, S3GetObjects, http.StatusInternalServerError).AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		// keys sort after their own prefix, so the versions of key come before those of longer keys
+		otherKeys := false
+		for _, version := range s3Result.Versions {
+			if aws.StringValue(version.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versionIDs = append(versionIDs, aws.StringValue(version.VersionId))
+		}
+		for _, marker := range s3Result.DeleteMarkers {
+			if aws.StringValue(marker.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versionIDs = append(versionIDs, aws.StringValue(marker.VersionId))
+		}
+		if otherKeys || !aws.BoolValue(s3Result.IsTruncated) {
+			return versionIDs, nil
+		}
+		s3Input.KeyMarker = s3Result.NextKeyMarker
+		s3Input.VersionIdMarker = s3Result.NextVersionIdMarker
+	}
+}
+
+// SecureDeleteObject permanently deletes every generation of an object in Google Cloud Storage bucket and
+// verifies none is left. Generations under a retention policy or hold fail the delete.
+func (b GoogleCSBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	var report SecureDeleteReport
+	key := objectKey(b.Prefix, path)
+	generations, appErr := b.objectGenerations(ctx, key)
+	if appErr != nil {
+		return report, appErr
+	}
+	for _, generation := range generations {
+		err := b.Client.Object(key).Generation(generation).Delete(ctx)
+		if err != nil && err.Error() != storage.ErrObjectNotExist.Error() {
+			return report, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to delete generation %d", generation), GCSDeleteObject, http.StatusInternalServerError).AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		report.VersionsPurged++
+	}
+	remaining, appErr := b.objectGenerations(ctx, key)
+	if appErr != nil {
+		return report, appErr
+	}
+	if len(remaining) > 0 {
+		return report, ae.GetAppErr(ctx, fmt.Errorf("%d generations of %s remain after delete", len(remaining), path), SecureDeleteIncomplete, http.StatusInternalServerError)
+	}
+	report.Verified = true
+	return report, nil
+}
+
+// objectGenerations returns every live and noncurrent generation of key
+func (b GoogleCSBackend) objectGenerations(ctx context.Context, key string) ([]int64, *ae.AppError) {
+	var generations []int64
+	it := b.Client.Objects(ctx, &storage.Query{Prefix: key, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return generations, nil
+		}
+		if err != nil {
+			return nil, ae.GetAppErr(ctx, err, GCSGetObjects, http.StatusInternalServerError).AddErrCode(SecureDeleteIncomplete.Code)
+		}
+		// objects are listed by name, so the generations of key come before those of longer names
+		if attrs.Name != key {
+			return generations, nil
+		}
+		generations = append(generations, attrs.Generation)
+	}
+}
+
+// SecureDeleteObject overwrites the cached copy of an object with zeros before removing it and securely deletes
+// the object from the cached backend. Overwriting in place does not reach blocks already remapped by SSDs or
+// copy-on-write filesystems, so keep the cache directory on an encrypted volume where that matters.
+func (b *DiskCacheBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	report, appErr := SecureDelete(ctx, b.Backend, path)
+	// shredded after the backend delete, so that no read racing it caches the object again
+	overwritten, err := b.shred(path)
+	if err != nil && appErr == nil {
+		appErr = ae.GetAppErr(ctx, errors.Wrap(err, "failed to overwrite the cached copy"), SecureDeleteIncomplete, http.StatusInternalServerError)
+	}
+	report.Overwritten = report.Overwritten || overwritten
+	return report, appErr
+}
+
+// shred overwrites and removes the cached files of path, reporting whether there were any
+func (b *DiskCacheBackend) shred(path string) (bool, error) {
+	name := diskCacheName(path)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+	element, ok := b.entries[name]
+	if !ok {
+		return false, nil
+	}
+	err := overwriteFile(filepath.Join(b.Dir, name+diskCacheDataSuffix))
+	if metaErr := overwriteFile(filepath.Join(b.Dir, name+diskCacheMetaSuffix)); err == nil {
+		err = metaErr
+	}
+	b.remove(element)
+	return err == nil, err
+}
+
+// SecureDeleteObject securely deletes an object from the primary and every mirror, whatever the Mode
+func (b *MirrorBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	report, appErr := SecureDelete(ctx, b.Primary, path)
+	if appErr != nil {
+		return report, appErr
+	}
+	for _, mirror := range b.Mirrors {
+		mirrorReport, appErr := SecureDelete(ctx, mirror, path)
+		report = report.merge(mirrorReport)
+		if appErr != nil {
+			return report, appErr.AddErrCode(MirrorWrite.Code)
+		}
+	}
+	return report, nil
+}
+
+// SecureDeleteObject securely deletes an object from both tiers
+func (b *TieredBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	unlock := b.lockPath(path)
+	defer unlock()
+	report, appErr := SecureDelete(ctx, b.Hot, path)
+	if appErr != nil {
+		return report, appErr
+	}
+	b.forget(path)
+	coldReport, appErr := SecureDelete(ctx, b.Cold, path)
+	return report.merge(coldReport), appErr
+}
+
+// overwriteFile overwrites the content of a file with zeros and flushes it to disk, a missing file is ignored
+func overwriteFile(name string) error {
+	file, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, min(info.Size(), secureDeleteChunk))
+	for written := int64(0); written < info.Size(); {
+		n, err := file.Write(zeros[:min(int64(len(zeros)), info.Size()-written)])
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	return file.Sync()
+}
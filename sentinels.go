@@ -0,0 +1,97 @@
+package object_storage
+
+import (
+	"errors"
+	"net/http"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// Sentinel errors classifying failures the same way across backends, matched with errors.Is on the error returned
+// by AsError
+var (
+	// ErrNotFound matches failures for a missing object, version or upload, 404 Not Found
+	ErrNotFound = errors.New("object storage: not found")
+	// ErrAccessDenied matches failures for missing credentials or permissions, 401 Unauthorized and 403 Forbidden
+	ErrAccessDenied = errors.New("object storage: access denied")
+	// ErrPreconditionFailed matches failures of a condition on the object, 412 Precondition Failed, and of writes
+	// conditional on the object not changing meanwhile, reported as 409 Conflict
+	ErrPreconditionFailed = errors.New("object storage: precondition failed")
+	// ErrTooLarge matches failures for an object or part over the limits of the provider or of a buffer, 413
+	// Request Entity Too Large
+	ErrTooLarge = errors.New("object storage: too large")
+	// ErrRateLimited matches failures for throttling by the provider or by a local limit, 429 Too Many Requests;
+	// RetryAfter tells how long to wait
+	ErrRateLimited = errors.New("object storage: rate limited")
+)
+
+// statusSentinels maps HTTP statuses to the sentinel errors they match
+var statusSentinels = map[int]error{
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusUnauthorized:          ErrAccessDenied,
+	http.StatusForbidden:             ErrAccessDenied,
+	http.StatusPreconditionFailed:    ErrPreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+	http.StatusTooManyRequests:       ErrRateLimited,
+}
+
+// Error is an *ae.AppError seen as an error chain, returned by AsError. It matches with errors.Is the sentinel error
+// of its HTTP status and any sentinel the backend wrapped into the provider error, and with errors.As the
+// *ae.AppError and the provider error, e.g. an awserr.Error or a *googleapi.Error.
+type Error struct {
+	AppErr *ae.AppError
+}
+
+// Error returns the message of the provider error
+func (e *Error) Error() string {
+	return e.AppErr.Error()
+}
+
+// Code returns the error code, e.g. ERR_OS_S3_2002
+func (e *Error) Code() string {
+	return e.AppErr.GetErrCode()
+}
+
+// HTTPCode returns the HTTP status of the failure
+func (e *Error) HTTPCode() int {
+	return e.AppErr.GetHTTPCode()
+}
+
+// Unwrap returns the *ae.AppError, the provider error and the sentinel error of the HTTP status
+func (e *Error) Unwrap() []error {
+	errs := []error{e.AppErr}
+	if err := e.AppErr.GetErr(); err != nil {
+		errs = append(errs, err)
+	}
+	if sentinel, ok := statusSentinels[e.AppErr.GetHTTPCode()]; ok {
+		errs = append(errs, sentinel)
+	}
+	return errs
+}
+
+// AsError returns appErr as an error for errors.Is and errors.As, nil when appErr is nil, so that callers test for
+// ErrNotFound and the other sentinel errors instead of HTTP codes or provider error strings. *ae.AppError itself
+// unwraps to nothing, so errors.Is on it does not see the sentinels.
+func AsError(appErr *ae.AppError) error {
+	if appErr == nil {
+		return nil
+	}
+	return &Error{AppErr: appErr}
+}
+
+// sentinelError is a provider error wrapped with the sentinel error it matches, for failures whose HTTP status does
+// not tell the sentinel apart
+type sentinelError struct {
+	error
+	sentinel error
+}
+
+// Unwrap returns the provider error and the sentinel error
+func (e sentinelError) Unwrap() []error {
+	return []error{e.error, e.sentinel}
+}
+
+// withSentinel wraps err so that it matches sentinel
+func withSentinel(err error, sentinel error) error {
+	return sentinelError{error: err, sentinel: sentinel}
+}
@@ -0,0 +1,176 @@
+package object_storage
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const defaultSessionMaxObjectSize = 1 << 20
+
+// sessionContextKey is the context key of the session attached by WithSession
+type sessionContextKey struct{}
+
+// readSession holds the objects written during one session, e.g. one request
+type readSession struct {
+	mu      sync.Mutex
+	objects map[sessionObjectKey]Object
+}
+
+// sessionObjectKey scopes a cached object to the backend it was written through
+type sessionObjectKey struct {
+	backend *SessionCacheBackend
+	path    string
+}
+
+// WithSession returns a context carrying a new, empty read-your-writes session. Objects written through a
+// SessionCacheBackend with this context, or one derived from it, are served from memory when read back with it.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, &readSession{objects: map[sessionObjectKey]Object{}})
+}
+
+// sessionFrom returns the session attached to ctx, nil when there is none
+func sessionFrom(ctx context.Context) *readSession {
+	s, _ := ctx.Value(sessionContextKey{}).(*readSession)
+	return s
+}
+
+// SessionCacheBackend is an IStorageBackend decorator serving objects written in the same session from memory,
+// saving the backend round trip of the common write then render pattern. The cache lives as long as the session
+// context and is never shared between sessions; calls made without a session pass straight through. Listings
+// always go to the backend.
+type SessionCacheBackend struct {
+	Backend IStorageBackend
+	// MaxObjectSize is the largest object cached, bigger writes are read back from the backend
+	MaxObjectSize int64
+}
+
+// NewSessionCacheBackend creates a new instance of SessionCacheBackend caching objects of up to maxObjectSize
+// bytes, 1 MiB when zero
+func NewSessionCacheBackend(backend IStorageBackend, maxObjectSize int64) *SessionCacheBackend {
+	if maxObjectSize <= 0 {
+		maxObjectSize = defaultSessionMaxObjectSize
+	}
+	return &SessionCacheBackend{
+		Backend:       backend,
+		MaxObjectSize: maxObjectSize,
+	}
+}
+
+// Unwrap returns the cached backend
+func (b *SessionCacheBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the size limit of cached objects
+func (b *SessionCacheBackend) Describe() map[string]string {
+	return map[string]string{
+		"maxObjectSize": strconv.FormatInt(b.MaxObjectSize, 10),
+	}
+}
+
+// GetObject retrieves an object from the session when it was written in it, otherwise from the backend. Versioned
+// reads and reads with a customer key always go to the backend.
+func (b *SessionCacheBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	if options.uncached() {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+	if object, ok := b.cached(ctx, path, options); ok {
+		return options.checkConditions(ctx, object, nil)
+	}
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *SessionCacheBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *SessionCacheBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object and keeps it in the session once the backend accepted it
+func (b *SessionCacheBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	s := sessionFrom(ctx)
+	if s != nil {
+		// a failed write leaves the stored object unknown
+		s.remove(b, path)
+	}
+	if appErr := b.Backend.PutObject(ctx, path, content, opts...); appErr != nil {
+		return appErr
+	}
+	options := getPutOptions(opts)
+	if s == nil || int64(len(content)) > b.MaxObjectSize || options.customerKeyed() {
+		return nil
+	}
+	object := cloneObject(Object{
+		Meta:               Metadata{User: options.Metadata},
+		Path:               path,
+		Content:            content,
+		LastModified:       time.Now(),
+		Size:               int64(len(content)),
+		ContentType:        options.ContentType,
+		CacheControl:       options.CacheControl,
+		ContentEncoding:    options.ContentEncoding,
+		ContentDisposition: options.ContentDisposition,
+		ContentLanguage:    options.ContentLanguage,
+		StorageClass:       options.StorageClass,
+	})
+	if options.Encryption != nil {
+		object.Encryption = *options.Encryption
+	}
+	s.mu.Lock()
+	s.objects[sessionObjectKey{backend: b, path: path}] = object
+	s.mu.Unlock()
+	return nil
+}
+
+// DeleteObject removes an object from the backend and the session
+func (b *SessionCacheBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if s := sessionFrom(ctx); s != nil {
+		s.remove(b, path)
+	}
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, the copy is read back from the backend
+func (b *SessionCacheBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if s := sessionFrom(ctx); s != nil {
+		s.remove(b, dstPath)
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// cached returns the object written at path in the session of ctx, with the requested range applied
+func (b *SessionCacheBackend) cached(ctx context.Context, path string, options GetOptions) (Object, bool) {
+	s := sessionFrom(ctx)
+	if s == nil {
+		return Object{}, false
+	}
+	s.mu.Lock()
+	object, ok := s.objects[sessionObjectKey{backend: b, path: path}]
+	s.mu.Unlock()
+	if !ok {
+		return Object{}, false
+	}
+	if options.Range != nil {
+		// out of range reads go to the backend so they fail the way it reports them
+		if object, ok = rangeObject(object, *options.Range); !ok {
+			return Object{}, false
+		}
+	}
+	return cloneObject(object), true
+}
+
+// remove drops the object written at path through backend from the session
+func (s *readSession) remove(backend *SessionCacheBackend, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, sessionObjectKey{backend: backend, path: path})
+}
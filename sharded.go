@@ -0,0 +1,285 @@
+package object_storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+const defaultShardVirtualNodes = 128
+
+// Shard is one backend of a ShardedBackend. Its name, not its position, places it on the hash ring, so shards can
+// be listed in any order but must keep their names for existing keys to keep resolving to them.
+type Shard struct {
+	Name    string
+	Backend IStorageBackend
+}
+
+// ShardOption configures a ShardedBackend
+type ShardOption func(*ShardedBackend)
+
+// WithVirtualNodes sets the number of points each shard has on the hash ring, more points spread keys more evenly
+func WithVirtualNodes(n int) ShardOption {
+	return func(b *ShardedBackend) {
+		b.VirtualNodes = n
+	}
+}
+
+// shardRingPoint is a point of the hash ring owned by the shard at index shard
+type shardRingPoint struct {
+	hash  uint64
+	shard int
+}
+
+// shardedCursor is the position of a listing across shards
+type shardedCursor struct {
+	// After is the last path returned
+	After string `json:"after,omitempty"`
+	// Shards holds, by shard name, the cursor of the page holding the next objects of each shard
+	Shards map[string]string `json:"shards,omitempty"`
+}
+
+// ShardedBackend is an IStorageBackend spreading objects over several backends, e.g. buckets, to stay below the
+// request rate limits of a single bucket. Every path is placed on a consistent hash ring, so adding a shard only
+// moves the keys the new shard takes over and the keys of the existing shards keep resolving to them; moving those
+// keys is left to the caller, ShardFor tells where a key belongs. Create it with NewShardedBackend.
+type ShardedBackend struct {
+	VirtualNodes int
+
+	shards []Shard
+	ring   []shardRingPoint
+}
+
+// NewShardedBackend creates a new instance of ShardedBackend spreading objects over shards, which need unique,
+// non-empty names
+func NewShardedBackend(shards []Shard, opts ...ShardOption) (*ShardedBackend, *ae.AppError) {
+	ctx := context.Background()
+	if len(shards) == 0 {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("at least one shard is required"), ShardedConfig, http.StatusInternalServerError)
+	}
+	b := &ShardedBackend{
+		VirtualNodes: defaultShardVirtualNodes,
+		shards:       slices.Clone(shards),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.VirtualNodes <= 0 {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("virtual nodes must be positive"), ShardedConfig, http.StatusInternalServerError)
+	}
+	slices.SortFunc(b.shards, func(x, y Shard) int { return cmp.Compare(x.Name, y.Name) })
+	for i, shard := range b.shards {
+		if shard.Name == "" || shard.Backend == nil {
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("shard %d needs a name and a backend", i), ShardedConfig, http.StatusInternalServerError)
+		}
+		if i > 0 && b.shards[i-1].Name == shard.Name {
+			return nil, ae.GetAppErr(ctx, fmt.Errorf("shard name %s is used twice", shard.Name), ShardedConfig, http.StatusInternalServerError)
+		}
+		for node := 0; node < b.VirtualNodes; node++ {
+			b.ring = append(b.ring, shardRingPoint{hash: shardHash(shard.Name + "#" + strconv.Itoa(node)), shard: i})
+		}
+	}
+	slices.SortFunc(b.ring, func(x, y shardRingPoint) int { return cmp.Compare(x.hash, y.hash) })
+	return b, nil
+}
+
+// ShardFor returns the shard holding path
+func (b *ShardedBackend) ShardFor(path string) Shard {
+	hash := shardHash(path)
+	i := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= hash })
+	if i == len(b.ring) {
+		i = 0
+	}
+	return b.shards[b.ring[i].shard]
+}
+
+// Shards returns the shards, ordered by name
+func (b *ShardedBackend) Shards() []Shard {
+	return slices.Clone(b.shards)
+}
+
+// Describe reports the shard names and the chain of every shard
+func (b *ShardedBackend) Describe() map[string]string {
+	names := make([]string, len(b.shards))
+	description := map[string]string{
+		"virtualNodes": strconv.Itoa(b.VirtualNodes),
+	}
+	for i, shard := range b.shards {
+		names[i] = shard.Name
+		description["shard."+shard.Name] = DescribeBackend(shard.Backend).String()
+	}
+	description["shards"] = strings.Join(names, ",")
+	return description
+}
+
+// GetObject retrieves an object from its shard
+func (b *ShardedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.ShardFor(path).Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects of every shard at the given prefix
+func (b *ShardedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists the objects of every shard at the given prefix, merged in path order. Each call lists a page
+// of every shard, so a paginated listing costs a request per shard and page. Listings of object versions are not
+// supported across shards.
+func (b *ShardedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	if options.Versions != VersionsCurrent {
+		return result, ae.GetAppErr(ctx, fmt.Errorf("version listings are not supported across shards"), ShardedListObjects, http.StatusNotImplemented)
+	}
+	cursor, err := parseShardedCursor(options.Cursor)
+	if err != nil {
+		return result, ae.GetAppErr(ctx, err, ShardedListObjects, http.StatusBadRequest)
+	}
+	if options.Cursor == "" {
+		cursor.After = options.StartAfter
+	}
+
+	pages := make([]*ListResult, len(b.shards))
+	done := make([]bool, len(b.shards))
+	for {
+		for i, shard := range b.shards {
+			if pages[i] != nil || done[i] {
+				continue
+			}
+			// shards not listed yet start after the last path returned
+			page, appErr := shard.Backend.ListObjects(ctx, prefix, WithMaxKeys(options.MaxKeys), WithCursor(cursor.Shards[shard.Name]),
+				WithStartAfter(cursor.After), WithHydratedMetadata(options.Hydrate), withFiltersOf(options))
+			result.Scanned += page.Scanned
+			if appErr != nil {
+				result.Truncated = true
+				result.NextCursor = cursor.String()
+				return result, appErr.AddErrCode(ShardedListObjects.Code)
+			}
+			pages[i] = &page
+		}
+
+		// objects past the last object of a truncated page may come after objects of that shard's next page
+		bound, bounded := "", false
+		for _, page := range pages {
+			if page == nil || !page.Truncated {
+				continue
+			}
+			last := cursor.After
+			if len(page.Objects) > 0 {
+				last = page.Objects[len(page.Objects)-1].Path
+			}
+			if !bounded || last < bound {
+				bound, bounded = last, true
+			}
+		}
+		var pending []Object
+		for _, page := range pages {
+			if page == nil {
+				continue
+			}
+			for _, object := range page.Objects {
+				if object.Path > cursor.After && (!bounded || object.Path <= bound) {
+					pending = append(pending, object)
+				}
+			}
+		}
+		slices.SortFunc(pending, func(x, y Object) int { return cmp.Compare(x.Path, y.Path) })
+		if options.MaxKeys > 0 && len(result.Objects)+len(pending) > options.MaxKeys {
+			pending = pending[:options.MaxKeys-len(result.Objects)]
+		}
+		result.Objects = append(result.Objects, pending...)
+		if len(pending) > 0 {
+			cursor.After = pending[len(pending)-1].Path
+		}
+
+		// move on to the next page of every shard whose page was returned in full
+		finished := true
+		for i, page := range pages {
+			if page == nil {
+				continue
+			}
+			if len(page.Objects) == 0 || page.Objects[len(page.Objects)-1].Path <= cursor.After {
+				pages[i] = nil
+				if page.Truncated {
+					cursor.Shards[b.shards[i].Name] = page.NextCursor
+				} else {
+					done[i] = true
+				}
+			}
+			finished = finished && done[i]
+		}
+		if finished {
+			return result, nil
+		}
+		if options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = cursor.String()
+			return result, nil
+		}
+	}
+}
+
+// PutObject uploads an object to its shard
+func (b *ShardedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.ShardFor(path).Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object from its shard
+func (b *ShardedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.ShardFor(path).Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object, within a shard when both paths resolve to it and otherwise by reading it from one
+// shard and writing it with all its attributes to the other
+func (b *ShardedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return CopyObjectBetween(ctx, b.ShardFor(srcPath).Backend, srcPath, b.ShardFor(dstPath).Backend, dstPath, PreserveAll())
+}
+
+// SecureDeleteObject securely deletes an object from its shard
+func (b *ShardedBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	return SecureDelete(ctx, b.ShardFor(path).Backend, path)
+}
+
+// String encodes the cursor for ListResult.NextCursor
+func (c shardedCursor) String() string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// parseShardedCursor decodes a cursor returned by ShardedBackend.ListObjects, an empty cursor starts the listing
+func parseShardedCursor(cursor string) (shardedCursor, error) {
+	parsed := shardedCursor{Shards: map[string]string{}}
+	if cursor == "" {
+		return parsed, nil
+	}
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(content, &parsed)
+	}
+	if err != nil {
+		return parsed, errors.Wrap(err, "invalid cursor")
+	}
+	if parsed.Shards == nil {
+		parsed.Shards = map[string]string{}
+	}
+	return parsed, nil
+}
+
+// shardHash places a key on the hash ring
+func shardHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
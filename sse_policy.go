@@ -0,0 +1,127 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// SSEPolicy lists the server side encryption settings accepted by SSEPolicyBackend
+type SSEPolicy struct {
+	// ApprovedKMSKeys are the S3 KMS key ARNs or GCS CMEK key names objects may be encrypted with
+	ApprovedKMSKeys []string
+	// AllowProviderManaged accepts encryption with provider owned keys (S3 SSE-S3, GCS default encryption)
+	AllowProviderManaged bool
+	// AllowCustomerKeys accepts encryption with customer supplied keys (S3 SSE-C, GCS customer-supplied keys)
+	AllowCustomerKeys bool
+}
+
+// SSEPolicyBackend is an IStorageBackend decorator which guarantees that nothing unencrypted lands in, or is
+// served from, the wrapped backend. PutObject is rejected unless it carries an approved encryption option and
+// GetObject fails when the stored object is not encrypted with an approved key.
+type SSEPolicyBackend struct {
+	Backend IStorageBackend
+	Policy  SSEPolicy
+}
+
+// NewSSEPolicyBackend creates a new instance of SSEPolicyBackend enforcing policy on backend
+func NewSSEPolicyBackend(backend IStorageBackend, policy SSEPolicy) (*SSEPolicyBackend, *ae.AppError) {
+	if len(policy.ApprovedKMSKeys) == 0 && !policy.AllowProviderManaged && !policy.AllowCustomerKeys {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("policy approves no encryption option"), SSEPolicyConfig, http.StatusInternalServerError)
+	}
+	return &SSEPolicyBackend{
+		Backend: backend,
+		Policy:  policy,
+	}, nil
+}
+
+// Approves reports whether the given encryption satisfies the policy
+func (p SSEPolicy) Approves(encryption Encryption) bool {
+	switch encryption.Type {
+	case EncryptionProviderManaged:
+		return p.AllowProviderManaged
+	case EncryptionCustomerKey:
+		return p.AllowCustomerKeys
+	case EncryptionKMS:
+		for _, key := range p.ApprovedKMSKeys {
+			// GCS reports the key version in use, e.g. <key name>/cryptoKeyVersions/1
+			if encryption.KMSKeyID == key || strings.HasPrefix(encryption.KMSKeyID, key+"/cryptoKeyVersions/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unwrap returns the backend the policy is enforced on
+func (b *SSEPolicyBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the approved encryption settings
+func (b *SSEPolicyBackend) Describe() map[string]string {
+	return map[string]string{
+		"approvedKMSKeys":      strings.Join(b.Policy.ApprovedKMSKeys, ","),
+		"allowProviderManaged": strconv.FormatBool(b.Policy.AllowProviderManaged),
+		"allowCustomerKeys":    strconv.FormatBool(b.Policy.AllowCustomerKeys),
+	}
+}
+
+// GetObject retrieves an object, failing when it is not encrypted with an approved key
+func (b *SSEPolicyBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	if appErr != nil {
+		return object, appErr
+	}
+	if !b.Policy.Approves(object.Encryption) {
+		err := fmt.Errorf("object %s has encryption %q with key %q", path, object.Encryption.Type, object.Encryption.KMSKeyID)
+		return Object{Path: path}, ae.GetAppErr(ctx, err, SSEReadRejected, http.StatusForbidden)
+	}
+	return object, nil
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *SSEPolicyBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	return b.Backend.GetObjects(ctx, prefix)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *SSEPolicyBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	return b.Backend.ListObjects(ctx, prefix, opts...)
+}
+
+// PutObject uploads an object, rejecting it unless an approved encryption option is given
+func (b *SSEPolicyBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	options := getPutOptions(opts)
+	if options.Encryption == nil || !b.Policy.Approves(*options.Encryption) {
+		return ae.GetAppErr(ctx, fmt.Errorf("put of %s carries no approved encryption option", path), SSEPutRejected, http.StatusForbidden)
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object
+func (b *SSEPolicyBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject copies an object. A provider side copy may fall back to the bucket default encryption, so the
+// encryption of the source is verified and the copy made with it explicitly, on the provider side on S3 and GCS and
+// otherwise read and written back with its attributes, see CopyObjectEncrypted.
+func (b *SSEPolicyBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	object, appErr := StatObject(ctx, b.Backend, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	if !b.Policy.Approves(object.Encryption) {
+		err := fmt.Errorf("object %s has encryption %q with key %q", srcPath, object.Encryption.Type, object.Encryption.KMSKeyID)
+		return ae.GetAppErr(ctx, err, SSEReadRejected, http.StatusForbidden)
+	}
+	encryption := object.Encryption
+	// GCS objects report the key version they were encrypted with, writes take the key itself
+	encryption.KMSKeyID, _, _ = strings.Cut(encryption.KMSKeyID, "/cryptoKeyVersions/")
+	return CopyObjectEncrypted(ctx, b.Backend, srcPath, dstPath, nil, encryption)
+}
@@ -0,0 +1,31 @@
+package object_storage
+
+import (
+	"context"
+	"net/http"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// IObjectStatter is implemented by backends able to read the attributes of an object without its content
+type IObjectStatter interface {
+	StatObject(ctx context.Context, path string) (Object, *ae.AppError)
+}
+
+// StatObject returns the attributes of the object at path of backend without its content: size, ETag, content
+// type, storage class, version and last modification time. Backends implementing IObjectStatter read them with a
+// HEAD request, on S3 and COS, or the object attributes, on GCS. Other backends, and decorators as they may change
+// the attributes or hide objects, are read with a one byte ranged read. A missing object fails with
+// StatusNotFound.
+func StatObject(ctx context.Context, backend IStorageBackend, path string) (Object, *ae.AppError) {
+	if statter, ok := backend.(IObjectStatter); ok {
+		return statter.StatObject(ctx, path)
+	}
+	object, appErr := backend.GetObject(ctx, path, WithRange(0, 1))
+	if appErr != nil && appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+		// providers refuse ranged reads of empty objects
+		object, appErr = backend.GetObject(ctx, path)
+	}
+	object.Content = nil
+	return object, appErr
+}
@@ -0,0 +1,69 @@
+package object_storage
+
+import "context"
+
+// IStdStorageBackend is IStorageBackend with methods returning plain errors, for code bases handling errors the
+// standard way. Errors are those of AsError, matching the sentinel errors with errors.Is.
+type IStdStorageBackend interface {
+	// GetObject retrieves a single object from the storage bucket
+	GetObject(ctx context.Context, path string, opts ...GetOption) (Object, error)
+	// GetObjects lists all objects at the given prefix
+	GetObjects(ctx context.Context, prefix string) ([]Object, error)
+	// ListObjects lists objects at the given prefix, reporting truncation and a cursor to resume from
+	ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, error)
+	// PutObject uploads an object to the storage bucket
+	PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) error
+	// DeleteObject removes an object from the storage bucket
+	DeleteObject(ctx context.Context, path string) error
+	// CopyObject copies an object from source path to destination path
+	CopyObject(ctx context.Context, srcPath, dstPath string) error
+}
+
+// StdBackend adapts an IStorageBackend, a storage backend or a composed one, to IStdStorageBackend, so that callers
+// never see *ae.AppError. The error code and HTTP code stay reachable through errors.As with *Error.
+type StdBackend struct {
+	Backend IStorageBackend
+}
+
+// NewStdBackend creates a new instance of StdBackend
+func NewStdBackend(backend IStorageBackend) *StdBackend {
+	return &StdBackend{Backend: backend}
+}
+
+// Unwrap returns the adapted backend, e.g. to call the package functions taking an IStorageBackend
+func (b *StdBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// GetObject retrieves an object
+func (b *StdBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, error) {
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	return object, AsError(appErr)
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *StdBackend) GetObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	return objects, AsError(appErr)
+}
+
+// ListObjects lists objects at the given prefix
+func (b *StdBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, error) {
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	return result, AsError(appErr)
+}
+
+// PutObject uploads an object
+func (b *StdBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) error {
+	return AsError(b.Backend.PutObject(ctx, path, content, opts...))
+}
+
+// DeleteObject removes an object
+func (b *StdBackend) DeleteObject(ctx context.Context, path string) error {
+	return AsError(b.Backend.DeleteObject(ctx, path))
+}
+
+// CopyObject copies an object
+func (b *StdBackend) CopyObject(ctx context.Context, srcPath, dstPath string) error {
+	return AsError(b.Backend.CopyObject(ctx, srcPath, dstPath))
+}
@@ -13,23 +13,59 @@ type Object struct {
 	Path         string
 	Content      []byte
 	LastModified time.Time
+	Encryption   Encryption
+	// Size is the size of the whole stored object, which differs from len(Content) for ranged reads and listings
+	Size int64
+	// VersionID is the S3 version id or GCS generation, set by GetObject, StatObject, GCS listings and version aware
+	// listings
+	VersionID string
+	// IsLatest is false for noncurrent versions returned by version aware listings
+	IsLatest bool
+	// IsDeleteMarker is true for S3 delete markers returned by version aware listings
+	IsDeleteMarker bool
+	// ContentType and CacheControl are the stored content headers of the object, set by GetObject and hydrated
+	// listings
+	ContentType  string
+	CacheControl string
+	// ContentEncoding, ContentDisposition and ContentLanguage are the other stored content headers, set alike
+	ContentEncoding    string
+	ContentDisposition string
+	ContentLanguage    string
+	// StorageClass is set by GetObject and by listings of the providers reporting it
+	StorageClass string
+	// ETag is the entity tag reported by the provider, without quotes, set by GetObject and listings
+	ETag string
+	// CRC32C is the hex CRC32C checksum of the whole content, set by GCS reads and listings and by S3 reads of
+	// objects uploaded with a CRC32C checksum
+	CRC32C string
+	// Retention is the object lock retention of the object, LegalHold its legal hold or GCS temporary hold, set by
+	// S3 and GCS reads
+	Retention Retention
+	LegalHold bool
 }
 
 // Metadata contains additional information about the object
 type Metadata struct {
 	Name    string
 	Version string
+	// User is the user metadata stored with the object, keys in lower case on S3 and COS, set by GetObject,
+	// StatObject and hydrated listings
+	User map[string]string
+	// Tags are the object tags, set by hydrated listings of backends implementing IObjectTagger
+	Tags map[string]string
 }
 
 // IStorageBackend defines the interface for storage backend implementations
-// Both S3Backend and GoogleCSBackend implement this interface
+// S3Backend, GoogleCSBackend, COSBackend, HDFSBackend and RedisBackend implement this interface
 type IStorageBackend interface {
 	// GetObject retrieves a single object from the storage bucket
-	GetObject(ctx context.Context, path string) (Object, *ae.AppError)
+	GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError)
 	// GetObjects lists all objects at the given prefix
 	GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError)
+	// ListObjects lists objects at the given prefix, reporting truncation and a cursor to resume from
+	ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError)
 	// PutObject uploads an object to the storage bucket
-	PutObject(ctx context.Context, path string, content []byte) *ae.AppError
+	PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError
 	// DeleteObject removes an object from the storage bucket
 	DeleteObject(ctx context.Context, path string) *ae.AppError
 	// CopyObject copies an object from source path to destination path
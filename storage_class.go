@@ -0,0 +1,246 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	// s3MaxCopySize is the largest object a single S3 copy request accepts, larger objects are copied in parts
+	s3MaxCopySize = 5 << 30
+	// s3CopyPartSize is the size of the parts of a multipart copy
+	s3CopyPartSize = 512 << 20
+)
+
+// Storage class names of S3 and GCS, for WithStorageClass and SetStorageClass. Other S3 compatible providers and COS
+// have their own names.
+const (
+	StorageClassStandard           = "STANDARD"
+	StorageClassStandardIA         = "STANDARD_IA"
+	StorageClassOneZoneIA          = "ONEZONE_IA"
+	StorageClassIntelligentTiering = "INTELLIGENT_TIERING"
+	StorageClassGlacierIR          = "GLACIER_IR"
+	StorageClassGlacier            = "GLACIER"
+	StorageClassDeepArchive        = "DEEP_ARCHIVE"
+	StorageClassNearline           = "NEARLINE"
+	StorageClassColdline           = "COLDLINE"
+	StorageClassArchive            = "ARCHIVE"
+)
+
+// IStorageClassSetter is implemented by backends able to change the storage class of an object in place
+type IStorageClassSetter interface {
+	SetStorageClass(ctx context.Context, path string, class string) *ae.AppError
+}
+
+// SetStorageClass moves the object at path of backend to another storage class, e.g. to archive data no longer
+// read, keeping its content and attributes. S3 and GCS, implementing IStorageClassSetter, rewrite the object on the
+// provider side, failing with 409 Conflict when it changes meanwhile; S3 objects in GLACIER or DEEP_ARCHIVE must be
+// restored first. Other backends, and decorators, get the object read and written back with the new class, which
+// fails with 501 Not Implemented on backends without storage classes.
+func SetStorageClass(ctx context.Context, backend IStorageBackend, path string, class string) *ae.AppError {
+	if class == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("storage class is required"), StorageClassInvalid, http.StatusBadRequest)
+	}
+	if setter, ok := backend.(IStorageClassSetter); ok {
+		return setter.SetStorageClass(ctx, path, class)
+	}
+	object, appErr := backend.GetObject(ctx, path)
+	if appErr != nil {
+		return appErr.AddErrCode(StorageClassTransition.Code)
+	}
+	preserve := PreserveAll()
+	preserve.StorageClass = false
+	opts, appErr := preservedPutOptions(ctx, backend, path, object, preserve)
+	if appErr != nil {
+		return appErr.AddErrCode(StorageClassTransition.Code)
+	}
+	return backend.PutObject(ctx, path, object.Content, append(opts, WithStorageClass(class))...)
+}
+
+// SetStorageClass moves an object in Amazon S3 bucket to another storage class by copying it onto itself, in parts
+// for objects larger than 5 GiB. Attributes, tags and encryption are kept.
+func (b *S3Backend) SetStorageClass(ctx context.Context, path string, class string) *ae.AppError {
+	if class == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("storage class is required"), StorageClassInvalid, http.StatusBadRequest)
+	}
+	current, appErr := b.StatObject(ctx, path)
+	if appErr != nil {
+		return appErr.AddErrCode(StorageClassTransition.Code)
+	}
+	// S3 reports no storage class for STANDARD objects
+	if current.StorageClass == class || (current.StorageClass == "" && class == StorageClassStandard) {
+		return nil
+	}
+	updated := current
+	updated.StorageClass = class
+	return b.rewriteInPlace(ctx, path, current, updated, StorageClassTransition)
+}
+
+// rewriteInPlace copies the object at path, as current was stated, onto itself with the stored attributes of
+// updated, in parts for objects larger than 5 GiB. The copy fails when the object changed since it was stated;
+// tags and encryption are kept. Errors are reported with customErr.
+func (b *S3Backend) rewriteInPlace(ctx context.Context, path string, current Object, updated Object, customErr *ae.CustomErr) *ae.AppError {
+	key := objectKey(b.Prefix, path)
+	etag := `"` + current.ETag + `"`
+	var tags map[string]string
+	if current.Size > s3MaxCopySize {
+		// copies in parts do not carry the tags over, the upload sets them
+		var appErr *ae.AppError
+		tags, appErr = b.GetObjectTags(ctx, path)
+		if appErr != nil && appErr.GetHTTPCode() != http.StatusNotImplemented {
+			return appErr.AddErrCode(customErr.Code)
+		}
+	}
+	opts := attributePutOptions(updated, tags, PreserveAll())
+	if updated.Encryption.Type != EncryptionNone {
+		opts = append(opts, WithEncryption(updated.Encryption))
+	}
+	upload, appErr := b.uploadInput(ctx, path, nil, getPutOptions(opts))
+	if appErr != nil {
+		return appErr.AddErrCode(customErr.Code)
+	}
+	if current.Size <= s3MaxCopySize {
+		_, err := b.Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:               upload.Bucket,
+			Key:                  upload.Key,
+			CopySource:           aws.String(url.PathEscape(b.Bucket + "/" + key)),
+			CopySourceIfMatch:    aws.String(etag),
+			MetadataDirective:    aws.String(s3.MetadataDirectiveReplace),
+			ContentType:          upload.ContentType,
+			CacheControl:         upload.CacheControl,
+			ContentEncoding:      upload.ContentEncoding,
+			ContentDisposition:   upload.ContentDisposition,
+			ContentLanguage:      upload.ContentLanguage,
+			Metadata:             upload.Metadata,
+			StorageClass:         upload.StorageClass,
+			ServerSideEncryption: upload.ServerSideEncryption,
+			SSEKMSKeyId:          upload.SSEKMSKeyId,
+		})
+		if err != nil {
+			return s3RewriteErr(ctx, err, customErr)
+		}
+		return nil
+	}
+
+	created, err := b.Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               upload.Bucket,
+		Key:                  upload.Key,
+		ContentType:          upload.ContentType,
+		CacheControl:         upload.CacheControl,
+		ContentEncoding:      upload.ContentEncoding,
+		ContentDisposition:   upload.ContentDisposition,
+		ContentLanguage:      upload.ContentLanguage,
+		Metadata:             upload.Metadata,
+		Tagging:              upload.Tagging,
+		StorageClass:         upload.StorageClass,
+		ServerSideEncryption: upload.ServerSideEncryption,
+		SSEKMSKeyId:          upload.SSEKMSKeyId,
+	})
+	if err != nil {
+		return s3RewriteErr(ctx, err, customErr)
+	}
+	uploadID := aws.StringValue(created.UploadId)
+	if err := b.copyParts(ctx, b.Bucket, key, key, uploadID, etag, current.Size, nil); err != nil {
+		_, _ = b.Client.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   upload.Bucket,
+			Key:      upload.Key,
+			UploadId: aws.String(uploadID),
+		})
+		return s3RewriteErr(ctx, err, customErr)
+	}
+	return nil
+}
+
+// copyParts completes a multipart upload to dstKey from a copy of the object at srcKey of srcBucket, matching etag,
+// in parts. progress, when set, is called with the bytes copied after every part.
+func (b *S3Backend) copyParts(ctx context.Context, srcBucket string, srcKey string, dstKey string, uploadID string, etag string, size int64, progress func(copied int64)) error {
+	var parts []*s3.CompletedPart
+	for offset, partNumber := int64(0), int64(1); offset < size; offset, partNumber = offset+s3CopyPartSize, partNumber+1 {
+		end := min(offset+s3CopyPartSize, size) - 1
+		copied, err := b.Client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(b.Bucket),
+			Key:               aws.String(dstKey),
+			UploadId:          aws.String(uploadID),
+			PartNumber:        aws.Int64(partNumber),
+			CopySource:        aws.String(url.PathEscape(srcBucket + "/" + srcKey)),
+			CopySourceIfMatch: aws.String(etag),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{PartNumber: aws.Int64(partNumber), ETag: copied.CopyPartResult.ETag})
+		if progress != nil {
+			progress(end + 1)
+		}
+	}
+	_, err := b.Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.Bucket),
+		Key:             aws.String(dstKey),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+// s3RewriteErr maps an S3 error of an in place rewrite, a changed or archived object is reported as 409
+func s3RewriteErr(ctx context.Context, err error, customErr *ae.CustomErr) *ae.AppError {
+	appErr := ae.GetAppErr(ctx, err, customErr, http.StatusInternalServerError)
+	switch {
+	case isS3PreconditionError(err):
+		appErr.SetErr(withSentinel(err, ErrPreconditionFailed))
+		appErr = appErr.SetHTTPCode(http.StatusConflict)
+	case contains(err.Error(), "InvalidObjectState"):
+		appErr = appErr.SetHTTPCode(http.StatusConflict)
+	case contains(err.Error(), "InvalidStorageClass"):
+		appErr = appErr.SetHTTPCode(http.StatusBadRequest)
+	case isS3NotFoundError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotFound)
+	case isS3NotImplementedError(err):
+		appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+	case isS3ThrottlingError(err):
+		appErr = throttled(appErr, defaultThrottleRetryAfter)
+	}
+	return appErr
+}
+
+// SetStorageClass moves an object in Google Cloud Storage bucket to another storage class by rewriting it onto
+// itself, conditional on its generation. Metadata and content headers are copied by GCS.
+func (b GoogleCSBackend) SetStorageClass(ctx context.Context, path string, class string) *ae.AppError {
+	if class == "" {
+		return ae.GetAppErr(ctx, fmt.Errorf("storage class is required"), StorageClassInvalid, http.StatusBadRequest)
+	}
+	object := b.Client.Object(objectKey(b.Prefix, path))
+	attrs, err := object.Attrs(ctx)
+	if err == nil && attrs.StorageClass == class {
+		return nil
+	}
+	if err == nil {
+		copier := object.If(storage.Conditions{GenerationMatch: attrs.Generation}).CopierFrom(object.Generation(attrs.Generation))
+		copier.StorageClass = class
+		// objects report the key version they were encrypted with, rewrites take the key itself
+		copier.DestinationKMSKeyName, _, _ = strings.Cut(attrs.KMSKeyName, "/cryptoKeyVersions/")
+		_, err = copier.Run(ctx)
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, StorageClassTransition, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if gcsPreconditionFailed(err) {
+			appErr.SetErr(withSentinel(err, ErrPreconditionFailed))
+			appErr = appErr.SetHTTPCode(http.StatusConflict)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr
+	}
+	return nil
+}
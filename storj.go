@@ -0,0 +1,280 @@
+//go:build storj
+
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"storj.io/uplink"
+)
+
+// custom metadata keys the content headers of an object are stored under, as the Storj S3 gateway stores them
+const (
+	storjContentType        = "content-type"
+	storjCacheControl       = "cache-control"
+	storjContentEncoding    = "content-encoding"
+	storjContentDisposition = "content-disposition"
+	storjContentLanguage    = "content-language"
+)
+
+// StorjBackend is a storage backend for a bucket on the Storj decentralized network, talking to the satellite and
+// the storage nodes through the uplink library. Objects are encrypted in process with the encryption key of the
+// access grant, which is never sent anywhere.
+type StorjBackend struct {
+	Project *uplink.Project
+	Bucket  string
+	Prefix  string
+}
+
+// NewStorjBackend creates a new instance of StorjBackend for bucket from a serialized access grant, e.g. one
+// created with `uplink share`. Close the backend to release the connections of its project.
+func NewStorjBackend(ctx context.Context, accessGrant string, bucket string, prefix string) (*StorjBackend, *ae.AppError) {
+	if accessGrant == "" || bucket == "" {
+		return nil, ae.GetAppErr(ctx, fmt.Errorf("access grant and bucket are required"), StorjAccessGrant, http.StatusInternalServerError)
+	}
+	access, err := uplink.ParseAccess(accessGrant)
+	if err != nil {
+		// the error never echoes the grant
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "invalid storj access grant"), StorjAccessGrant, http.StatusInternalServerError)
+	}
+	project, err := uplink.OpenProject(ctx, access)
+	if err != nil {
+		return nil, ae.GetAppErr(ctx, errors.Wrap(err, "failed to open the storj project"), StorjAccessGrant, http.StatusInternalServerError)
+	}
+	return &StorjBackend{
+		Project: project,
+		Bucket:  bucket,
+		Prefix:  cleanPrefix(prefix),
+	}, nil
+}
+
+// Close closes the project of the backend
+func (b *StorjBackend) Close() error {
+	return b.Project.Close()
+}
+
+// Describe reports the bucket and prefix the backend is bound to
+func (b *StorjBackend) Describe() map[string]string {
+	return map[string]string{
+		"provider": "storj",
+		"bucket":   b.Bucket,
+		"prefix":   b.Prefix,
+	}
+}
+
+// GetObject downloads an object from Storj bucket, at prefix
+func (b *StorjBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	options := getGetOptions(opts)
+	if options.versioned() {
+		return Object{Path: path}, ae.GetAppErr(ctx, fmt.Errorf("storj does not keep object versions"), StorjGetObject, http.StatusNotImplemented)
+	}
+
+	var downloadOptions *uplink.DownloadOptions
+	if options.Range != nil {
+		// a negative length reads to the end of the object, a negative offset reads the suffix
+		downloadOptions = &uplink.DownloadOptions{Offset: options.Range.Offset, Length: -1}
+		if options.Range.Length > 0 && options.Range.Offset >= 0 {
+			downloadOptions.Length = options.Range.Length
+		}
+	}
+	download, err := b.Project.DownloadObject(ctx, b.Bucket, objectKey(b.Prefix, path), downloadOptions)
+	if err != nil {
+		return Object{Path: path}, storjErr(ctx, err, StorjGetObject)
+	}
+	defer download.Close()
+
+	object := storjObject(path, download.Info())
+	if options.unchanged(object) {
+		return Object{Path: path}, notModifiedErr(ctx, path)
+	}
+	object.Content, err = io.ReadAll(download)
+	if err != nil {
+		return Object{Path: path}, storjErr(ctx, errors.Wrap(err, "failed to read from reader stream"), StorjGetObject)
+	}
+	return object, nil
+}
+
+// GetObjects lists all objects in Storj bucket, at prefix
+func (b *StorjBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects in Storj bucket at the given prefix, honouring MaxKeys and cursor options. Objects are
+// listed in the order of the satellite, which for buckets with encrypted paths is not the order of their keys.
+func (b *StorjBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	var result ListResult
+	options := getListOptions(opts)
+	fullPrefix := listPrefix(b.Prefix, prefix)
+	options.Cursor = options.startCursor(fullPrefix)
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	if options.Versions != VersionsCurrent {
+		return result, ae.GetAppErr(ctx, fmt.Errorf("storj does not keep object versions"), StorjGetObjects, http.StatusNotImplemented)
+	}
+
+	// uplink only lists below a folder, so the folder holding the prefix is listed and filtered
+	folder := fullPrefix[:strings.LastIndex(fullPrefix, "/")+1]
+	iterator := b.Project.ListObjects(ctx, b.Bucket, &uplink.ListObjectsOptions{
+		Prefix:    folder,
+		Cursor:    strings.TrimPrefix(options.Cursor, folder),
+		Recursive: true,
+		System:    true,
+	})
+	lastKey := ""
+	for iterator.Next() {
+		item := iterator.Item()
+		result.Scanned++
+		lastKey = item.Key
+		if item.IsPrefix || !strings.HasPrefix(item.Key, fullPrefix) {
+			continue
+		}
+		object := storjObject(removePrefixFromObjectPath(fullPrefix, item.Key), item)
+		if !options.matches(object) {
+			continue
+		}
+		result.Objects = append(result.Objects, object)
+		if options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = item.Key
+			break
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		result.interrupted(lastKey, options)
+		return result, storjErr(ctx, err, StorjGetObjects)
+	}
+	return result, nil
+}
+
+// PutObject uploads an object to Storj bucket, at prefix. Content headers and user metadata are stored as custom
+// metadata, encrypted along with the content.
+func (b *StorjBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	options := getPutOptions(opts)
+	if options.Encryption != nil && options.Encryption.Type != EncryptionNone {
+		return ae.GetAppErr(ctx, fmt.Errorf("storj encrypts objects with the key of the access grant"), StorjPutObject, http.StatusNotImplemented)
+	}
+	var unsupported []string
+	if len(options.Tags) > 0 {
+		unsupported = append(unsupported, "tags")
+	}
+	if options.StorageClass != "" {
+		unsupported = append(unsupported, "storage class")
+	}
+	if len(unsupported) > 0 {
+		return ae.GetAppErr(ctx, fmt.Errorf("%s not supported by storj", strings.Join(unsupported, ", ")), StorjPutObject, http.StatusNotImplemented)
+	}
+
+	upload, err := b.Project.UploadObject(ctx, b.Bucket, objectKey(b.Prefix, path), nil)
+	if err != nil {
+		return storjErr(ctx, err, StorjPutObject)
+	}
+	if _, err := upload.Write(content); err != nil {
+		_ = upload.Abort()
+		return storjErr(ctx, err, StorjPutObject)
+	}
+	if custom := storjCustomMetadata(options); len(custom) > 0 {
+		if err := upload.SetCustomMetadata(ctx, custom); err != nil {
+			_ = upload.Abort()
+			return storjErr(ctx, err, StorjPutObject)
+		}
+	}
+	if err := upload.Commit(); err != nil {
+		return storjErr(ctx, err, StorjPutObject)
+	}
+	return nil
+}
+
+// DeleteObject removes an object from Storj bucket, at prefix
+func (b *StorjBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	deleted, err := b.Project.DeleteObject(ctx, b.Bucket, objectKey(b.Prefix, path))
+	if err != nil {
+		return storjErr(ctx, err, StorjDeleteObject)
+	}
+	if deleted == nil {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s not found", path), StorjDeleteObject, http.StatusNotFound)
+	}
+	return nil
+}
+
+// CopyObject copies an object within Storj bucket on the satellite, without downloading it
+func (b *StorjBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	_, err := b.Project.CopyObject(ctx, b.Bucket, objectKey(b.Prefix, srcPath), b.Bucket, objectKey(b.Prefix, dstPath), nil)
+	if err != nil {
+		return storjErr(ctx, err, StorjCopyObject)
+	}
+	return nil
+}
+
+// storjObject converts the uplink description of an object into an Object at path, without content
+func storjObject(path string, info *uplink.Object) Object {
+	object := Object{
+		Path:         path,
+		Content:      []byte{},
+		Size:         info.System.ContentLength,
+		LastModified: info.System.Created,
+	}
+	for key, value := range info.Custom {
+		switch key {
+		case storjContentType:
+			object.ContentType = value
+		case storjCacheControl:
+			object.CacheControl = value
+		case storjContentEncoding:
+			object.ContentEncoding = value
+		case storjContentDisposition:
+			object.ContentDisposition = value
+		case storjContentLanguage:
+			object.ContentLanguage = value
+		default:
+			if object.Meta.User == nil {
+				object.Meta.User = map[string]string{}
+			}
+			object.Meta.User[key] = value
+		}
+	}
+	return object
+}
+
+// storjCustomMetadata returns the custom metadata an object is uploaded with, its user metadata and content headers
+func storjCustomMetadata(options PutOptions) uplink.CustomMetadata {
+	custom := uplink.CustomMetadata{}
+	for key, value := range options.Metadata {
+		custom[key] = value
+	}
+	for key, value := range map[string]string{
+		storjContentType:        options.ContentType,
+		storjCacheControl:       options.CacheControl,
+		storjContentEncoding:    options.ContentEncoding,
+		storjContentDisposition: options.ContentDisposition,
+		storjContentLanguage:    options.ContentLanguage,
+	} {
+		if value != "" {
+			custom[key] = value
+		}
+	}
+	return custom
+}
+
+// storjErr wraps an uplink error, mapping missing objects and buckets, denied access and exceeded limits to their
+// HTTP status
+func storjErr(ctx context.Context, err error, customErr *ae.CustomErr) *ae.AppError {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, uplink.ErrObjectNotFound), errors.Is(err, uplink.ErrBucketNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, uplink.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, uplink.ErrTooManyRequests), errors.Is(err, uplink.ErrBandwidthLimitExceeded),
+		errors.Is(err, uplink.ErrStorageLimitExceeded), errors.Is(err, uplink.ErrSegmentsLimitExceeded):
+		status = http.StatusTooManyRequests
+	}
+	return ae.GetAppErr(ctx, err, customErr, status)
+}
@@ -0,0 +1,137 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// IStreamUploader is implemented by backends able to upload content read from an io.Reader without holding it
+// in memory
+type IStreamUploader interface {
+	// PutObjectStream uploads size bytes read from r to path, a negative size when the length is unknown
+	PutObjectStream(ctx context.Context, path string, r io.Reader, size int64, opts ...PutOption) *ae.AppError
+}
+
+// PutObjectStream uploads the content read from r to path of backend, e.g. an HTTP request body or a file. size is
+// the length of the content, negative when unknown; content of another length fails the upload with
+// StatusBadRequest and nothing is stored. Backends implementing IStreamUploader stream the content to the
+// provider; other backends, and decorators as they may need the whole content to transform or check it, get it
+// read into memory first.
+func PutObjectStream(ctx context.Context, backend IStorageBackend, path string, r io.Reader, size int64, opts ...PutOption) *ae.AppError {
+	if uploader, ok := backend.(IStreamUploader); ok {
+		return uploader.PutObjectStream(ctx, path, r, size, opts...)
+	}
+	body := newSizedReader(r, size)
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return body.appErr(ctx, path)
+	}
+	return backend.PutObject(ctx, path, content, opts...)
+}
+
+// sizedReader reads the content of a streamed upload, failing once it turns out longer or shorter than its size.
+// The failure is kept, as the provider SDKs reading it report their own error.
+type sizedReader struct {
+	r    io.Reader
+	size int64
+	read int64
+	// err is the failure of the reader or the length mismatch
+	err error
+	// mismatch is true when err is a length mismatch
+	mismatch bool
+}
+
+// newSizedReader creates a new instance of sizedReader reading size bytes from r, any length when size is negative
+func newSizedReader(r io.Reader, size int64) *sizedReader {
+	return &sizedReader{r: r, size: size}
+}
+
+// Read reads from the content, failing when it is longer or shorter than its size
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+	switch {
+	case s.size >= 0 && s.read > s.size:
+		s.err, s.mismatch = fmt.Errorf("content is longer than %d bytes", s.size), true
+	case err == io.EOF && s.size >= 0 && s.read < s.size:
+		s.err, s.mismatch = fmt.Errorf("content is %d bytes, shorter than %d bytes", s.read, s.size), true
+	case err != nil && err != io.EOF:
+		s.err = errors.Wrap(err, "reading content")
+	}
+	if s.err != nil {
+		return n, s.err
+	}
+	return n, err
+}
+
+// appErr returns the failure of the reader, nil when it read the content fine
+func (s *sizedReader) appErr(ctx context.Context, path string) *ae.AppError {
+	if s.err == nil {
+		return nil
+	}
+	if s.mismatch {
+		return ae.GetAppErr(ctx, errors.Wrapf(s.err, "uploading %s", path), StreamUploadSize, http.StatusBadRequest)
+	}
+	return ae.GetAppErr(ctx, errors.Wrapf(s.err, "uploading %s", path), StreamUploadRead, http.StatusBadRequest)
+}
+
+// ObjectWriter is an io.WriteCloser uploading what is written to it as one object, e.g. to stream the output of a
+// gzip.Writer, csv.Writer or json.Encoder straight into storage. Close commits the object; cancelling the context
+// of the writer before discards the partial upload and nothing is stored.
+type ObjectWriter struct {
+	pw     *io.PipeWriter
+	done   chan struct{}
+	appErr *ae.AppError
+}
+
+// NewObjectWriter creates a new instance of ObjectWriter uploading to path of backend with PutObjectStream, so
+// backends implementing IStreamUploader upload the content as it is written and others once it is closed
+func NewObjectWriter(ctx context.Context, backend IStorageBackend, path string, opts ...PutOption) *ObjectWriter {
+	pr, pw := io.Pipe()
+	w := &ObjectWriter{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		w.appErr = PutObjectStream(ctx, backend, path, pr, -1, opts...)
+		// unblock writes once the upload stopped reading
+		_ = pr.CloseWithError(io.ErrClosedPipe)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// a failing read aborts the upload
+			_ = pw.CloseWithError(ctx.Err())
+		case <-w.done:
+		}
+	}()
+	return w
+}
+
+// Write writes p to the object, failing with the error of the upload once it failed
+func (w *ObjectWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	if err != nil {
+		<-w.done
+		if w.appErr != nil {
+			return n, w.appErr
+		}
+	}
+	return n, err
+}
+
+// Close commits the object and returns the outcome of the upload
+func (w *ObjectWriter) Close() error {
+	_ = w.pw.Close()
+	<-w.done
+	if w.appErr != nil {
+		return w.appErr
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// SubBackend is an IStorageBackend rooted at a prefix of a parent backend, e.g. the folder of one tenant handed to
+// a component that must not see the others. Paths are resolved below Prefix and paths resolving outside of it, such
+// as "../x", are rejected, so nothing outside the prefix can be read, listed or written through it. Create it with
+// NewSubBackend.
+type SubBackend struct {
+	Parent IStorageBackend
+	// Prefix is the root of the view in the parent, without leading or trailing slashes
+	Prefix string
+}
+
+// NewSubBackend creates a new instance of SubBackend exposing prefix of parent as its root
+func NewSubBackend(parent IStorageBackend, prefix string) (*SubBackend, *ae.AppError) {
+	prefix = cleanPrefix(pathutil.Clean(prefix))
+	if parent == nil || prefix == "." || hasParentSegment(prefix) {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("a parent and a prefix without .. segments are required"), SubBackendConfig, http.StatusInternalServerError)
+	}
+	return &SubBackend{
+		Parent: parent,
+		Prefix: prefix,
+	}, nil
+}
+
+// Describe reports the prefix and the chain of the parent. SubBackend has no Unwrap, as helpers walking a chain
+// would address the parent with paths not resolved below the prefix.
+func (b *SubBackend) Describe() map[string]string {
+	return map[string]string{
+		"prefix": b.Prefix,
+		"parent": DescribeBackend(b.Parent).String(),
+	}
+}
+
+// GetObject retrieves an object below the prefix
+func (b *SubBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	object, appErr := b.Parent.GetObject(ctx, key, opts...)
+	object.Path = path
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix below the prefix
+func (b *SubBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists objects at the given prefix below the prefix, paths are relative to the given prefix as usual
+func (b *SubBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	// the trailing slash keeps sibling prefixes such as tenant-b out of a listing of tenant
+	key := b.Prefix + "/"
+	if prefix != "" {
+		var appErr *ae.AppError
+		if key, appErr = b.resolve(ctx, prefix); appErr != nil {
+			return ListResult{}, appErr
+		}
+	}
+	return b.Parent.ListObjects(ctx, key, opts...)
+}
+
+// PutObject uploads an object below the prefix
+func (b *SubBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Parent.PutObject(ctx, key, content, opts...)
+}
+
+// DeleteObject removes an object below the prefix
+func (b *SubBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Parent.DeleteObject(ctx, key)
+}
+
+// CopyObject copies an object within the prefix
+func (b *SubBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	srcKey, appErr := b.resolve(ctx, srcPath)
+	if appErr != nil {
+		return appErr
+	}
+	dstKey, appErr := b.resolve(ctx, dstPath)
+	if appErr != nil {
+		return appErr
+	}
+	return b.Parent.CopyObject(ctx, srcKey, dstKey)
+}
+
+// SecureDeleteObject securely deletes an object below the prefix
+func (b *SubBackend) SecureDeleteObject(ctx context.Context, path string) (SecureDeleteReport, *ae.AppError) {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return SecureDeleteReport{}, appErr
+	}
+	return SecureDelete(ctx, b.Parent, key)
+}
+
+// resolve returns the key of path in the parent, rejecting paths resolving outside the prefix such as "../x"
+func (b *SubBackend) resolve(ctx context.Context, path string) (string, *ae.AppError) {
+	key := objectKey(b.Prefix, path)
+	if !strings.HasPrefix(key, b.Prefix+"/") {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("path %q resolves outside the backend root", path), SubBackendPath, http.StatusBadRequest)
+	}
+	return key, nil
+}
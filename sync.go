@@ -0,0 +1,512 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// SyncCompare selects how SyncUp, SyncDown and SyncBackends decide that a source and its copy differ
+type SyncCompare int
+
+const (
+	// SyncSizeAndTime syncs files and objects of different sizes, or whose source was modified after the copy, as
+	// aws s3 sync does
+	SyncSizeAndTime SyncCompare = iota
+	// SyncChecksum syncs files and objects of different sizes or contents, comparing the CRC32C of the file with the
+	// one the object reports, GCS, or its MD5 with the ETag of S3 objects uploaded in one part without KMS. Objects
+	// reporting neither are always synced.
+	SyncChecksum
+)
+
+// SyncReport describes the changes made by SyncUp, SyncDown or SyncBackends, or those they would make on a dry run.
+// Paths are relative to the remote prefix and the local directory, with forward slashes.
+type SyncReport struct {
+	// Uploaded are the files uploaded by SyncUp, Downloaded the objects downloaded by SyncDown and Copied the
+	// objects copied by SyncBackends
+	Uploaded   []string
+	Downloaded []string
+	Copied     []string
+	// Deleted are the objects deleted by SyncUp and SyncBackends, or the files deleted by SyncDown
+	Deleted []string
+	// Unchanged is the number of files and objects left as they are
+	Unchanged int
+	// Bytes is the size of the files and objects transferred
+	Bytes int64
+	// Failures are the changes that failed
+	Failures []SyncFailure
+}
+
+// SyncFailure is a change SyncUp failed to make
+type SyncFailure struct {
+	Path string
+	Err  *ae.AppError
+}
+
+// SyncOptions holds the settings applied to a sync
+type SyncOptions struct {
+	Compare SyncCompare
+	// Delete deletes the remote objects without a local file on SyncUp, the local files without an object on
+	// SyncDown and the destination objects without a source object on SyncBackends
+	Delete bool
+	// DryRun only reports the changes
+	DryRun bool
+	// Concurrency is the number of files or objects transferred at a time
+	Concurrency int
+	// Progress, when set, is called with the number of files or objects transferred, or failing to, after every one
+	Progress func(done, total int)
+	// Upload are the options of every upload of SyncUp, Download of every download of SyncDown
+	Upload   []UploadOption
+	Download []DownloadOption
+}
+
+// SyncOption configures a sync
+type SyncOption func(*SyncOptions)
+
+// WithSyncCompare sets how changed files are detected, SyncSizeAndTime by default
+func WithSyncCompare(compare SyncCompare) SyncOption {
+	return func(o *SyncOptions) {
+		o.Compare = compare
+	}
+}
+
+// WithSyncDelete deletes the remote objects without a local file on SyncUp, e.g. to mirror a build output
+// directory, the local files without an object on SyncDown and the destination objects without a source object on
+// SyncBackends
+func WithSyncDelete() SyncOption {
+	return func(o *SyncOptions) {
+		o.Delete = true
+	}
+}
+
+// WithSyncDryRun reports the changes a sync would make without making them
+func WithSyncDryRun() SyncOption {
+	return func(o *SyncOptions) {
+		o.DryRun = true
+	}
+}
+
+// WithSyncConcurrency sets the number of files or objects transferred at a time, 16 by default
+func WithSyncConcurrency(concurrency int) SyncOption {
+	return func(o *SyncOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithSyncProgress has the sync call progress with the number of files or objects transferred so far, out of those
+// to sync, after every one. Calls are never concurrent.
+func WithSyncProgress(progress func(done, total int)) SyncOption {
+	return func(o *SyncOptions) {
+		o.Progress = progress
+	}
+}
+
+// WithSyncUploadOptions applies opts to every upload of SyncUp, e.g. WithPutOptions setting a cache control
+func WithSyncUploadOptions(opts ...UploadOption) SyncOption {
+	return func(o *SyncOptions) {
+		o.Upload = opts
+	}
+}
+
+// WithSyncDownloadOptions applies opts to every download of SyncDown, e.g. WithDownloadConcurrency
+func WithSyncDownloadOptions(opts ...DownloadOption) SyncOption {
+	return func(o *SyncOptions) {
+		o.Download = opts
+	}
+}
+
+// getSyncOptions applies the given options over the defaults
+func getSyncOptions(opts []SyncOption) SyncOptions {
+	options := SyncOptions{Concurrency: defaultPutConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// localFile is a regular file of a synced directory, path being its path relative to the directory with forward
+// slashes
+type localFile struct {
+	path      string
+	localPath string
+	size      int64
+	modTime   time.Time
+}
+
+// SyncUp makes the objects below the folder remotePrefix of backend match the files of localDir, as aws s3 sync
+// does: files without an object, or whose object differs as the SyncCompare says, are uploaded with UploadFromFile,
+// and, WithSyncDelete, objects without a file are deleted. Paths use forward slashes; symbolic links and folder
+// marker objects are left out. Failures do not stop the sync: once every change is attempted the error counts
+// them and the report lists them, while failing to read localDir or to list the objects stops it at once.
+func SyncUp(ctx context.Context, backend IStorageBackend, localDir, remotePrefix string, opts ...SyncOption) (SyncReport, *ae.AppError) {
+	var report SyncReport
+	options := getSyncOptions(opts)
+	files, appErr := localFiles(ctx, localDir)
+	if appErr != nil {
+		return report, appErr
+	}
+	prefix := cleanPrefix(remotePrefix)
+	remote, appErr := remoteObjects(ctx, backend, prefix)
+	if appErr != nil {
+		return report, appErr
+	}
+
+	var uploads []localFile
+	for _, file := range files {
+		object, ok := remote[file.path]
+		delete(remote, file.path)
+		if ok {
+			changed, appErr := fileChanged(ctx, file, object, options.Compare, file.modTime.After(object.LastModified))
+			if appErr != nil {
+				report.Failures = append(report.Failures, SyncFailure{Path: file.path, Err: appErr})
+				continue
+			}
+			if !changed {
+				report.Unchanged++
+				continue
+			}
+		}
+		uploads = append(uploads, file)
+	}
+	var deletes []string
+	if options.Delete {
+		deletes = slices.Sorted(maps.Keys(remote))
+	}
+	if options.DryRun {
+		for _, file := range uploads {
+			report.Uploaded = append(report.Uploaded, file.path)
+			report.Bytes += file.size
+		}
+		report.Deleted = deletes
+		return report, syncErr(ctx, report)
+	}
+
+	batch := BatchOptions{Concurrency: options.Concurrency, Progress: options.Progress}
+	errs, _ := runBatch(ctx, len(uploads), batch, SyncIncomplete, SyncIncomplete, func(ctx context.Context, i int) *ae.AppError {
+		return UploadFromFile(ctx, backend, objectKey(prefix, uploads[i].path), uploads[i].localPath, options.Upload...)
+	})
+	for i, file := range uploads {
+		if errs[i] != nil {
+			report.Failures = append(report.Failures, SyncFailure{Path: file.path, Err: errs[i]})
+		} else {
+			report.Uploaded = append(report.Uploaded, file.path)
+			report.Bytes += file.size
+		}
+	}
+	deleteExtraneous(ctx, backend, prefix, deletes, options.Concurrency, &report)
+	return report, syncErr(ctx, report)
+}
+
+// deleteExtraneous deletes the objects at paths below the folder prefix of backend, recording the outcome in report
+func deleteExtraneous(ctx context.Context, backend IStorageBackend, prefix string, paths []string, concurrency int, report *SyncReport) {
+	if len(paths) == 0 {
+		return
+	}
+	keys := make([]string, len(paths))
+	for i, path := range paths {
+		keys[i] = objectKey(prefix, path)
+	}
+	results, _ := DeleteObjects(ctx, backend, keys, WithDeleteConcurrency(concurrency))
+	for i, result := range results {
+		if result.Err != nil {
+			report.Failures = append(report.Failures, SyncFailure{Path: paths[i], Err: result.Err})
+		} else {
+			report.Deleted = append(report.Deleted, paths[i])
+		}
+	}
+}
+
+// syncErr summarises the failures of a sync, nil when every change was made
+func syncErr(ctx context.Context, report SyncReport) *ae.AppError {
+	if len(report.Failures) == 0 {
+		return nil
+	}
+	first := report.Failures[0].Err
+	err := fmt.Errorf("%d changes not synced, first: %s: %s", len(report.Failures), report.Failures[0].Path, first.Error())
+	return ae.GetAppErr(ctx, err, SyncIncomplete, first.GetHTTPCode())
+}
+
+// localFiles returns the regular files below localDir, in lexical order
+func localFiles(ctx context.Context, localDir string) ([]localFile, *ae.AppError) {
+	var files []localFile
+	err := filepath.WalkDir(localDir, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{path: filepath.ToSlash(rel), localPath: localPath, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, errors.Wrapf(err, "failed to read %s", localDir), SyncLocal, http.StatusInternalServerError)
+		if errors.Is(err, fs.ErrNotExist) {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		}
+		return nil, appErr
+	}
+	return files, nil
+}
+
+// remoteObjects returns the objects below the folder prefix of backend by path relative to it, leaving out folder
+// markers
+func remoteObjects(ctx context.Context, backend IStorageBackend, prefix string) (map[string]Object, *ae.AppError) {
+	remote := map[string]Object{}
+	listPrefix := ""
+	if prefix != "" {
+		listPrefix = prefix + "/"
+	}
+	appErr := Walk(ctx, backend, listPrefix, func(object Object) error {
+		if !strings.HasSuffix(object.Path, "/") {
+			remote[object.Path] = object
+		}
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr.AddErrCode(SyncList.Code)
+	}
+	return remote, nil
+}
+
+// fileChanged reports whether file differs from its object as compare says, sourceNewer telling whether the source
+// of the sync was modified after the copy
+func fileChanged(ctx context.Context, file localFile, object Object, compare SyncCompare, sourceNewer bool) (bool, *ae.AppError) {
+	if file.size != object.Size {
+		return true, nil
+	}
+	if compare == SyncSizeAndTime {
+		return sourceNewer, nil
+	}
+	var digest hash.Hash
+	var want string
+	switch {
+	case object.CRC32C != "":
+		digest, want = HashCRC32C.New(), object.CRC32C
+	case isMD5ETag(object.ETag):
+		digest, want = md5.New(), object.ETag
+	default:
+		return true, nil
+	}
+	f, err := os.Open(file.localPath)
+	if err == nil {
+		_, err = io.Copy(digest, f)
+		f.Close()
+	}
+	if err != nil {
+		return false, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to read %s", file.localPath), SyncLocal, http.StatusInternalServerError)
+	}
+	return hex.EncodeToString(digest.Sum(nil)) != want, nil
+}
+
+// isMD5ETag reports whether etag is the MD5 of the content, as S3 reports for objects uploaded in one part without
+// KMS encryption; multipart ETags end with the number of parts
+func isMD5ETag(etag string) bool {
+	if len(etag) != 2*md5.Size {
+		return false
+	}
+	_, err := hex.DecodeString(etag)
+	return err == nil
+}
+
+// SyncDown makes the files of localDir match the objects below the folder remotePrefix of backend, the inverse of
+// SyncUp, e.g. for a deployment agent pulling an asset bundle: objects without a file, or whose file differs as the
+// SyncCompare says, are downloaded with DownloadToFile, and, WithSyncDelete, files without an object are deleted.
+// Downloaded files get the modification time of their object, so that they compare as unchanged afterwards.
+// Objects whose path would leave localDir fail with 400 Bad Request. Failures do not stop the sync: once every
+// change is attempted the error counts them and the report lists them, while failing to read localDir or to list the
+// objects stops it at once.
+func SyncDown(ctx context.Context, backend IStorageBackend, remotePrefix, localDir string, opts ...SyncOption) (SyncReport, *ae.AppError) {
+	var report SyncReport
+	options := getSyncOptions(opts)
+	if err := os.MkdirAll(localDir, 0o755); err != nil {
+		return report, ae.GetAppErr(ctx, errors.Wrapf(err, "failed to create %s", localDir), SyncLocal, http.StatusInternalServerError)
+	}
+	files, appErr := localFiles(ctx, localDir)
+	if appErr != nil {
+		return report, appErr
+	}
+	prefix := cleanPrefix(remotePrefix)
+	remote, appErr := remoteObjects(ctx, backend, prefix)
+	if appErr != nil {
+		return report, appErr
+	}
+
+	local := make(map[string]localFile, len(files))
+	for _, file := range files {
+		local[file.path] = file
+	}
+	paths := slices.Sorted(maps.Keys(remote))
+	var downloads []Object
+	for _, path := range paths {
+		object := remote[path]
+		if !filepath.IsLocal(filepath.FromSlash(path)) {
+			err := fmt.Errorf("%s would be written outside of %s", path, localDir)
+			report.Failures = append(report.Failures, SyncFailure{Path: path, Err: ae.GetAppErr(ctx, err, SyncLocal, http.StatusBadRequest)})
+			continue
+		}
+		file, ok := local[path]
+		delete(local, path)
+		if ok {
+			changed, appErr := fileChanged(ctx, file, object, options.Compare, object.LastModified.After(file.modTime))
+			if appErr != nil {
+				report.Failures = append(report.Failures, SyncFailure{Path: path, Err: appErr})
+				continue
+			}
+			if !changed {
+				report.Unchanged++
+				continue
+			}
+		}
+		downloads = append(downloads, object)
+	}
+	var deletes []string
+	if options.Delete {
+		deletes = slices.Sorted(maps.Keys(local))
+	}
+	if options.DryRun {
+		for _, object := range downloads {
+			report.Downloaded = append(report.Downloaded, object.Path)
+			report.Bytes += object.Size
+		}
+		report.Deleted = deletes
+		return report, syncErr(ctx, report)
+	}
+
+	batch := BatchOptions{Concurrency: options.Concurrency, Progress: options.Progress}
+	errs, _ := runBatch(ctx, len(downloads), batch, SyncIncomplete, SyncIncomplete, func(ctx context.Context, i int) *ae.AppError {
+		return syncDownload(ctx, backend, objectKey(prefix, downloads[i].Path), downloads[i], localDir, options.Download)
+	})
+	for i, object := range downloads {
+		if errs[i] != nil {
+			report.Failures = append(report.Failures, SyncFailure{Path: object.Path, Err: errs[i]})
+		} else {
+			report.Downloaded = append(report.Downloaded, object.Path)
+			report.Bytes += object.Size
+		}
+	}
+	for _, path := range deletes {
+		if err := os.Remove(local[path].localPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			appErr := ae.GetAppErr(ctx, errors.Wrapf(err, "failed to delete %s", local[path].localPath), SyncLocal, http.StatusInternalServerError)
+			report.Failures = append(report.Failures, SyncFailure{Path: path, Err: appErr})
+		} else {
+			report.Deleted = append(report.Deleted, path)
+		}
+	}
+	return report, syncErr(ctx, report)
+}
+
+// syncDownload downloads the object at key into localDir and gives the file the modification time of the object
+func syncDownload(ctx context.Context, backend IStorageBackend, key string, object Object, localDir string, opts []DownloadOption) *ae.AppError {
+	localPath := filepath.Join(localDir, filepath.FromSlash(object.Path))
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to create the folder of %s", localPath), SyncLocal, http.StatusInternalServerError)
+	}
+	if appErr := DownloadToFile(ctx, backend, key, localPath, opts...); appErr != nil {
+		return appErr
+	}
+	if !object.LastModified.IsZero() {
+		if err := os.Chtimes(localPath, time.Time{}, object.LastModified); err != nil {
+			return ae.GetAppErr(ctx, errors.Wrapf(err, "failed to set the modification time of %s", localPath), SyncLocal, http.StatusInternalServerError)
+		}
+	}
+	return nil
+}
+
+// SyncBackends makes the objects below the folder prefix of dst match those of src, e.g. in a replication job run
+// on a schedule: objects missing from dst, or differing from their copy, are copied with CopyObjectTo, keeping their
+// attributes, and, WithSyncDelete, objects of dst without a source are deleted. Objects differ by size, or by
+// checksum when both sides report comparable ones, CRC32C on GCS and MD5 ETags on S3 objects uploaded in one part;
+// otherwise SyncSizeAndTime copies sources modified after their copy and SyncChecksum always copies. Unchanged
+// objects cost listing only, so repeated runs copy just what changed since the last one. Failures do not stop the
+// sync: once every change is attempted the error counts them and the report lists them, while failing to list
+// either side stops it at once.
+func SyncBackends(ctx context.Context, src, dst IStorageBackend, prefix string, opts ...SyncOption) (SyncReport, *ae.AppError) {
+	var report SyncReport
+	options := getSyncOptions(opts)
+	prefix = cleanPrefix(prefix)
+	sources, appErr := remoteObjects(ctx, src, prefix)
+	if appErr != nil {
+		return report, appErr
+	}
+	copies, appErr := remoteObjects(ctx, dst, prefix)
+	if appErr != nil {
+		return report, appErr
+	}
+
+	var changed []Object
+	for _, path := range slices.Sorted(maps.Keys(sources)) {
+		source := sources[path]
+		copied, ok := copies[path]
+		delete(copies, path)
+		if ok && !objectChanged(source, copied, options.Compare) {
+			report.Unchanged++
+			continue
+		}
+		changed = append(changed, source)
+	}
+	var deletes []string
+	if options.Delete {
+		deletes = slices.Sorted(maps.Keys(copies))
+	}
+	if options.DryRun {
+		for _, object := range changed {
+			report.Copied = append(report.Copied, object.Path)
+			report.Bytes += object.Size
+		}
+		report.Deleted = deletes
+		return report, nil
+	}
+
+	batch := BatchOptions{Concurrency: options.Concurrency, Progress: options.Progress}
+	errs, _ := runBatch(ctx, len(changed), batch, SyncIncomplete, SyncIncomplete, func(ctx context.Context, i int) *ae.AppError {
+		key := objectKey(prefix, changed[i].Path)
+		return CopyObjectTo(ctx, src, key, dst, key)
+	})
+	for i, object := range changed {
+		if errs[i] != nil {
+			report.Failures = append(report.Failures, SyncFailure{Path: object.Path, Err: errs[i]})
+		} else {
+			report.Copied = append(report.Copied, object.Path)
+			report.Bytes += object.Size
+		}
+	}
+	deleteExtraneous(ctx, dst, prefix, deletes, options.Concurrency, &report)
+	return report, syncErr(ctx, report)
+}
+
+// objectChanged reports whether the object copied differs from its source object as compare says, comparing their
+// checksums whenever both report comparable ones
+func objectChanged(source, copied Object, compare SyncCompare) bool {
+	switch {
+	case source.Size != copied.Size:
+		return true
+	case source.CRC32C != "" && copied.CRC32C != "":
+		return source.CRC32C != copied.CRC32C
+	case isMD5ETag(source.ETag) && isMD5ETag(copied.ETag):
+		return source.ETag != copied.ETag
+	case compare == SyncSizeAndTime:
+		return source.LastModified.After(copied.LastModified)
+	}
+	return true
+}
@@ -0,0 +1,514 @@
+package object_storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultTierDemoteAfter   = 24 * time.Hour
+	defaultTierSweepInterval = time.Minute
+	tierPromotionQueueSize   = 1024
+	// tierCursorSeparator joins the last listed path and the cold tier cursor in a TieredBackend cursor
+	tierCursorSeparator = "\x00"
+)
+
+// TierMove is the direction an object is moved between the tiers of a TieredBackend
+type TierMove string
+
+const (
+	// TierPromote copies an object read from the cold tier to the hot tier
+	TierPromote TierMove = "promote"
+	// TierDemote moves an idle object from the hot tier to the cold tier
+	TierDemote TierMove = "demote"
+)
+
+// TierErrorFunc is called with the path and error of a failed background move, path is empty when the hot tier
+// could not be listed
+type TierErrorFunc func(ctx context.Context, move TierMove, path string, appErr *ae.AppError)
+
+// TieredOption configures a TieredBackend
+type TieredOption func(*TieredBackend)
+
+// WithDemoteAfter sets how long an object stays in the hot tier without being read or written
+func WithDemoteAfter(idle time.Duration) TieredOption {
+	return func(b *TieredBackend) {
+		b.DemoteAfter = idle
+	}
+}
+
+// WithPromoteOnRead sets whether objects read from the cold tier are copied to the hot tier, true by default
+func WithPromoteOnRead(promote bool) TieredOption {
+	return func(b *TieredBackend) {
+		b.PromoteOnRead = promote
+	}
+}
+
+// WithTierSweepInterval sets how often the hot tier is checked for idle objects
+func WithTierSweepInterval(interval time.Duration) TieredOption {
+	return func(b *TieredBackend) {
+		b.SweepInterval = interval
+	}
+}
+
+// WithTierAttributes sets the attributes carried over when objects move between the tiers
+func WithTierAttributes(preserve PreserveAttributes) TieredOption {
+	return func(b *TieredBackend) {
+		b.Preserve = preserve
+	}
+}
+
+// WithTierErrorHandler sets the function called for every failed background move
+func WithTierErrorHandler(onError TierErrorFunc) TieredOption {
+	return func(b *TieredBackend) {
+		b.OnTierError = onError
+	}
+}
+
+// tierAccess is the last access of an object in the hot tier
+type tierAccess struct {
+	at time.Time
+	// clean is true for promoted objects not written since, their cold copy is still current
+	clean bool
+}
+
+// tierLock serialises the writes and moves of one path
+type tierLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// TieredBackend is an IStorageBackend writing to a fast hot tier, e.g. Redis or a local disk, and moving objects
+// not accessed for DemoteAfter to a cold tier, e.g. S3 or GCS, in the background once Start is called. Reads try
+// the hot tier first and fall back to the cold tier; with PromoteOnRead an object read from the cold tier is
+// copied back to the hot tier asynchronously. The hot copy of an object takes precedence, so the hot tier must not
+// expire objects itself, and a cold copy left behind by an overwrite is only replaced when the object is demoted
+// again. Create it with NewTieredBackend.
+type TieredBackend struct {
+	Hot  IStorageBackend
+	Cold IStorageBackend
+	// DemoteAfter is how long an object stays in the hot tier without being read or written
+	DemoteAfter   time.Duration
+	PromoteOnRead bool
+	SweepInterval time.Duration
+	// Preserve selects the attributes carried over by moves, none by default as a Redis hot tier stores none
+	Preserve PreserveAttributes
+	// OnTierError, when set, is called for every failed background move, e.g. to log it
+	OnTierError TierErrorFunc
+
+	mu         sync.Mutex
+	accessed   map[string]tierAccess
+	locks      map[string]*tierLock
+	promotions chan string
+	pending    map[string]bool
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewTieredBackend creates a new instance of TieredBackend writing to hot and demoting idle objects to cold
+func NewTieredBackend(hot, cold IStorageBackend, opts ...TieredOption) (*TieredBackend, *ae.AppError) {
+	if hot == nil || cold == nil {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("a hot and a cold tier are required"), TieredConfig, http.StatusInternalServerError)
+	}
+	b := &TieredBackend{
+		Hot:           hot,
+		Cold:          cold,
+		DemoteAfter:   defaultTierDemoteAfter,
+		PromoteOnRead: true,
+		SweepInterval: defaultTierSweepInterval,
+		accessed:      map[string]tierAccess{},
+		locks:         map[string]*tierLock{},
+		promotions:    make(chan string, tierPromotionQueueSize),
+		pending:       map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.DemoteAfter <= 0 || b.SweepInterval <= 0 {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("demote after and sweep interval must be positive"), TieredConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Start demotes idle objects every SweepInterval and runs queued promotions until ctx is done or Stop is called.
+// Objects found in the hot tier without a recorded access, e.g. after a restart, are idle since their last
+// modification.
+func (b *TieredBackend) Start(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return
+	}
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.wg.Add(2)
+	go b.sweepLoop(ctx)
+	go b.promoteLoop(ctx)
+}
+
+// Stop stops the background moves, queued promotions are dropped
+func (b *TieredBackend) Stop() {
+	b.mu.Lock()
+	cancel := b.cancel
+	b.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	b.wg.Wait()
+}
+
+// Unwrap returns the hot tier
+func (b *TieredBackend) Unwrap() IStorageBackend {
+	return b.Hot
+}
+
+// Describe reports the move policy and the chain of the cold tier
+func (b *TieredBackend) Describe() map[string]string {
+	return map[string]string{
+		"demoteAfter":   b.DemoteAfter.String(),
+		"promoteOnRead": strconv.FormatBool(b.PromoteOnRead),
+		"sweepInterval": b.SweepInterval.String(),
+		"cold":          DescribeBackend(b.Cold).String(),
+	}
+}
+
+// GetObject retrieves an object from the hot tier, or from the cold tier when the hot tier does not hold it.
+// Versioned reads are served by the cold tier alone, like version listings.
+func (b *TieredBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	if getGetOptions(opts).versioned() {
+		return b.Cold.GetObject(ctx, path, opts...)
+	}
+	object, appErr := b.Hot.GetObject(ctx, path, opts...)
+	if appErr == nil {
+		b.touch(path)
+		return object, nil
+	}
+	if appErr.GetHTTPCode() != http.StatusNotFound {
+		return object, appErr
+	}
+	object, appErr = b.Cold.GetObject(ctx, path, opts...)
+	if appErr == nil && b.PromoteOnRead {
+		b.queuePromotion(path)
+	}
+	return object, appErr
+}
+
+// GetObjects lists all objects of both tiers at the given prefix
+func (b *TieredBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	result, appErr := b.ListObjects(ctx, prefix)
+	return result.Objects, appErr
+}
+
+// ListObjects lists the objects of both tiers at the given prefix, the hot copy of an object held by both tiers
+// taking precedence. The hot tier is listed in full on every call and the cold tier page by page. Listings of
+// object versions are served by the cold tier alone.
+func (b *TieredBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	options := getListOptions(opts)
+	if options.Versions != VersionsCurrent {
+		return b.Cold.ListObjects(ctx, prefix, opts...)
+	}
+	var result ListResult
+	// after is the last path returned, coldCursor the start of the cold page holding the next objects
+	after, coldCursor, _ := strings.Cut(options.Cursor, tierCursorSeparator)
+	if options.Cursor == "" {
+		after = options.StartAfter
+	}
+	if appErr := options.filterErr(ctx); appErr != nil {
+		return result, appErr
+	}
+	hotObjects, appErr := b.Hot.GetObjects(ctx, prefix)
+	if appErr != nil {
+		result.interrupted("", options)
+		return result, appErr
+	}
+	hotObjects = slices.DeleteFunc(hotObjects, func(object Object) bool { return !options.matches(object) })
+	slices.SortFunc(hotObjects, func(x, y Object) int { return cmp.Compare(x.Path, y.Path) })
+
+	for {
+		page, appErr := b.Cold.ListObjects(ctx, prefix, WithMaxKeys(options.MaxKeys), WithCursor(coldCursor), WithStartAfter(after),
+			WithHydratedMetadata(options.Hydrate), withFiltersOf(options))
+		result.Scanned += page.Scanned
+		if appErr != nil {
+			result.Truncated = true
+			result.NextCursor = after + tierCursorSeparator + coldCursor
+			return result, appErr
+		}
+		// hot objects up to the last cold object of the page belong to this page, all of them on the last page
+		bound, bounded := after, page.Truncated
+		if len(page.Objects) > 0 {
+			bound = page.Objects[len(page.Objects)-1].Path
+		}
+		byPath := map[string]Object{}
+		for _, object := range page.Objects {
+			if object.Path > after {
+				byPath[object.Path] = object
+			}
+		}
+		for _, object := range hotObjects {
+			if object.Path > after && (!bounded || object.Path <= bound) {
+				byPath[object.Path] = object
+			}
+		}
+		merged := slices.SortedFunc(maps.Values(byPath), func(x, y Object) int { return cmp.Compare(x.Path, y.Path) })
+
+		if options.MaxKeys > 0 && len(result.Objects)+len(merged) > options.MaxKeys {
+			// the rest of this cold page is listed again on the next call, skipping what was returned
+			merged = merged[:options.MaxKeys-len(result.Objects)]
+			result.Objects = append(result.Objects, merged...)
+			result.Truncated = true
+			result.NextCursor = merged[len(merged)-1].Path + tierCursorSeparator + coldCursor
+			return result, nil
+		}
+		result.Objects = append(result.Objects, merged...)
+		if len(merged) > 0 {
+			after = merged[len(merged)-1].Path
+		}
+		if !page.Truncated {
+			return result, nil
+		}
+		coldCursor = page.NextCursor
+		if options.limitReached(len(result.Objects)) {
+			result.Truncated = true
+			result.NextCursor = after + tierCursorSeparator + coldCursor
+			return result, nil
+		}
+	}
+}
+
+// PutObject uploads an object to the hot tier
+func (b *TieredBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	unlock := b.lockPath(path)
+	defer unlock()
+	if appErr := b.Hot.PutObject(ctx, path, content, opts...); appErr != nil {
+		return appErr
+	}
+	b.setAccess(path, false)
+	return nil
+}
+
+// DeleteObject removes an object from both tiers, it is missing only when neither tier holds it
+func (b *TieredBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	unlock := b.lockPath(path)
+	defer unlock()
+	hotErr := b.Hot.DeleteObject(ctx, path)
+	if hotErr != nil && hotErr.GetHTTPCode() != http.StatusNotFound {
+		return hotErr
+	}
+	b.forget(path)
+	coldErr := b.Cold.DeleteObject(ctx, path)
+	if coldErr == nil || (coldErr.GetHTTPCode() == http.StatusNotFound && hotErr == nil) {
+		return nil
+	}
+	return coldErr
+}
+
+// CopyObject copies an object within the tier holding it, the hot tier first
+func (b *TieredBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	unlock := b.lockPath(dstPath)
+	defer unlock()
+	appErr := b.Hot.CopyObject(ctx, srcPath, dstPath)
+	if appErr == nil {
+		b.setAccess(dstPath, false)
+		return nil
+	}
+	if appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr
+	}
+	if appErr := b.Cold.CopyObject(ctx, srcPath, dstPath); appErr != nil {
+		return appErr
+	}
+	// a hot copy of the destination would hide the new cold one
+	if appErr := b.Hot.DeleteObject(ctx, dstPath); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr
+	}
+	b.forget(dstPath)
+	return nil
+}
+
+// lockPath locks path against concurrent writes and moves and returns the function unlocking it
+func (b *TieredBackend) lockPath(path string) func() {
+	b.mu.Lock()
+	lock, ok := b.locks[path]
+	if !ok {
+		lock = &tierLock{}
+		b.locks[path] = lock
+	}
+	lock.refs++
+	b.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(b.locks, path)
+		}
+	}
+}
+
+// touch records a read of path from the hot tier
+func (b *TieredBackend) touch(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	access := b.accessed[path]
+	access.at = time.Now()
+	b.accessed[path] = access
+}
+
+// setAccess records a write or promotion of path to the hot tier
+func (b *TieredBackend) setAccess(path string, clean bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accessed[path] = tierAccess{at: time.Now(), clean: clean}
+}
+
+// forget drops the access of path, once it left the hot tier
+func (b *TieredBackend) forget(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.accessed, path)
+}
+
+// queuePromotion queues path for promotion to the hot tier, nothing is queued before Start or when the queue is full
+func (b *TieredBackend) queuePromotion(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel == nil || b.pending[path] {
+		return
+	}
+	select {
+	case b.promotions <- path:
+		b.pending[path] = true
+	default:
+	}
+}
+
+// promoteLoop promotes queued paths until ctx is done
+func (b *TieredBackend) promoteLoop(ctx context.Context) {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path := <-b.promotions:
+			if appErr := b.promote(ctx, path); appErr != nil && b.OnTierError != nil {
+				b.OnTierError(ctx, TierPromote, path, appErr)
+			}
+			b.mu.Lock()
+			delete(b.pending, path)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// promote copies path from the cold tier to the hot tier unless it was written to the hot tier meanwhile
+func (b *TieredBackend) promote(ctx context.Context, path string) *ae.AppError {
+	unlock := b.lockPath(path)
+	defer unlock()
+	b.mu.Lock()
+	_, hot := b.accessed[path]
+	b.mu.Unlock()
+	if hot {
+		return nil
+	}
+	if appErr := b.move(ctx, b.Cold, b.Hot, path); appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return nil
+		}
+		return appErr
+	}
+	b.setAccess(path, true)
+	return nil
+}
+
+// sweepLoop demotes idle objects every SweepInterval until ctx is done
+func (b *TieredBackend) sweepLoop(ctx context.Context) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		b.sweep(ctx)
+	}
+}
+
+// sweep demotes the objects of the hot tier not accessed for DemoteAfter
+func (b *TieredBackend) sweep(ctx context.Context) {
+	objects, appErr := b.Hot.GetObjects(ctx, "")
+	if appErr != nil {
+		if b.OnTierError != nil {
+			b.OnTierError(ctx, TierDemote, "", appErr.AddErrCode(TieredMove.Code))
+		}
+		return
+	}
+	for _, object := range objects {
+		if ctx.Err() != nil {
+			return
+		}
+		b.mu.Lock()
+		access, known := b.accessed[object.Path]
+		b.mu.Unlock()
+		if !known {
+			if object.LastModified.IsZero() {
+				b.setAccess(object.Path, false)
+				continue
+			}
+			access.at = object.LastModified
+		}
+		if time.Since(access.at) < b.DemoteAfter {
+			continue
+		}
+		if appErr := b.demote(ctx, object.Path); appErr != nil && b.OnTierError != nil {
+			b.OnTierError(ctx, TierDemote, object.Path, appErr)
+		}
+	}
+}
+
+// demote moves path from the hot tier to the cold tier unless it was accessed meanwhile. A promoted object not
+// written since is only deleted from the hot tier, its cold copy is current.
+func (b *TieredBackend) demote(ctx context.Context, path string) *ae.AppError {
+	unlock := b.lockPath(path)
+	defer unlock()
+	b.mu.Lock()
+	access, known := b.accessed[path]
+	b.mu.Unlock()
+	if known && time.Since(access.at) < b.DemoteAfter {
+		return nil
+	}
+	if !access.clean {
+		if appErr := b.move(ctx, b.Hot, b.Cold, path); appErr != nil {
+			if appErr.GetHTTPCode() == http.StatusNotFound {
+				b.forget(path)
+				return nil
+			}
+			return appErr
+		}
+	}
+	if appErr := b.Hot.DeleteObject(ctx, path); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(TieredMove.Code)
+	}
+	b.forget(path)
+	return nil
+}
+
+// move copies path from one tier to the other with the attributes selected by Preserve
+func (b *TieredBackend) move(ctx context.Context, from, to IStorageBackend, path string) *ae.AppError {
+	if appErr := CopyObjectBetween(ctx, from, path, to, path, b.Preserve); appErr != nil {
+		return appErr.AddErrCode(TieredMove.Code)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"google.golang.org/api/iterator"
+)
+
+// GetObjectAt retrieves the version of an object that was current at asOf from a versioned bucket, see
+// WithVersionAt
+func GetObjectAt(ctx context.Context, backend IStorageBackend, path string, asOf time.Time, opts ...GetOption) (Object, *ae.AppError) {
+	return backend.GetObject(ctx, path, append(opts, WithVersionAt(asOf))...)
+}
+
+// versionIDAt returns the id of the version of an object in Amazon S3 bucket that was current at asOf
+func (b *S3Backend) versionIDAt(ctx context.Context, path string, asOf time.Time) (string, *ae.AppError) {
+	if b.Compat.NoVersionListing {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("object versions are not supported by this provider"), S3GetObject, http.StatusNotImplemented)
+	}
+	key := objectKey(b.Prefix, path)
+	var versions []Object
+	s3Input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(key),
+	}
+	for {
+		s3Result, err := b.Client.ListObjectVersionsWithContext(ctx, s3Input)
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, S3GetObject, http.StatusInternalServerError)
+			if isS3NotFoundError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusNotFound)
+			} else if isS3NotImplementedError(err) {
+				appErr = appErr.SetHTTPCode(http.StatusNotImplemented)
+			} else if isS3ThrottlingError(err) {
+				appErr = throttled(appErr, defaultThrottleRetryAfter)
+			}
+			return "", appErr
+		}
+		// keys sort after their own prefix, so the versions of key come before those of longer keys
+		otherKeys := false
+		for _, version := range s3Result.Versions {
+			if aws.StringValue(version.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versions = append(versions, Object{VersionID: aws.StringValue(version.VersionId), LastModified: aws.TimeValue(version.LastModified)})
+		}
+		for _, marker := range s3Result.DeleteMarkers {
+			if aws.StringValue(marker.Key) != key {
+				otherKeys = true
+				continue
+			}
+			versions = append(versions, Object{VersionID: aws.StringValue(marker.VersionId), LastModified: aws.TimeValue(marker.LastModified), IsDeleteMarker: true})
+		}
+		if otherKeys || !aws.BoolValue(s3Result.IsTruncated) {
+			break
+		}
+		s3Input.KeyMarker = s3Result.NextKeyMarker
+		s3Input.VersionIdMarker = s3Result.NextVersionIdMarker
+	}
+	sortVersionsNewestFirst(versions)
+	version := versionAt(versions, asOf)
+	if version == nil {
+		return "", ae.GetAppErr(ctx, fmt.Errorf("object %s did not exist at %s", path, asOf.Format(time.RFC3339)), S3GetObject, http.StatusNotFound)
+	}
+	return version.VersionID, nil
+}
+
+// generationAt returns the generation of an object in Google Cloud Storage bucket that was live at asOf
+func (b GoogleCSBackend) generationAt(ctx context.Context, path string, asOf time.Time) (int64, *ae.AppError) {
+	key := objectKey(b.Prefix, path)
+	it := b.Client.Objects(ctx, &storage.Query{Prefix: key, Versions: true})
+	for {
+		attrs, err := it.Next()
+		// objects are listed by name, so the generations of key come before those of longer names
+		if err == iterator.Done || (err == nil && attrs.Name != key) {
+			return 0, ae.GetAppErr(ctx, fmt.Errorf("object %s did not exist at %s", path, asOf.Format(time.RFC3339)), GCSGetObject, http.StatusNotFound)
+		}
+		if err != nil {
+			appErr := ae.GetAppErr(ctx, err, GCSGetObject, http.StatusInternalServerError)
+			if retryAfter, ok := gcsRetryAfter(err); ok {
+				appErr = throttled(appErr, retryAfter)
+			}
+			return 0, appErr
+		}
+		// a generation is live from its creation until it was overwritten or deleted
+		if !attrs.Created.After(asOf) && (attrs.Deleted.IsZero() || attrs.Deleted.After(asOf)) {
+			return attrs.Generation, nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package object_storage
+
+import (
+	"context"
+
+	ae "github.com/piyushkumar96/app-error"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of TracingBackend
+const tracerName = "github.com/piyushkumar96/generic-object-storage"
+
+// TracingOption configures a TracingBackend
+type TracingOption func(*TracingBackend)
+
+// WithTracerProvider creates the spans with provider instead of the global tracer provider
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(b *TracingBackend) {
+		b.Tracer = provider.Tracer(tracerName)
+	}
+}
+
+// TracingBackend is an IStorageBackend decorator creating an OpenTelemetry client span for every operation, child of
+// the span of the context it is called with. Spans carry the backend, bucket, object key and content size, and on
+// failure the HTTP status and error code of the error.
+type TracingBackend struct {
+	Backend IStorageBackend
+	Tracer  trace.Tracer
+	// attributes are the attributes of every span, identifying the storage backend
+	attributes []attribute.KeyValue
+}
+
+// NewTracingBackend creates a new instance of TracingBackend, using the global tracer provider by default
+func NewTracingBackend(backend IStorageBackend, opts ...TracingOption) *TracingBackend {
+	chain := DescribeBackend(backend)
+	storage := chain[len(chain)-1]
+	b := &TracingBackend{
+		Backend: backend,
+		Tracer:  otel.Tracer(tracerName),
+		attributes: []attribute.KeyValue{
+			attribute.String("storage.backend", storage.Type),
+			attribute.String("storage.bucket", storage.Config["bucket"]),
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the traced backend
+func (b *TracingBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// transparent lets operations without spans run on the wrapped backend
+func (b *TracingBackend) transparent() {}
+
+// Describe reports the backend attributes of the spans
+func (b *TracingBackend) Describe() map[string]string {
+	config := map[string]string{}
+	for _, attr := range b.attributes {
+		config[string(attr.Key)] = attr.Value.Emit()
+	}
+	return config
+}
+
+// GetObject retrieves an object
+func (b *TracingBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	ctx, span := b.start(ctx, "GetObject", attribute.String("storage.key", path))
+	object, appErr := b.Backend.GetObject(ctx, path, opts...)
+	if appErr == nil {
+		span.SetAttributes(attribute.Int("storage.size", len(object.Content)))
+	}
+	endSpan(span, appErr)
+	return object, appErr
+}
+
+// GetObjects lists all objects at the given prefix
+func (b *TracingBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	ctx, span := b.start(ctx, "GetObjects", attribute.String("storage.prefix", prefix))
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	span.SetAttributes(attribute.Int("storage.objects", len(objects)))
+	endSpan(span, appErr)
+	return objects, appErr
+}
+
+// ListObjects lists objects at the given prefix
+func (b *TracingBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	ctx, span := b.start(ctx, "ListObjects", attribute.String("storage.prefix", prefix))
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	span.SetAttributes(attribute.Int("storage.objects", len(result.Objects)), attribute.Bool("storage.truncated", result.Truncated))
+	endSpan(span, appErr)
+	return result, appErr
+}
+
+// PutObject uploads an object
+func (b *TracingBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	ctx, span := b.start(ctx, "PutObject", attribute.String("storage.key", path), attribute.Int("storage.size", len(content)))
+	appErr := b.Backend.PutObject(ctx, path, content, opts...)
+	endSpan(span, appErr)
+	return appErr
+}
+
+// DeleteObject removes an object
+func (b *TracingBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	ctx, span := b.start(ctx, "DeleteObject", attribute.String("storage.key", path))
+	appErr := b.Backend.DeleteObject(ctx, path)
+	endSpan(span, appErr)
+	return appErr
+}
+
+// CopyObject copies an object
+func (b *TracingBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	ctx, span := b.start(ctx, "CopyObject", attribute.String("storage.key", dstPath), attribute.String("storage.source_key", srcPath))
+	appErr := b.Backend.CopyObject(ctx, srcPath, dstPath)
+	endSpan(span, appErr)
+	return appErr
+}
+
+// start starts the client span of an operation with the backend attributes and attrs
+func (b *TracingBackend) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return b.Tracer.Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(b.attributes...),
+		trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of an operation on its span and ends it
+func endSpan(span trace.Span, appErr *ae.AppError) {
+	if appErr != nil {
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", appErr.GetHTTPCode()),
+			attribute.String("storage.error_code", appErr.GetErrCode()))
+		span.RecordError(appErr)
+		span.SetStatus(codes.Error, appErr.GetMsg())
+	}
+	span.End()
+}
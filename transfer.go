@@ -0,0 +1,322 @@
+package object_storage
+
+import (
+	"context"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"slices"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultTransferPartSize    = 16 * 1024 * 1024
+	defaultTransferConcurrency = 4
+)
+
+// TransferCheckpoint is the state of a transfer uploaded in parts, to resume it after an interruption with
+// WithTransferResume. It is plain data, so that it can be persisted as JSON between runs of a migration job.
+type TransferCheckpoint struct {
+	UploadID string
+	// ETag, VersionID and Size identify the source object, a source changed since restarts the transfer
+	ETag      string
+	VersionID string
+	Size      int64
+	PartSize  int64
+	// Parts are the leading parts of the object stored so far, Digest the CRC32C state over their content
+	Parts  []MultipartPart
+	Digest []byte
+}
+
+// TransferOptions holds the settings applied to a transfer between backends
+type TransferOptions struct {
+	PartSize    int64
+	Concurrency int
+	// Preserve selects the attributes carried over, all but tags and storage class by default as they are provider
+	// specific
+	Preserve PreserveAttributes
+	// Resume, when set, is the checkpoint of an interrupted transfer to carry on
+	Resume *TransferCheckpoint
+	// Checkpoint, when set, is called with the checkpoint of the transfer every time a part is stored
+	Checkpoint func(TransferCheckpoint)
+	// Progress, when set, is called with the bytes transferred so far and the size of the object
+	Progress func(transferred, total int64)
+}
+
+// TransferOption configures a transfer between backends
+type TransferOption func(*TransferOptions)
+
+// WithTransferPartSize sets the size of the parts read and uploaded, 16 MiB by default and raised as needed to stay
+// within 10000 parts
+func WithTransferPartSize(partSize int64) TransferOption {
+	return func(o *TransferOptions) {
+		o.PartSize = partSize
+	}
+}
+
+// WithTransferConcurrency sets how many parts are uploaded in parallel
+func WithTransferConcurrency(concurrency int) TransferOption {
+	return func(o *TransferOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithTransferAttributes selects the attributes carried over to the destination
+func WithTransferAttributes(preserve PreserveAttributes) TransferOption {
+	return func(o *TransferOptions) {
+		o.Preserve = preserve
+	}
+}
+
+// WithTransferCheckpoint has the transfer call checkpoint with its state every time a part is stored, e.g. to
+// persist it for WithTransferResume. A failed transfer keeps its stored parts when a checkpoint is set, and
+// aborts the upload otherwise. Calls are never concurrent.
+func WithTransferCheckpoint(checkpoint func(TransferCheckpoint)) TransferOption {
+	return func(o *TransferOptions) {
+		o.Checkpoint = checkpoint
+	}
+}
+
+// WithTransferResume carries on the interrupted transfer of checkpoint, skipping the parts it stored. The transfer
+// restarts from scratch, aborting the old upload, when the source changed or the upload is gone.
+func WithTransferResume(checkpoint TransferCheckpoint) TransferOption {
+	return func(o *TransferOptions) {
+		o.Resume = &checkpoint
+	}
+}
+
+// WithTransferProgress has the transfer call progress with the bytes transferred so far and the size of the object.
+// Calls are never concurrent.
+func WithTransferProgress(progress func(transferred, total int64)) TransferOption {
+	return func(o *TransferOptions) {
+		o.Progress = progress
+	}
+}
+
+// getTransferOptions applies the given options over the defaults
+func getTransferOptions(opts []TransferOption) TransferOptions {
+	options := TransferOptions{
+		PartSize:    defaultTransferPartSize,
+		Concurrency: defaultTransferConcurrency,
+		Preserve: PreserveAttributes{
+			Metadata:       true,
+			ContentType:    true,
+			CacheControl:   true,
+			ContentHeaders: true,
+		},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.PartSize = max(options.PartSize, s3MinPartSize)
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// Transfer copies the object at srcPath of src to dstPath of dst across providers, e.g. from S3 to GCS in a cloud
+// migration, streaming the content through the process with memory bounded by the part size and concurrency.
+// Objects of at least one part going to a backend implementing IMultipartUploader, S3 and GCS, are read with ranged
+// reads of the source version and uploaded in parallel parts, and can be resumed with WithTransferCheckpoint and
+// WithTransferResume; other transfers are streamed with PutObjectStream. The CRC32C of the content is checked
+// against the checksums the source and destination report, GCS for every object and S3 for objects uploaded with
+// one; a mismatch deletes the destination object and fails with TransferChecksumMismatch.
+func Transfer(ctx context.Context, src IStorageBackend, srcPath string, dst IStorageBackend, dstPath string, opts ...TransferOption) *ae.AppError {
+	options := getTransferOptions(opts)
+	source, appErr := StatObject(ctx, src, srcPath)
+	if appErr != nil {
+		return appErr.AddErrCode(TransferOperation.Code)
+	}
+	putOpts, appErr := preservedPutOptions(ctx, src, srcPath, source, options.Preserve)
+	if appErr != nil {
+		return appErr.AddErrCode(TransferOperation.Code)
+	}
+	progress := &uploadProgress{total: source.Size, progress: options.Progress}
+
+	var digest hash.Hash
+	uploader, multipart := dst.(IMultipartUploader)
+	if multipart && source.Size >= options.PartSize && !getPutOptions(putOpts).customerKeyed() {
+		digest, appErr = transferParts(ctx, src, srcPath, uploader, dstPath, source, putOpts, options, progress)
+	} else {
+		digest = HashCRC32C.New()
+		appErr = pipeObject(ctx, src, srcPath, dst, dstPath, source.Size, putOpts, progress, digest)
+	}
+	if appErr != nil {
+		return appErr.AddErrCode(TransferOperation.Code)
+	}
+	return verifyTransfer(ctx, dst, dstPath, source, hex.EncodeToString(digest.Sum(nil)), multipart)
+}
+
+// verifyTransfer checks the CRC32C of the transferred content against the checksums reported by the source and the
+// destination, and the size of objects uploaded in parts, deleting the destination object on a mismatch
+func verifyTransfer(ctx context.Context, dst IStorageBackend, dstPath string, source Object, checksum string, checkSize bool) *ae.AppError {
+	var err error
+	if source.CRC32C != "" && source.CRC32C != checksum {
+		err = fmt.Errorf("crc32c of %s is %s, the source reports %s", dstPath, checksum, source.CRC32C)
+	} else {
+		stored, appErr := StatObject(ctx, dst, dstPath)
+		if appErr != nil {
+			return appErr.AddErrCode(TransferOperation.Code)
+		}
+		if stored.CRC32C != "" && stored.CRC32C != checksum {
+			err = fmt.Errorf("crc32c of %s is %s, the destination reports %s", dstPath, checksum, stored.CRC32C)
+		} else if checkSize && stored.Size != source.Size {
+			err = fmt.Errorf("%s is %d bytes, the source %d bytes", dstPath, stored.Size, source.Size)
+		}
+	}
+	if err != nil {
+		_ = dst.DeleteObject(context.WithoutCancel(ctx), dstPath)
+		return ae.GetAppErr(ctx, err, TransferChecksumMismatch, http.StatusUnprocessableEntity)
+	}
+	return nil
+}
+
+// transferParts uploads the object at srcPath of src to dstPath in parts, resuming options.Resume when it still
+// matches the source, and returns the CRC32C of the content
+func transferParts(ctx context.Context, src IStorageBackend, srcPath string, uploader IMultipartUploader, dstPath string, source Object, putOpts []PutOption, options TransferOptions, progress *uploadProgress) (hash.Hash, *ae.AppError) {
+	checkpoint, appErr := resumeCheckpoint(ctx, uploader, dstPath, source, options.Resume)
+	if appErr != nil {
+		return nil, appErr
+	}
+	digest := HashCRC32C.New()
+	if checkpoint.UploadID == "" {
+		uploadID, appErr := uploader.InitiateMultipart(ctx, dstPath, putOpts...)
+		if appErr != nil {
+			return nil, appErr
+		}
+		checkpoint = TransferCheckpoint{
+			UploadID:  uploadID,
+			ETag:      source.ETag,
+			VersionID: source.VersionID,
+			Size:      source.Size,
+			PartSize:  max(options.PartSize, (source.Size+s3MaxParts-1)/s3MaxParts),
+		}
+		if options.Checkpoint != nil {
+			options.Checkpoint(checkpoint)
+		}
+	} else if len(checkpoint.Parts) > 0 {
+		if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(checkpoint.Digest); err != nil {
+			return nil, ae.GetAppErr(ctx, errors.Wrap(err, "invalid checkpoint digest"), TransferOperation, http.StatusBadRequest)
+		}
+	}
+	var getOpts []GetOption
+	if source.VersionID != "" {
+		getOpts = append(getOpts, WithVersionID(source.VersionID))
+	}
+
+	partCount := int((source.Size + checkpoint.PartSize - 1) / checkpoint.PartSize)
+	parts := make([]MultipartPart, partCount)
+	copy(parts, checkpoint.Parts)
+	done := len(checkpoint.Parts)
+	progress.add(min(int64(done)*checkpoint.PartSize, source.Size))
+
+	// states are the digests after every part read, kept until the parts before it are stored
+	var mu sync.Mutex
+	states := map[int][]byte{}
+	stored := map[int]bool{}
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(options.Concurrency)
+	for i := done; i < partCount && groupCtx.Err() == nil; i++ {
+		offset := int64(i) * checkpoint.PartSize
+		length := min(checkpoint.PartSize, source.Size-offset)
+		part, appErr := src.GetObject(groupCtx, srcPath, append(getOpts, WithRange(offset, length))...)
+		if appErr != nil {
+			group.Go(func() error { return appErr })
+			break
+		}
+		if int64(len(part.Content)) != length {
+			err := fmt.Errorf("short read of %s at offset %d: got %d of %d bytes", srcPath, offset, len(part.Content), length)
+			group.Go(func() error { return ae.GetAppErr(ctx, err, TransferOperation, http.StatusInternalServerError) })
+			break
+		}
+		digest.Write(part.Content)
+		state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			group.Go(func() error { return ae.GetAppErr(ctx, err, TransferOperation, http.StatusInternalServerError) })
+			break
+		}
+		mu.Lock()
+		states[i] = state
+		mu.Unlock()
+		group.Go(func() error {
+			uploaded, appErr := uploader.UploadPart(groupCtx, dstPath, checkpoint.UploadID, int64(i+1), part.Content)
+			if appErr != nil {
+				return appErr
+			}
+			progress.add(length)
+			mu.Lock()
+			defer mu.Unlock()
+			parts[i] = uploaded
+			stored[i] = true
+			// the checkpoint only advances over the leading parts stored
+			for stored[done] {
+				checkpoint.Parts = append(checkpoint.Parts, parts[done])
+				checkpoint.Digest = states[done]
+				delete(stored, done)
+				delete(states, done)
+				done++
+				if options.Checkpoint != nil {
+					saved := checkpoint
+					saved.Parts = slices.Clone(checkpoint.Parts)
+					options.Checkpoint(saved)
+				}
+			}
+			return nil
+		})
+	}
+	err := group.Wait()
+	if err == nil {
+		if appErr := uploader.CompleteMultipart(ctx, dstPath, checkpoint.UploadID, parts); appErr != nil {
+			err = appErr
+		}
+	}
+	if err != nil {
+		if options.Checkpoint == nil {
+			// abort even when ctx is done, so the stored parts are not billed
+			_ = uploader.AbortMultipart(context.WithoutCancel(ctx), dstPath, checkpoint.UploadID)
+		}
+		if appErr, ok := err.(*ae.AppError); ok {
+			return nil, appErr
+		}
+		return nil, ae.GetAppErr(ctx, err, TransferOperation, http.StatusInternalServerError)
+	}
+	return digest, nil
+}
+
+// resumeCheckpoint returns resume when its upload still holds its parts and the source has not changed, and an
+// empty checkpoint otherwise, aborting the upload of resume
+func resumeCheckpoint(ctx context.Context, uploader IMultipartUploader, dstPath string, source Object, resume *TransferCheckpoint) (TransferCheckpoint, *ae.AppError) {
+	if resume == nil || resume.UploadID == "" {
+		return TransferCheckpoint{}, nil
+	}
+	valid := resume.ETag == source.ETag && resume.VersionID == source.VersionID && resume.Size == source.Size &&
+		resume.PartSize > 0 && len(resume.Parts) <= int((source.Size+resume.PartSize-1)/resume.PartSize)
+	if valid {
+		stored, appErr := uploader.ListParts(ctx, dstPath, resume.UploadID)
+		if appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return TransferCheckpoint{}, appErr
+		}
+		// the upload is gone, or lost parts of the checkpoint
+		valid = appErr == nil
+		storedParts := make(map[int64]MultipartPart, len(stored))
+		for _, part := range stored {
+			storedParts[part.PartNumber] = part
+		}
+		for i, part := range resume.Parts {
+			storedPart, ok := storedParts[int64(i+1)]
+			valid = valid && ok && part.PartNumber == int64(i+1) && unquoteETag(storedPart.ETag) == unquoteETag(part.ETag)
+		}
+	}
+	if !valid {
+		_ = uploader.AbortMultipart(ctx, dstPath, resume.UploadID)
+		return TransferCheckpoint{}, nil
+	}
+	checkpoint := *resume
+	checkpoint.Parts = slices.Clone(resume.Parts)
+	return checkpoint, nil
+}
@@ -0,0 +1,218 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const (
+	defaultTrashPrefix = ".trash"
+	trashPageSize      = 1000
+)
+
+// TrashEntry is an object moved to the trash of a TrashBackend
+type TrashEntry struct {
+	// Path is the path the object was deleted from
+	Path      string
+	DeletedAt time.Time
+	Size      int64
+	// TrashPath is the path of the object in the trash
+	TrashPath string
+}
+
+// TrashOption configures a TrashBackend
+type TrashOption func(*TrashBackend)
+
+// WithTrashPrefix sets the prefix holding the trash, ".trash" by default
+func WithTrashPrefix(prefix string) TrashOption {
+	return func(b *TrashBackend) {
+		b.TrashPrefix = cleanPrefix(prefix)
+	}
+}
+
+// TrashBackend is an IStorageBackend decorator making deletes recoverable without provider versioning: DeleteObject
+// moves the object to <TrashPrefix>/<timestamp>/<path>, Restore moves the last deleted copy of a path back and
+// PurgeOlderThan deletes old trash for good. The trash is left out of listings, and deleting an object inside it
+// deletes it for good.
+type TrashBackend struct {
+	Backend     IStorageBackend
+	TrashPrefix string
+}
+
+// NewTrashBackend creates a new instance of TrashBackend
+func NewTrashBackend(backend IStorageBackend, opts ...TrashOption) *TrashBackend {
+	b := &TrashBackend{
+		Backend:     backend,
+		TrashPrefix: defaultTrashPrefix,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Unwrap returns the backend holding the objects and the trash
+func (b *TrashBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the trash prefix
+func (b *TrashBackend) Describe() map[string]string {
+	return map[string]string{
+		"trashPrefix": b.TrashPrefix,
+	}
+}
+
+// ListTrash returns the objects in the trash, oldest deletion first
+func (b *TrashBackend) ListTrash(ctx context.Context) ([]TrashEntry, *ae.AppError) {
+	var entries []TrashEntry
+	cursor := ""
+	for {
+		page, appErr := b.Backend.ListObjects(ctx, b.TrashPrefix, WithMaxKeys(trashPageSize), WithCursor(cursor))
+		if appErr != nil {
+			return entries, appErr
+		}
+		for _, object := range page.Objects {
+			folder, path, ok := strings.Cut(NormalizePath(object.Path), "/")
+			if !ok {
+				continue
+			}
+			deletedAt, err := time.Parse(sortableTimeLayout, folder)
+			if err != nil {
+				// not written by a TrashBackend
+				continue
+			}
+			entries = append(entries, TrashEntry{
+				Path:      path,
+				DeletedAt: deletedAt,
+				Size:      object.Size,
+				TrashPath: objectKey(b.TrashPrefix, object.Path),
+			})
+		}
+		if !page.Truncated {
+			return entries, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Restore moves the last deleted copy of path back from the trash. It fails with StatusNotFound when the trash
+// holds no copy and with StatusConflict when an object exists at path again.
+func (b *TrashBackend) Restore(ctx context.Context, path string) *ae.AppError {
+	entries, appErr := b.ListTrash(ctx)
+	if appErr != nil {
+		return appErr.AddErrCode(TrashRestore.Code)
+	}
+	path = NormalizePath(path)
+	var last *TrashEntry
+	for i := range entries {
+		if entries[i].Path == path {
+			last = &entries[i]
+		}
+	}
+	if last == nil {
+		return ae.GetAppErr(ctx, fmt.Errorf("no deleted copy of %s in the trash", path), TrashRestore, http.StatusNotFound)
+	}
+	_, appErr = b.Backend.GetObject(ctx, path, WithRange(0, 1))
+	if appErr == nil || appErr.GetHTTPCode() == http.StatusRequestedRangeNotSatisfiable {
+		return ae.GetAppErr(ctx, fmt.Errorf("object %s exists, delete it before restoring", path), TrashRestore, http.StatusConflict)
+	}
+	if appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(TrashRestore.Code)
+	}
+	if appErr := b.Backend.CopyObject(ctx, last.TrashPath, path); appErr != nil {
+		return appErr.AddErrCode(TrashRestore.Code)
+	}
+	if appErr := b.Backend.DeleteObject(ctx, last.TrashPath); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+		return appErr.AddErrCode(TrashRestore.Code)
+	}
+	return nil
+}
+
+// PurgeOlderThan deletes for good the objects moved to the trash more than age ago and returns how many were
+// deleted
+func (b *TrashBackend) PurgeOlderThan(ctx context.Context, age time.Duration) (int, *ae.AppError) {
+	entries, appErr := b.ListTrash(ctx)
+	if appErr != nil {
+		return 0, appErr.AddErrCode(TrashPurge.Code)
+	}
+	cutoff := time.Now().Add(-age)
+	purged := 0
+	for _, entry := range entries {
+		// entries are listed in deletion order
+		if !entry.DeletedAt.Before(cutoff) {
+			break
+		}
+		if appErr := b.Backend.DeleteObject(ctx, entry.TrashPath); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return purged, appErr.AddErrCode(TrashPurge.Code)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// GetObject retrieves an object
+func (b *TrashBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix, leaving out the trash
+func (b *TrashBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	return b.withoutTrash(prefix, objects), appErr
+}
+
+// ListObjects lists objects at the given prefix, leaving out the trash. Pages holding trash are shorter than
+// requested.
+func (b *TrashBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	result.Objects = b.withoutTrash(prefix, result.Objects)
+	return result, appErr
+}
+
+// PutObject uploads an object
+func (b *TrashBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject moves an object to the trash, an object already in the trash is deleted for good
+func (b *TrashBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	if b.inTrash(path) {
+		return b.Backend.DeleteObject(ctx, path)
+	}
+	trashPath := pathutil.Join(b.TrashPrefix, time.Now().UTC().Format(sortableTimeLayout), NormalizePath(path))
+	if appErr := b.Backend.CopyObject(ctx, path, trashPath); appErr != nil {
+		return appErr.AddErrCode(TrashMove.Code)
+	}
+	if appErr := b.Backend.DeleteObject(ctx, path); appErr != nil {
+		return appErr.AddErrCode(TrashMove.Code)
+	}
+	return nil
+}
+
+// CopyObject copies an object
+func (b *TrashBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// withoutTrash leaves out the objects of the trash listed at prefix
+func (b *TrashBackend) withoutTrash(prefix string, objects []Object) []Object {
+	kept := objects[:0]
+	for _, object := range objects {
+		if !b.inTrash(objectKey(prefix, object.Path)) {
+			kept = append(kept, object)
+		}
+	}
+	return kept
+}
+
+// inTrash reports whether path lies in the trash
+func (b *TrashBackend) inTrash(path string) bool {
+	return strings.HasPrefix(NormalizePath(path), b.TrashPrefix+"/")
+}
@@ -0,0 +1,187 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+)
+
+// UndeleteReport describes what UndeletePrefix restored
+type UndeleteReport struct {
+	// Restored are the paths of the deleted objects restored
+	Restored []string
+	// Live is the number of objects left as they are because they are not deleted
+	Live int
+	// Missing is the number of deleted objects left deleted because no version of them was live at the time
+	Missing int
+}
+
+// IVersionRestorer is implemented by backends and decorators able to make a noncurrent version of an object its
+// current version again
+type IVersionRestorer interface {
+	RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError
+}
+
+// RestoreObjectVersion makes the version versionID, as reported by version aware listings, the current version of
+// path in backend. Backends and decorators implementing IVersionRestorer do the work themselves, transparent
+// decorators such as caches are passed through to the layer they wrap, dropping the object from caches afterwards.
+// Other decorators, such as ImmutableBackend, fail with 501 Not Implemented, since a restore below them would
+// overwrite the current version without their checks.
+func RestoreObjectVersion(ctx context.Context, backend IStorageBackend, path string, versionID string) *ae.AppError {
+	if restorer, ok := backend.(IVersionRestorer); ok {
+		return restorer.RestoreObjectVersion(ctx, path, versionID)
+	}
+	wrapper, ok := backend.(transparentDecorator)
+	if !ok {
+		return ae.GetAppErr(ctx, fmt.Errorf("backend does not support restoring object versions"), UndeleteRestore, http.StatusNotImplemented)
+	}
+	appErr := RestoreObjectVersion(ctx, wrapper.Unwrap(), path, versionID)
+	if invalidator, ok := backend.(cacheInvalidator); ok {
+		invalidator.Invalidate(path)
+	}
+	return appErr
+}
+
+// UndeletePrefix restores the objects at prefix deleted since asOf from the version history of a versioned bucket,
+// e.g. after a bulk delete ran against the wrong prefix. Every object deleted now that was live at asOf gets the
+// version it had at asOf back as its current version. Objects not deleted are left as they are, so writes made
+// since asOf are kept, and objects created after asOf stay deleted. GCS does not report when a generation was
+// deleted, so on GCS the latest generation written up to asOf is restored even when it was deleted before asOf.
+// The report lists what was restored up to the first failure.
+func UndeletePrefix(ctx context.Context, backend IStorageBackend, prefix string, asOf time.Time) (UndeleteReport, *ae.AppError) {
+	var report UndeleteReport
+	result, appErr := backend.ListObjects(ctx, prefix, WithVersions(VersionsAllWithDeleteMarkers))
+	if appErr != nil {
+		return report, appErr.AddErrCode(UndeleteRestore.Code)
+	}
+	// listings return the versions of every path together, newest first
+	for start := 0; start < len(result.Objects); {
+		end := start + 1
+		for end < len(result.Objects) && result.Objects[end].Path == result.Objects[start].Path {
+			end++
+		}
+		versions := result.Objects[start:end]
+		start = end
+		if versions[0].IsLatest && !versions[0].IsDeleteMarker {
+			report.Live++
+			continue
+		}
+		restore := versionAt(versions, asOf)
+		if restore == nil {
+			report.Missing++
+			continue
+		}
+		path := objectKey(prefix, restore.Path)
+		if appErr := RestoreObjectVersion(ctx, backend, path, restore.VersionID); appErr != nil {
+			return report, appErr
+		}
+		report.Restored = append(report.Restored, path)
+	}
+	return report, nil
+}
+
+// versionAt returns the version live at asOf among the versions of a path sorted newest first, nil when it did not
+// exist or was deleted at the time
+func versionAt(versions []Object, asOf time.Time) *Object {
+	for i := range versions {
+		if versions[i].LastModified.After(asOf) {
+			continue
+		}
+		if versions[i].IsDeleteMarker {
+			return nil
+		}
+		return &versions[i]
+	}
+	return nil
+}
+
+// RestoreObjectVersion copies a version of an object in Amazon S3 bucket over the object, making it the current
+// version with its content, metadata and storage class
+func (b *S3Backend) RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	if b.Compat.NoVersionListing {
+		return ae.GetAppErr(ctx, fmt.Errorf("object versions are not supported by this provider"), UndeleteRestore, http.StatusNotImplemented)
+	}
+	key := objectKey(b.Prefix, path)
+	head, err := b.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(b.Bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	})
+	if err == nil {
+		_, err = b.Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:       aws.String(b.Bucket),
+			CopySource:   aws.String(url.PathEscape(b.Bucket+"/"+key) + "?versionId=" + url.QueryEscape(versionID)),
+			Key:          aws.String(key),
+			StorageClass: head.StorageClass,
+		})
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, errors.Wrapf(err, "failed to restore version %s of %s", versionID, path), S3CopyObject, http.StatusInternalServerError)
+		if isS3NotFoundError(err) {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if isS3ThrottlingError(err) {
+			appErr = throttled(appErr, defaultThrottleRetryAfter)
+		}
+		return appErr.AddErrCode(UndeleteRestore.Code)
+	}
+	return nil
+}
+
+// RestoreObjectVersion copies a generation of an object in Google Cloud Storage bucket over the object, making it
+// the live generation with its content, metadata and storage class
+func (b GoogleCSBackend) RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	generation, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		return ae.GetAppErr(ctx, errors.Wrapf(err, "invalid generation %q", versionID), UndeleteRestore, http.StatusBadRequest)
+	}
+	key := objectKey(b.Prefix, path)
+	src := b.Client.Object(key).Generation(generation)
+	attrs, err := src.Attrs(ctx)
+	if err == nil {
+		copier := b.Client.Object(key).CopierFrom(src)
+		copier.StorageClass = attrs.StorageClass
+		_, err = copier.Run(ctx)
+	}
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, errors.Wrapf(err, "failed to restore generation %d of %s", generation, path), GCSCopyObject, http.StatusInternalServerError)
+		if err.Error() == storage.ErrObjectNotExist.Error() {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		} else if retryAfter, ok := gcsRetryAfter(err); ok {
+			appErr = throttled(appErr, retryAfter)
+		}
+		return appErr.AddErrCode(UndeleteRestore.Code)
+	}
+	return nil
+}
+
+// RestoreObjectVersion restores a version of an object below the prefix
+func (b *SubBackend) RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	key, appErr := b.resolve(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return RestoreObjectVersion(ctx, b.Parent, key, versionID)
+}
+
+// RestoreObjectVersion restores a version of an object in its shard
+func (b *ShardedBackend) RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	return RestoreObjectVersion(ctx, b.ShardFor(path).Backend, path, versionID)
+}
+
+// RestoreObjectVersion restores a version of an object in the backend of its route
+func (b *RouterBackend) RestoreObjectVersion(ctx context.Context, path string, versionID string) *ae.AppError {
+	backend, appErr := b.route(ctx, path)
+	if appErr != nil {
+		return appErr
+	}
+	return RestoreObjectVersion(ctx, backend, path, versionID)
+}
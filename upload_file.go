@@ -0,0 +1,204 @@
+package object_storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ae "github.com/piyushkumar96/app-error"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultUploadPartSize           = 16 * 1024 * 1024
+	defaultUploadConcurrency        = 4
+	defaultUploadMultipartThreshold = 64 * 1024 * 1024
+)
+
+// UploadOptions holds the settings applied to a file upload
+type UploadOptions struct {
+	// MultipartThreshold is the file size from which the file is uploaded in parts
+	MultipartThreshold int64
+	PartSize           int64
+	Concurrency        int
+	// Progress, when set, is called with the bytes uploaded so far and the size of the file
+	Progress func(uploaded, total int64)
+	// Put holds the attributes and encryption of the object
+	Put []PutOption
+}
+
+// UploadOption configures a file upload
+type UploadOption func(*UploadOptions)
+
+// WithMultipartThreshold uploads files of at least threshold bytes in parts, 64 MiB by default
+func WithMultipartThreshold(threshold int64) UploadOption {
+	return func(o *UploadOptions) {
+		o.MultipartThreshold = threshold
+	}
+}
+
+// WithUploadPartSize sets the size of the parts of a multipart upload, 16 MiB by default and raised as needed to
+// stay within 10000 parts
+func WithUploadPartSize(partSize int64) UploadOption {
+	return func(o *UploadOptions) {
+		o.PartSize = partSize
+	}
+}
+
+// WithUploadConcurrency sets how many parts of a multipart upload are sent in parallel
+func WithUploadConcurrency(concurrency int) UploadOption {
+	return func(o *UploadOptions) {
+		o.Concurrency = concurrency
+	}
+}
+
+// WithUploadProgress has the upload call progress with the bytes uploaded so far and the size of the file, e.g. to
+// render a progress bar. Calls are never concurrent.
+func WithUploadProgress(progress func(uploaded, total int64)) UploadOption {
+	return func(o *UploadOptions) {
+		o.Progress = progress
+	}
+}
+
+// WithPutOptions sets the attributes and encryption of the uploaded object
+func WithPutOptions(opts ...PutOption) UploadOption {
+	return func(o *UploadOptions) {
+		o.Put = append(o.Put, opts...)
+	}
+}
+
+// getUploadOptions applies the given options over the defaults
+func getUploadOptions(opts []UploadOption) UploadOptions {
+	options := UploadOptions{
+		MultipartThreshold: defaultUploadMultipartThreshold,
+		PartSize:           defaultUploadPartSize,
+		Concurrency:        defaultUploadConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.PartSize = max(options.PartSize, s3MinPartSize)
+	options.Concurrency = max(options.Concurrency, 1)
+	return options
+}
+
+// uploadProgress counts the bytes of an upload and reports them to the progress callback
+type uploadProgress struct {
+	mu       sync.Mutex
+	uploaded int64
+	total    int64
+	progress func(uploaded, total int64)
+}
+
+// add counts n more bytes uploaded
+func (p *uploadProgress) add(n int64) {
+	if p.progress == nil || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uploaded += n
+	p.progress(p.uploaded, p.total)
+}
+
+// progressReader reports the bytes read from r as uploaded
+type progressReader struct {
+	r        io.Reader
+	progress *uploadProgress
+}
+
+// Read reads from r and counts the bytes read
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.progress.add(int64(n))
+	return n, err
+}
+
+// UploadFromFile uploads the file localPath to path of backend, e.g. from a CLI or a batch job. Files smaller than
+// the multipart threshold are streamed with PutObjectStream; larger ones are sent in parallel parts through
+// IMultipartUploader when backend implements it, S3 and GCS, and streamed otherwise. Without WithContentType among
+// WithPutOptions the content type is guessed from the file extension. A failed multipart upload is aborted, so no
+// parts are left behind.
+func UploadFromFile(ctx context.Context, backend IStorageBackend, path, localPath string, opts ...UploadOption) *ae.AppError {
+	options := getUploadOptions(opts)
+	file, err := os.Open(localPath)
+	if err != nil {
+		appErr := ae.GetAppErr(ctx, err, UploadFile, http.StatusInternalServerError)
+		if errors.Is(err, os.ErrNotExist) {
+			appErr = appErr.SetHTTPCode(http.StatusNotFound)
+		}
+		return appErr
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return ae.GetAppErr(ctx, err, UploadFile, http.StatusInternalServerError)
+	}
+
+	putOpts := options.Put
+	if getPutOptions(putOpts).ContentType == "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(localPath)); contentType != "" {
+			putOpts = append([]PutOption{WithContentType(contentType)}, putOpts...)
+		}
+	}
+	progress := &uploadProgress{total: info.Size(), progress: options.Progress}
+
+	uploader, ok := backend.(IMultipartUploader)
+	if !ok || info.Size() < options.MultipartThreshold || getPutOptions(putOpts).customerKeyed() {
+		appErr := PutObjectStream(ctx, backend, path, &progressReader{r: file, progress: progress}, info.Size(), putOpts...)
+		if appErr != nil {
+			return appErr.AddErrCode(UploadFile.Code)
+		}
+		return nil
+	}
+	return uploadParts(ctx, uploader, path, file, info.Size(), options, putOpts, progress)
+}
+
+// uploadParts uploads size bytes of file to path in a multipart upload, aborting it on failure
+func uploadParts(ctx context.Context, uploader IMultipartUploader, path string, file io.ReaderAt, size int64, options UploadOptions, putOpts []PutOption, progress *uploadProgress) *ae.AppError {
+	partSize := max(options.PartSize, (size+s3MaxParts-1)/s3MaxParts)
+	uploadID, appErr := uploader.InitiateMultipart(ctx, path, putOpts...)
+	if appErr != nil {
+		return appErr.AddErrCode(UploadFile.Code)
+	}
+	parts := make([]MultipartPart, (size+partSize-1)/partSize)
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(options.Concurrency)
+	for i := range parts {
+		offset := int64(i) * partSize
+		length := min(partSize, size-offset)
+		group.Go(func() error {
+			content := make([]byte, length)
+			if _, err := file.ReadAt(content, offset); err != nil {
+				return ae.GetAppErr(groupCtx, errors.Wrapf(err, "failed to read part %d", i+1), UploadFile, http.StatusInternalServerError)
+			}
+			part, appErr := uploader.UploadPart(groupCtx, path, uploadID, int64(i+1), content)
+			if appErr != nil {
+				return appErr
+			}
+			parts[i] = part
+			progress.add(length)
+			return nil
+		})
+	}
+	err := group.Wait()
+	if err == nil {
+		if appErr := uploader.CompleteMultipart(ctx, path, uploadID, parts); appErr != nil {
+			err = appErr
+		}
+	}
+	if err != nil {
+		// abort even when ctx is done, so the stored parts are not billed
+		_ = uploader.AbortMultipart(context.WithoutCancel(ctx), path, uploadID)
+		if appErr, ok := err.(*ae.AppError); ok {
+			return appErr.AddErrCode(UploadFile.Code)
+		}
+		return ae.GetAppErr(ctx, err, UploadFile, http.StatusInternalServerError)
+	}
+	return nil
+}
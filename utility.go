@@ -1,18 +1,134 @@
 package object_storage
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"maps"
+	"net/http"
+	pathutil "path"
+	"strconv"
 	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
 )
 
+// sortableTimeLayout formats times in names that sort in time order, e.g. of audit events and trash folders
+const sortableTimeLayout = "20060102T150405.000000000Z"
+
+// cleanPrefix strips the leading and trailing slashes of a backend prefix, an empty prefix being the bucket root
 func cleanPrefix(prefix string) string {
 	return strings.Trim(prefix, "/")
 }
 
+// objectKey joins the backend prefix and an object path into the provider key, the same on every backend: the key
+// is cleaned and never starts with a slash, so "/a", "a" and "./a" address the same object whether or not the
+// backend has a prefix, and an empty path, "/" or "." address the root. Unlike path.Join it keeps a trailing
+// slash, so directory-like marker objects such as "logs/" stay addressable.
+func objectKey(prefix string, path string) string {
+	key := strings.TrimLeft(pathutil.Join(prefix, path), "/")
+	if key == "." {
+		key = ""
+	}
+	if strings.HasSuffix(path, "/") && key != "" {
+		key += "/"
+	}
+	return key
+}
+
+// listPrefix returns the provider key prefix listing path below the backend prefix. Listing the root of a backend
+// with a prefix lists the prefix as a folder, so a backend at logs does not list logs-archive/a.
+func listPrefix(prefix string, path string) string {
+	key := objectKey(prefix, path)
+	if key != "" && key == cleanPrefix(prefix) {
+		key += "/"
+	}
+	return key
+}
+
+// hasParentSegment reports whether path contains a ".." segment, which would resolve above the prefix it is
+// joined to
+func hasParentSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteETag strips the double quotes S3 compatible APIs wrap entity tags in
+func unquoteETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
+// removePrefixFromObjectPath returns a listed provider key relative to the listing prefix. Only a leading prefix
+// folder is removed, keys matching the prefix without being below it as a folder, such as logs-archive/a for the
+// prefix logs, are returned as they are.
 func removePrefixFromObjectPath(prefix string, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
 	if prefix == "" {
 		return path
 	}
-	path = strings.Replace(path, fmt.Sprintf("%s/", prefix), "", 1)
-	return path
+	return strings.TrimPrefix(path, prefix+"/")
+}
+
+// httpRangeHeader formats a byte range as an HTTP Range header value
+func httpRangeHeader(r ByteRange) string {
+	if r.Offset < 0 {
+		return fmt.Sprintf("bytes=%d", r.Offset)
+	}
+	if r.Length <= 0 {
+		return fmt.Sprintf("bytes=%d-", r.Offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Offset, r.Offset+r.Length-1)
+}
+
+// totalSizeFromContentRange extracts the complete length from a Content-Range header such as "bytes 0-99/1234"
+func totalSizeFromContentRange(contentRange string) (int64, bool) {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// cloneObject returns a copy of object not sharing content or metadata with it
+func cloneObject(object Object) Object {
+	object.Content = bytes.Clone(object.Content)
+	if object.Content == nil {
+		object.Content = []byte{}
+	}
+	object.Meta.User = maps.Clone(object.Meta.User)
+	return object
+}
+
+// rangeObject returns the requested range of a whole object, false when the range starts beyond its end
+func rangeObject(object Object, byteRange ByteRange) (Object, bool) {
+	byteRange = byteRange.from(object.Size)
+	if byteRange.Offset >= object.Size && object.Size > 0 {
+		return Object{}, false
+	}
+	end := object.Size
+	if byteRange.Length > 0 && byteRange.Offset+byteRange.Length < end {
+		end = byteRange.Offset + byteRange.Length
+	}
+	object.Content = object.Content[min(byteRange.Offset, object.Size):end]
+	return object, true
+}
+
+// objectSize returns the size of the object at path of backend and whether it exists
+func objectSize(ctx context.Context, backend IStorageBackend, path string) (int64, bool, *ae.AppError) {
+	object, appErr := StatObject(ctx, backend, path)
+	if appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return 0, false, nil
+		}
+		return 0, false, appErr
+	}
+	return object.Size, true, nil
 }
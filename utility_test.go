@@ -0,0 +1,219 @@
+package object_storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// keyCases are object paths joined to backend prefixes, with the provider key of the object and the provider prefix
+// listing the path
+var keyCases = []struct {
+	name   string
+	prefix string
+	path   string
+	key    string
+	list   string
+}{
+	{name: "empty prefix", prefix: "", path: "a/b", key: "a/b", list: "a/b"},
+	{name: "empty prefix root", prefix: "", path: "", key: "", list: ""},
+	{name: "empty prefix leading slash", prefix: "", path: "/foo", key: "foo", list: "foo"},
+	{name: "empty prefix dot", prefix: "", path: "./a", key: "a", list: "a"},
+	{name: "leading slash", prefix: "logs", path: "/foo", key: "logs/foo", list: "logs/foo"},
+	{name: "dot", prefix: "logs", path: "./a", key: "logs/a", list: "logs/a"},
+	{name: "repeated slashes", prefix: "logs", path: "a//./b", key: "logs/a/b", list: "logs/a/b"},
+	{name: "trailing slash", prefix: "logs", path: "dir/", key: "logs/dir/", list: "logs/dir/"},
+	{name: "prefix with slashes", prefix: "/logs/", path: "a", key: "logs/a", list: "logs/a"},
+	{name: "root", prefix: "logs", path: "", key: "logs", list: "logs/"},
+	{name: "root slash", prefix: "logs", path: "/", key: "logs/", list: "logs/"},
+	{name: "root dot", prefix: "logs", path: ".", key: "logs", list: "logs/"},
+	{name: "partial name", prefix: "logs", path: "a", key: "logs/a", list: "logs/a"},
+	{name: "parent escape", prefix: "logs", path: "../secret", key: "secret", list: "secret"},
+	{name: "parent back in", prefix: "logs", path: "a/../b", key: "logs/b", list: "logs/b"},
+}
+
+func TestObjectKey(t *testing.T) {
+	for _, c := range keyCases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.key, objectKey(c.prefix, c.path))
+			assert.Equal(t, c.list, listPrefix(c.prefix, c.path))
+		})
+	}
+}
+
+func TestRemovePrefixFromObjectPath(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix string
+		key    string
+		path   string
+	}{
+		{name: "empty prefix", prefix: "", key: "a/b", path: "a/b"},
+		{name: "folder", prefix: "logs", key: "logs/a", path: "a"},
+		{name: "folder with trailing slash", prefix: "logs/", key: "logs/a", path: "a"},
+		{name: "nested folder", prefix: "logs/2024", key: "logs/2024/a", path: "a"},
+		{name: "sibling folder", prefix: "logs", key: "logs-archive/a", path: "logs-archive/a"},
+		{name: "sibling folder with trailing slash", prefix: "logs/", key: "logs-archive/a", path: "logs-archive/a"},
+		{name: "partial name", prefix: "logs/a", key: "logs/ab", path: "logs/ab"},
+		{name: "marker object", prefix: "logs", key: "logs/dir/", path: "dir/"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.path, removePrefixFromObjectPath(c.prefix, c.key))
+		})
+	}
+}
+
+func TestBackendKeys(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range keyCases {
+		t.Run(c.name, func(t *testing.T) {
+			for name, backend := range keyBackends(t, cleanPrefix(c.prefix), nil) {
+				_, _ = backend.GetObject(ctx, c.path)
+				_, _ = backend.ListObjects(ctx, c.path)
+				assert.Equal(t, []string{c.key}, backend.keys(), name)
+				assert.Equal(t, []string{c.list}, backend.prefixes(), name)
+			}
+		})
+	}
+}
+
+func TestBackendListingsKeepFolders(t *testing.T) {
+	ctx := context.Background()
+	stored := []string{"logs-archive/b", "logs/a", "logs/dir/", "other/c"}
+	cases := []struct {
+		name   string
+		prefix string
+		list   string
+		paths  []string
+	}{
+		{name: "root of prefix", prefix: "logs", list: "", paths: []string{"a", "dir/"}},
+		{name: "root of prefix with slashes", prefix: "/logs/", list: "/", paths: []string{"a", "dir/"}},
+		{name: "folder", prefix: "", list: "logs/", paths: []string{"a", "dir/"}},
+		{name: "name prefix", prefix: "", list: "logs", paths: []string{"a", "dir/", "logs-archive/b"}},
+		{name: "sibling", prefix: "logs-archive", list: "", paths: []string{"b"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for name, backend := range keyBackends(t, cleanPrefix(c.prefix), stored) {
+				result, appErr := backend.ListObjects(ctx, c.list)
+				require.Nil(t, appErr, name)
+				var paths []string
+				for _, object := range result.Objects {
+					paths = append(paths, object.Path)
+				}
+				sort.Strings(paths)
+				assert.Equal(t, c.paths, paths, name)
+			}
+		})
+	}
+}
+
+// keyBackend is a backend recording the provider keys and listing prefixes it sends
+type keyBackend interface {
+	IStorageBackend
+	keys() []string
+	prefixes() []string
+}
+
+// keyBackends returns an S3 and a GCS backend at prefix over recording clients holding the stored keys
+func keyBackends(t *testing.T, prefix string, stored []string) map[string]keyBackend {
+	s3Client := &s3KeyClient{stored: stored}
+	gcsClient := newGCSKeyClient(t, stored)
+	return map[string]keyBackend{
+		"s3":  &s3KeyBackend{S3Backend: &S3Backend{Bucket: "bucket", Prefix: prefix, Client: s3Client}, client: s3Client},
+		"gcs": &gcsKeyBackend{GoogleCSBackend: GoogleCSBackend{Prefix: prefix, Client: gcsClient}, client: gcsClient},
+	}
+}
+
+type s3KeyBackend struct {
+	*S3Backend
+	client *s3KeyClient
+}
+
+func (b *s3KeyBackend) keys() []string     { return b.client.keys }
+func (b *s3KeyBackend) prefixes() []string { return b.client.prefixes }
+
+type gcsKeyBackend struct {
+	GoogleCSBackend
+	client *gcsKeyClient
+}
+
+func (b *gcsKeyBackend) keys() []string     { return b.client.keys }
+func (b *gcsKeyBackend) prefixes() []string { return b.client.prefixes }
+
+// s3KeyClient is an IS3Client finding no object on reads and listing the stored keys matching the requested prefix
+type s3KeyClient struct {
+	IS3Client
+	stored   []string
+	keys     []string
+	prefixes []string
+}
+
+func (c *s3KeyClient) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	c.keys = append(c.keys, aws.StringValue(input.Key))
+	return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+}
+
+func (c *s3KeyClient) ListObjectsWithContext(_ aws.Context, input *s3.ListObjectsInput, _ ...request.Option) (*s3.ListObjectsOutput, error) {
+	c.prefixes = append(c.prefixes, aws.StringValue(input.Prefix))
+	output := &s3.ListObjectsOutput{IsTruncated: aws.Bool(false)}
+	for _, key := range c.stored {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			output.Contents = append(output.Contents, &s3.Object{Key: aws.String(key)})
+		}
+	}
+	return output, nil
+}
+
+// gcsKeyClient is an IGCSClient over a fake JSON API finding no object on reads and listing the stored keys
+// matching the requested prefix
+type gcsKeyClient struct {
+	bucket   *storage.BucketHandle
+	keys     []string
+	prefixes []string
+}
+
+func newGCSKeyClient(t *testing.T, stored []string) *gcsKeyClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/o") {
+			http.NotFound(w, r)
+			return
+		}
+		var items []map[string]string
+		for _, key := range stored {
+			if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+				items = append(items, map[string]string{"name": key, "bucket": "bucket"})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"kind": "storage#objects", "items": items})
+	}))
+	t.Cleanup(server.Close)
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return &gcsKeyClient{bucket: client.Bucket("bucket")}
+}
+
+func (c *gcsKeyClient) Object(name string) *storage.ObjectHandle {
+	c.keys = append(c.keys, name)
+	return c.bucket.Object(name)
+}
+
+func (c *gcsKeyClient) Objects(ctx context.Context, q *storage.Query) *storage.ObjectIterator {
+	c.prefixes = append(c.prefixes, q.Prefix)
+	return c.bucket.Objects(ctx, q)
+}
@@ -0,0 +1,198 @@
+package object_storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	pathutil "path"
+	"strconv"
+	"strings"
+	"time"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+const defaultVersionsPrefix = ".versions"
+
+// VersionedOption configures a VersionedBackend
+type VersionedOption func(*VersionedBackend)
+
+// WithVersionsPrefix sets the prefix holding the previous versions, ".versions" by default
+func WithVersionsPrefix(prefix string) VersionedOption {
+	return func(b *VersionedBackend) {
+		b.VersionsPrefix = cleanPrefix(prefix)
+	}
+}
+
+// VersionedBackend is an IStorageBackend decorator keeping previous versions of objects itself, for providers or
+// buckets where native versioning cannot be enabled. A PutObject or CopyObject replacing an object first copies it
+// to <VersionsPrefix>/<path>/<timestamp>, and only the Keep most recent previous versions are kept. Deleting an
+// object keeps its previous versions. The versions are left out of listings. Concurrent writes to one path may
+// each archive the same version.
+type VersionedBackend struct {
+	Backend        IStorageBackend
+	VersionsPrefix string
+	// Keep is the number of previous versions kept per object
+	Keep int
+}
+
+// NewVersionedBackend creates a new instance of VersionedBackend keeping keep previous versions of every object
+func NewVersionedBackend(backend IStorageBackend, keep int, opts ...VersionedOption) (*VersionedBackend, *ae.AppError) {
+	b := &VersionedBackend{
+		Backend:        backend,
+		VersionsPrefix: defaultVersionsPrefix,
+		Keep:           keep,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.Keep <= 0 || b.VersionsPrefix == "" {
+		return nil, ae.GetAppErr(context.Background(), fmt.Errorf("the number of versions kept must be positive and the versions prefix not empty"), VersionedConfig, http.StatusInternalServerError)
+	}
+	return b, nil
+}
+
+// Unwrap returns the backend holding the objects and their versions
+func (b *VersionedBackend) Unwrap() IStorageBackend {
+	return b.Backend
+}
+
+// Describe reports the versions prefix and the number of versions kept
+func (b *VersionedBackend) Describe() map[string]string {
+	return map[string]string{
+		"versionsPrefix": b.VersionsPrefix,
+		"keep":           strconv.Itoa(b.Keep),
+	}
+}
+
+// ListVersions returns the previous versions of an object, newest first, without content. Object.VersionID
+// identifies a version and Object.LastModified is the time it was replaced.
+func (b *VersionedBackend) ListVersions(ctx context.Context, path string) ([]Object, *ae.AppError) {
+	prefix := b.versionsOf(path)
+	versions, appErr := b.Backend.GetObjects(ctx, prefix)
+	if appErr != nil {
+		return nil, appErr
+	}
+	kept := versions[:0]
+	for _, version := range versions {
+		replacedAt, err := time.Parse(sortableTimeLayout, version.Path)
+		if err != nil {
+			// not a version, e.g. the versions of a path below this one
+			continue
+		}
+		version.VersionID = version.Path
+		version.Path = NormalizePath(path)
+		version.LastModified = replacedAt
+		kept = append(kept, version)
+	}
+	sortVersionsNewestFirst(kept)
+	return kept, nil
+}
+
+// GetVersion retrieves version n of an object counting back from the current one: 0 is the current object, 1 the
+// version it replaced and so on. Versions no longer kept are not found.
+func (b *VersionedBackend) GetVersion(ctx context.Context, path string, n int, opts ...GetOption) (Object, *ae.AppError) {
+	if n == 0 {
+		return b.Backend.GetObject(ctx, path, opts...)
+	}
+	versions, appErr := b.ListVersions(ctx, path)
+	if appErr != nil {
+		return Object{Path: path}, appErr
+	}
+	if n < 0 || n > len(versions) {
+		return Object{Path: path}, ae.GetAppErr(ctx, fmt.Errorf("object %s has %d previous versions, version %d is not kept", path, len(versions), n), VersionedNotFound, http.StatusNotFound)
+	}
+	version := versions[n-1]
+	object, appErr := b.Backend.GetObject(ctx, pathutil.Join(b.versionsOf(path), version.VersionID), opts...)
+	if appErr != nil {
+		return object, appErr
+	}
+	object.Path = version.Path
+	object.VersionID = version.VersionID
+	return object, nil
+}
+
+// GetObject retrieves the current version of an object
+func (b *VersionedBackend) GetObject(ctx context.Context, path string, opts ...GetOption) (Object, *ae.AppError) {
+	return b.Backend.GetObject(ctx, path, opts...)
+}
+
+// GetObjects lists all objects at the given prefix, leaving out the versions
+func (b *VersionedBackend) GetObjects(ctx context.Context, prefix string) ([]Object, *ae.AppError) {
+	objects, appErr := b.Backend.GetObjects(ctx, prefix)
+	return b.withoutVersions(prefix, objects), appErr
+}
+
+// ListObjects lists objects at the given prefix, leaving out the versions. Pages holding versions are shorter than
+// requested.
+func (b *VersionedBackend) ListObjects(ctx context.Context, prefix string, opts ...ListOption) (ListResult, *ae.AppError) {
+	result, appErr := b.Backend.ListObjects(ctx, prefix, opts...)
+	result.Objects = b.withoutVersions(prefix, result.Objects)
+	return result, appErr
+}
+
+// PutObject keeps the object at path as a previous version, if any, and uploads the new one
+func (b *VersionedBackend) PutObject(ctx context.Context, path string, content []byte, opts ...PutOption) *ae.AppError {
+	if appErr := b.archive(ctx, path); appErr != nil {
+		return appErr
+	}
+	return b.Backend.PutObject(ctx, path, content, opts...)
+}
+
+// DeleteObject removes an object, its previous versions are kept
+func (b *VersionedBackend) DeleteObject(ctx context.Context, path string) *ae.AppError {
+	return b.Backend.DeleteObject(ctx, path)
+}
+
+// CopyObject keeps the object at dstPath as a previous version, if any, and copies the source over it
+func (b *VersionedBackend) CopyObject(ctx context.Context, srcPath, dstPath string) *ae.AppError {
+	if appErr := b.archive(ctx, dstPath); appErr != nil {
+		return appErr
+	}
+	return b.Backend.CopyObject(ctx, srcPath, dstPath)
+}
+
+// archive copies the object at path, if any, to a new version and deletes the versions beyond Keep
+func (b *VersionedBackend) archive(ctx context.Context, path string) *ae.AppError {
+	if b.inVersions(path) {
+		return nil
+	}
+	version := pathutil.Join(b.versionsOf(path), time.Now().UTC().Format(sortableTimeLayout))
+	if appErr := b.Backend.CopyObject(ctx, path, version); appErr != nil {
+		if appErr.GetHTTPCode() == http.StatusNotFound {
+			return nil
+		}
+		return appErr.AddErrCode(VersionedArchive.Code)
+	}
+	versions, appErr := b.ListVersions(ctx, path)
+	if appErr != nil {
+		return appErr.AddErrCode(VersionedArchive.Code)
+	}
+	for _, expired := range versions[min(b.Keep, len(versions)):] {
+		if appErr := b.Backend.DeleteObject(ctx, pathutil.Join(b.versionsOf(path), expired.VersionID)); appErr != nil && appErr.GetHTTPCode() != http.StatusNotFound {
+			return appErr.AddErrCode(VersionedArchive.Code)
+		}
+	}
+	return nil
+}
+
+// versionsOf returns the prefix holding the versions of path
+func (b *VersionedBackend) versionsOf(path string) string {
+	return pathutil.Join(b.VersionsPrefix, NormalizePath(path)) + "/"
+}
+
+// withoutVersions leaves out the versions listed at prefix
+func (b *VersionedBackend) withoutVersions(prefix string, objects []Object) []Object {
+	kept := objects[:0]
+	for _, object := range objects {
+		if !b.inVersions(objectKey(prefix, object.Path)) {
+			kept = append(kept, object)
+		}
+	}
+	return kept
+}
+
+// inVersions reports whether path lies in the versions prefix
+func (b *VersionedBackend) inVersions(path string) bool {
+	return strings.HasPrefix(NormalizePath(path), b.VersionsPrefix+"/")
+}
@@ -0,0 +1,82 @@
+package object_storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	ae "github.com/piyushkumar96/app-error"
+)
+
+// walkPageSize is the number of objects Walk lists at a time
+const walkPageSize = 1000
+
+// Errors a Walk callback returns to steer the walk, as filepath.SkipDir and filepath.SkipAll do
+var (
+	// SkipPrefix skips the objects left in the folder of the object the callback was called with, ending the walk
+	// for an object directly at the walked prefix
+	SkipPrefix = errors.New("object storage: skip prefix")
+	// StopWalk ends the walk without an error
+	StopWalk = errors.New("object storage: stop walk")
+)
+
+// Walk calls fn with every object at prefix of backend, in listing order, listing one page at a time so trees of any
+// size are processed without holding their listing, e.g. to index or migrate a bucket. Objects carry the attributes
+// listings report and paths relative to prefix, as ListObjects returns them; opts such as WithHydratedMetadata or
+// WithGlob apply to the listing. fn returns SkipPrefix to skip the rest of the folder of an object, which S3 and GCS
+// jump over without listing it, StopWalk to end the walk, and any other error to stop the walk with WalkCallback
+// wrapping it.
+func Walk(ctx context.Context, backend IStorageBackend, prefix string, fn func(Object) error, opts ...ListOption) *ae.AppError {
+	cursor := ""
+	// skip is the folder being skipped, with a trailing slash
+	skip := ""
+	for {
+		page, appErr := walkPage(ctx, backend, prefix, cursor, skip, opts)
+		if appErr != nil {
+			return appErr.AddErrCode(WalkList.Code)
+		}
+		for _, object := range page.Objects {
+			if skip != "" && strings.HasPrefix(object.Path, skip) {
+				continue
+			}
+			skip = ""
+			err := fn(object)
+			switch {
+			case err == nil:
+			case errors.Is(err, StopWalk):
+				return nil
+			case errors.Is(err, SkipPrefix):
+				folder := path.Dir(object.Path)
+				if folder == "." || folder == "/" {
+					return nil
+				}
+				skip = folder + "/"
+			default:
+				return ae.GetAppErr(ctx, err, WalkCallback, http.StatusInternalServerError)
+			}
+		}
+		if !page.Truncated {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// walkPage lists the page of prefix after cursor. While a folder is skipped, it first tries listing after the
+// folder, keeping that page unless the backend ignored the start path and listed from the start.
+func walkPage(ctx context.Context, backend IStorageBackend, prefix, cursor, skip string, opts []ListOption) (ListResult, *ae.AppError) {
+	if skip != "" {
+		// no valid UTF-8 path in the folder sorts after this one
+		after := skip + string(rune(0x10FFFF))
+		page, appErr := backend.ListObjects(ctx, prefix, append(opts, WithMaxKeys(walkPageSize), WithStartAfter(after))...)
+		if appErr != nil {
+			return page, appErr
+		}
+		if len(page.Objects) == 0 && !page.Truncated || len(page.Objects) > 0 && page.Objects[0].Path > after {
+			return page, nil
+		}
+	}
+	return backend.ListObjects(ctx, prefix, append(opts, WithMaxKeys(walkPageSize), WithCursor(cursor))...)
+}